@@ -5,80 +5,135 @@ package autobatch
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"time"
 
 	ds "github.com/ipfs/go-datastore"
 	dsq "github.com/ipfs/go-datastore/query"
 )
 
-// Datastore implements a go-datastore.
+// Datastore implements a go-datastore. It is safe for concurrent use.
 type Datastore struct {
 	child ds.Batching
+	cfg   Config
 
+	mu sync.Mutex
 	// TODO: discuss making ds.Batch implement the full ds.Datastore interface
-	buffer           map[ds.Key]op
-	maxBufferEntries int
+	buffer map[ds.Key]op
+	bytes  int
+	timer  *time.Timer
+	closed bool
 }
 
 var _ ds.Datastore = (*Datastore)(nil)
 var _ ds.PersistentDatastore = (*Datastore)(nil)
+var _ ds.CheckedDatastore = (*Datastore)(nil)
+var _ ds.ScrubbedDatastore = (*Datastore)(nil)
+var _ ds.GCDatastore = (*Datastore)(nil)
+var _ ds.TTLDatastore = (*Datastore)(nil)
+var _ ds.TxnDatastore = (*Datastore)(nil)
+var _ ds.Shim = (*Datastore)(nil)
 
 type op struct {
 	delete bool
 	value  []byte
 }
 
+// Config sets when an autobatching datastore flushes its buffered writes.
+type Config struct {
+	// MaxEntries flushes the buffer when it holds more than MaxEntries
+	// keys.
+	MaxEntries int
+	// MaxBytes flushes the buffer when the values it holds add up to more
+	// than MaxBytes, if set.
+	MaxBytes int
+	// MaxAge flushes the buffer, in the background, once its oldest write
+	// is MaxAge old, if set.
+	MaxAge time.Duration
+	// OnError is called with the errors of background flushes. The writes
+	// that failed to flush stay buffered, and are flushed again with the
+	// next flush.
+	OnError func(error)
+}
+
 // NewAutoBatching returns a new datastore that automatically
 // batches writes using the given Batching datastore. The size
 // of the memory pool is given by size.
+//
+// The returned datastore implements every optional feature; use
+// scoped.Inherit to only expose the features d supports.
 func NewAutoBatching(d ds.Batching, size int) *Datastore {
+	return New(d, Config{MaxEntries: size})
+}
+
+// New returns a new datastore that automatically batches writes using the
+// given Batching datastore, flushing them according to cfg. See
+// NewAutoBatching for the features it implements.
+//
+// The datastore must be closed to stop the MaxAge timer.
+func New(d ds.Batching, cfg Config) *Datastore {
 	return &Datastore{
-		child:            d,
-		buffer:           make(map[ds.Key]op, size),
-		maxBufferEntries: size,
+		child:  d,
+		cfg:    cfg,
+		buffer: make(map[ds.Key]op, cfg.MaxEntries),
 	}
 }
 
-// Delete deletes a key/value
-func (d *Datastore) Delete(ctx context.Context, k ds.Key) error {
-	d.buffer[k] = op{delete: true}
-	if len(d.buffer) > d.maxBufferEntries {
-		return d.Flush(ctx)
-	}
-	return nil
+// Children implements ds.Shim
+func (d *Datastore) Children() []ds.Datastore {
+	return []ds.Datastore{d.child}
 }
 
-// Get retrieves a value given a key.
-func (d *Datastore) Get(ctx context.Context, k ds.Key) ([]byte, error) {
-	o, ok := d.buffer[k]
-	if ok {
-		if o.delete {
-			return nil, ds.ErrNotFound
-		}
-		return o.value, nil
+// write records o on k, flushing if the buffer is full. d.mu must be held.
+func (d *Datastore) write(ctx context.Context, k ds.Key, o op) error {
+	if prev, ok := d.buffer[k]; ok {
+		d.bytes -= len(prev.value)
 	}
+	d.buffer[k] = o
+	d.bytes += len(o.value)
 
-	return d.child.Get(ctx, k)
+	if len(d.buffer) > d.cfg.MaxEntries || (d.cfg.MaxBytes > 0 && d.bytes > d.cfg.MaxBytes) {
+		return d.flush(ctx, ds.RawKey("/"))
+	}
+	if d.cfg.MaxAge > 0 && d.timer == nil && !d.closed {
+		d.timer = time.AfterFunc(d.cfg.MaxAge, d.flushAged)
+	}
+	return nil
 }
 
-// Put stores a key/value.
-func (d *Datastore) Put(ctx context.Context, k ds.Key, val []byte) error {
-	d.buffer[k] = op{value: val}
-	if len(d.buffer) > d.maxBufferEntries {
-		return d.Flush(ctx)
+// flushAged flushes the buffer once MaxAge has passed.
+func (d *Datastore) flushAged() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.timer = nil
+	if d.closed {
+		return
+	}
+	if err := d.flush(context.Background(), ds.RawKey("/")); err != nil {
+		if d.cfg.OnError != nil {
+			d.cfg.OnError(err)
+		}
+		// Try again later.
+		if len(d.buffer) > 0 {
+			d.timer = time.AfterFunc(d.cfg.MaxAge, d.flushAged)
+		}
 	}
-	return nil
 }
 
-// Sync flushes all operations on keys at or under the prefix
-// from the current batch to the underlying datastore
-func (d *Datastore) Sync(ctx context.Context, prefix ds.Key) error {
+// flush commits the buffered operations on keys at or under prefix to the
+// child datastore, and drops them from the buffer if the commit succeeds.
+// d.mu must be held.
+func (d *Datastore) flush(ctx context.Context, prefix ds.Key) error {
+	all := prefix.String() == "/"
 	b, err := d.child.Batch(ctx)
 	if err != nil {
 		return err
 	}
 
+	var flushed []ds.Key
 	for k, o := range d.buffer {
-		if !(k.Equal(prefix) || k.IsDescendantOf(prefix)) {
+		if !all && !(k.Equal(prefix) || k.IsDescendantOf(prefix)) {
 			continue
 		}
 
@@ -91,40 +146,83 @@ func (d *Datastore) Sync(ctx context.Context, prefix ds.Key) error {
 		if err != nil {
 			return err
 		}
+		flushed = append(flushed, k)
+	}
+	if len(flushed) == 0 {
+		return nil
+	}
 
+	if err := b.Commit(ctx); err != nil {
+		return err
+	}
+	for _, k := range flushed {
+		d.bytes -= len(d.buffer[k].value)
 		delete(d.buffer, k)
 	}
+	if len(d.buffer) == 0 && d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	return nil
+}
 
-	return b.Commit(ctx)
+// Delete deletes a key/value
+func (d *Datastore) Delete(ctx context.Context, k ds.Key) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.write(ctx, k, op{delete: true})
 }
 
-// Flush flushes the current batch to the underlying datastore.
-func (d *Datastore) Flush(ctx context.Context) error {
-	b, err := d.child.Batch(ctx)
-	if err != nil {
-		return err
-	}
+// lookup returns the buffered operation on k, if any.
+func (d *Datastore) lookup(k ds.Key) (op, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	o, ok := d.buffer[k]
+	return o, ok
+}
 
-	for k, o := range d.buffer {
-		var err error
+// Get retrieves a value given a key.
+func (d *Datastore) Get(ctx context.Context, k ds.Key) ([]byte, error) {
+	o, ok := d.lookup(k)
+	if ok {
 		if o.delete {
-			err = b.Delete(ctx, k)
-		} else {
-			err = b.Put(ctx, k, o.value)
-		}
-		if err != nil {
-			return err
+			return nil, ds.ErrNotFound
 		}
+		return o.value, nil
+	}
+
+	return d.child.Get(ctx, k)
+}
+
+// Put stores a key/value.
+func (d *Datastore) Put(ctx context.Context, k ds.Key, val []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.write(ctx, k, op{value: val})
+}
+
+// Sync flushes all operations on keys at or under the prefix
+// from the current batch to the underlying datastore, and syncs it.
+func (d *Datastore) Sync(ctx context.Context, prefix ds.Key) error {
+	d.mu.Lock()
+	err := d.flush(ctx, prefix)
+	d.mu.Unlock()
+	if err != nil {
+		return err
 	}
-	// clear out buffer
-	clear(d.buffer)
+	return d.child.Sync(ctx, prefix)
+}
 
-	return b.Commit(ctx)
+// Flush flushes the current batch to the underlying datastore.
+func (d *Datastore) Flush(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.flush(ctx, ds.RawKey("/"))
 }
 
 // Has checks if a key is stored.
 func (d *Datastore) Has(ctx context.Context, k ds.Key) (bool, error) {
-	o, ok := d.buffer[k]
+	o, ok := d.lookup(k)
 	if ok {
 		return !o.delete, nil
 	}
@@ -134,7 +232,7 @@ func (d *Datastore) Has(ctx context.Context, k ds.Key) (bool, error) {
 
 // GetSize implements Datastore.GetSize
 func (d *Datastore) GetSize(ctx context.Context, k ds.Key) (int, error) {
-	o, ok := d.buffer[k]
+	o, ok := d.lookup(k)
 	if ok {
 		if o.delete {
 			return -1, ds.ErrNotFound
@@ -145,14 +243,68 @@ func (d *Datastore) GetSize(ctx context.Context, k ds.Key) (int, error) {
 	return d.child.GetSize(ctx, k)
 }
 
-// Query performs a query
+// Query performs a query, merging the buffered operations into the results
+// of the underlying datastore. Buffered puts matching the query are returned
+// after the results of the underlying datastore unless the query is ordered.
 func (d *Datastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
-	err := d.Flush(ctx)
+	prefix := ds.NewKey(q.Prefix)
+	buffered := make(map[string]op)
+	d.mu.Lock()
+	for k, o := range d.buffer {
+		if prefix.String() == "/" || k.IsDescendantOf(prefix) {
+			buffered[k.String()] = o
+		}
+	}
+	d.mu.Unlock()
+	if len(buffered) == 0 {
+		return d.child.Query(ctx, q)
+	}
+
+	// Orders, offsets and limits are applied once merged.
+	res, err := d.child.Query(ctx, dsq.Query{
+		Prefix:            q.Prefix,
+		Filters:           q.Filters,
+		KeysOnly:          q.KeysOnly,
+		ReturnExpirations: q.ReturnExpirations,
+		ReturnsSizes:      q.ReturnsSizes,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return d.child.Query(ctx, q)
+	var entries []dsq.Entry
+	for k, o := range buffered {
+		if o.delete {
+			continue
+		}
+		e := dsq.Entry{Key: k, Size: len(o.value)}
+		if !q.KeysOnly {
+			e.Value = o.value
+		}
+		entries = append(entries, e)
+	}
+	merged := dsq.ResultsFromIterator(q, dsq.Iterator{
+		Next: func() (dsq.Result, bool) {
+			for {
+				r, ok := res.NextSync()
+				if !ok {
+					break
+				}
+				if _, shadowed := buffered[r.Key]; r.Error == nil && shadowed {
+					continue
+				}
+				return r, true
+			}
+			if len(entries) == 0 {
+				return dsq.Result{}, false
+			}
+			e := entries[0]
+			entries = entries[1:]
+			return dsq.Result{Entry: e}, true
+		},
+		Close: res.Close,
+	})
+	return dsq.NaiveQueryApply(q, merged), nil
 }
 
 // DiskUsage implements the PersistentDatastore interface.
@@ -160,15 +312,108 @@ func (d *Datastore) DiskUsage(ctx context.Context) (uint64, error) {
 	return ds.DiskUsage(ctx, d.child)
 }
 
-func (d *Datastore) Close() error {
-	ctx := context.Background()
-	err1 := d.Flush(ctx)
-	err2 := d.child.Close()
-	if err1 != nil {
-		return err1
+// Check flushes the current batch and checks the underlying datastore.
+func (d *Datastore) Check(ctx context.Context) error {
+	if err := d.Flush(ctx); err != nil {
+		return err
+	}
+	if c, ok := d.child.(ds.CheckedDatastore); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+// Scrub flushes the current batch and scrubs the underlying datastore.
+func (d *Datastore) Scrub(ctx context.Context) error {
+	if err := d.Flush(ctx); err != nil {
+		return err
 	}
-	if err2 != nil {
-		return err2
+	if c, ok := d.child.(ds.ScrubbedDatastore); ok {
+		return c.Scrub(ctx)
 	}
 	return nil
 }
+
+// CollectGarbage flushes the current batch and collects garbage in the
+// underlying datastore.
+func (d *Datastore) CollectGarbage(ctx context.Context) error {
+	if err := d.Flush(ctx); err != nil {
+		return err
+	}
+	if c, ok := d.child.(ds.GCDatastore); ok {
+		return c.CollectGarbage(ctx)
+	}
+	return nil
+}
+
+// PutWithTTL stores a key/value that expires after ttl. It is not batched,
+// and replaces any batched operation on the key.
+func (d *Datastore) PutWithTTL(ctx context.Context, k ds.Key, val []byte, ttl time.Duration) error {
+	tds, ok := d.child.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := tds.PutWithTTL(ctx, k, val, ttl); err != nil {
+		return err
+	}
+	if o, ok := d.buffer[k]; ok {
+		d.bytes -= len(o.value)
+		delete(d.buffer, k)
+	}
+	return nil
+}
+
+// SetTTL flushes any batched operation on the key and sets its time-to-live.
+func (d *Datastore) SetTTL(ctx context.Context, k ds.Key, ttl time.Duration) error {
+	tds, ok := d.child.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	if err := d.Sync(ctx, k); err != nil {
+		return err
+	}
+	return tds.SetTTL(ctx, k, ttl)
+}
+
+// GetExpiration flushes any batched operation on the key and returns its
+// expiration time.
+func (d *Datastore) GetExpiration(ctx context.Context, k ds.Key) (time.Time, error) {
+	tds, ok := d.child.(ds.TTLDatastore)
+	if !ok {
+		return time.Time{}, ds.ErrTTLUnsupported
+	}
+	if err := d.Sync(ctx, k); err != nil {
+		return time.Time{}, err
+	}
+	return tds.GetExpiration(ctx, k)
+}
+
+// NewTransaction flushes the current batch and starts a transaction on the
+// underlying datastore. Writes to the transaction are not batched, and writes
+// batched after it starts are not visible to it.
+func (d *Datastore) NewTransaction(ctx context.Context, readOnly bool) (ds.Txn, error) {
+	tds, ok := d.child.(ds.TxnDatastore)
+	if !ok {
+		return nil, ds.ErrTxnUnsupported
+	}
+	if err := d.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return tds.NewTransaction(ctx, readOnly)
+}
+
+// Close flushes the current batch, stops the MaxAge timer and closes the
+// underlying datastore.
+func (d *Datastore) Close() error {
+	d.mu.Lock()
+	err := d.flush(context.Background(), ds.RawKey("/"))
+	d.closed = true
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.mu.Unlock()
+	return errors.Join(err, d.child.Close())
+}
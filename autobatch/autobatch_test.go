@@ -3,11 +3,20 @@ package autobatch
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/crash"
+	"github.com/ipfs/go-datastore/failstore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
 	dstest "github.com/ipfs/go-datastore/test"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAutobatch(t *testing.T) {
@@ -257,3 +266,165 @@ func checkKeyRange(t *testing.T, keymap map[ds.Key]int, keys []ds.Key,
 		}
 	}
 }
+
+func TestFlushOnBytes(t *testing.T) {
+	ctx := context.Background()
+	child := ds.NewMapDatastore()
+	d := New(child, Config{MaxEntries: 100, MaxBytes: 10})
+
+	require.NoError(t, d.Put(ctx, ds.NewKey("/a"), make([]byte, 6)))
+	// Overwrites replace the size of the previous value.
+	require.NoError(t, d.Put(ctx, ds.NewKey("/a"), make([]byte, 4)))
+	require.NoError(t, d.Put(ctx, ds.NewKey("/b"), make([]byte, 6)))
+	has, err := child.Has(ctx, ds.NewKey("/a"))
+	require.NoError(t, err)
+	require.False(t, has)
+
+	require.NoError(t, d.Put(ctx, ds.NewKey("/c"), make([]byte, 1)))
+	has, err = child.Has(ctx, ds.NewKey("/a"))
+	require.NoError(t, err)
+	require.True(t, has)
+}
+
+func TestFlushOnAge(t *testing.T) {
+	ctx := context.Background()
+	child := dssync.MutexWrap(ds.NewMapDatastore())
+	d := New(child, Config{MaxEntries: 100, MaxAge: 10 * time.Millisecond})
+	defer d.Close()
+
+	require.NoError(t, d.Put(ctx, ds.NewKey("/a"), []byte("a")))
+	require.Eventually(t, func() bool {
+		has, err := child.Has(ctx, ds.NewKey("/a"))
+		return err == nil && has
+	}, time.Second, time.Millisecond)
+}
+
+func TestFlushErrors(t *testing.T) {
+	ctx := context.Background()
+	flushErr := errors.New("flush failed")
+	var failing atomic.Bool
+	failing.Store(true)
+	child := failstore.NewFailstore(dssync.MutexWrap(ds.NewMapDatastore()), func(op string) error {
+		if op == "batch-commit" && failing.Load() {
+			return flushErr
+		}
+		return nil
+	})
+	errs := make(chan error, 16)
+	d := New(child, Config{MaxEntries: 1, MaxAge: 5 * time.Millisecond, OnError: func(err error) { errs <- err }})
+	defer d.Close()
+
+	require.NoError(t, d.Put(ctx, ds.NewKey("/a"), []byte("a")))
+	require.ErrorIs(t, d.Put(ctx, ds.NewKey("/b"), []byte("b")), flushErr)
+	// Background flushes report their errors.
+	require.ErrorIs(t, <-errs, flushErr)
+
+	// Writes that failed to flush are kept, and flushed later.
+	failing.Store(false)
+	require.Eventually(t, func() bool {
+		has, err := child.Has(ctx, ds.NewKey("/b"))
+		return err == nil && has
+	}, time.Second, time.Millisecond)
+}
+
+func TestSyncIsDurable(t *testing.T) {
+	dstest.RunCrashWorkload(t, dstest.CrashWorkload{
+		Seed:             1,
+		Steps:            100,
+		CrashProbability: 0.1,
+		Loss:             crash.Loss{Survive: 0.5},
+		Open: func(ctx context.Context, d *crash.Datastore) (ds.Datastore, error) {
+			return NewAutoBatching(d, 8), nil
+		},
+		Step: func(ctx context.Context, d ds.Datastore, i int, ack func(ds.Key, []byte)) error {
+			key := ds.NewKey(fmt.Sprintf("/%d/k", i%4))
+			value := []byte(fmt.Sprint(i))
+			if err := d.Put(ctx, key, value); err != nil {
+				return err
+			}
+			if err := d.Sync(ctx, key.Parent()); err != nil {
+				return err
+			}
+			ack(key, value)
+			return nil
+		},
+	})
+}
+
+func TestQueryMergesBuffer(t *testing.T) {
+	ctx := context.Background()
+	child := ds.NewMapDatastore()
+	for _, k := range []string{"/q/a", "/q/b", "/q/c", "/r/a"} {
+		require.NoError(t, child.Put(ctx, ds.NewKey(k), []byte("child")))
+	}
+	d := NewAutoBatching(child, 100)
+	require.NoError(t, d.Put(ctx, ds.NewKey("/q/b"), []byte("buffered")))
+	require.NoError(t, d.Put(ctx, ds.NewKey("/q/d"), []byte("buffered")))
+	require.NoError(t, d.Put(ctx, ds.NewKey("/r/b"), []byte("buffered")))
+	require.NoError(t, d.Delete(ctx, ds.NewKey("/q/c")))
+
+	res, err := d.Query(ctx, dsq.Query{Prefix: "/q", Orders: []dsq.Order{dsq.OrderByKey{}}})
+	require.NoError(t, err)
+	entries, err := res.Rest()
+	require.NoError(t, err)
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Key+"="+string(e.Value))
+	}
+	require.Equal(t, []string{"/q/a=child", "/q/b=buffered", "/q/d=buffered"}, got)
+
+	// Nothing was flushed.
+	has, err := child.Has(ctx, ds.NewKey("/q/d"))
+	require.NoError(t, err)
+	require.False(t, has)
+
+	res, err = d.Query(ctx, dsq.Query{Prefix: "/q", KeysOnly: true, Limit: 2, Offset: 1, Orders: []dsq.Order{dsq.OrderByKey{}}})
+	require.NoError(t, err)
+	entries, err = res.Rest()
+	require.NoError(t, err)
+	require.Equal(t, []dsq.Entry{{Key: "/q/b", Size: 8}, {Key: "/q/d", Size: 8}}, entries)
+}
+
+func TestConcurrent(t *testing.T) {
+	ctx := context.Background()
+	child := dssync.MutexWrap(ds.NewMapDatastore())
+	d := New(child, Config{MaxEntries: 8, MaxAge: time.Millisecond})
+	defer d.Close()
+
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Go(func() {
+			for i := range 50 {
+				key := ds.NewKey(fmt.Sprintf("/%d/%d", w, i))
+				if err := d.Put(ctx, key, []byte("v")); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := d.Get(ctx, key); err != nil {
+					t.Error(err)
+					return
+				}
+				if i%10 == 0 {
+					res, err := d.Query(ctx, dsq.Query{Prefix: fmt.Sprintf("/%d", w), KeysOnly: true})
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					entries, err := res.Rest()
+					if err != nil || len(entries) != i+1 {
+						t.Errorf("query found %d entries, want %d (err: %v)", len(entries), i+1, err)
+						return
+					}
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	require.NoError(t, d.Flush(ctx))
+	res, err := child.Query(ctx, dsq.Query{KeysOnly: true})
+	require.NoError(t, err)
+	entries, err := res.Rest()
+	require.NoError(t, err)
+	require.Len(t, entries, 8*50)
+}
@@ -3,6 +3,7 @@ package datastore
 import (
 	"context"
 	"log"
+	"time"
 
 	dsq "github.com/ipfs/go-datastore/query"
 )
@@ -81,6 +82,14 @@ func (d *MapDatastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, err
 	return r, nil
 }
 
+// QueryCapabilities implements query.Capable. Apart from KeysOnly, the
+// MapDatastore applies every part of queries with NaiveQueryApply.
+func (d *MapDatastore) QueryCapabilities() dsq.Capabilities {
+	return dsq.Capabilities{}
+}
+
+var _ dsq.Capable = (*MapDatastore)(nil)
+
 func (d *MapDatastore) Batch(ctx context.Context) (Batch, error) {
 	return NewBasicBatch(d), nil
 }
@@ -101,6 +110,8 @@ var _ GCDatastore = (*LogDatastore)(nil)
 var _ PersistentDatastore = (*LogDatastore)(nil)
 var _ ScrubbedDatastore = (*LogDatastore)(nil)
 var _ CheckedDatastore = (*LogDatastore)(nil)
+var _ TTLDatastore = (*LogDatastore)(nil)
+var _ TxnDatastore = (*LogDatastore)(nil)
 var _ Shim = (*LogDatastore)(nil)
 
 // Shim is a datastore which has a child.
@@ -111,6 +122,9 @@ type Shim interface {
 }
 
 // NewLogDatastore constructs a log datastore.
+//
+// The returned datastore implements every optional feature; use
+// scoped.Inherit to only expose the features ds supports.
 func NewLogDatastore(ds Datastore, name string) *LogDatastore {
 	if len(name) < 1 {
 		name = "LogDatastore"
@@ -246,3 +260,106 @@ func (d *LogDatastore) CollectGarbage(ctx context.Context) error {
 	}
 	return nil
 }
+
+// PutWithTTL implements TTL.PutWithTTL
+func (d *LogDatastore) PutWithTTL(ctx context.Context, key Key, value []byte, ttl time.Duration) error {
+	log.Printf("%s: PutWithTTL %s %s\n", d.Name, key, ttl)
+	tds, ok := d.child.(TTLDatastore)
+	if !ok {
+		return ErrTTLUnsupported
+	}
+	return tds.PutWithTTL(ctx, key, value, ttl)
+}
+
+// SetTTL implements TTL.SetTTL
+func (d *LogDatastore) SetTTL(ctx context.Context, key Key, ttl time.Duration) error {
+	log.Printf("%s: SetTTL %s %s\n", d.Name, key, ttl)
+	tds, ok := d.child.(TTLDatastore)
+	if !ok {
+		return ErrTTLUnsupported
+	}
+	return tds.SetTTL(ctx, key, ttl)
+}
+
+// GetExpiration implements TTL.GetExpiration
+func (d *LogDatastore) GetExpiration(ctx context.Context, key Key) (time.Time, error) {
+	log.Printf("%s: GetExpiration %s\n", d.Name, key)
+	tds, ok := d.child.(TTLDatastore)
+	if !ok {
+		return time.Time{}, ErrTTLUnsupported
+	}
+	return tds.GetExpiration(ctx, key)
+}
+
+// LogTxn logs all accesses through the transaction.
+type LogTxn struct {
+	Name  string
+	child Txn
+}
+
+var _ Txn = (*LogTxn)(nil)
+
+// NewTransaction implements TxnDatastore.NewTransaction
+func (d *LogDatastore) NewTransaction(ctx context.Context, readOnly bool) (Txn, error) {
+	log.Printf("%s: NewTransaction readOnly=%v\n", d.Name, readOnly)
+	tds, ok := d.child.(TxnDatastore)
+	if !ok {
+		return nil, ErrTxnUnsupported
+	}
+	txn, err := tds.NewTransaction(ctx, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &LogTxn{
+		Name:  d.Name,
+		child: txn,
+	}, nil
+}
+
+// Get implements Txn.Get
+func (t *LogTxn) Get(ctx context.Context, key Key) ([]byte, error) {
+	log.Printf("%s: TxnGet %s\n", t.Name, key)
+	return t.child.Get(ctx, key)
+}
+
+// Has implements Txn.Has
+func (t *LogTxn) Has(ctx context.Context, key Key) (bool, error) {
+	log.Printf("%s: TxnHas %s\n", t.Name, key)
+	return t.child.Has(ctx, key)
+}
+
+// GetSize implements Txn.GetSize
+func (t *LogTxn) GetSize(ctx context.Context, key Key) (int, error) {
+	log.Printf("%s: TxnGetSize %s\n", t.Name, key)
+	return t.child.GetSize(ctx, key)
+}
+
+// Query implements Txn.Query
+func (t *LogTxn) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	log.Printf("%s: TxnQuery %s\n", t.Name, q)
+	return t.child.Query(ctx, q)
+}
+
+// Put implements Txn.Put
+func (t *LogTxn) Put(ctx context.Context, key Key, value []byte) error {
+	log.Printf("%s: TxnPut %s\n", t.Name, key)
+	return t.child.Put(ctx, key, value)
+}
+
+// Delete implements Txn.Delete
+func (t *LogTxn) Delete(ctx context.Context, key Key) error {
+	log.Printf("%s: TxnDelete %s\n", t.Name, key)
+	return t.child.Delete(ctx, key)
+}
+
+// Commit implements Txn.Commit
+func (t *LogTxn) Commit(ctx context.Context) error {
+	log.Printf("%s: TxnCommit\n", t.Name)
+	return t.child.Commit(ctx)
+}
+
+// Discard implements Txn.Discard
+func (t *LogTxn) Discard(ctx context.Context) {
+	log.Printf("%s: TxnDiscard\n", t.Name)
+	t.child.Discard(ctx)
+}
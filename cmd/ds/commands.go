@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/diff"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+var errUsage = errors.New("usage")
+
+// cli runs commands against a datastore.
+type cli struct {
+	d   ds.Datastore
+	in  io.Reader
+	out io.Writer
+	// inShell is set while running commands from the shell, whose input
+	// can't be used for values.
+	inShell bool
+}
+
+type command struct {
+	usage string
+	run   func(c *cli, ctx context.Context, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"get":    {"get <key>", (*cli).get},
+		"put":    {"put <key> [value]  (value read from stdin if omitted, outside the shell)", (*cli).put},
+		"delete": {"delete <key>", (*cli).delete},
+		"has":    {"has <key>", (*cli).has},
+		"query":  {"query [-q query] [-prefix key] [-filter f]... [-order o]... [-offset n] [-limit n] [-keys-only]", (*cli).query},
+		"du":     {"du", (*cli).du},
+		"check":  {"check", (*cli).check},
+		"scrub":  {"scrub", (*cli).scrub},
+		"gc":     {"gc", (*cli).gc},
+		"stack":  {"stack", (*cli).stack},
+		"export": {"export [-prefix key] [-o file]", (*cli).export},
+		"import": {"import [-i file]", (*cli).importPatch},
+		"shell":  {"shell", (*cli).shell},
+	}
+}
+
+func (c *cli) run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	err := cmd.run(c, ctx, args[1:])
+	if errors.Is(err, errUsage) {
+		return fmt.Errorf("usage: %s", cmd.usage)
+	}
+	return err
+}
+
+func (c *cli) get(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	v, err := c.d.Get(ctx, ds.NewKey(args[0]))
+	if err != nil {
+		return err
+	}
+	_, err = c.out.Write(v)
+	return err
+}
+
+func (c *cli) put(ctx context.Context, args []string) error {
+	var v []byte
+	switch len(args) {
+	case 1:
+		if c.inShell {
+			return errUsage
+		}
+		var err error
+		if v, err = io.ReadAll(c.in); err != nil {
+			return err
+		}
+	case 2:
+		v = []byte(args[1])
+	default:
+		return errUsage
+	}
+	return c.d.Put(ctx, ds.NewKey(args[0]), v)
+}
+
+func (c *cli) delete(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return c.d.Delete(ctx, ds.NewKey(args[0]))
+}
+
+func (c *cli) has(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	has, err := c.d.Has(ctx, ds.NewKey(args[0]))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, has)
+	return nil
+}
+
+func (c *cli) query(ctx context.Context, args []string) error {
+	var q dsq.Query
+	fs := c.flagSet("query")
+	fs.Func("q", `run a query as printed by -v, e.g. 'SELECT keys FROM "/a" LIMIT 5'; later flags amend it`, func(s string) error {
+		var err error
+		q, err = dsq.Parse(s)
+		return err
+	})
+	fs.StringVar(&q.Prefix, "prefix", "", "only return keys under this prefix")
+	fs.Func("filter", `filter results, e.g. 'KEY > "/a"', 'VALUE == "x"', 'PREFIX("/a/b")', 'NOT(GLOB("/a/*"))' (repeatable)`, func(s string) error {
+		f, err := dsq.ParseFilter(s)
+		if err != nil {
+			return err
+		}
+		q.Filters = append(q.Filters, f)
+		return nil
+	})
+	fs.Func("order", "order results: KEY, desc(KEY), VALUE or desc(VALUE) (repeatable)", func(s string) error {
+		o, err := dsq.ParseOrder(s)
+		if err != nil {
+			return err
+		}
+		q.Orders = append(q.Orders, o)
+		return nil
+	})
+	fs.IntVar(&q.Offset, "offset", 0, "skip this many results")
+	fs.IntVar(&q.Limit, "limit", 0, "return at most this many results")
+	fs.BoolVar(&q.KeysOnly, "keys-only", false, "only return keys")
+	verbose := fs.Bool("v", false, "print the query before the results")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errUsage
+	}
+
+	if *verbose {
+		fmt.Fprintln(c.out, q)
+	}
+	for e, err := range ds.QueryIter(ctx, c.d, q) {
+		if err != nil {
+			return err
+		}
+		if q.KeysOnly {
+			fmt.Fprintln(c.out, e.Key)
+		} else {
+			fmt.Fprintf(c.out, "%s\t%q\n", e.Key, e.Value)
+		}
+	}
+	return nil
+}
+
+func (c *cli) du(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if _, ok := c.d.(ds.PersistentDatastore); !ok {
+		return fmt.Errorf("datastore does not report disk usage")
+	}
+	du, err := ds.DiskUsage(ctx, c.d)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, du)
+	return nil
+}
+
+func (c *cli) check(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	cds, ok := c.d.(ds.CheckedDatastore)
+	if !ok {
+		return fmt.Errorf("datastore does not support checking")
+	}
+	return cds.Check(ctx)
+}
+
+func (c *cli) scrub(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	sds, ok := c.d.(ds.ScrubbedDatastore)
+	if !ok {
+		return fmt.Errorf("datastore does not support scrubbing")
+	}
+	return sds.Scrub(ctx)
+}
+
+func (c *cli) gc(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	gds, ok := c.d.(ds.GCDatastore)
+	if !ok {
+		return fmt.Errorf("datastore does not support garbage collection")
+	}
+	return gds.CollectGarbage(ctx)
+}
+
+// stack prints the layers of the datastore and their features.
+func (c *cli) stack(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	return ds.PrintStack(c.out, c.d)
+}
+
+// export writes the entries of the datastore as a patch (see the diff
+// package) that adds them.
+func (c *cli) export(ctx context.Context, args []string) error {
+	fs := c.flagSet("export")
+	prefix := fs.String("prefix", "/", "only export keys under this prefix")
+	output := fs.String("o", "", "file to write to (stdout if not specified)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errUsage
+	}
+
+	w := c.out
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err := diff.WritePatch(w, diff.Diff(ctx, ds.NewNullDatastore(), c.d, ds.NewKey(*prefix)))
+	return err
+}
+
+// importPatch applies a patch, such as one written by export.
+func (c *cli) importPatch(ctx context.Context, args []string) error {
+	fs := c.flagSet("import")
+	input := fs.String("i", "", "file to read from (stdin if not specified)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errUsage
+	}
+	bds, ok := c.d.(ds.Batching)
+	if !ok {
+		return ds.ErrBatchUnsupported
+	}
+
+	if *input == "" && c.inShell {
+		return fmt.Errorf("-i is required in the shell")
+	}
+	r := c.in
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	n, err := diff.Apply(ctx, bds, diff.ReadPatch(r))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "imported %d entries\n", n)
+	return nil
+}
+
+// shell reads commands from the input, one per line, until EOF or "exit".
+func (c *cli) shell(ctx context.Context, args []string) error {
+	if len(args) != 0 || c.inShell {
+		return errUsage
+	}
+	c.inShell = true
+	defer func() { c.inShell = false }()
+
+	sc := bufio.NewScanner(c.in)
+	for {
+		fmt.Fprint(c.out, "ds> ")
+		if !sc.Scan() {
+			fmt.Fprintln(c.out)
+			return sc.Err()
+		}
+		args, err := splitArgs(sc.Text())
+		if err != nil {
+			fmt.Fprintln(c.out, "error:", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "exit", "quit":
+			return nil
+		case "help":
+			printCommands(c.out)
+			continue
+		}
+		if err := c.run(ctx, args); err != nil {
+			fmt.Fprintln(c.out, "error:", err)
+			continue
+		}
+		if args[0] == "get" {
+			fmt.Fprintln(c.out)
+		}
+	}
+}
+
+func (c *cli) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.out)
+	return fs
+}
+
+func printCommands(w io.Writer) {
+	for _, name := range []string{"get", "put", "delete", "has", "query", "du", "check", "scrub", "gc", "stack", "export", "import", "shell"} {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+}
+
+// splitArgs splits a shell line into arguments. Arguments are separated by
+// spaces, and may be quoted with single or double quotes.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/cmd/internal/openers"
+	"github.com/stretchr/testify/require"
+)
+
+func runCmd(t *testing.T, d ds.Datastore, in string, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	c := &cli{d: d, in: strings.NewReader(in), out: &out}
+	err := c.run(context.Background(), args)
+	return out.String(), err
+}
+
+func TestCommands(t *testing.T) {
+	d, err := openers.Open("mem", "")
+	require.NoError(t, err)
+
+	_, err = runCmd(t, d, "", "put", "/a/1", "one")
+	require.NoError(t, err)
+	_, err = runCmd(t, d, "two", "put", "/a/2")
+	require.NoError(t, err)
+	_, err = runCmd(t, d, "", "put", "/b", "three")
+	require.NoError(t, err)
+
+	out, err := runCmd(t, d, "", "get", "/a/2")
+	require.NoError(t, err)
+	require.Equal(t, "two", out)
+
+	out, err = runCmd(t, d, "", "has", "/b")
+	require.NoError(t, err)
+	require.Equal(t, "true\n", out)
+
+	out, err = runCmd(t, d, "", "query", "-v", "-prefix", "/a", "-filter", `VALUE != "one"`, "-order", "desc(KEY)")
+	require.NoError(t, err)
+	require.Equal(t, "SELECT keys,vals FROM \"/a\" FILTER [VALUE != \"one\"] ORDER [desc(KEY)]\n/a/2\t\"two\"\n", out)
+
+	out, err = runCmd(t, d, "", "query", "-keys-only", "-order", "KEY", "-limit", "2")
+	require.NoError(t, err)
+	require.Equal(t, "/a/1\n/a/2\n", out)
+
+	out, err = runCmd(t, d, "", "stack")
+	require.NoError(t, err)
+	require.Equal(t, "*scoped.ds1 [Batching]\n  *sync.MutexDatastore [Batching Checked GC Persistent Scrubbed TTL Transaction]\n    *datastore.MapDatastore [Batching]\n", out)
+
+	patch, err := runCmd(t, d, "", "export", "-prefix", "/a")
+	require.NoError(t, err)
+
+	other, err := openers.Open("mem", "")
+	require.NoError(t, err)
+	out, err = runCmd(t, other, patch, "import")
+	require.NoError(t, err)
+	require.Equal(t, "imported 2 entries\n", out)
+
+	_, err = runCmd(t, d, "", "delete", "/b")
+	require.NoError(t, err)
+	_, err = runCmd(t, d, "", "get", "/b")
+	require.ErrorIs(t, err, ds.ErrNotFound)
+
+	_, err = runCmd(t, d, "", "get")
+	require.ErrorContains(t, err, "usage: get <key>")
+	_, err = runCmd(t, d, "", "frobnicate")
+	require.Error(t, err)
+}
+
+func TestShell(t *testing.T) {
+	d, err := openers.Open("mem", "")
+	require.NoError(t, err)
+
+	out, err := runCmd(t, d, `put /x "hello world"
+get /x
+query -filter 'KEY == "/x"'
+put /y
+exit
+get /x
+`, "shell")
+	require.NoError(t, err)
+	require.Equal(t, "ds> ds> hello world\nds> /x\t\"hello world\"\nds> error: usage: put <key> [value]  (value read from stdin if omitted, outside the shell)\nds> ", out)
+}
+
+func TestQueryString(t *testing.T) {
+	d, err := openers.Open("mem", "")
+	require.NoError(t, err)
+	for _, k := range []string{"/a/1", "/a/2", "/a/3/x", "/b"} {
+		_, err = runCmd(t, d, "", "put", k, "v"+k)
+		require.NoError(t, err)
+	}
+
+	out, err := runCmd(t, d, "", "query", "-q", `SELECT keys FROM "/a" FILTER [NOT(GLOB("/a/*/*"))] ORDER [desc(KEY)]`, "-limit", "1")
+	require.NoError(t, err)
+	require.Equal(t, "/a/2\n", out)
+
+	_, err = runCmd(t, d, "", "query", "-q", "SELECT keys LIMIT")
+	require.ErrorContains(t, err, "query: offset 17: expected integer")
+	_, err = runCmd(t, d, "", "query", "-filter", "KEY ~ x")
+	require.Error(t, err)
+	_, err = runCmd(t, d, "", "query", "-order", "SIZE")
+	require.Error(t, err)
+}
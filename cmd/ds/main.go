@@ -0,0 +1,59 @@
+// Command ds inspects and modifies a datastore from the command line.
+//
+// The datastore is opened by type name, through the openers registered with
+// openers.Add (see cmd/internal/openers). The "mem", "fs" and "config" types
+// are built in; "config" builds a whole datastore stack from a JSON spec file
+// (see the config package):
+//
+//	ds -type fs -loc ./data query -prefix /blocks -limit 10 -keys-only
+//	ds -type config -loc ./datastore.json du
+//	ds -type fs -loc ./data get /config
+//	ds -type fs -loc ./data export -o backup.patch
+//	ds -type fs -loc ./data shell
+//
+// Run ds without a command for the list of commands.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ipfs/go-datastore/cmd/internal/openers"
+)
+
+var dsType = flag.String("type", "fs", "type of the datastore to open")
+var dsLoc = flag.String("loc", ".", "location of the datastore")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-type name] [-loc location] <command> [args]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "datastore types: %v\n\n", openers.Names())
+		fmt.Fprintf(os.Stderr, "commands:\n")
+		printCommands(os.Stderr)
+		fmt.Fprintf(os.Stderr, "\nflags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	d, err := openers.Open(*dsType, *dsLoc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open datastore: %v\n", err)
+		os.Exit(1)
+	}
+
+	c := &cli{d: d, in: os.Stdin, out: os.Stdout}
+	err = c.run(context.Background(), flag.Args())
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
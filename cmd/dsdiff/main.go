@@ -0,0 +1,131 @@
+// Command dsdiff computes the difference between two datastores as a patch
+// file, and applies patch files to a datastore.
+//
+// Datastores are opened by type name and location, like with the ds command
+// (see cmd/internal/openers). The default type is "fs", directories in the
+// layout of the examples fs datastore.
+//
+//	dsdiff diff [-type fs] [-prefix /some/prefix] [-o out.patch] <from> <to>
+//	dsdiff apply [-type fs] [-i in.patch] <loc>
+//
+// diff exits with status 1 if the datastores differ.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/cmd/internal/openers"
+	"github.com/ipfs/go-datastore/diff"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage:\n")
+	fmt.Fprintf(os.Stderr, "  %s diff [-type name] [-prefix key] [-o file] <from> <to>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s apply [-type name] [-i file] <loc>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "datastore types: %v\n", openers.Names())
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "diff":
+		var differ bool
+		differ, err = runDiff(os.Args[2:])
+		if err == nil && differ {
+			os.Exit(1)
+		}
+	case "apply":
+		err = runApply(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+		os.Exit(2)
+	}
+}
+
+func runDiff(args []string) (bool, error) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	dsType := fs.String("type", "fs", "type of the datastores to open")
+	prefix := fs.String("prefix", "/", "only compare keys under this prefix")
+	output := fs.String("o", "", "file to write the patch to (stdout if not specified)")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		usage()
+	}
+
+	from, err := openers.Open(*dsType, fs.Arg(0))
+	if err != nil {
+		return false, err
+	}
+	defer from.Close()
+	to, err := openers.Open(*dsType, fs.Arg(1))
+	if err != nil {
+		return false, err
+	}
+	defer to.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := diff.WritePatch(w, diff.Diff(context.Background(), from, to, ds.NewKey(*prefix)))
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	dsType := fs.String("type", "fs", "type of the datastore to open")
+	input := fs.String("i", "", "file to read the patch from (stdin if not specified)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	dstore, err := openers.Open(*dsType, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer dstore.Close()
+	bds, ok := dstore.(ds.Batching)
+	if !ok {
+		return ds.ErrBatchUnsupported
+	}
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	n, err := diff.Apply(context.Background(), bds, diff.ReadPatch(r))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "applied %d changes\n", n)
+	return nil
+}
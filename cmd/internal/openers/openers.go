@@ -0,0 +1,58 @@
+// Package openers is the registry of the datastore implementations the
+// commands open by type name.
+package openers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/config"
+	"github.com/ipfs/go-datastore/examples"
+	"github.com/ipfs/go-datastore/scoped"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+// openers contains the known datastore implementations.
+var openers map[string]func(loc string) (ds.Datastore, error)
+
+// Add allows registration of a new datastore implementation. Additional
+// implementations can be linked in by adding a file to a command that
+// registers them from an init function.
+func Add(name string, opener func(loc string) (ds.Datastore, error)) {
+	if openers == nil {
+		openers = make(map[string]func(string) (ds.Datastore, error))
+	}
+	openers[name] = opener
+}
+
+func init() {
+	Add("mem", func(string) (ds.Datastore, error) {
+		return scoped.Inherit(dssync.MutexWrap(ds.NewMapDatastore())), nil
+	})
+	Add("fs", examples.NewDatastore)
+	// loc is the path of a JSON spec, see the config package.
+	Add("config", func(loc string) (ds.Datastore, error) {
+		return config.Load(context.Background(), loc)
+	})
+}
+
+// Open instantiates the named datastore implementation at the given location.
+func Open(name, loc string) (ds.Datastore, error) {
+	opener, ok := openers[name]
+	if !ok {
+		return nil, fmt.Errorf("no such datastore type: %s (known: %v)", name, Names())
+	}
+	return opener(loc)
+}
+
+// Names returns the sorted names of the known datastore implementations.
+func Names() []string {
+	var names []string
+	for name := range openers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
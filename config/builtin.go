@@ -0,0 +1,240 @@
+package config
+
+import (
+	"errors"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/autobatch"
+	"github.com/ipfs/go-datastore/delayed"
+	"github.com/ipfs/go-datastore/examples"
+	"github.com/ipfs/go-datastore/keytransform"
+	"github.com/ipfs/go-datastore/metrics"
+	"github.com/ipfs/go-datastore/mount"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/retrystore"
+	"github.com/ipfs/go-datastore/scoped"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/go-datastore/trace"
+	delay "github.com/ipfs/go-ipfs-delay"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func init() {
+	// {"type": "mem"}
+	Register("mem", func(p *Params) (ds.Datastore, error) {
+		return ds.NewMapDatastore(), nil
+	})
+
+	// {"type": "null"}
+	Register("null", func(p *Params) (ds.Datastore, error) {
+		return ds.NewNullDatastore(), nil
+	})
+
+	// {"type": "fs", "path": "/data"}
+	Register("fs", func(p *Params) (ds.Datastore, error) {
+		p.Require("path")
+		path := p.String("path", "")
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		return examples.NewDatastore(path)
+	})
+
+	// {"type": "mount", "mounts": [{"prefix": "/a", "child": {...}}, ...]}
+	Register("mount", func(p *Params) (ds.Datastore, error) {
+		p.Require("mounts")
+		var mounts []mount.Mount
+		for _, m := range p.Objects("mounts") {
+			m.Require("prefix")
+			mounts = append(mounts, mount.Mount{
+				Prefix:    m.Key("prefix", ds.NewKey("/")),
+				Datastore: m.Child("child"),
+			})
+		}
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		return scoped.Inherit(mount.New(mounts), ds.FeatureNameChecked, ds.FeatureNameScrubbed,
+			ds.FeatureNameGC, ds.FeatureNamePersistent), nil
+	})
+
+	// {"type": "namespace", "prefix": "/ns", "child": {...}}
+	Register("namespace", func(p *Params) (ds.Datastore, error) {
+		p.Require("prefix")
+		prefix := p.Key("prefix", ds.NewKey("/"))
+		child := p.Child("child")
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		return scoped.Inherit(namespace.Wrap(child, prefix)), nil
+	})
+
+	// {"type": "keytransform", "transform": {"type": "prefix", ...}, "child": {...}}
+	Register("keytransform", func(p *Params) (ds.Datastore, error) {
+		t := p.Transform("transform")
+		child := p.Child("child")
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		return scoped.Inherit(keytransform.Wrap(child, t)), nil
+	})
+
+	// {"type": "sync", "child": {...}}
+	Register("sync", func(p *Params) (ds.Datastore, error) {
+		child := p.Child("child")
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		return scoped.Inherit(dssync.MutexWrap(child)), nil
+	})
+
+	// {"type": "autobatch", "size": 128, "max-bytes": 1048576, "max-age": "1s", "child": {...}}
+	//
+	// Background flushes triggered by "max-age" are retried until they
+	// succeed.
+	Register("autobatch", func(p *Params) (ds.Datastore, error) {
+		cfg := autobatch.Config{
+			MaxEntries: p.Int("size", 128),
+			MaxBytes:   p.Int("max-bytes", 0),
+			MaxAge:     p.Duration("max-age", 0),
+		}
+		child := p.BatchingChild("child")
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		return scoped.Inherit(autobatch.New(child, cfg)), nil
+	})
+
+	// {"type": "retrystore", "retries": 5, "delay": "100ms", "child": {...}}
+	//
+	// All errors except ds.ErrNotFound are considered temporary.
+	Register("retrystore", func(p *Params) (ds.Datastore, error) {
+		retries := p.Int("retries", 5)
+		d := p.Duration("delay", 0)
+		child := p.BatchingChild("child")
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		return scoped.Inherit(&retrystore.Datastore{
+			Batching: child,
+			Retries:  retries,
+			Delay:    d,
+			TempErrFunc: func(err error) bool {
+				return !errors.Is(err, ds.ErrNotFound)
+			},
+		}), nil
+	})
+
+	// {"type": "delayed", "delay": "10ms", "child": {...}}
+	Register("delayed", func(p *Params) (ds.Datastore, error) {
+		d := p.Duration("delay", 0)
+		child := p.Child("child")
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		return scoped.Inherit(delayed.New(child, delay.Fixed(d)), ds.FeatureNameBatching), nil
+	})
+
+	// {"type": "trace", "tracer": "name", "keys": "hashed", "child": {...}}
+	//
+	// The tracer is obtained from the global OpenTelemetry tracer provider.
+	// "keys" is the key policy: full (the default), hashed, prefix or omitted.
+	Register("trace", func(p *Params) (ds.Datastore, error) {
+		name := p.String("tracer", "github.com/ipfs/go-datastore")
+		keys, err := trace.ParseKeyPolicy(p.String("keys", string(trace.KeyFull)))
+		if err != nil {
+			p.Errorf("parameter %q: %v", "keys", err)
+		}
+		child := p.Child("child")
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		t := trace.New(child, otel.Tracer(name))
+		t.KeyPolicy = keys
+		return scoped.Inherit(t, ds.FeatureNameBatching), nil
+	})
+
+	// {"type": "metrics", "meter": "name", "attributes": {"mount": "/blocks"}, "child": {...}}
+	//
+	// The meter is obtained from the global OpenTelemetry meter provider. The
+	// attributes are added to every measurement.
+	Register("metrics", func(p *Params) (ds.Datastore, error) {
+		name := p.String("meter", "github.com/ipfs/go-datastore")
+		var attrs map[string]string
+		p.Decode("attributes", &attrs)
+		child := p.Child("child")
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		var kvs []attribute.KeyValue
+		for k, v := range attrs {
+			kvs = append(kvs, attribute.String(k, v))
+		}
+		m, err := metrics.New(child, otel.Meter(name), kvs...)
+		if err != nil {
+			return nil, err
+		}
+		return scoped.Inherit(m), nil
+	})
+
+	// {"type": "log", "name": "name", "child": {...}}
+	Register("log", func(p *Params) (ds.Datastore, error) {
+		name := p.String("name", "")
+		child := p.Child("child")
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		return scoped.Inherit(ds.NewLogDatastore(child, name)), nil
+	})
+
+	// {"type": "prefix", "prefix": "/p"}
+	RegisterTransform("prefix", func(p *Params) (keytransform.KeyTransform, error) {
+		p.Require("prefix")
+		prefix := p.Key("prefix", ds.NewKey("/"))
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		return keytransform.PrefixTransform{Prefix: prefix}, nil
+	})
+
+	// {"type": "escape", "base32": false}
+	RegisterTransform("escape", func(p *Params) (keytransform.KeyTransform, error) {
+		base32 := p.Bool("base32", false)
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		return keytransform.EscapeTransform{Base32: base32}, nil
+	})
+
+	// {"type": "case-insensitive"}
+	RegisterTransform("case-insensitive", func(p *Params) (keytransform.KeyTransform, error) {
+		return keytransform.CaseInsensitiveTransform{}, nil
+	})
+
+	// {"type": "shard", "func": "next-to-last", "length": 2}
+	RegisterTransform("shard", func(p *Params) (keytransform.KeyTransform, error) {
+		fn := p.String("func", "next-to-last")
+		n := p.Int("length", 2)
+		if n <= 0 {
+			p.Errorf("parameter %q: must be positive", "length")
+		}
+		switch fn {
+		case "next-to-last":
+		case "hash":
+			if n > 64 {
+				p.Errorf("parameter %q: hash shards are at most 64 digits long", "length")
+			}
+		default:
+			p.Errorf("parameter %q: unknown shard function %q", "func", fn)
+		}
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		shard := keytransform.NextToLast(n)
+		if fn == "hash" {
+			shard = keytransform.HashShard(n)
+		}
+		return keytransform.ShardTransform{Shard: shard}, nil
+	})
+}
@@ -0,0 +1,365 @@
+// Package config builds datastores from declarative JSON specs.
+//
+// A spec is a JSON object whose "type" field names a constructor registered
+// with Register, and whose other fields are the constructor's parameters.
+// Wrappers take their child datastores as nested specs, so whole stacks can be
+// described in one document:
+//
+//	{
+//	  "type": "mount",
+//	  "mounts": [
+//	    {"prefix": "/blocks", "child": {"type": "fs", "path": "/data/blocks"}},
+//	    {"prefix": "/", "child": {
+//	      "type": "sync",
+//	      "child": {"type": "namespace", "prefix": "/meta", "child": {"type": "mem"}}
+//	    }}
+//	  ]
+//	}
+//
+// Wrappers are scoped down with scoped.Inherit, so a stack implements an
+// optional feature, such as transactions or TTLs, exactly when the datastores
+// it wraps do.
+//
+// Specs are validated while they are built: unknown types, unknown or
+// mistyped parameters and constructor errors are all reported with the path
+// of the offending field, and any datastores already opened are closed again.
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/keytransform"
+)
+
+// Constructor builds a datastore from the parameters of a spec.
+//
+// Constructors read their parameters with the Params getters, which record
+// any error, and must return p.Err() before using the values they read.
+type Constructor func(p *Params) (ds.Datastore, error)
+
+// TransformConstructor builds a key transform from the parameters of a spec.
+type TransformConstructor func(p *Params) (keytransform.KeyTransform, error)
+
+var (
+	constructors          = map[string]Constructor{}
+	transformConstructors = map[string]TransformConstructor{}
+)
+
+// Register registers a datastore constructor under the given type name,
+// replacing any previous constructor with that name.
+func Register(name string, ctor Constructor) {
+	constructors[name] = ctor
+}
+
+// RegisterTransform registers a key transform constructor under the given
+// type name, for use by the "keytransform" datastore type.
+func RegisterTransform(name string, ctor TransformConstructor) {
+	transformConstructors[name] = ctor
+}
+
+// Types returns the registered datastore type names, sorted.
+func Types() []string {
+	var names []string
+	for name := range constructors {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Build builds the datastore described by spec.
+func Build(ctx context.Context, spec []byte) (ds.Datastore, error) {
+	var fields map[string]json.RawMessage
+	if err := decodeStrict(spec, &fields); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	st := &state{ctx: ctx}
+	d := st.build("", fields)
+	if err := st.finish(); err != nil {
+		for _, o := range st.open {
+			o.Close()
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+// Load builds the datastore described by the spec in the given file.
+func Load(ctx context.Context, path string) (ds.Datastore, error) {
+	spec, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Build(ctx, spec)
+}
+
+// Validate builds the datastore described by spec, closes it, and returns the
+// features the datastore implemented.
+func Validate(ctx context.Context, spec []byte) ([]ds.Feature, error) {
+	d, err := Build(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	features := ds.FeaturesForDatastore(d)
+	return features, d.Close()
+}
+
+// state is shared by the Params of one Build.
+type state struct {
+	ctx    context.Context
+	errs   []error
+	params []*Params
+	// open holds the datastores built so far that are not owned by a parent
+	// datastore yet.
+	open []ds.Datastore
+}
+
+func (st *state) newParams(path string, fields map[string]json.RawMessage) *Params {
+	p := &Params{st: st, path: path, fields: fields, used: map[string]bool{}}
+	st.params = append(st.params, p)
+	return p
+}
+
+func (st *state) build(path string, fields map[string]json.RawMessage) ds.Datastore {
+	p := st.newParams(path, fields)
+	typ := p.String("type", "")
+	if typ == "" {
+		p.Errorf("missing type")
+		return nil
+	}
+	ctor, ok := constructors[typ]
+	if !ok {
+		p.Errorf("unknown type %q (known: %s)", typ, strings.Join(Types(), ", "))
+		return nil
+	}
+
+	nerrs := len(st.errs)
+	d, err := ctor(p)
+	if err != nil {
+		// Don't repeat errors the constructor got from p.Err().
+		if len(st.errs) == nerrs {
+			p.Errorf("%s: %v", typ, err)
+		}
+		return nil
+	}
+	st.open = slices.DeleteFunc(st.open, func(o ds.Datastore) bool {
+		return slices.Contains(p.children, o)
+	})
+	st.open = append(st.open, d)
+	return d
+}
+
+func (st *state) finish() error {
+	for _, p := range st.params {
+		var unknown []string
+		for name := range p.fields {
+			if !p.used[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		slices.Sort(unknown)
+		for _, name := range unknown {
+			p.Errorf("unknown parameter %q", name)
+		}
+	}
+	return errors.Join(st.errs...)
+}
+
+// Params holds the parameters of a spec, or of a nested object in a spec.
+type Params struct {
+	st       *state
+	path     string
+	fields   map[string]json.RawMessage
+	used     map[string]bool
+	children []ds.Datastore
+}
+
+// Context returns the context passed to Build.
+func (p *Params) Context() context.Context {
+	return p.st.ctx
+}
+
+// Path returns the location of these parameters in the spec.
+func (p *Params) Path() string {
+	if p.path == "" {
+		return "."
+	}
+	return p.path
+}
+
+// Errorf records an error about these parameters.
+func (p *Params) Errorf(format string, args ...any) {
+	p.st.errs = append(p.st.errs, fmt.Errorf("config: %s: %s", p.Path(), fmt.Sprintf(format, args...)))
+}
+
+// Err returns the errors recorded so far while building the spec.
+func (p *Params) Err() error {
+	return errors.Join(p.st.errs...)
+}
+
+// Has returns whether the named parameter is set.
+func (p *Params) Has(name string) bool {
+	_, ok := p.fields[name]
+	return ok
+}
+
+// Decode decodes the named parameter into v, and returns whether it was set.
+func (p *Params) Decode(name string, v any) bool {
+	raw, ok := p.fields[name]
+	p.used[name] = true
+	if !ok {
+		return false
+	}
+	if err := decodeStrict(raw, v); err != nil {
+		p.Errorf("parameter %q: %v", name, err)
+		return false
+	}
+	return true
+}
+
+// Require records an error for each of the named parameters that is not set.
+func (p *Params) Require(names ...string) {
+	for _, name := range names {
+		if !p.Has(name) {
+			p.Errorf("missing parameter %q", name)
+		}
+	}
+}
+
+// String returns the named string parameter, or def if it is not set.
+func (p *Params) String(name string, def string) string {
+	v := def
+	p.Decode(name, &v)
+	return v
+}
+
+// Int returns the named integer parameter, or def if it is not set.
+func (p *Params) Int(name string, def int) int {
+	v := def
+	p.Decode(name, &v)
+	return v
+}
+
+// Bool returns the named boolean parameter, or def if it is not set.
+func (p *Params) Bool(name string, def bool) bool {
+	v := def
+	p.Decode(name, &v)
+	return v
+}
+
+// Duration returns the named duration parameter, written as a string in the
+// format accepted by time.ParseDuration, or def if it is not set.
+func (p *Params) Duration(name string, def time.Duration) time.Duration {
+	var s string
+	if !p.Decode(name, &s) {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		p.Errorf("parameter %q: %v", name, err)
+		return def
+	}
+	return d
+}
+
+// Key returns the named key parameter, or def if it is not set.
+func (p *Params) Key(name string, def ds.Key) ds.Key {
+	var s string
+	if !p.Decode(name, &s) {
+		return def
+	}
+	return ds.NewKey(s)
+}
+
+// Objects returns the parameters of the objects in the named array parameter.
+func (p *Params) Objects(name string) []*Params {
+	var objs []map[string]json.RawMessage
+	if !p.Decode(name, &objs) {
+		return nil
+	}
+	out := make([]*Params, len(objs))
+	for i, fields := range objs {
+		out[i] = p.st.newParams(fmt.Sprintf("%s.%s[%d]", p.path, name, i), fields)
+	}
+	return out
+}
+
+// Child builds the datastore described by the named spec parameter. It
+// records an error and returns nil if the parameter is missing or invalid.
+func (p *Params) Child(name string) ds.Datastore {
+	var fields map[string]json.RawMessage
+	if !p.Decode(name, &fields) {
+		if !p.Has(name) {
+			p.Errorf("missing parameter %q", name)
+		}
+		return nil
+	}
+	d := p.st.build(p.path+"."+name, fields)
+	if d != nil {
+		p.children = append(p.children, d)
+	}
+	return d
+}
+
+// BatchingChild is like Child, but records an error if the datastore does not
+// support batching.
+func (p *Params) BatchingChild(name string) ds.Batching {
+	d := p.Child(name)
+	if d == nil {
+		return nil
+	}
+	bds, ok := d.(ds.Batching)
+	if !ok {
+		p.Errorf("parameter %q: datastore does not support batching", name)
+		return nil
+	}
+	return bds
+}
+
+// Transform builds the key transform described by the named spec parameter.
+func (p *Params) Transform(name string) keytransform.KeyTransform {
+	var fields map[string]json.RawMessage
+	if !p.Decode(name, &fields) {
+		if !p.Has(name) {
+			p.Errorf("missing parameter %q", name)
+		}
+		return nil
+	}
+	tp := p.st.newParams(p.path+"."+name, fields)
+	typ := tp.String("type", "")
+	ctor, ok := transformConstructors[typ]
+	if !ok {
+		var known []string
+		for name := range transformConstructors {
+			known = append(known, name)
+		}
+		slices.Sort(known)
+		tp.Errorf("unknown transform type %q (known: %s)", typ, strings.Join(known, ", "))
+		return nil
+	}
+	nerrs := len(p.st.errs)
+	t, err := ctor(tp)
+	if err != nil {
+		if len(p.st.errs) == nerrs {
+			tp.Errorf("%s: %v", typ, err)
+		}
+		return nil
+	}
+	return t
+}
+
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
@@ -0,0 +1,170 @@
+package config_test
+
+import (
+	"context"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/config"
+	"github.com/ipfs/go-datastore/mount"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuild(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	d, err := config.Build(ctx, []byte(`{
+		"type": "mount",
+		"mounts": [
+			{"prefix": "/files", "child": {"type": "fs", "path": "`+dir+`"}},
+			{"prefix": "/", "child": {
+				"type": "sync",
+				"child": {
+					"type": "keytransform",
+					"transform": {"type": "prefix", "prefix": "/kt"},
+					"child": {"type": "namespace", "prefix": "/ns", "child": {"type": "mem"}}
+				}
+			}}
+		]
+	}`))
+	require.NoError(t, err)
+	m, ok := ds.Find[*mount.Datastore](d)
+	require.True(t, ok)
+	require.Same(t, d.(ds.Shim).Children()[0], m)
+
+	require.NoError(t, d.Put(ctx, ds.NewKey("/files/a"), []byte("file")))
+	require.NoError(t, d.Put(ctx, ds.NewKey("/other"), []byte("mem")))
+	v, err := d.Get(ctx, ds.NewKey("/files/a"))
+	require.NoError(t, err)
+	require.Equal(t, "file", string(v))
+	require.FileExists(t, dir+"/a/.dsobject")
+	require.NoError(t, d.Close())
+}
+
+func TestBuildEscapedFS(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	d, err := config.Build(ctx, []byte(`{
+		"type": "keytransform",
+		"transform": {"type": "case-insensitive"},
+		"child": {
+			"type": "keytransform",
+			"transform": {"type": "shard", "func": "next-to-last", "length": 2},
+			"child": {"type": "fs", "path": "`+dir+`"}
+		}
+	}`))
+	require.NoError(t, err)
+	require.NoError(t, d.Put(ctx, ds.NewKey("/Blocks/ciqabcd"), []byte("v")))
+	require.FileExists(t, dir+"/%42locks/bc/ciqabcd/.dsobject")
+	require.NoError(t, d.Close())
+}
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+
+	names := func(features []ds.Feature) []string {
+		var names []string
+		for _, f := range features {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	features, err := config.Validate(ctx, []byte(`{
+		"type": "retrystore", "retries": 2, "delay": "1ms",
+		"child": {"type": "trace", "child": {"type": "mem"}}
+	}`))
+	require.NoError(t, err)
+	require.Equal(t, []string{ds.FeatureNameBatching}, names(features))
+
+	// Wrappers keep the features of the datastores they wrap.
+	features, err = config.Validate(ctx, []byte(`{
+		"type": "retrystore", "retries": 2, "delay": "1ms",
+		"child": {"type": "trace", "child": {"type": "null"}}
+	}`))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		ds.FeatureNameBatching, ds.FeatureNameChecked, ds.FeatureNameGC,
+		ds.FeatureNamePersistent, ds.FeatureNameScrubbed, ds.FeatureNameTransaction,
+	}, names(features))
+
+	_, err = config.Validate(ctx, []byte(`{"type": "autobatch", "child": {"type": "log", "child": {"type": "mem"}}}`))
+	require.NoError(t, err)
+
+	_, err = config.Validate(ctx, []byte(`{"type": "retrystore", "child": {"type": "autobatch", "child": {"type": "mem"}}}`))
+	require.ErrorContains(t, err, `config: .: parameter "child": datastore does not support batching`)
+}
+
+func TestBuildErrors(t *testing.T) {
+	ctx := context.Background()
+
+	cases := []struct {
+		name string
+		spec string
+		errs []string
+	}{
+		{
+			name: "unknown type",
+			spec: `{"type": "sync", "child": {"type": "nope"}}`,
+			errs: []string{`config: .child: unknown type "nope"`},
+		},
+		{
+			name: "missing and unknown parameters",
+			spec: `{"type": "mount", "mounts": [{"child": {"type": "mem", "size": 3}}], "extra": true}`,
+			errs: []string{
+				`config: .mounts[0]: missing parameter "prefix"`,
+				`config: .mounts[0].child: unknown parameter "size"`,
+				`config: .: unknown parameter "extra"`,
+			},
+		},
+		{
+			name: "mistyped parameter",
+			spec: `{"type": "delayed", "delay": "soon", "child": {"type": "autobatch", "size": "big", "child": {"type": "mem"}}}`,
+			errs: []string{
+				`config: .: parameter "delay": time: invalid duration "soon"`,
+				`config: .child: parameter "size"`,
+			},
+		},
+		{
+			name: "constructor error",
+			spec: `{"type": "fs", "path": "/does/not/exist"}`,
+			errs: []string{`config: .: fs: failed to find directory`},
+		},
+		{
+			name: "unknown transform",
+			spec: `{"type": "keytransform", "transform": {"type": "rot13"}, "child": {"type": "mem"}}`,
+			errs: []string{`config: .transform: unknown transform type "rot13"`},
+		},
+		{
+			name: "unknown shard function",
+			spec: `{"type": "keytransform", "transform": {"type": "shard", "func": "prefix/2"}, "child": {"type": "mem"}}`,
+			errs: []string{`config: .transform: parameter "func": unknown shard function "prefix/2"`},
+		},
+		{
+			name: "invalid shard length",
+			spec: `{"type": "keytransform", "transform": {"type": "shard", "func": "hash", "length": 0}, "child": {"type": "mem"}}`,
+			errs: []string{`config: .transform: parameter "length": must be positive`},
+		},
+		{
+			name: "unknown key policy",
+			spec: `{"type": "trace", "keys": "encrypted", "child": {"type": "mem"}}`,
+			errs: []string{`config: .: parameter "keys": unknown key policy "encrypted"`},
+		},
+		{
+			name: "missing type",
+			spec: `{"child": {"type": "mem"}}`,
+			errs: []string{`config: .: missing type`},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := config.Build(ctx, []byte(c.spec))
+			require.Error(t, err)
+			for _, e := range c.errs {
+				require.ErrorContains(t, err, e)
+			}
+		})
+	}
+}
@@ -3,21 +3,30 @@ package contextds
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
+	"github.com/ipfs/go-datastore/scoped"
 )
 
 var _ datastore.Datastore = (*Datastore)(nil)
 var _ datastore.Batching = (*Datastore)(nil)
 var _ datastore.TxnDatastore = (*Datastore)(nil)
+var _ datastore.Shim = (*Datastore)(nil)
+var _ datastore.PersistentDatastore = (*Datastore)(nil)
+var _ datastore.CheckedDatastore = (*Datastore)(nil)
+var _ datastore.ScrubbedDatastore = (*Datastore)(nil)
+var _ datastore.GCDatastore = (*Datastore)(nil)
+var _ datastore.TTLDatastore = (*Datastore)(nil)
 
 // WrapsDatastore wraps around the given datastore.Datastore making its operations context-aware
 // It intercepts datastore operations routing them to the current Write or Read if one exists on the context.
+// The returned datastore implements the optional features implemented by ds.
 func WrapDatastore(ds datastore.Datastore) datastore.Datastore {
-	return &Datastore{
+	return scoped.Inherit(&Datastore{
 		inner: ds,
-	}
+	})
 }
 
 // Datastore is a wrapper around a datastore.Datastore that provides context-aware operations.
@@ -26,6 +35,11 @@ type Datastore struct {
 	inner datastore.Datastore
 }
 
+// Children implements datastore.Shim
+func (ds *Datastore) Children() []datastore.Datastore {
+	return []datastore.Datastore{ds.inner}
+}
+
 func (ds *Datastore) Put(ctx context.Context, key datastore.Key, value []byte) error {
 	if write, ok := GetWrite(ctx); ok {
 		return write.Put(ctx, key, value)
@@ -93,3 +107,69 @@ func (ds *Datastore) NewTransaction(ctx context.Context, readOnly bool) (datasto
 
 	return tds.NewTransaction(ctx, readOnly)
 }
+
+func (ds *Datastore) DiskUsage(ctx context.Context) (uint64, error) {
+	return datastore.DiskUsage(ctx, ds.inner)
+}
+
+func (ds *Datastore) Check(ctx context.Context) error {
+	if c, ok := ds.inner.(datastore.CheckedDatastore); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+func (ds *Datastore) Scrub(ctx context.Context) error {
+	if c, ok := ds.inner.(datastore.ScrubbedDatastore); ok {
+		return c.Scrub(ctx)
+	}
+	return nil
+}
+
+func (ds *Datastore) CollectGarbage(ctx context.Context) error {
+	if c, ok := ds.inner.(datastore.GCDatastore); ok {
+		return c.CollectGarbage(ctx)
+	}
+	return nil
+}
+
+// ttlWrite returns the TTL implementation for writes: the current Write if
+// one exists on the context, else the inner datastore.
+func (ds *Datastore) ttlWrite(ctx context.Context) (datastore.TTL, bool) {
+	if write, ok := GetWrite(ctx); ok {
+		ttl, ok := write.(datastore.TTL)
+		return ttl, ok
+	}
+	ttl, ok := ds.inner.(datastore.TTL)
+	return ttl, ok
+}
+
+func (ds *Datastore) PutWithTTL(ctx context.Context, key datastore.Key, value []byte, ttl time.Duration) error {
+	t, ok := ds.ttlWrite(ctx)
+	if !ok {
+		return datastore.ErrTTLUnsupported
+	}
+	return t.PutWithTTL(ctx, key, value, ttl)
+}
+
+func (ds *Datastore) SetTTL(ctx context.Context, key datastore.Key, ttl time.Duration) error {
+	t, ok := ds.ttlWrite(ctx)
+	if !ok {
+		return datastore.ErrTTLUnsupported
+	}
+	return t.SetTTL(ctx, key, ttl)
+}
+
+func (ds *Datastore) GetExpiration(ctx context.Context, key datastore.Key) (time.Time, error) {
+	var t datastore.TTL
+	var ok bool
+	if read, rok := GetRead(ctx); rok {
+		t, ok = read.(datastore.TTL)
+	} else {
+		t, ok = ds.inner.(datastore.TTL)
+	}
+	if !ok {
+		return time.Time{}, datastore.ErrTTLUnsupported
+	}
+	return t.GetExpiration(ctx, key)
+}
@@ -0,0 +1,252 @@
+// Package crash implements an in-memory datastore for durability testing. It
+// tracks which writes were made durable by Sync, and can simulate a power loss
+// that discards the others.
+package crash
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"math/rand/v2"
+	"sync"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+// ErrCrashed is returned when committing a batch created before a crash.
+var ErrCrashed = errors.New("crash: batch created before a crash")
+
+// Loss describes the un-synced writes lost in a crash.
+type Loss struct {
+	// Survive is the probability of each un-synced write surviving the
+	// crash. With 0, all un-synced writes are lost.
+	Survive float64
+	// Torn lets the writes of a committed batch survive independently of
+	// each other, instead of all or none of them.
+	Torn bool
+}
+
+// write is an un-synced write. Writes of the same batch share a batch number;
+// other writes have batch 0.
+type write struct {
+	key    ds.Key
+	value  []byte
+	delete bool
+	batch  int
+}
+
+// Datastore is a thread-safe in-memory datastore whose writes only become
+// durable when a Sync covering their key is called.
+type Datastore struct {
+	mu      sync.Mutex
+	durable map[ds.Key][]byte
+	current map[ds.Key][]byte
+	pending []write
+	batches int
+	crashes int
+	rng     *rand.Rand
+}
+
+var (
+	_ ds.Datastore = (*Datastore)(nil)
+	_ ds.Batching  = (*Datastore)(nil)
+)
+
+// New returns an empty crash datastore. Lost writes are chosen with a random
+// source seeded with seed, so that crashes reproduce.
+func New(seed uint64) *Datastore {
+	return &Datastore{
+		durable: make(map[ds.Key][]byte),
+		current: make(map[ds.Key][]byte),
+		rng:     rand.New(rand.NewPCG(seed, seed)),
+	}
+}
+
+// Crash simulates a power loss and reboot: the un-synced writes are discarded,
+// except those surviving according to loss, and the remaining state becomes
+// durable. Batches created before the crash fail to commit with ErrCrashed.
+func (d *Datastore) Crash(loss Loss) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	survived := make(map[int]bool)
+	for _, w := range d.pending {
+		var survives bool
+		if w.batch != 0 && !loss.Torn {
+			var seen bool
+			survives, seen = survived[w.batch]
+			if !seen {
+				survives = d.survives(loss)
+				survived[w.batch] = survives
+			}
+		} else {
+			survives = d.survives(loss)
+		}
+		if survives {
+			apply(d.durable, w)
+		}
+	}
+
+	d.pending = nil
+	d.current = maps.Clone(d.durable)
+	d.crashes++
+}
+
+func (d *Datastore) survives(loss Loss) bool {
+	return loss.Survive > 0 && d.rng.Float64() < loss.Survive
+}
+
+// Crashes returns the number of times the datastore crashed.
+func (d *Datastore) Crashes() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.crashes
+}
+
+// Unsynced returns the number of writes that would be lost in a crash.
+func (d *Datastore) Unsynced() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pending)
+}
+
+func apply(m map[ds.Key][]byte, w write) {
+	if w.delete {
+		delete(m, w.key)
+	} else {
+		m[w.key] = w.value
+	}
+}
+
+// write applies w and records it as un-synced. d.mu must be held.
+func (d *Datastore) write(w write) {
+	apply(d.current, w)
+	d.pending = append(d.pending, w)
+}
+
+// Put implements Datastore.Put
+func (d *Datastore) Put(ctx context.Context, key ds.Key, value []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.write(write{key: key, value: append([]byte{}, value...)})
+	return nil
+}
+
+// Delete implements Datastore.Delete
+func (d *Datastore) Delete(ctx context.Context, key ds.Key) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.write(write{key: key, delete: true})
+	return nil
+}
+
+// Sync implements Datastore.Sync, making the writes to prefix and its
+// descendants durable.
+func (d *Datastore) Sync(ctx context.Context, prefix ds.Key) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	root := prefix.String() == "/"
+	pending := d.pending[:0]
+	for _, w := range d.pending {
+		if root || w.key == prefix || prefix.IsAncestorOf(w.key) {
+			apply(d.durable, w)
+		} else {
+			pending = append(pending, w)
+		}
+	}
+	clear(d.pending[len(pending):])
+	d.pending = pending
+	return nil
+}
+
+// Get implements Datastore.Get
+func (d *Datastore) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	val, found := d.current[key]
+	if !found {
+		return nil, ds.ErrNotFound
+	}
+	return val, nil
+}
+
+// Has implements Datastore.Has
+func (d *Datastore) Has(ctx context.Context, key ds.Key) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, found := d.current[key]
+	return found, nil
+}
+
+// GetSize implements Datastore.GetSize
+func (d *Datastore) GetSize(ctx context.Context, key ds.Key) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if v, found := d.current[key]; found {
+		return len(v), nil
+	}
+	return -1, ds.ErrNotFound
+}
+
+// Query implements Datastore.Query
+func (d *Datastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	re := make([]dsq.Entry, 0, len(d.current))
+	for k, v := range d.current {
+		e := dsq.Entry{Key: k.String(), Size: len(v)}
+		if !q.KeysOnly {
+			e.Value = v
+		}
+		re = append(re, e)
+	}
+	r := dsq.ResultsWithEntries(q, re)
+	r = dsq.NaiveQueryApply(q, r)
+	return r, nil
+}
+
+// Batch implements Batching.Batch. Committed batches are applied atomically,
+// but only become durable when synced.
+func (d *Datastore) Batch(ctx context.Context) (ds.Batch, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return &batch{d: d, crashes: d.crashes}, nil
+}
+
+// Close implements Datastore.Close
+func (d *Datastore) Close() error {
+	return nil
+}
+
+type batch struct {
+	d       *Datastore
+	crashes int
+	writes  []write
+}
+
+func (b *batch) Put(ctx context.Context, key ds.Key, value []byte) error {
+	b.writes = append(b.writes, write{key: key, value: append([]byte{}, value...)})
+	return nil
+}
+
+func (b *batch) Delete(ctx context.Context, key ds.Key) error {
+	b.writes = append(b.writes, write{key: key, delete: true})
+	return nil
+}
+
+func (b *batch) Commit(ctx context.Context) error {
+	b.d.mu.Lock()
+	defer b.d.mu.Unlock()
+	if b.crashes != b.d.crashes {
+		return ErrCrashed
+	}
+	b.d.batches++
+	for _, w := range b.writes {
+		w.batch = b.d.batches
+		b.d.write(w)
+	}
+	b.writes = nil
+	return nil
+}
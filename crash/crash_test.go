@@ -0,0 +1,139 @@
+package crash_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/crash"
+	"github.com/ipfs/go-datastore/namespace"
+	dstest "github.com/ipfs/go-datastore/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCrashAll(t *testing.T) {
+	dstest.SubtestAll(t, crash.New(1))
+}
+
+func has(t *testing.T, d ds.Datastore, key string) bool {
+	ok, err := d.Has(context.Background(), ds.NewKey(key))
+	require.NoError(t, err)
+	return ok
+}
+
+func TestSyncPrefix(t *testing.T) {
+	ctx := context.Background()
+	d := crash.New(1)
+
+	require.NoError(t, d.Put(ctx, ds.NewKey("/a/1"), []byte("1")))
+	require.NoError(t, d.Put(ctx, ds.NewKey("/b/1"), []byte("1")))
+	require.NoError(t, d.Put(ctx, ds.NewKey("/a"), []byte("a")))
+	require.NoError(t, d.Sync(ctx, ds.NewKey("/a")))
+	require.Equal(t, 1, d.Unsynced())
+
+	d.Crash(crash.Loss{})
+	require.True(t, has(t, d, "/a"))
+	require.True(t, has(t, d, "/a/1"))
+	require.False(t, has(t, d, "/b/1"))
+	require.Equal(t, 1, d.Crashes())
+
+	// Un-synced deletes are lost too.
+	require.NoError(t, d.Delete(ctx, ds.NewKey("/a")))
+	require.False(t, has(t, d, "/a"))
+	d.Crash(crash.Loss{})
+	require.True(t, has(t, d, "/a"))
+
+	require.NoError(t, d.Delete(ctx, ds.NewKey("/a")))
+	require.NoError(t, d.Sync(ctx, ds.NewKey("/")))
+	d.Crash(crash.Loss{})
+	require.False(t, has(t, d, "/a"))
+}
+
+func TestCrashLoss(t *testing.T) {
+	ctx := context.Background()
+
+	survivors := func(seed uint64, loss crash.Loss) []bool {
+		d := crash.New(seed)
+		b, err := d.Batch(ctx)
+		require.NoError(t, err)
+		for i := range 32 {
+			require.NoError(t, b.Put(ctx, ds.NewKey(fmt.Sprintf("/batch/%d", i)), nil))
+			require.NoError(t, d.Put(ctx, ds.NewKey(fmt.Sprintf("/single/%d", i)), nil))
+		}
+		require.NoError(t, b.Commit(ctx))
+		d.Crash(loss)
+
+		var out []bool
+		for i := range 32 {
+			out = append(out, has(t, d, fmt.Sprintf("/batch/%d", i)))
+		}
+		for i := range 32 {
+			out = append(out, has(t, d, fmt.Sprintf("/single/%d", i)))
+		}
+		return out
+	}
+
+	loss := crash.Loss{Survive: 0.5}
+	got := survivors(3, loss)
+	require.Equal(t, got, survivors(3, loss))
+	// Batches survive as a whole, single writes independently.
+	for i := 1; i < 32; i++ {
+		require.Equal(t, got[0], got[i])
+	}
+	require.Contains(t, got[32:], true)
+	require.Contains(t, got[32:], false)
+
+	torn := survivors(3, crash.Loss{Survive: 0.5, Torn: true})
+	require.Contains(t, torn[:32], true)
+	require.Contains(t, torn[:32], false)
+}
+
+func TestBatchAcrossCrash(t *testing.T) {
+	ctx := context.Background()
+	d := crash.New(1)
+
+	b, err := d.Batch(ctx)
+	require.NoError(t, err)
+	require.NoError(t, b.Put(ctx, ds.NewKey("/a"), nil))
+	d.Crash(crash.Loss{})
+	require.ErrorIs(t, b.Commit(ctx), crash.ErrCrashed)
+}
+
+func TestRunCrashWorkload(t *testing.T) {
+	for _, loss := range []crash.Loss{{}, {Survive: 0.5}, {Survive: 0.5, Torn: true}} {
+		t.Run(fmt.Sprintf("%+v", loss), func(t *testing.T) {
+			dstest.RunCrashWorkload(t, dstest.CrashWorkload{
+				Seed:             42,
+				Steps:            200,
+				CrashProbability: 0.1,
+				Loss:             loss,
+				Open: func(ctx context.Context, d *crash.Datastore) (ds.Datastore, error) {
+					return namespace.Wrap(d, ds.NewKey("/ns")), nil
+				},
+				Step: func(ctx context.Context, d ds.Datastore, i int, ack func(ds.Key, []byte)) error {
+					key := ds.NewKey(fmt.Sprintf("/k/%d", i%16))
+					value := []byte(fmt.Sprint(i))
+					if i%3 == 0 {
+						// Writes that are never synced must not be acknowledged.
+						return d.Put(ctx, ds.NewKey(fmt.Sprintf("/scratch/%d", i)), value)
+					}
+					if err := d.Put(ctx, key, value); err != nil {
+						return err
+					}
+					if err := d.Sync(ctx, key); err != nil {
+						return err
+					}
+					ack(key, value)
+					return nil
+				},
+				Check: func(ctx context.Context, d ds.Datastore) error {
+					if _, err := d.Get(ctx, ds.NewKey("/k/0")); err != nil && err != ds.ErrNotFound {
+						return err
+					}
+					return nil
+				},
+			})
+		})
+	}
+}
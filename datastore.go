@@ -154,6 +154,14 @@ type Batching interface {
 // actually support batching.
 var ErrBatchUnsupported = errors.New("this datastore does not support batching")
 
+// ErrTxnUnsupported is returned by NewTransaction if the Datastore doesn't
+// actually support transactions.
+var ErrTxnUnsupported = errors.New("this datastore does not support transactions")
+
+// ErrTTLUnsupported is returned by the TTL methods if the Datastore doesn't
+// actually support expiring entries.
+var ErrTTLUnsupported = errors.New("this datastore does not support TTLs")
+
 // CheckedDatastore is an interface that should be implemented by datastores
 // which may need checking on-disk data integrity.
 type CheckedDatastore interface {
@@ -5,68 +5,166 @@ package delayed
 import (
 	"context"
 	"io"
+	"time"
 
 	ds "github.com/ipfs/go-datastore"
 	dsq "github.com/ipfs/go-datastore/query"
 	delay "github.com/ipfs/go-ipfs-delay"
 )
 
-// New returns a new delayed datastore.
-func New(ds ds.Datastore, delay delay.D) *Delayed {
-	return &Delayed{ds: ds, delay: delay}
+// New returns a new delayed datastore, delaying every operation by dl.
+//
+// The returned datastore implements every optional feature and delays it too;
+// use scoped.Inherit to only expose the features the inner datastore supports.
+// Batching works on any datastore and can be kept by naming it:
+//
+//	scoped.Inherit(delayed.New(d, dl), ds.FeatureNameBatching)
+func New(ds ds.Datastore, dl delay.D) *Delayed {
+	return NewModel(ds, Model{Default: Profile{Latency: FromDelay(dl)}})
+}
+
+// NewModel returns a new delayed datastore, delaying operations according to
+// m. See New for the features it implements.
+func NewModel(ds ds.Datastore, m Model) *Delayed {
+	dds := &Delayed{ds: ds, model: m}
+	if dds.model.Clock == nil {
+		dds.model.Clock = RealClock{}
+	}
+	if m.Concurrency > 0 {
+		dds.slots = make(chan struct{}, m.Concurrency)
+	}
+	return dds
 }
 
 // Delayed is an adapter that delays operations on the inner datastore.
 type Delayed struct {
 	ds    ds.Datastore
-	delay delay.D
+	model Model
+	slots chan struct{}
 }
 
 var _ ds.Datastore = (*Delayed)(nil)
 var _ ds.Batching = (*Delayed)(nil)
 var _ ds.PersistentDatastore = (*Delayed)(nil)
+var _ ds.CheckedDatastore = (*Delayed)(nil)
+var _ ds.ScrubbedDatastore = (*Delayed)(nil)
+var _ ds.GCDatastore = (*Delayed)(nil)
+var _ ds.TTLDatastore = (*Delayed)(nil)
+var _ ds.TxnDatastore = (*Delayed)(nil)
 var _ io.Closer = (*Delayed)(nil)
+var _ ds.Shim = (*Delayed)(nil)
+
+// profile returns the profile of op.
+func (dds *Delayed) profile(op string) *Profile {
+	if p, ok := dds.model.Ops[op]; ok {
+		return &p
+	}
+	return &dds.model.Default
+}
+
+// wait delays a call of op transferring size bytes.
+func (dds *Delayed) wait(ctx context.Context, op string, size int) error {
+	p := dds.profile(op)
+	return dds.sleep(ctx, p.delay(p.Latency, size))
+}
+
+// sleep waits for d, queueing for a slot first if concurrency is limited.
+func (dds *Delayed) sleep(ctx context.Context, d time.Duration) error {
+	if dds.slots != nil {
+		select {
+		case dds.slots <- struct{}{}:
+			defer func() { <-dds.slots }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return dds.model.Clock.Sleep(ctx, d)
+}
+
+// results delays each result of a query of op.
+func (dds *Delayed) results(ctx context.Context, op string, res dsq.Results) dsq.Results {
+	p := dds.profile(op)
+	if p.PerResult == nil && p.Bandwidth == 0 {
+		return res
+	}
+	return dsq.ResultsFromIterator(res.Query(), dsq.Iterator{
+		Next: func() (dsq.Result, bool) {
+			r, ok := res.NextSync()
+			if ok && r.Error == nil {
+				if err := dds.sleep(ctx, p.delay(p.PerResult, len(r.Value))); err != nil {
+					return dsq.Result{Error: err}, true
+				}
+			}
+			return r, ok
+		},
+		Close: res.Close,
+	})
+}
+
+// Children implements ds.Shim
+func (dds *Delayed) Children() []ds.Datastore {
+	return []ds.Datastore{dds.ds}
+}
 
 // Put implements the ds.Datastore interface.
 func (dds *Delayed) Put(ctx context.Context, key ds.Key, value []byte) (err error) {
-	dds.delay.Wait()
+	if err := dds.wait(ctx, "put", len(value)); err != nil {
+		return err
+	}
 	return dds.ds.Put(ctx, key, value)
 }
 
 // Sync implements Datastore.Sync
 func (dds *Delayed) Sync(ctx context.Context, prefix ds.Key) error {
-	dds.delay.Wait()
+	if err := dds.wait(ctx, "sync", 0); err != nil {
+		return err
+	}
 	return dds.ds.Sync(ctx, prefix)
 }
 
 // Get implements the ds.Datastore interface.
 func (dds *Delayed) Get(ctx context.Context, key ds.Key) (value []byte, err error) {
-	dds.delay.Wait()
-	return dds.ds.Get(ctx, key)
+	value, err = dds.ds.Get(ctx, key)
+	if werr := dds.wait(ctx, "get", len(value)); werr != nil {
+		return nil, werr
+	}
+	return value, err
 }
 
 // Has implements the ds.Datastore interface.
 func (dds *Delayed) Has(ctx context.Context, key ds.Key) (exists bool, err error) {
-	dds.delay.Wait()
+	if err := dds.wait(ctx, "has", 0); err != nil {
+		return false, err
+	}
 	return dds.ds.Has(ctx, key)
 }
 
 // GetSize implements the ds.Datastore interface.
 func (dds *Delayed) GetSize(ctx context.Context, key ds.Key) (size int, err error) {
-	dds.delay.Wait()
+	if err := dds.wait(ctx, "getsize", 0); err != nil {
+		return -1, err
+	}
 	return dds.ds.GetSize(ctx, key)
 }
 
 // Delete implements the ds.Datastore interface.
 func (dds *Delayed) Delete(ctx context.Context, key ds.Key) (err error) {
-	dds.delay.Wait()
+	if err := dds.wait(ctx, "delete", 0); err != nil {
+		return err
+	}
 	return dds.ds.Delete(ctx, key)
 }
 
 // Query implements the ds.Datastore interface.
 func (dds *Delayed) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
-	dds.delay.Wait()
-	return dds.ds.Query(ctx, q)
+	if err := dds.wait(ctx, "query", 0); err != nil {
+		return nil, err
+	}
+	res, err := dds.ds.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return dds.results(ctx, "query", res), nil
 }
 
 // Batch implements the ds.Batching interface.
@@ -76,10 +174,98 @@ func (dds *Delayed) Batch(ctx context.Context) (ds.Batch, error) {
 
 // DiskUsage implements the ds.PersistentDatastore interface.
 func (dds *Delayed) DiskUsage(ctx context.Context) (uint64, error) {
-	dds.delay.Wait()
+	if err := dds.wait(ctx, "disk-usage", 0); err != nil {
+		return 0, err
+	}
 	return ds.DiskUsage(ctx, dds.ds)
 }
 
+// Check implements the ds.CheckedDatastore interface.
+func (dds *Delayed) Check(ctx context.Context) error {
+	if err := dds.wait(ctx, "check", 0); err != nil {
+		return err
+	}
+	if c, ok := dds.ds.(ds.CheckedDatastore); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+// Scrub implements the ds.ScrubbedDatastore interface.
+func (dds *Delayed) Scrub(ctx context.Context) error {
+	if err := dds.wait(ctx, "scrub", 0); err != nil {
+		return err
+	}
+	if c, ok := dds.ds.(ds.ScrubbedDatastore); ok {
+		return c.Scrub(ctx)
+	}
+	return nil
+}
+
+// CollectGarbage implements the ds.GCDatastore interface.
+func (dds *Delayed) CollectGarbage(ctx context.Context) error {
+	if err := dds.wait(ctx, "gc", 0); err != nil {
+		return err
+	}
+	if c, ok := dds.ds.(ds.GCDatastore); ok {
+		return c.CollectGarbage(ctx)
+	}
+	return nil
+}
+
+// PutWithTTL implements the ds.TTL interface.
+func (dds *Delayed) PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error {
+	if err := dds.wait(ctx, "put-with-ttl", len(value)); err != nil {
+		return err
+	}
+	tds, ok := dds.ds.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	return tds.PutWithTTL(ctx, key, value, ttl)
+}
+
+// SetTTL implements the ds.TTL interface.
+func (dds *Delayed) SetTTL(ctx context.Context, key ds.Key, ttl time.Duration) error {
+	if err := dds.wait(ctx, "set-ttl", 0); err != nil {
+		return err
+	}
+	tds, ok := dds.ds.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	return tds.SetTTL(ctx, key, ttl)
+}
+
+// GetExpiration implements the ds.TTL interface.
+func (dds *Delayed) GetExpiration(ctx context.Context, key ds.Key) (time.Time, error) {
+	if err := dds.wait(ctx, "get-expiration", 0); err != nil {
+		return time.Time{}, err
+	}
+	tds, ok := dds.ds.(ds.TTLDatastore)
+	if !ok {
+		return time.Time{}, ds.ErrTTLUnsupported
+	}
+	return tds.GetExpiration(ctx, key)
+}
+
+// NewTransaction implements the ds.TxnDatastore interface. Operations on the
+// transaction are delayed like operations on the datastore.
+func (dds *Delayed) NewTransaction(ctx context.Context, readOnly bool) (ds.Txn, error) {
+	if err := dds.wait(ctx, "txn", 0); err != nil {
+		return nil, err
+	}
+	tds, ok := dds.ds.(ds.TxnDatastore)
+	if !ok {
+		return nil, ds.ErrTxnUnsupported
+	}
+	txn, err := tds.NewTransaction(ctx, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &delayedTxn{txn: txn, dds: dds}, nil
+}
+
 // Close closes the inner datastore (if it implements the io.Closer interface).
 func (dds *Delayed) Close() error {
 	if closer, ok := dds.ds.(io.Closer); ok {
@@ -87,3 +273,66 @@ func (dds *Delayed) Close() error {
 	}
 	return nil
 }
+
+type delayedTxn struct {
+	txn ds.Txn
+	dds *Delayed
+}
+
+func (t *delayedTxn) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	value, err := t.txn.Get(ctx, key)
+	if werr := t.dds.wait(ctx, "txn-get", len(value)); werr != nil {
+		return nil, werr
+	}
+	return value, err
+}
+
+func (t *delayedTxn) Has(ctx context.Context, key ds.Key) (bool, error) {
+	if err := t.dds.wait(ctx, "txn-has", 0); err != nil {
+		return false, err
+	}
+	return t.txn.Has(ctx, key)
+}
+
+func (t *delayedTxn) GetSize(ctx context.Context, key ds.Key) (int, error) {
+	if err := t.dds.wait(ctx, "txn-getsize", 0); err != nil {
+		return -1, err
+	}
+	return t.txn.GetSize(ctx, key)
+}
+
+func (t *delayedTxn) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	if err := t.dds.wait(ctx, "txn-query", 0); err != nil {
+		return nil, err
+	}
+	res, err := t.txn.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return t.dds.results(ctx, "txn-query", res), nil
+}
+
+func (t *delayedTxn) Put(ctx context.Context, key ds.Key, value []byte) error {
+	if err := t.dds.wait(ctx, "txn-put", len(value)); err != nil {
+		return err
+	}
+	return t.txn.Put(ctx, key, value)
+}
+
+func (t *delayedTxn) Delete(ctx context.Context, key ds.Key) error {
+	if err := t.dds.wait(ctx, "txn-delete", 0); err != nil {
+		return err
+	}
+	return t.txn.Delete(ctx, key)
+}
+
+func (t *delayedTxn) Commit(ctx context.Context) error {
+	if err := t.dds.wait(ctx, "txn-commit", 0); err != nil {
+		return err
+	}
+	return t.txn.Commit(ctx)
+}
+
+func (t *delayedTxn) Discard(ctx context.Context) {
+	t.txn.Discard(ctx)
+}
@@ -2,12 +2,18 @@ package delayed
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"sync"
 	"testing"
 	"time"
 
 	datastore "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
 	dstest "github.com/ipfs/go-datastore/test"
 	delay "github.com/ipfs/go-ipfs-delay"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDelayed(t *testing.T) {
@@ -34,3 +40,109 @@ func TestDelayedAll(t *testing.T) {
 	// delays anything.
 	dstest.SubtestAll(t, New(datastore.NewMapDatastore(), delay.Fixed(0)))
 }
+
+func TestModelProfiles(t *testing.T) {
+	ctx := context.Background()
+	clock := &VirtualClock{}
+	d := NewModel(datastore.NewMapDatastore(), Model{
+		Default: Profile{Latency: Fixed(time.Millisecond)},
+		Ops: map[string]Profile{
+			"put":   {Latency: Fixed(10 * time.Millisecond), Bandwidth: 1000},
+			"query": {Latency: Fixed(time.Second), PerResult: Fixed(100 * time.Millisecond)},
+		},
+		Clock: clock,
+	})
+
+	// 10ms latency plus 500 bytes at 1000 bytes per second.
+	require.NoError(t, d.Put(ctx, datastore.NewKey("/a"), make([]byte, 500)))
+	require.Equal(t, 510*time.Millisecond, clock.Elapsed())
+
+	_, err := d.Has(ctx, datastore.NewKey("/a"))
+	require.NoError(t, err)
+	require.Equal(t, 511*time.Millisecond, clock.Elapsed())
+
+	require.NoError(t, d.Put(ctx, datastore.NewKey("/b"), nil))
+	res, err := d.Query(ctx, dsq.Query{})
+	require.NoError(t, err)
+	// The per-result delays are only paid as results are read.
+	require.Equal(t, 1521*time.Millisecond, clock.Elapsed())
+	entries, err := res.Rest()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, 1721*time.Millisecond, clock.Elapsed())
+}
+
+func TestModelCancel(t *testing.T) {
+	d := NewModel(datastore.NewMapDatastore(), Model{Default: Profile{Latency: Fixed(time.Hour)}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, d.Put(ctx, datastore.NewKey("/a"), nil), context.DeadlineExceeded)
+}
+
+// gateClock blocks sleepers until released, tracking how many sleep at once.
+type gateClock struct {
+	mu       sync.Mutex
+	sleeping int
+	peak     int
+	release  chan struct{}
+}
+
+func (c *gateClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	c.sleeping++
+	c.peak = max(c.peak, c.sleeping)
+	c.mu.Unlock()
+	<-c.release
+	c.mu.Lock()
+	c.sleeping--
+	c.mu.Unlock()
+	return nil
+}
+
+func TestModelConcurrency(t *testing.T) {
+	ctx := context.Background()
+	clock := &gateClock{release: make(chan struct{})}
+	d := NewModel(dssync.MutexWrap(datastore.NewMapDatastore()), Model{Concurrency: 2, Clock: clock})
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			require.NoError(t, d.Put(ctx, datastore.NewKey(fmt.Sprint(i)), nil))
+		})
+	}
+	require.Eventually(t, func() bool {
+		clock.mu.Lock()
+		defer clock.mu.Unlock()
+		return clock.sleeping == 2
+	}, time.Second, time.Millisecond)
+	for range 8 {
+		clock.release <- struct{}{}
+	}
+	wg.Wait()
+	require.Equal(t, 2, clock.peak)
+}
+
+func TestDistributions(t *testing.T) {
+	percentile := func(d Distribution, p float64) time.Duration {
+		samples := make([]time.Duration, 10000)
+		for i := range samples {
+			samples[i] = d.Next()
+		}
+		slices.Sort(samples)
+		return samples[int(p*float64(len(samples)))]
+	}
+
+	normal := Normal(10*time.Millisecond, time.Millisecond, 1)
+	require.InDelta(t, float64(10*time.Millisecond), float64(percentile(normal, 0.5)), float64(100*time.Microsecond))
+
+	tail := LongTail(time.Millisecond, 50*time.Millisecond, 1)
+	require.InEpsilon(t, float64(time.Millisecond), float64(percentile(tail, 0.5)), 0.1)
+	require.InEpsilon(t, float64(50*time.Millisecond), float64(percentile(tail, 0.99)), 0.2)
+
+	// Distributions are seeded.
+	a, b := LongTail(time.Millisecond, 50*time.Millisecond, 7), LongTail(time.Millisecond, 50*time.Millisecond, 7)
+	for range 10 {
+		require.Equal(t, a.Next(), b.Next())
+	}
+}
@@ -0,0 +1,169 @@
+package delayed
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	delay "github.com/ipfs/go-ipfs-delay"
+)
+
+// Model describes the latencies added by a delayed datastore.
+type Model struct {
+	// Default is the profile of operations without one in Ops.
+	Default Profile
+	// Ops holds the profiles of specific operations: put, get, has,
+	// getsize, delete, query, sync, disk-usage, check, scrub, gc,
+	// put-with-ttl, set-ttl, get-expiration, txn, txn-get, txn-has,
+	// txn-getsize, txn-query, txn-put, txn-delete and txn-commit.
+	Ops map[string]Profile
+	// Concurrency is the number of operations that can be delayed at once,
+	// like the queue depth of a slow disk. Further operations queue until
+	// one finishes. 0 means no limit.
+	Concurrency int
+	// Clock waits for the delays. Defaults to the real clock.
+	Clock Clock
+}
+
+// Profile describes the latency of an operation.
+type Profile struct {
+	// Latency is the fixed cost of each call.
+	Latency Distribution
+	// Bandwidth, in bytes per second, adds a delay proportional to the size
+	// of the values put or got. 0 means no limit.
+	Bandwidth float64
+	// PerResult delays each result of a query, on top of Bandwidth.
+	PerResult Distribution
+}
+
+// delay returns the time an operation with the profile takes to transfer
+// size bytes after its fixed latency.
+func (p *Profile) delay(lat Distribution, size int) time.Duration {
+	var d time.Duration
+	if lat != nil {
+		d = lat.Next()
+	}
+	if p.Bandwidth > 0 && size > 0 {
+		d += time.Duration(float64(size) / p.Bandwidth * float64(time.Second))
+	}
+	return d
+}
+
+// Distribution generates latencies.
+type Distribution interface {
+	Next() time.Duration
+}
+
+type fixed time.Duration
+
+func (f fixed) Next() time.Duration {
+	return time.Duration(f)
+}
+
+// Fixed returns a distribution that always returns d.
+func Fixed(d time.Duration) Distribution {
+	return fixed(d)
+}
+
+type fromDelay struct {
+	d delay.D
+}
+
+func (f fromDelay) Next() time.Duration {
+	return f.d.NextWaitTime()
+}
+
+// FromDelay returns a distribution drawing latencies from d.
+func FromDelay(d delay.D) Distribution {
+	return fromDelay{d: d}
+}
+
+// sampler draws latencies from a random source, safely for concurrent use.
+type sampler struct {
+	mu     sync.Mutex
+	rng    *rand.Rand
+	sample func(rng *rand.Rand) float64
+}
+
+func (s *sampler) Next() time.Duration {
+	s.mu.Lock()
+	v := s.sample(s.rng)
+	s.mu.Unlock()
+	return time.Duration(max(v, 0))
+}
+
+// Normal returns a normal distribution of latencies with the given mean and
+// standard deviation, drawn from a source seeded with seed. Negative samples
+// are clamped to 0.
+func Normal(mean, stddev time.Duration, seed uint64) Distribution {
+	return &sampler{
+		rng: rand.New(rand.NewPCG(seed, seed)),
+		sample: func(rng *rand.Rand) float64 {
+			return rng.NormFloat64()*float64(stddev) + float64(mean)
+		},
+	}
+}
+
+// LongTail returns a log-normal distribution of latencies whose median is p50
+// and 99th percentile is p99, drawn from a source seeded with seed. It models
+// the occasional slow calls of real disks and networks.
+func LongTail(p50, p99 time.Duration, seed uint64) Distribution {
+	// 2.326 is the 99th percentile of the standard normal distribution.
+	mu := math.Log(float64(p50))
+	sigma := (math.Log(float64(p99)) - mu) / 2.326
+	return &sampler{
+		rng: rand.New(rand.NewPCG(seed, seed)),
+		sample: func(rng *rand.Rand) float64 {
+			return math.Exp(mu + sigma*rng.NormFloat64())
+		},
+	}
+}
+
+// Clock waits for delays.
+type Clock interface {
+	// Sleep waits for d, or until ctx is done.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+// RealClock sleeps for real.
+type RealClock struct{}
+
+// Sleep implements Clock.
+func (RealClock) Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// VirtualClock doesn't sleep, but adds up the delays it is asked to wait for,
+// so that tests and benchmarks can measure the modelled latency without
+// waiting for it.
+type VirtualClock struct {
+	mu      sync.Mutex
+	elapsed time.Duration
+}
+
+// Sleep implements Clock.
+func (c *VirtualClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	c.elapsed += d
+	c.mu.Unlock()
+	return ctx.Err()
+}
+
+// Elapsed returns the total of the delays waited for.
+func (c *VirtualClock) Elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.elapsed
+}
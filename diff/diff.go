@@ -0,0 +1,114 @@
+// Package diff computes the difference between two datastores and applies it
+// as a patch to another.
+//
+// Differences are found with a merged scan over two key-ordered queries, so
+// both datastores are read exactly once and only the current entry of each is
+// held in memory:
+//
+//	for c, err := range diff.Diff(ctx, replica, primary, ds.NewKey("/")) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(c.Op, c.Key)
+//	}
+package diff
+
+import (
+	"bytes"
+	"context"
+	"iter"
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+// Op is the kind of a Change.
+type Op string
+
+const (
+	// Added means the key only exists in the target datastore.
+	Added Op = "add"
+	// Removed means the key only exists in the source datastore.
+	Removed Op = "remove"
+	// Changed means the key exists in both datastores with different values.
+	Changed Op = "change"
+)
+
+// Change is a single difference between two datastores.
+type Change struct {
+	Op  Op     `json:"op"`
+	Key ds.Key `json:"key"`
+	// Value is the value in the target datastore. It is nil for Removed.
+	Value []byte `json:"value,omitempty"`
+}
+
+// Diff returns the changes that turn the contents of from into the contents
+// of to, limited to keys under prefix. Changes are yielded in ascending key
+// order. If an error is yielded, iteration stops.
+//
+// A prefix of "/" (or the empty key) compares the whole datastore.
+func Diff(ctx context.Context, from, to ds.Read, prefix ds.Key) iter.Seq2[Change, error] {
+	q := dsq.Query{
+		Prefix: prefix.String(),
+		Orders: []dsq.Order{dsq.OrderByKey{}},
+	}
+	return func(yield func(Change, error) bool) {
+		nextFrom, stopFrom := iter.Pull2(ds.QueryIter(ctx, from, q))
+		defer stopFrom()
+		nextTo, stopTo := iter.Pull2(ds.QueryIter(ctx, to, q))
+		defer stopTo()
+
+		a, errA, okA := nextFrom()
+		b, errB, okB := nextTo()
+		for okA || okB {
+			if errA != nil {
+				yield(Change{}, errA)
+				return
+			}
+			if errB != nil {
+				yield(Change{}, errB)
+				return
+			}
+
+			cmp := 0
+			switch {
+			case !okA:
+				cmp = 1
+			case !okB:
+				cmp = -1
+			default:
+				cmp = strings.Compare(a.Key, b.Key)
+			}
+
+			switch {
+			case cmp < 0:
+				if !yield(Change{Op: Removed, Key: ds.RawKey(a.Key)}, nil) {
+					return
+				}
+				a, errA, okA = nextFrom()
+			case cmp > 0:
+				if !yield(Change{Op: Added, Key: ds.RawKey(b.Key), Value: b.Value}, nil) {
+					return
+				}
+				b, errB, okB = nextTo()
+			default:
+				if !bytes.Equal(a.Value, b.Value) {
+					if !yield(Change{Op: Changed, Key: ds.RawKey(b.Key), Value: b.Value}, nil) {
+						return
+					}
+				}
+				a, errA, okA = nextFrom()
+				b, errB, okB = nextTo()
+			}
+		}
+	}
+}
+
+// Equal reports whether from and to hold the same entries under prefix.
+func Equal(ctx context.Context, from, to ds.Read, prefix ds.Key) (bool, error) {
+	for _, err := range Diff(ctx, from, to, prefix) {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,122 @@
+package diff_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/diff"
+	"github.com/ipfs/go-datastore/failstore"
+	"github.com/stretchr/testify/require"
+)
+
+func fill(t *testing.T, d ds.Datastore, kv map[string]string) {
+	t.Helper()
+	for k, v := range kv {
+		require.NoError(t, d.Put(context.Background(), ds.NewKey(k), []byte(v)))
+	}
+}
+
+func collect(t *testing.T, from, to ds.Read, prefix string) []diff.Change {
+	t.Helper()
+	var changes []diff.Change
+	for c, err := range diff.Diff(context.Background(), from, to, ds.NewKey(prefix)) {
+		require.NoError(t, err)
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+func TestDiff(t *testing.T) {
+	from := ds.NewMapDatastore()
+	to := ds.NewMapDatastore()
+	fill(t, from, map[string]string{
+		"/a":     "1",
+		"/b":     "2",
+		"/c/d":   "3",
+		"/c/e":   "4",
+		"/other": "5",
+	})
+	fill(t, to, map[string]string{
+		"/a":   "1",
+		"/b":   "changed",
+		"/c/e": "4",
+		"/c/f": "6",
+	})
+
+	require.Equal(t, []diff.Change{
+		{Op: diff.Changed, Key: ds.NewKey("/b"), Value: []byte("changed")},
+		{Op: diff.Removed, Key: ds.NewKey("/c/d")},
+		{Op: diff.Added, Key: ds.NewKey("/c/f"), Value: []byte("6")},
+		{Op: diff.Removed, Key: ds.NewKey("/other")},
+	}, collect(t, from, to, "/"))
+
+	require.Equal(t, []diff.Change{
+		{Op: diff.Removed, Key: ds.NewKey("/c/d")},
+		{Op: diff.Added, Key: ds.NewKey("/c/f"), Value: []byte("6")},
+	}, collect(t, from, to, "/c"))
+
+	equal, err := diff.Equal(context.Background(), from, to, ds.NewKey("/a"))
+	require.NoError(t, err)
+	require.True(t, equal)
+	equal, err = diff.Equal(context.Background(), from, to, ds.NewKey("/"))
+	require.NoError(t, err)
+	require.False(t, equal)
+}
+
+func TestDiffQueryError(t *testing.T) {
+	errQuery := errors.New("query failed")
+	from := failstore.NewFailstore(ds.NewMapDatastore(), func(op string) error {
+		if op == "query" {
+			return errQuery
+		}
+		return nil
+	})
+	_, err := diff.Equal(context.Background(), from, ds.NewMapDatastore(), ds.NewKey("/"))
+	require.ErrorIs(t, err, errQuery)
+}
+
+func TestPatchRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	from := ds.NewMapDatastore()
+	to := ds.NewMapDatastore()
+	fill(t, from, map[string]string{"/a": "1", "/b": "2", "/c": "3"})
+	fill(t, to, map[string]string{"/a": "1", "/b": "two", "/d": "4"})
+
+	var buf bytes.Buffer
+	n, err := diff.WritePatch(&buf, diff.Diff(ctx, from, to, ds.NewKey("/")))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	n, err = diff.Apply(ctx, from, diff.ReadPatch(&buf))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	equal, err := diff.Equal(ctx, from, to, ds.NewKey("/"))
+	require.NoError(t, err)
+	require.True(t, equal)
+}
+
+func TestReadPatchInvalid(t *testing.T) {
+	patch := `{"op":"add","key":"/a","value":"MQ=="}
+{"op":"frobnicate","key":"/b"}
+`
+	var got []diff.Change
+	var err error
+	for c, e := range diff.ReadPatch(strings.NewReader(patch)) {
+		if e != nil {
+			err = e
+			break
+		}
+		got = append(got, c)
+	}
+	require.ErrorIs(t, err, diff.ErrInvalidChange)
+	require.ErrorContains(t, err, "entry 2")
+	require.Len(t, got, 1)
+
+	_, err = diff.Apply(context.Background(), ds.NewMapDatastore(), diff.ReadPatch(strings.NewReader(patch)))
+	require.ErrorIs(t, err, diff.ErrInvalidChange)
+}
@@ -0,0 +1,112 @@
+package diff
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// A patch is a stream of changes, encoded as one JSON object per line:
+//
+//	{"op":"add","key":"/foo","value":"YmFy"}
+//	{"op":"remove","key":"/baz"}
+//
+// Values are base64 encoded, as encoding/json does for byte slices.
+
+// ErrInvalidChange is returned when a patch contains a malformed change.
+var ErrInvalidChange = errors.New("diff: invalid change")
+
+// WritePatch writes the given changes to w in the patch format, returning
+// the number of changes written.
+func WritePatch(w io.Writer, changes iter.Seq2[Change, error]) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	n := 0
+	for c, err := range changes {
+		if err != nil {
+			return n, err
+		}
+		if err := enc.Encode(c); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, bw.Flush()
+}
+
+// ReadPatch returns the changes encoded in r. If an error is yielded,
+// iteration stops.
+func ReadPatch(r io.Reader) iter.Seq2[Change, error] {
+	return func(yield func(Change, error) bool) {
+		dec := json.NewDecoder(r)
+		for line := 1; ; line++ {
+			var c Change
+			err := dec.Decode(&c)
+			if err == io.EOF {
+				return
+			}
+			if err == nil {
+				err = c.validate()
+			}
+			if err != nil {
+				yield(Change{}, fmt.Errorf("reading patch entry %d: %w", line, err))
+				return
+			}
+			if !yield(c, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c Change) validate() error {
+	switch c.Op {
+	case Added, Changed, Removed:
+	default:
+		return fmt.Errorf("%w: unknown op %q", ErrInvalidChange, c.Op)
+	}
+	if c.Key.String() == "/" {
+		return fmt.Errorf("%w: missing key", ErrInvalidChange)
+	}
+	return nil
+}
+
+// Apply applies the given changes to dst in a single batch. Added and Changed
+// entries are put, Removed entries are deleted. Apply returns the number of
+// changes applied; nothing is committed if an error occurs before Commit.
+func Apply(ctx context.Context, dst ds.Batching, changes iter.Seq2[Change, error]) (int, error) {
+	b, err := dst.Batch(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for c, err := range changes {
+		if err != nil {
+			return 0, err
+		}
+		switch c.Op {
+		case Added, Changed:
+			err = b.Put(ctx, c.Key, c.Value)
+		case Removed:
+			err = b.Delete(ctx, c.Key)
+		default:
+			err = fmt.Errorf("%w: unknown op %q", ErrInvalidChange, c.Op)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("applying %s of %s: %w", c.Op, c.Key, err)
+		}
+		n++
+	}
+
+	if err := b.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
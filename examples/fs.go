@@ -12,6 +12,10 @@
 // Keys that only differ in case may be confused with each other on
 // case insensitive file systems, for example in OS X.
 //
+// Wrapping the datastore with keytransform.EscapeTransform, or
+// keytransform.CaseInsensitiveTransform, makes any key safe, and
+// keytransform.ShardTransform avoids large directories.
+//
 // This package is intended for exploratory use, where the user would
 // examine the file system manually, and should only be used with
 // human-friendly, trusted keys. You have been warned.
@@ -2,9 +2,14 @@ package examples
 
 import (
 	"context"
+	iofs "io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/keytransform"
 	query "github.com/ipfs/go-datastore/query"
 	"github.com/stretchr/testify/require"
 )
@@ -99,6 +104,71 @@ func TestDiskUsage(t *testing.T) {
 	require.Equal(t, uint64(totalBytes), s, "unexpected size")
 }
 
+func TestEscapedKeys(t *testing.T) {
+	ctx := context.Background()
+
+	keys := []ds.Key{
+		ds.RawKey("/."), ds.RawKey("/foo/.."), ds.NewKey("/.dsobject"), ds.NewKey("/foo\x00bar"),
+		ds.NewKey("/Foo"), ds.NewKey("/foo"), ds.NewKey("/foo/Bar"), ds.NewKey("/foo/bar"),
+		ds.NewKey("/CIQABCD"), ds.NewKey("/x"),
+	}
+
+	for _, tc := range []struct {
+		tr       keytransform.KeyTransform
+		foldCase bool
+	}{
+		{keytransform.EscapeTransform{}, false},
+		{keytransform.EscapeTransform{Base32: true}, true},
+		{keytransform.CaseInsensitiveTransform{}, true},
+	} {
+		tr := tc.tr
+		dir := t.TempDir()
+		fs, err := NewDatastore(dir)
+		require.NoError(t, err)
+		sharded := keytransform.Wrap(fs, keytransform.ShardTransform{Shard: keytransform.NextToLast(2)})
+		dstore := keytransform.Wrap(sharded, tr)
+
+		for _, k := range keys {
+			require.NoError(t, dstore.Put(ctx, k, []byte(k.String())))
+		}
+		for _, k := range keys {
+			v, err := dstore.Get(ctx, k)
+			require.NoError(t, err)
+			require.Equal(t, k.String(), string(v))
+		}
+
+		r, err := dstore.Query(ctx, query.Query{Orders: []query.Order{query.OrderByKey{}}})
+		require.NoError(t, err)
+		all, err := r.Rest()
+		require.NoError(t, err)
+		var got []string
+		for _, e := range all {
+			require.Equal(t, e.Key, string(e.Value))
+			got = append(got, e.Key)
+		}
+		var want []string
+		for _, k := range keys {
+			want = append(want, k.String())
+		}
+		slices.Sort(want)
+		require.Equal(t, want, got, "%T", tr)
+
+		// Keys only differing in case have their own object file, even on
+		// case insensitive file systems.
+		var files []string
+		require.NoError(t, filepath.WalkDir(dir, func(path string, d iofs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				files = append(files, strings.ToLower(path))
+			}
+			return err
+		}))
+		if tc.foldCase {
+			slices.Sort(files)
+			require.Len(t, slices.Compact(files), len(keys), "%T", tr)
+		}
+	}
+}
+
 func strsToKeys(strs []string) []ds.Key {
 	keys := make([]ds.Key, len(strs))
 	for i, s := range strs {
@@ -0,0 +1,28 @@
+package datastore
+
+import (
+	"fmt"
+
+	"github.com/ipfs/go-datastore/query"
+)
+
+// Explain describes how d runs q. Datastores implementing query.Explainer
+// describe themselves, along with the datastores they wrap, and those
+// implementing query.Capable are described by query.Plan. Others are assumed
+// to execute the whole query natively.
+func Explain(d Read, q query.Query) query.Explain {
+	var e query.Explain
+	switch d := d.(type) {
+	case query.Explainer:
+		e = d.ExplainQuery(q)
+	case query.Capable:
+		e = query.Plan(q, d.QueryCapabilities())
+	default:
+		e = query.Explain{Query: q, Native: q}
+		e.Notef("the datastore does not describe how it runs queries")
+	}
+	if e.Datastore == "" {
+		e.Datastore = fmt.Sprintf("%T", d)
+	}
+	return e
+}
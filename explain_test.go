@@ -0,0 +1,24 @@
+package datastore_test
+
+import (
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	q := dsq.Query{Prefix: "/a", Orders: []dsq.Order{dsq.OrderByKey{}}, Limit: 1}
+
+	e := ds.Explain(ds.NewMapDatastore(), q)
+	require.Equal(t, "*datastore.MapDatastore", e.Datastore)
+	require.Equal(t, dsq.Query{}, e.Native)
+	require.Equal(t, q, e.Residual)
+
+	e = ds.Explain(ds.NewNullDatastore(), q)
+	require.Equal(t, "*datastore.NullDatastore", e.Datastore)
+	require.Equal(t, q, e.Native)
+	require.Equal(t, dsq.Query{}, e.Residual)
+	require.Len(t, e.Notes, 1)
+}
@@ -1,30 +1,46 @@
 // Package failstore implements a datastore which can produce
 // custom failures on operations by calling a user-provided
-// error function.
+// error function, or by applying fault injection rules.
 package failstore
 
 import (
 	"context"
+	"time"
 
 	ds "github.com/ipfs/go-datastore"
 	dsq "github.com/ipfs/go-datastore/query"
 )
 
 // Failstore is a datastore which fails according to a user-provided
-// function.
+// function or a set of rules.
 type Failstore struct {
 	child   ds.Datastore
 	errfunc func(string) error
+	rules   *injector
 }
 
 var _ ds.Datastore = (*Failstore)(nil)
 var _ ds.Batching = (*Failstore)(nil)
 var _ ds.PersistentDatastore = (*Failstore)(nil)
+var _ ds.CheckedDatastore = (*Failstore)(nil)
+var _ ds.ScrubbedDatastore = (*Failstore)(nil)
+var _ ds.GCDatastore = (*Failstore)(nil)
+var _ ds.TTLDatastore = (*Failstore)(nil)
+var _ ds.TxnDatastore = (*Failstore)(nil)
+var _ ds.Shim = (*Failstore)(nil)
 
 // NewFailstore creates a new datastore with the given error function.
 // The efunc will be called with different strings depending on the
-// datastore function: put, get, has, delete, query, batch, batch-put,
-// batch-delete and batch-commit are the possible values.
+// datastore function: put, get, has, getsize, delete, query, sync,
+// disk-usage, check, scrub, gc, put-with-ttl, set-ttl, get-expiration, batch,
+// batch-put, batch-delete, batch-commit, txn, txn-get, txn-has, txn-getsize,
+// txn-query, txn-put, txn-delete and txn-commit are the possible values.
+//
+// See NewRuleFailstore for failures depending on keys, call counts or chance,
+// and for latency, corruption and partial failures.
+//
+// The returned datastore implements every optional feature; use
+// scoped.Inherit to only expose the features c supports.
 func NewFailstore(c ds.Datastore, efunc func(string) error) *Failstore {
 	return &Failstore{
 		child:   c,
@@ -32,9 +48,22 @@ func NewFailstore(c ds.Datastore, efunc func(string) error) *Failstore {
 	}
 }
 
+// fail runs the error function or rules for a call of op on keys.
+func (d *Failstore) fail(ctx context.Context, op string, keys ...ds.Key) (fault, error) {
+	if d.errfunc != nil {
+		return fault{}, d.errfunc(op)
+	}
+	return d.rules.inject(ctx, op, keys)
+}
+
+// Children implements ds.Shim
+func (d *Failstore) Children() []ds.Datastore {
+	return []ds.Datastore{d.child}
+}
+
 // Put puts a key/value into the datastore.
 func (d *Failstore) Put(ctx context.Context, k ds.Key, val []byte) error {
-	err := d.errfunc("put")
+	_, err := d.fail(ctx, "put", k)
 	if err != nil {
 		return err
 	}
@@ -44,7 +73,7 @@ func (d *Failstore) Put(ctx context.Context, k ds.Key, val []byte) error {
 
 // Sync implements Datastore.Sync
 func (d *Failstore) Sync(ctx context.Context, prefix ds.Key) error {
-	err := d.errfunc("sync")
+	_, err := d.fail(ctx, "sync", prefix)
 	if err != nil {
 		return err
 	}
@@ -54,17 +83,21 @@ func (d *Failstore) Sync(ctx context.Context, prefix ds.Key) error {
 
 // Get retrieves a value from the datastore.
 func (d *Failstore) Get(ctx context.Context, k ds.Key) ([]byte, error) {
-	err := d.errfunc("get")
+	f, err := d.fail(ctx, "get", k)
 	if err != nil {
 		return nil, err
 	}
 
-	return d.child.Get(ctx, k)
+	val, err := d.child.Get(ctx, k)
+	if err == nil && f.corrupt {
+		val = d.rules.corrupt(val)
+	}
+	return val, err
 }
 
 // Has returns if the datastore contains a key/value.
 func (d *Failstore) Has(ctx context.Context, k ds.Key) (bool, error) {
-	err := d.errfunc("has")
+	_, err := d.fail(ctx, "has", k)
 	if err != nil {
 		return false, err
 	}
@@ -74,7 +107,7 @@ func (d *Failstore) Has(ctx context.Context, k ds.Key) (bool, error) {
 
 // GetSize returns the size of the value in the datastore, if present.
 func (d *Failstore) GetSize(ctx context.Context, k ds.Key) (int, error) {
-	err := d.errfunc("getsize")
+	_, err := d.fail(ctx, "getsize", k)
 	if err != nil {
 		return -1, err
 	}
@@ -84,7 +117,7 @@ func (d *Failstore) GetSize(ctx context.Context, k ds.Key) (int, error) {
 
 // Delete removes a key/value from the datastore.
 func (d *Failstore) Delete(ctx context.Context, k ds.Key) error {
-	err := d.errfunc("delete")
+	_, err := d.fail(ctx, "delete", k)
 	if err != nil {
 		return err
 	}
@@ -94,22 +127,95 @@ func (d *Failstore) Delete(ctx context.Context, k ds.Key) error {
 
 // Query performs a query on the datastore.
 func (d *Failstore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
-	err := d.errfunc("query")
+	f, err := d.fail(ctx, "query", ds.NewKey(q.Prefix))
 	if err != nil {
 		return nil, err
 	}
 
-	return d.child.Query(ctx, q)
+	res, err := d.child.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return d.rules.results(res, f), nil
 }
 
 // DiskUsage implements the PersistentDatastore interface.
 func (d *Failstore) DiskUsage(ctx context.Context) (uint64, error) {
-	if err := d.errfunc("disk-usage"); err != nil {
+	if _, err := d.fail(ctx, "disk-usage"); err != nil {
 		return 0, err
 	}
 	return ds.DiskUsage(ctx, d.child)
 }
 
+// Check implements the CheckedDatastore interface.
+func (d *Failstore) Check(ctx context.Context) error {
+	if _, err := d.fail(ctx, "check"); err != nil {
+		return err
+	}
+	if c, ok := d.child.(ds.CheckedDatastore); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+// Scrub implements the ScrubbedDatastore interface.
+func (d *Failstore) Scrub(ctx context.Context) error {
+	if _, err := d.fail(ctx, "scrub"); err != nil {
+		return err
+	}
+	if c, ok := d.child.(ds.ScrubbedDatastore); ok {
+		return c.Scrub(ctx)
+	}
+	return nil
+}
+
+// CollectGarbage implements the GCDatastore interface.
+func (d *Failstore) CollectGarbage(ctx context.Context) error {
+	if _, err := d.fail(ctx, "gc"); err != nil {
+		return err
+	}
+	if c, ok := d.child.(ds.GCDatastore); ok {
+		return c.CollectGarbage(ctx)
+	}
+	return nil
+}
+
+// PutWithTTL implements the TTL interface.
+func (d *Failstore) PutWithTTL(ctx context.Context, k ds.Key, val []byte, ttl time.Duration) error {
+	if _, err := d.fail(ctx, "put-with-ttl", k); err != nil {
+		return err
+	}
+	tds, ok := d.child.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	return tds.PutWithTTL(ctx, k, val, ttl)
+}
+
+// SetTTL implements the TTL interface.
+func (d *Failstore) SetTTL(ctx context.Context, k ds.Key, ttl time.Duration) error {
+	if _, err := d.fail(ctx, "set-ttl", k); err != nil {
+		return err
+	}
+	tds, ok := d.child.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	return tds.SetTTL(ctx, k, ttl)
+}
+
+// GetExpiration implements the TTL interface.
+func (d *Failstore) GetExpiration(ctx context.Context, k ds.Key) (time.Time, error) {
+	if _, err := d.fail(ctx, "get-expiration", k); err != nil {
+		return time.Time{}, err
+	}
+	tds, ok := d.child.(ds.TTLDatastore)
+	if !ok {
+		return time.Time{}, ds.ErrTTLUnsupported
+	}
+	return tds.GetExpiration(ctx, k)
+}
+
 // Close implements the Datastore interface
 func (d *Failstore) Close() error {
 	return d.child.Close()
@@ -119,17 +225,29 @@ func (d *Failstore) Close() error {
 type FailBatch struct {
 	cb     ds.Batch
 	dstore *Failstore
+	ops    []batchOp
+}
+
+// batchOp is a batched operation, kept to apply partial commits.
+type batchOp struct {
+	key    ds.Key
+	value  []byte
+	delete bool
 }
 
 var _ ds.Batch = (*FailBatch)(nil)
 
 // Batch returns a new Batch Failstore.
 func (d *Failstore) Batch(ctx context.Context) (ds.Batch, error) {
-	if err := d.errfunc("batch"); err != nil {
+	if _, err := d.fail(ctx, "batch"); err != nil {
 		return nil, err
 	}
 
-	b, err := d.child.(ds.Batching).Batch(ctx)
+	bds, ok := d.child.(ds.Batching)
+	if !ok {
+		return nil, ds.ErrBatchUnsupported
+	}
+	b, err := bds.Batch(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -142,27 +260,165 @@ func (d *Failstore) Batch(ctx context.Context) (ds.Batch, error) {
 
 // Put does a batch put.
 func (b *FailBatch) Put(ctx context.Context, k ds.Key, val []byte) error {
-	if err := b.dstore.errfunc("batch-put"); err != nil {
+	if _, err := b.dstore.fail(ctx, "batch-put", k); err != nil {
 		return err
 	}
 
-	return b.cb.Put(ctx, k, val)
+	if err := b.cb.Put(ctx, k, val); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, batchOp{key: k, value: val})
+	return nil
 }
 
 // Delete does a batch delete.
 func (b *FailBatch) Delete(ctx context.Context, k ds.Key) error {
-	if err := b.dstore.errfunc("batch-delete"); err != nil {
+	if _, err := b.dstore.fail(ctx, "batch-delete", k); err != nil {
 		return err
 	}
 
-	return b.cb.Delete(ctx, k)
+	if err := b.cb.Delete(ctx, k); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, batchOp{key: k, delete: true})
+	return nil
 }
 
-// Commit commits all operations in the batch.
+// Commit commits all operations in the batch. A partial failure applies the
+// first operations of the batch to the child datastore, one by one, and drops
+// the others.
 func (b *FailBatch) Commit(ctx context.Context) error {
-	if err := b.dstore.errfunc("batch-commit"); err != nil {
+	keys := make([]ds.Key, len(b.ops))
+	for i, op := range b.ops {
+		keys[i] = op.key
+	}
+
+	f, err := b.dstore.fail(ctx, "batch-commit", keys...)
+	if err != nil {
 		return err
 	}
+	ops := b.ops
+	b.ops = nil
+	if !f.partial {
+		return b.cb.Commit(ctx)
+	}
+
+	for _, op := range ops[:min(f.after, len(ops))] {
+		if op.delete {
+			err = b.dstore.child.Delete(ctx, op.key)
+		} else {
+			err = b.dstore.child.Put(ctx, op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return f.err
+}
+
+// FailTxn implements transactions on the Failstore.
+type FailTxn struct {
+	txn    ds.Txn
+	dstore *Failstore
+}
+
+var _ ds.Txn = (*FailTxn)(nil)
+
+// NewTransaction returns a new transaction on the Failstore.
+func (d *Failstore) NewTransaction(ctx context.Context, readOnly bool) (ds.Txn, error) {
+	if _, err := d.fail(ctx, "txn"); err != nil {
+		return nil, err
+	}
+
+	tds, ok := d.child.(ds.TxnDatastore)
+	if !ok {
+		return nil, ds.ErrTxnUnsupported
+	}
+	txn, err := tds.NewTransaction(ctx, readOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FailTxn{
+		txn:    txn,
+		dstore: d,
+	}, nil
+}
+
+// Get retrieves a value in the transaction.
+func (t *FailTxn) Get(ctx context.Context, k ds.Key) ([]byte, error) {
+	f, err := t.dstore.fail(ctx, "txn-get", k)
+	if err != nil {
+		return nil, err
+	}
+
+	val, err := t.txn.Get(ctx, k)
+	if err == nil && f.corrupt {
+		val = t.dstore.rules.corrupt(val)
+	}
+	return val, err
+}
+
+// Has returns if the transaction contains a key/value.
+func (t *FailTxn) Has(ctx context.Context, k ds.Key) (bool, error) {
+	if _, err := t.dstore.fail(ctx, "txn-has", k); err != nil {
+		return false, err
+	}
+
+	return t.txn.Has(ctx, k)
+}
+
+// GetSize returns the size of the value in the transaction, if present.
+func (t *FailTxn) GetSize(ctx context.Context, k ds.Key) (int, error) {
+	if _, err := t.dstore.fail(ctx, "txn-getsize", k); err != nil {
+		return -1, err
+	}
+
+	return t.txn.GetSize(ctx, k)
+}
+
+// Query performs a query in the transaction.
+func (t *FailTxn) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	f, err := t.dstore.fail(ctx, "txn-query", ds.NewKey(q.Prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := t.txn.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return t.dstore.rules.results(res, f), nil
+}
+
+// Put does a transactional put.
+func (t *FailTxn) Put(ctx context.Context, k ds.Key, val []byte) error {
+	if _, err := t.dstore.fail(ctx, "txn-put", k); err != nil {
+		return err
+	}
+
+	return t.txn.Put(ctx, k, val)
+}
+
+// Delete does a transactional delete.
+func (t *FailTxn) Delete(ctx context.Context, k ds.Key) error {
+	if _, err := t.dstore.fail(ctx, "txn-delete", k); err != nil {
+		return err
+	}
+
+	return t.txn.Delete(ctx, k)
+}
+
+// Commit commits the transaction.
+func (t *FailTxn) Commit(ctx context.Context) error {
+	if _, err := t.dstore.fail(ctx, "txn-commit"); err != nil {
+		return err
+	}
+
+	return t.txn.Commit(ctx)
+}
 
-	return b.cb.Commit(ctx)
+// Discard discards the transaction.
+func (t *FailTxn) Discard(ctx context.Context) {
+	t.txn.Discard(ctx)
 }
@@ -0,0 +1,221 @@
+package failstore
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+// ErrInjected is returned by partial failures of rules without an Err.
+var ErrInjected = errors.New("failstore: injected failure")
+
+// Rule describes a fault injected into the calls it matches.
+//
+// A rule matches calls of its operation whose key is Prefix or one of its
+// descendants. Queries match when their prefix and Prefix overlap, batch
+// commits when any of the batched keys matches, and operations without keys
+// only match rules without a Prefix.
+//
+// A matching call triggers the rule on the Nth matching call if Nth is set,
+// with the given Probability otherwise, or always if neither is set. A
+// triggered call is delayed by Latency, then the values it returns are
+// corrupted if Corrupt is set, and it fails with Err if set.
+type Rule struct {
+	// Op is the operation name, as passed to the error function of
+	// NewFailstore. An empty Op matches all operations.
+	Op string
+	// Prefix restricts the rule to keys under it. An empty Prefix matches
+	// all keys.
+	Prefix ds.Key
+
+	// Nth triggers the rule on the Nth matching call only, counting from 1.
+	Nth int
+	// Probability triggers the rule on each matching call with the given
+	// probability.
+	Probability float64
+
+	// Latency delays triggered calls.
+	Latency time.Duration
+	// Corrupt flips a bit of the values returned by triggered get, txn-get,
+	// query and txn-query calls.
+	Corrupt bool
+	// Err is the error triggered calls fail with.
+	Err error
+	// Partial makes triggered query, txn-query and batch-commit calls fail
+	// midway, with Err or ErrInjected: queries after returning After
+	// results, and batch commits after applying the first After operations
+	// of the batch, directly to the child datastore. Other operations fail
+	// outright.
+	Partial bool
+	After   int
+}
+
+// fault is the outcome of the rules triggered by a call that didn't fail
+// outright.
+type fault struct {
+	corrupt bool
+	partial bool
+	after   int
+	err     error
+}
+
+// injector applies rules, with a seeded random source so that failures
+// reproduce.
+type injector struct {
+	mu     sync.Mutex
+	rules  []Rule
+	counts []int
+	rng    *rand.Rand
+}
+
+// NewRuleFailstore creates a new datastore injecting faults into the calls
+// matching rules. Random failures are drawn from a source seeded with seed, so
+// that a sequence of calls fails the same way on every run.
+//
+// The returned datastore implements every optional feature; use
+// scoped.Inherit to only expose the features c supports.
+func NewRuleFailstore(c ds.Datastore, seed uint64, rules ...Rule) *Failstore {
+	return &Failstore{
+		child: c,
+		rules: &injector{
+			rules:  rules,
+			counts: make([]int, len(rules)),
+			rng:    rand.New(rand.NewPCG(seed, seed)),
+		},
+	}
+}
+
+func (r *Rule) matches(op string, keys []ds.Key) bool {
+	if r.Op != "" && r.Op != op {
+		return false
+	}
+	if r.Prefix.String() == "" || r.Prefix.String() == "/" {
+		return true
+	}
+	for _, k := range keys {
+		if k == r.Prefix || r.Prefix.IsAncestorOf(k) {
+			return true
+		}
+		// Queries also match rules under their prefix.
+		if (op == "query" || op == "txn-query") && k.IsAncestorOf(r.Prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// trigger returns the rules triggered by a call of op on keys.
+func (in *injector) trigger(op string, keys []ds.Key) []Rule {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	var triggered []Rule
+	for i := range in.rules {
+		r := &in.rules[i]
+		if !r.matches(op, keys) {
+			continue
+		}
+		in.counts[i]++
+		switch {
+		case r.Nth > 0:
+			if in.counts[i] != r.Nth {
+				continue
+			}
+		case r.Probability > 0:
+			if in.rng.Float64() >= r.Probability {
+				continue
+			}
+		}
+		triggered = append(triggered, *r)
+	}
+	return triggered
+}
+
+// inject applies the rules triggered by a call of op on keys, returning an
+// error if the call must fail outright.
+func (in *injector) inject(ctx context.Context, op string, keys []ds.Key) (fault, error) {
+	var f fault
+	if in == nil {
+		return f, nil
+	}
+	for _, r := range in.trigger(op, keys) {
+		if r.Latency > 0 {
+			t := time.NewTimer(r.Latency)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return f, ctx.Err()
+			}
+		}
+		if r.Corrupt {
+			f.corrupt = true
+		}
+		err := r.Err
+		if r.Partial {
+			if err == nil {
+				err = ErrInjected
+			}
+			switch op {
+			case "query", "txn-query", "batch-commit":
+				if !f.partial {
+					f.partial, f.after, f.err = true, r.After, err
+				}
+				continue
+			}
+		}
+		if err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// corrupt returns a copy of value with a bit flipped, or a single byte if
+// value is empty.
+func (in *injector) corrupt(value []byte) []byte {
+	if len(value) == 0 {
+		return []byte{0}
+	}
+	in.mu.Lock()
+	bit := in.rng.IntN(len(value) * 8)
+	in.mu.Unlock()
+	out := append([]byte(nil), value...)
+	out[bit/8] ^= 1 << (bit % 8)
+	return out
+}
+
+// results wraps res to apply f to the results of a query.
+func (in *injector) results(res dsq.Results, f fault) dsq.Results {
+	if !f.corrupt && !f.partial {
+		return res
+	}
+	var n int
+	var failed bool
+	return dsq.ResultsFromIterator(res.Query(), dsq.Iterator{
+		Next: func() (dsq.Result, bool) {
+			if failed {
+				return dsq.Result{}, false
+			}
+			if f.partial && n >= f.after {
+				failed = true
+				return dsq.Result{Error: f.err}, true
+			}
+			r, ok := res.NextSync()
+			if !ok || r.Error != nil {
+				return r, ok
+			}
+			n++
+			if f.corrupt && !res.Query().KeysOnly {
+				r.Value = in.corrupt(r.Value)
+			}
+			return r, true
+		},
+		Close: res.Close,
+	})
+}
@@ -0,0 +1,157 @@
+package failstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dstest "github.com/ipfs/go-datastore/test"
+	"github.com/stretchr/testify/require"
+)
+
+var errRule = errors.New("rule failure")
+
+func TestRuleFailstoreAll(t *testing.T) {
+	dstest.SubtestAll(t, NewRuleFailstore(ds.NewMapDatastore(), 1))
+}
+
+func TestRulePrefixAndOp(t *testing.T) {
+	ctx := context.Background()
+	d := NewRuleFailstore(ds.NewMapDatastore(), 1, Rule{Op: "put", Prefix: ds.NewKey("/bad"), Err: errRule})
+
+	require.ErrorIs(t, d.Put(ctx, ds.NewKey("/bad"), nil), errRule)
+	require.ErrorIs(t, d.Put(ctx, ds.NewKey("/bad/child"), nil), errRule)
+	require.NoError(t, d.Put(ctx, ds.NewKey("/badger"), nil))
+	require.NoError(t, d.Put(ctx, ds.NewKey("/good"), nil))
+	_, err := d.Get(ctx, ds.NewKey("/badger"))
+	require.NoError(t, err)
+}
+
+func TestRuleNth(t *testing.T) {
+	ctx := context.Background()
+	d := NewRuleFailstore(ds.NewMapDatastore(), 1, Rule{Op: "has", Nth: 3, Err: errRule})
+
+	for i := 1; i <= 5; i++ {
+		_, err := d.Has(ctx, ds.NewKey("/a"))
+		if i == 3 {
+			require.ErrorIs(t, err, errRule)
+		} else {
+			require.NoError(t, err, "call %d", i)
+		}
+	}
+}
+
+func TestRuleProbabilityIsSeeded(t *testing.T) {
+	ctx := context.Background()
+	failures := func(seed uint64) []bool {
+		d := NewRuleFailstore(ds.NewMapDatastore(), seed, Rule{Op: "has", Probability: 0.5, Err: errRule})
+		var out []bool
+		for range 64 {
+			_, err := d.Has(ctx, ds.NewKey("/a"))
+			out = append(out, err != nil)
+		}
+		return out
+	}
+
+	a := failures(7)
+	require.Equal(t, a, failures(7))
+	require.NotEqual(t, a, failures(8))
+	require.Contains(t, a, true)
+	require.Contains(t, a, false)
+}
+
+func TestRuleLatency(t *testing.T) {
+	d := NewRuleFailstore(ds.NewMapDatastore(), 1, Rule{Op: "get", Latency: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := d.Get(ctx, ds.NewKey("/a"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRuleCorrupt(t *testing.T) {
+	ctx := context.Background()
+	d := NewRuleFailstore(ds.NewMapDatastore(), 1, Rule{Prefix: ds.NewKey("/c"), Corrupt: true})
+
+	value := []byte("value")
+	require.NoError(t, d.Put(ctx, ds.NewKey("/c"), value))
+	got, err := d.Get(ctx, ds.NewKey("/c"))
+	require.NoError(t, err)
+	require.Len(t, got, len(value))
+	require.NotEqual(t, value, got)
+	require.Equal(t, []byte("value"), value)
+
+	res, err := d.Query(ctx, dsq.Query{})
+	require.NoError(t, err)
+	entries, err := res.Rest()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.NotEqual(t, value, entries[0].Value)
+}
+
+func TestRulePartialQuery(t *testing.T) {
+	ctx := context.Background()
+	d := NewRuleFailstore(ds.NewMapDatastore(), 1, Rule{Op: "query", Partial: true, After: 2})
+
+	for _, k := range []string{"/a", "/b", "/c", "/d"} {
+		require.NoError(t, d.Put(ctx, ds.NewKey(k), nil))
+	}
+	res, err := d.Query(ctx, dsq.Query{})
+	require.NoError(t, err)
+	var n int
+	for r := range res.Next() {
+		if r.Error != nil {
+			require.ErrorIs(t, r.Error, ErrInjected)
+			break
+		}
+		n++
+	}
+	require.Equal(t, 2, n)
+	require.NoError(t, res.Close())
+}
+
+func TestRulePartialBatchCommit(t *testing.T) {
+	ctx := context.Background()
+	child := ds.NewMapDatastore()
+	d := NewRuleFailstore(child, 1, Rule{Op: "batch-commit", Prefix: ds.NewKey("/p"), Partial: true, After: 2, Err: errRule})
+
+	b, err := d.Batch(ctx)
+	require.NoError(t, err)
+	for _, k := range []string{"/p/a", "/p/b", "/p/c"} {
+		require.NoError(t, b.Put(ctx, ds.NewKey(k), []byte(k)))
+	}
+	require.ErrorIs(t, b.Commit(ctx), errRule)
+
+	for k, want := range map[string]bool{"/p/a": true, "/p/b": true, "/p/c": false} {
+		has, err := child.Has(ctx, ds.NewKey(k))
+		require.NoError(t, err)
+		require.Equal(t, want, has, k)
+	}
+
+	// Batches outside the prefix commit in full.
+	b, err = d.Batch(ctx)
+	require.NoError(t, err)
+	require.NoError(t, b.Put(ctx, ds.NewKey("/q"), nil))
+	require.NoError(t, b.Commit(ctx))
+}
+
+func TestRuleTxnAndTTL(t *testing.T) {
+	ctx := context.Background()
+	d := NewRuleFailstore(ds.NewNullDatastore(), 1,
+		Rule{Op: "txn-put", Prefix: ds.NewKey("/t"), Err: errRule},
+		Rule{Op: "set-ttl", Err: errRule},
+	)
+
+	txn, err := d.NewTransaction(ctx, false)
+	require.NoError(t, err)
+	require.ErrorIs(t, txn.Put(ctx, ds.NewKey("/t/a"), nil), errRule)
+	require.NoError(t, txn.Put(ctx, ds.NewKey("/u"), nil))
+	txn.Discard(ctx)
+
+	// Rules apply before the child is checked for TTL support.
+	require.ErrorIs(t, d.PutWithTTL(ctx, ds.NewKey("/a"), nil, time.Hour), ds.ErrTTLUnsupported)
+	require.ErrorIs(t, d.SetTTL(ctx, ds.NewKey("/a"), time.Hour), errRule)
+}
@@ -53,7 +53,7 @@ func TestFeaturesForDatastore(t *testing.T) {
 		{
 			name:             "LogDatastore",
 			d:                &LogDatastore{},
-			expectedFeatures: []string{"Batching", "Checked", "GC", "Persistent", "Scrubbed"},
+			expectedFeatures: []string{"Batching", "Checked", "GC", "Persistent", "Scrubbed", "TTL", "Transaction"},
 		},
 		{
 			name:             "nil datastore",
@@ -7,8 +7,8 @@ import (
 	"os"
 
 	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/diff"
 	fuzzer "github.com/ipfs/go-datastore/fuzz"
-	dsq "github.com/ipfs/go-datastore/query"
 
 	"github.com/spf13/pflag"
 )
@@ -67,39 +67,20 @@ func main() {
 	db2 := inst2.DB()
 
 	ctx := context.Background()
-	r1, err := db1.Query(ctx, dsq.Query{})
-	if err != nil {
-		panic(err)
-	}
-
-	for r := range r1.Next() {
-		if r.Error != nil {
-			break
-		}
-		if r.Entry.Key == "/" {
-			continue
-		}
-
-		if exist, _ := db2.Has(ctx, ds.NewKey(r.Entry.Key)); !exist {
-			fmt.Fprintf(os.Stderr, "db2 failed to get key %s held by db1\n", r.Entry.Key)
+	for c, err := range diff.Diff(ctx, db1, db2, ds.NewKey("/")) {
+		if err != nil {
+			panic(err)
 		}
-	}
-
-	r2, err := db2.Query(ctx, dsq.Query{})
-	if err != nil {
-		panic(err)
-	}
-
-	for r := range r2.Next() {
-		if r.Error != nil {
-			break
-		}
-		if r.Entry.Key == "/" {
+		if c.Key.String() == "/" {
 			continue
 		}
-
-		if exist, _ := db1.Has(ctx, ds.NewKey(r.Entry.Key)); !exist {
-			fmt.Fprintf(os.Stderr, "db1 failed to get key %s held by db2\n", r.Entry.Key)
+		switch c.Op {
+		case diff.Added:
+			fmt.Fprintf(os.Stderr, "db1 failed to get key %s held by db2\n", c.Key)
+		case diff.Removed:
+			fmt.Fprintf(os.Stderr, "db2 failed to get key %s held by db1\n", c.Key)
+		case diff.Changed:
+			fmt.Fprintf(os.Stderr, "db1 and db2 hold different values for key %s\n", c.Key)
 		}
 	}
 
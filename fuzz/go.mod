@@ -15,7 +15,7 @@ require (
 	github.com/mattn/go-isatty v0.0.22 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.28.0 // indirect
-	golang.org/x/sys v0.35.0 // indirect
+	golang.org/x/sys v0.45.0 // indirect
 )
 
 replace github.com/ipfs/go-datastore => ../
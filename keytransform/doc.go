@@ -21,4 +21,13 @@
 //	    Invert: reverseKey,  // reverse is its own inverse.
 //	  })
 //	}
+//
+// Queries are pushed down to the child datastore as far as the transform
+// allows. Transforms implementing Declarer declare the Properties of their
+// conversion, such as preserving the order of keys, which
+// dstest.CheckTransform can check.
+//
+// PrefixTransform, EscapeTransform, CaseInsensitiveTransform and
+// ShardTransform are ready-made transforms, the last three making keys safe
+// to store in datastores backed by file systems.
 package keytransform
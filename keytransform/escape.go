@@ -0,0 +1,190 @@
+package keytransform
+
+import (
+	"encoding/base32"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// base32Encoding is the extended hex alphabet of RFC 4648, lower cased, which
+// keeps the order of the encoded bytes.
+var base32Encoding = base32.NewEncoding("0123456789abcdefghijklmnopqrstuv").WithPadding(base32.NoPadding)
+
+// EscapeTransform escapes each namespace of keys, so that any byte string can
+// be used as a namespace of a datastore that only supports file name safe
+// keys, like examples/fs.
+//
+// By default, the bytes other than ASCII letters, digits, '-', '_' and '.'
+// are percent-encoded, as well as a leading '.', so that "." and ".." and
+// hidden files can't be confused with namespaces. With Base32, namespaces are
+// encoded with the lower cased extended hex alphabet of RFC 4648 instead.
+// Either way, an empty namespace is encoded as "%", so that keys like /a//b
+// don't convert to keys that clean to the conversion of /a/b.
+type EscapeTransform struct {
+	Base32 bool
+}
+
+// ConvertKey escapes the namespaces of k.
+func (t EscapeTransform) ConvertKey(k ds.Key) ds.Key {
+	if t.Base32 {
+		return convertNamespaces(k, func(ns string) string {
+			return base32Encoding.EncodeToString([]byte(ns))
+		})
+	}
+	return convertNamespaces(k, func(ns string) string {
+		return escape(ns, false)
+	})
+}
+
+// InvertKey unescapes the namespaces of k. It panics if k was not escaped.
+func (t EscapeTransform) InvertKey(k ds.Key) ds.Key {
+	return mustInvert(t.TryInvertKey(k))
+}
+
+// TryInvertKey implements Inverter.
+func (t EscapeTransform) TryInvertKey(k ds.Key) (ds.Key, error) {
+	if t.Base32 {
+		return invertNamespaces(k, func(ns string) (string, error) {
+			b, err := base32Encoding.DecodeString(ns)
+			if err != nil {
+				return "", fmt.Errorf("keytransform: invalid base32 namespace %q: %v", ns, err)
+			}
+			return string(b), nil
+		})
+	}
+	return invertNamespaces(k, unescape)
+}
+
+// Properties implements Declarer.
+func (t EscapeTransform) Properties() Properties {
+	return Properties{PrefixPreserving: true}
+}
+
+// CaseInsensitiveTransform escapes keys like EscapeTransform, and also
+// percent-encodes upper case letters, so that keys that only differ in case
+// can be stored in datastores backed by case insensitive file systems.
+type CaseInsensitiveTransform struct{}
+
+// ConvertKey escapes the namespaces of k.
+func (CaseInsensitiveTransform) ConvertKey(k ds.Key) ds.Key {
+	return convertNamespaces(k, func(ns string) string {
+		return escape(ns, true)
+	})
+}
+
+// InvertKey unescapes the namespaces of k. It panics if k was not escaped.
+func (t CaseInsensitiveTransform) InvertKey(k ds.Key) ds.Key {
+	return mustInvert(t.TryInvertKey(k))
+}
+
+// TryInvertKey implements Inverter.
+func (CaseInsensitiveTransform) TryInvertKey(k ds.Key) (ds.Key, error) {
+	return invertNamespaces(k, unescape)
+}
+
+// Properties implements Declarer.
+func (CaseInsensitiveTransform) Properties() Properties {
+	return Properties{PrefixPreserving: true}
+}
+
+var (
+	_ Declarer = EscapeTransform{}
+	_ Declarer = CaseInsensitiveTransform{}
+	_ Inverter = EscapeTransform{}
+	_ Inverter = CaseInsensitiveTransform{}
+)
+
+// emptyNamespace is the encoding of the empty namespace, which neither escape
+// nor base32 produce.
+const emptyNamespace = "%"
+
+// convertNamespaces encodes each namespace of k with f, and empty namespaces
+// as emptyNamespace.
+func convertNamespaces(k ds.Key, f func(string) string) ds.Key {
+	if k.String() == "/" {
+		return k
+	}
+	l := k.List()
+	for i, ns := range l {
+		if ns == "" {
+			l[i] = emptyNamespace
+		} else {
+			l[i] = f(ns)
+		}
+	}
+	return ds.RawKey("/" + strings.Join(l, "/"))
+}
+
+// invertNamespaces decodes each namespace of k converted by
+// convertNamespaces, with f.
+func invertNamespaces(k ds.Key, f func(string) (string, error)) (ds.Key, error) {
+	if k.String() == "/" {
+		return k, nil
+	}
+	l := k.List()
+	for i, ns := range l {
+		switch ns {
+		case emptyNamespace:
+			l[i] = ""
+		case "":
+			return ds.Key{}, fmt.Errorf("keytransform: empty namespace in %s", k)
+		default:
+			var err error
+			if l[i], err = f(ns); err != nil {
+				return ds.Key{}, err
+			}
+		}
+	}
+	return ds.RawKey("/" + strings.Join(l, "/")), nil
+}
+
+// mustInvert returns k, or panics with err.
+func mustInvert(k ds.Key, err error) ds.Key {
+	if err != nil {
+		panic(err.Error())
+	}
+	return k
+}
+
+// escape percent-encodes the unsafe bytes of ns, with lower case hexadecimal
+// digits. With foldCase, upper case letters are unsafe.
+func escape(ns string, foldCase bool) string {
+	var b strings.Builder
+	for i := 0; i < len(ns); i++ {
+		c := ns[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_':
+		case c >= 'A' && c <= 'Z' && !foldCase:
+		case c == '.' && i > 0:
+		default:
+			fmt.Fprintf(&b, "%%%02x", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// unescape decodes the percent-encoded bytes of ns.
+func unescape(ns string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(ns); i++ {
+		if ns[i] != '%' {
+			b.WriteByte(ns[i])
+			continue
+		}
+		if i+3 > len(ns) {
+			return "", fmt.Errorf("keytransform: truncated escape in namespace %q", ns)
+		}
+		c, err := strconv.ParseUint(ns[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("keytransform: invalid escape in namespace %q", ns)
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -1,6 +1,10 @@
 package keytransform
 
-import ds "github.com/ipfs/go-datastore"
+import (
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+)
 
 // KeyMapping is a function that maps one key to annother
 type KeyMapping func(ds.Key) ds.Key
@@ -11,3 +15,60 @@ type KeyTransform interface {
 	ConvertKey(ds.Key) ds.Key
 	InvertKey(ds.Key) ds.Key
 }
+
+// Inverter is implemented by KeyTransforms that can tell the keys they didn't
+// convert, instead of panicking on them. Queries through a Datastore then
+// return such keys of the child datastore as error results.
+type Inverter interface {
+	KeyTransform
+	// TryInvertKey is like InvertKey, but returns an error if k can't be
+	// inverted.
+	TryInvertKey(ds.Key) (ds.Key, error)
+}
+
+// Properties describes how a KeyTransform converts keys, so that queries can
+// be pushed down to the child datastore. Use dstest.CheckTransform to check
+// that a transform has the properties it declares.
+type Properties struct {
+	// OrderPreserving transforms keep the order of keys: a < b if and only
+	// if ConvertKey(a) < ConvertKey(b). Key orders and key comparison
+	// filters are then pushed down.
+	OrderPreserving bool
+	// PrefixPreserving transforms convert the descendants of a key, and
+	// only those, to descendants of the converted key. The query prefix is
+	// then pushed down.
+	PrefixPreserving bool
+	// PrefixInvertible transforms can convert string prefixes of keys: a
+	// key starts with a string s if and only if the converted key starts
+	// with ConvertPrefix(t, s). Key prefix filters are then pushed down.
+	PrefixInvertible bool
+}
+
+// Declarer is implemented by KeyTransforms declaring their Properties.
+type Declarer interface {
+	KeyTransform
+	Properties() Properties
+}
+
+// PropertiesOf returns the properties t declares, and whether it declares
+// them.
+func PropertiesOf(t KeyTransform) (Properties, bool) {
+	d, ok := t.(Declarer)
+	if !ok {
+		return Properties{}, false
+	}
+	return d.Properties(), true
+}
+
+// ConvertPrefix converts s, a string prefix of keys starting with "/", with
+// t.ConvertKey. A trailing "/" is kept.
+func ConvertPrefix(t KeyTransform, s string) string {
+	if s == "/" || !strings.HasSuffix(s, "/") {
+		return t.ConvertKey(ds.RawKey(s)).String()
+	}
+	c := t.ConvertKey(ds.RawKey(s[:len(s)-1])).String()
+	if c == "/" {
+		return c
+	}
+	return c + "/"
+}
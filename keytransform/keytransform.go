@@ -3,6 +3,8 @@ package keytransform
 import (
 	"context"
 	"errors"
+	"strings"
+	"time"
 
 	ds "github.com/ipfs/go-datastore"
 	dsq "github.com/ipfs/go-datastore/query"
@@ -11,6 +13,9 @@ import (
 // Wrap wraps a given datastore with a KeyTransform function.
 // The resulting wrapped datastore will use the transform on all Datastore
 // operations.
+//
+// The returned datastore implements every optional feature; use
+// scoped.Inherit to only expose the features child supports.
 func Wrap(child ds.Datastore, t KeyTransform) *Datastore {
 	if t == nil {
 		panic("t (KeyTransform) is nil")
@@ -38,6 +43,8 @@ var _ ds.PersistentDatastore = (*Datastore)(nil)
 var _ ds.CheckedDatastore = (*Datastore)(nil)
 var _ ds.ScrubbedDatastore = (*Datastore)(nil)
 var _ ds.GCDatastore = (*Datastore)(nil)
+var _ ds.TTLDatastore = (*Datastore)(nil)
+var _ dsq.Explainer = (*Datastore)(nil)
 
 // Children implements ds.Shim
 func (d *Datastore) Children() []ds.Datastore {
@@ -78,9 +85,15 @@ func (d *Datastore) Delete(ctx context.Context, key ds.Key) (err error) {
 
 // Query implements Query, inverting keys on the way back out.
 func (d *Datastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
-	nq, cq := d.prepareQuery(q)
+	return d.query(ctx, d.child, q)
+}
+
+// query runs q against src, which is the child datastore or a transaction on
+// it.
+func (d *Datastore) query(ctx context.Context, src ds.Read, q dsq.Query) (dsq.Results, error) {
+	plan, cq := d.plan(q)
 
-	cqr, err := d.child.Query(ctx, cq)
+	cqr, err := src.Query(ctx, cq)
 	if err != nil {
 		return nil, err
 	}
@@ -92,7 +105,11 @@ func (d *Datastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error)
 				return r, false
 			}
 			if r.Error == nil {
-				r.Entry.Key = d.InvertKey(ds.RawKey(r.Entry.Key)).String()
+				k, err := d.tryInvertKey(ds.RawKey(r.Entry.Key))
+				if err != nil {
+					return dsq.Result{Error: err}, true
+				}
+				r.Entry.Key = k.String()
 			}
 			return r, true
 		},
@@ -100,104 +117,94 @@ func (d *Datastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error)
 			return cqr.Close()
 		},
 	})
-	return dsq.NaiveQueryApply(nq, qr), nil
+	return dsq.NaiveQueryApply(plan.Residual, qr), nil
 }
 
-// Split the query into a child query and a naive query. That way, we can make
-// the child datastore do as much work as possible.
-func (d *Datastore) prepareQuery(q dsq.Query) (naive, child dsq.Query) {
-
-	// First, put everything in the child query. Then, start taking things
-	// out.
-	child = q
-
-	// Always let the child handle the key prefix.
-	child.Prefix = d.ConvertKey(ds.NewKey(child.Prefix)).String()
-
-	// Check if the key transform is order-preserving so we can use the
-	// child datastore's built-in ordering.
-	orderPreserving := false
-	switch d.KeyTransform.(type) {
-	case PrefixTransform, *PrefixTransform:
-		orderPreserving = true
+// tryInvertKey inverts k with the transform, returning an error instead of
+// panicking if the transform is an Inverter.
+func (d *Datastore) tryInvertKey(k ds.Key) (ds.Key, error) {
+	if inv, ok := d.KeyTransform.(Inverter); ok {
+		return inv.TryInvertKey(k)
 	}
+	return d.InvertKey(k), nil
+}
 
-	// Try to let the child handle ordering.
-orders:
-	for i, o := range child.Orders {
-		switch o.(type) {
-		case dsq.OrderByValue, *dsq.OrderByValue,
-			dsq.OrderByValueDescending, *dsq.OrderByValueDescending:
-			// Key doesn't matter.
-			continue
-		case dsq.OrderByKey, *dsq.OrderByKey,
-			dsq.OrderByKeyDescending, *dsq.OrderByKeyDescending:
-			// if the key transform preserves order, we can delegate to the
-			// child datastore.
-			if orderPreserving {
-				// When sorting, we compare with the first Order, then, if
-				// equal, we compare with the second Order, etc. However, keys
-				// are _unique_ so we'll never apply any additional orders
-				// after ordering by key.
-				child.Orders = child.Orders[:i+1]
-				break orders
-			}
-		}
+// ExplainQuery implements dsq.Explainer.
+func (d *Datastore) ExplainQuery(q dsq.Query) dsq.Explain {
+	plan, cq := d.plan(q)
+	plan.Children = []dsq.Explain{ds.Explain(d.child, cq)}
+	return plan
+}
 
-		// Can't handle this order under transform, punt it to a naive
-		// ordering.
-		naive.Orders = q.Orders
-		child.Orders = nil
-		naive.Offset = q.Offset
-		child.Offset = 0
-		naive.Limit = q.Limit
-		child.Limit = 0
-		break
+// plan splits the query into the part the child datastore can run, and a
+// residual part applied to its results, and returns the query for the child.
+// That way, we can make the child datastore do as much work as possible.
+//
+// What can be pushed down depends on the Properties the transform declares.
+// Transforms that don't declare them are assumed to preserve prefixes and key
+// comparisons, but not orders, as they always were.
+func (d *Datastore) plan(q dsq.Query) (dsq.Explain, dsq.Query) {
+	props, declared := PropertiesOf(d.KeyTransform)
+	if !declared {
+		props = Properties{PrefixPreserving: true, PrefixInvertible: true}
 	}
+	plan := dsq.Plan(q, dsq.Capabilities{
+		Prefix:       props.PrefixPreserving,
+		KeyPrefixes:  props.PrefixInvertible,
+		KeyRanges:    props.OrderPreserving || !declared,
+		ValueFilters: true,
+		KeyOrders:    props.OrderPreserving,
+		ValueOrders:  true,
+		Limit:        true,
+	})
 
-	// Try to let the child handle the filters.
-
-	// don't modify the original filters.
-	child.Filters = append([]dsq.Filter(nil), child.Filters...)
+	child := plan.Native
+	if props.PrefixPreserving {
+		child.Prefix = d.ConvertKey(ds.NewKey(child.Prefix)).String()
+	}
+	child.Filters = make([]dsq.Filter, len(plan.Native.Filters))
+	for i, f := range plan.Native.Filters {
+		child.Filters[i] = d.convertFilter(f)
+	}
+	if len(child.Filters) == 0 {
+		child.Filters = nil
+	}
+	return plan, child
+}
 
-	for i, f := range child.Filters {
-		switch f := f.(type) {
-		case dsq.FilterValueCompare, *dsq.FilterValueCompare:
-			continue
-		case dsq.FilterKeyCompare:
-			child.Filters[i] = dsq.FilterKeyCompare{
-				Op:  f.Op,
-				Key: d.ConvertKey(ds.NewKey(f.Key)).String(),
-			}
-			continue
-		case *dsq.FilterKeyCompare:
-			child.Filters[i] = &dsq.FilterKeyCompare{
-				Op:  f.Op,
-				Key: d.ConvertKey(ds.NewKey(f.Key)).String(),
-			}
-			continue
-		case dsq.FilterKeyPrefix:
-			child.Filters[i] = dsq.FilterKeyPrefix{
-				Prefix: d.ConvertKey(ds.NewKey(f.Prefix)).String(),
-			}
-			continue
-		case *dsq.FilterKeyPrefix:
-			child.Filters[i] = &dsq.FilterKeyPrefix{
-				Prefix: d.ConvertKey(ds.NewKey(f.Prefix)).String(),
-			}
-			continue
+// convertFilter converts f, a filter the plan found native, to apply to the
+// keys of the child datastore.
+func (d *Datastore) convertFilter(f dsq.Filter) dsq.Filter {
+	switch f := f.(type) {
+	case dsq.FilterKeyCompare:
+		return dsq.FilterKeyCompare{
+			Op:  f.Op,
+			Key: d.ConvertKey(ds.NewKey(f.Key)).String(),
+		}
+	case dsq.FilterKeyPrefix:
+		// Prefixes not starting with "/" match no key, or every key if
+		// empty, whether converted or not.
+		if !strings.HasPrefix(f.Prefix, "/") {
+			return f
 		}
+		return dsq.FilterKeyPrefix{Prefix: ConvertPrefix(d.KeyTransform, f.Prefix)}
+	case dsq.FilterNot:
+		return dsq.FilterNot{Negated: d.convertFilter(f.Negated)}
+	case dsq.FilterAnd:
+		return dsq.FilterAnd{Filters: d.convertFilters(f.Filters)}
+	case dsq.FilterOr:
+		return dsq.FilterOr{Filters: d.convertFilters(f.Filters)}
+	}
+	// Filters on values, sizes and expirations apply as they are.
+	return f
+}
 
-		// Not a known filter, defer to the naive implementation.
-		naive.Filters = q.Filters
-		child.Filters = nil
-		naive.Offset = q.Offset
-		child.Offset = 0
-		naive.Limit = q.Limit
-		child.Limit = 0
-		break
+func (d *Datastore) convertFilters(filters []dsq.Filter) []dsq.Filter {
+	converted := make([]dsq.Filter, len(filters))
+	for i, f := range filters {
+		converted[i] = d.convertFilter(f)
 	}
-	return
+	return converted
 }
 
 func (d *Datastore) Close() error {
@@ -237,6 +244,7 @@ func (d *Datastore) NewTransaction(ctx context.Context, readOnly bool) (ds.Txn,
 	}
 
 	return &transformTxn{
+		ds:  d,
 		dst: childTxn,
 		f:   d.ConvertKey,
 	}, nil
@@ -296,7 +304,7 @@ func (t *transformTxn) GetSize(ctx context.Context, key ds.Key) (size int, err e
 }
 
 func (t *transformTxn) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
-	return t.ds.Query(ctx, q)
+	return t.ds.query(ctx, t.dst, q)
 }
 
 func (t *transformTxn) Discard(ctx context.Context) {
@@ -323,3 +331,27 @@ func (d *Datastore) CollectGarbage(ctx context.Context) error {
 	}
 	return nil
 }
+
+func (d *Datastore) PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error {
+	tds, ok := d.child.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	return tds.PutWithTTL(ctx, d.ConvertKey(key), value, ttl)
+}
+
+func (d *Datastore) SetTTL(ctx context.Context, key ds.Key, ttl time.Duration) error {
+	tds, ok := d.child.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	return tds.SetTTL(ctx, d.ConvertKey(key), ttl)
+}
+
+func (d *Datastore) GetExpiration(ctx context.Context, key ds.Key) (time.Time, error) {
+	tds, ok := d.child.(ds.TTLDatastore)
+	if !ok {
+		return time.Time{}, ds.ErrTTLUnsupported
+	}
+	return tds.GetExpiration(ctx, d.ConvertKey(key))
+}
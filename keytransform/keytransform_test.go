@@ -3,6 +3,7 @@ package keytransform_test
 import (
 	"context"
 	"slices"
+	"strings"
 	"testing"
 
 	ds "github.com/ipfs/go-datastore"
@@ -111,3 +112,233 @@ func TestSuitePrefixTransform(t *testing.T) {
 	ktds := kt.Wrap(mpds, kt.PrefixTransform{Prefix: ds.NewKey("/foo")})
 	dstest.SubtestAll(t, ktds)
 }
+
+// suffixTransform appends "x" to every namespace. It preserves prefixes, but
+// not string prefixes nor orders.
+type suffixTransform struct{}
+
+func (suffixTransform) ConvertKey(k ds.Key) ds.Key {
+	if k.String() == "/" {
+		return k
+	}
+	l := k.List()
+	for i := range l {
+		l[i] += "x"
+	}
+	return ds.KeyWithNamespaces(l)
+}
+
+func (suffixTransform) InvertKey(k ds.Key) ds.Key {
+	if k.String() == "/" {
+		return k
+	}
+	l := k.List()
+	for i := range l {
+		l[i] = strings.TrimSuffix(l[i], "x")
+	}
+	return ds.KeyWithNamespaces(l)
+}
+
+func (suffixTransform) Properties() kt.Properties {
+	return kt.Properties{PrefixPreserving: true}
+}
+
+// reverseTransform reverses the namespaces of keys, and declares no property.
+type reverseTransform struct{}
+
+func (reverseTransform) ConvertKey(k ds.Key) ds.Key { return k.Reverse() }
+func (reverseTransform) InvertKey(k ds.Key) ds.Key  { return k.Reverse() }
+func (reverseTransform) Properties() kt.Properties  { return kt.Properties{} }
+
+func TestCheckTransform(t *testing.T) {
+	dstest.CheckTransform(t, kt.PrefixTransform{Prefix: ds.NewKey("/p")}, nil)
+	dstest.CheckTransform(t, suffixTransform{}, nil)
+	dstest.CheckTransform(t, reverseTransform{}, nil)
+	dstest.CheckTransform(t, pair, nil)
+}
+
+// queryRecorder records the queries it runs.
+type queryRecorder struct {
+	ds.Datastore
+	queries []dsq.Query
+}
+
+func (r *queryRecorder) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	r.queries = append(r.queries, q)
+	return r.Datastore.Query(ctx, q)
+}
+
+func TestQueryPushdown(t *testing.T) {
+	ctx := context.Background()
+	q := dsq.Query{
+		Prefix:  "/a",
+		Filters: []dsq.Filter{dsq.FilterKeyPrefix{Prefix: "/a/b"}},
+		Orders:  []dsq.Order{dsq.OrderByKey{}},
+		Limit:   2,
+	}
+	run := func(tr kt.KeyTransform) dsq.Query {
+		rec := &queryRecorder{Datastore: ds.NewMapDatastore()}
+		res, err := kt.Wrap(rec, tr).Query(ctx, q)
+		require.NoError(t, err)
+		_, err = res.Rest()
+		require.NoError(t, err)
+		require.Len(t, rec.queries, 1)
+		return rec.queries[0]
+	}
+
+	cq := run(kt.PrefixTransform{Prefix: ds.NewKey("/p")})
+	require.Equal(t, "/p/a", cq.Prefix)
+	require.Equal(t, []dsq.Filter{dsq.FilterKeyPrefix{Prefix: "/p/a/b"}}, cq.Filters)
+	require.Equal(t, q.Orders, cq.Orders)
+	require.Equal(t, 2, cq.Limit)
+
+	q.Filters = []dsq.Filter{dsq.Or(dsq.Not(&dsq.FilterKeyCompare{Op: dsq.LessThan, Key: "/a/c"}), dsq.FilterValuePrefix{Prefix: []byte("v")})}
+	cq = run(kt.PrefixTransform{Prefix: ds.NewKey("/p")})
+	require.Equal(t, []dsq.Filter{dsq.Or(dsq.FilterKeyCompare{Op: dsq.GreaterThanOrEqual, Key: "/p/a/c"}, dsq.FilterValuePrefix{Prefix: []byte("v")})}, cq.Filters)
+	require.Equal(t, 2, cq.Limit)
+
+	// Filters are pushed down one by one.
+	q.Filters = []dsq.Filter{dsq.FilterKeyGlob{Pattern: "/a/*"}, dsq.FilterValuePrefix{Prefix: []byte("v")}}
+	cq = run(kt.PrefixTransform{Prefix: ds.NewKey("/p")})
+	require.Equal(t, []dsq.Filter{dsq.FilterValuePrefix{Prefix: []byte("v")}}, cq.Filters)
+	require.Equal(t, q.Orders, cq.Orders)
+	require.Zero(t, cq.Limit)
+
+	e := ds.Explain(kt.Wrap(ds.NewMapDatastore(), kt.PrefixTransform{Prefix: ds.NewKey("/p")}), q)
+	require.Equal(t, []dsq.Filter{dsq.FilterKeyGlob{Pattern: "/a/*"}}, e.Residual.Filters)
+	require.Equal(t, 2, e.Residual.Limit)
+	require.Len(t, e.Children, 1)
+	require.Equal(t, cq, e.Children[0].Query)
+
+	q.Filters = []dsq.Filter{dsq.FilterKeyPrefix{Prefix: "/a/b"}}
+	cq = run(suffixTransform{})
+	require.Equal(t, "/ax", cq.Prefix)
+	require.Empty(t, cq.Filters)
+	require.Empty(t, cq.Orders)
+	require.Zero(t, cq.Limit)
+
+	cq = run(reverseTransform{})
+	require.Empty(t, cq.Prefix)
+	require.Empty(t, cq.Filters)
+	require.Empty(t, cq.Orders)
+	require.Zero(t, cq.Limit)
+}
+
+// unsafeKeys are keys that can't be stored as is by datastores mapping keys
+// to file names.
+var unsafeKeys = []ds.Key{
+	ds.RawKey("/."), ds.RawKey("/a/.."), ds.RawKey("/a/../b"), ds.NewKey("/.dsobject"),
+	ds.NewKey("/a\x00b"), ds.NewKey("/\xff\xfe"), ds.NewKey("/Foo"), ds.NewKey("/FOO/Bar"),
+	ds.NewKey("/a%2fb"), ds.NewKey("/a:b\\c"), ds.NewKey("/x.y"), ds.RawKey("/a//b"),
+}
+
+func TestEscapeTransforms(t *testing.T) {
+	keys := slices.Clone(unsafeKeys)
+	for _, k := range dstest.TransformKeys {
+		keys = append(keys, ds.NewKey(k))
+	}
+
+	safe := func(ns string, foldCase bool) bool {
+		for _, c := range []byte(ns) {
+			switch {
+			case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == '%':
+			case c >= 'A' && c <= 'Z' && !foldCase:
+			default:
+				return false
+			}
+		}
+		return ns[0] != '.'
+	}
+	for _, tc := range []struct {
+		tr       kt.KeyTransform
+		foldCase bool
+	}{
+		{kt.EscapeTransform{}, false},
+		{kt.EscapeTransform{Base32: true}, true},
+		{kt.CaseInsensitiveTransform{}, true},
+	} {
+		dstest.CheckTransform(t, tc.tr, keys)
+		for _, k := range keys {
+			c := tc.tr.ConvertKey(k)
+			require.Equal(t, ds.NewKey(c.String()), c, "%T: %s escapes to unclean key %s", tc.tr, k, c)
+			for _, ns := range c.List() {
+				require.True(t, safe(ns, tc.foldCase), "%T: %s escapes to unsafe namespace %q", tc.tr, k, ns)
+			}
+		}
+	}
+
+	require.Equal(t, "/%2e/a%00b/%2edsobject/x.y/A%3ab", kt.EscapeTransform{}.ConvertKey(ds.RawKey("/./a\x00b/.dsobject/x.y/A:b")).String())
+	require.Equal(t, "/%46oo/bar", kt.CaseInsensitiveTransform{}.ConvertKey(ds.NewKey("/Foo/bar")).String())
+	require.Equal(t, "/cpnmu/c9gn4", kt.EscapeTransform{Base32: true}.ConvertKey(ds.NewKey("/foo/bar")).String())
+	require.Panics(t, func() { kt.EscapeTransform{}.InvertKey(ds.NewKey("/a%2")) })
+	require.Panics(t, func() { kt.EscapeTransform{}.InvertKey(ds.NewKey("/a%zz")) })
+	require.Panics(t, func() { kt.EscapeTransform{Base32: true}.InvertKey(ds.NewKey("/xyz")) })
+	require.Equal(t, "/a/%/b", kt.EscapeTransform{}.ConvertKey(ds.RawKey("/a//b")).String())
+	require.Equal(t, "/c4/%/c8", kt.EscapeTransform{Base32: true}.ConvertKey(ds.RawKey("/a//b")).String())
+	_, err := kt.EscapeTransform{}.TryInvertKey(ds.NewKey("/a%zz"))
+	require.Error(t, err)
+	_, err = kt.EscapeTransform{Base32: true}.TryInvertKey(ds.RawKey("/c4//c8"))
+	require.Error(t, err)
+}
+
+func TestShardTransform(t *testing.T) {
+	keys := slices.Clone(unsafeKeys)
+	for _, k := range dstest.TransformKeys {
+		keys = append(keys, ds.NewKey(k))
+	}
+	dstest.CheckTransform(t, kt.ShardTransform{Shard: kt.NextToLast(2)}, keys)
+	dstest.CheckTransform(t, kt.ShardTransform{Shard: kt.HashShard(3)}, keys)
+
+	tr := kt.ShardTransform{Shard: kt.NextToLast(2)}
+	require.Equal(t, "/a/b/BC/CIQABCD", tr.ConvertKey(ds.NewKey("/a/b/CIQABCD")).String())
+	require.Equal(t, "/__/x", tr.ConvertKey(ds.NewKey("/x")).String())
+	require.Equal(t, "/_a/ab", tr.ConvertKey(ds.NewKey("/ab")).String())
+	require.Equal(t, "/__/a..b", tr.ConvertKey(ds.NewKey("/a..b")).String())
+	require.Equal(t, "/", tr.ConvertKey(ds.NewKey("/")).String())
+	require.Panics(t, func() { tr.InvertKey(ds.NewKey("/x")) })
+	require.Panics(t, func() { tr.InvertKey(ds.NewKey("/zz/x")) })
+	_, err := tr.TryInvertKey(ds.NewKey("/zz/x"))
+	require.Error(t, err)
+
+	hashed := kt.ShardTransform{Shard: kt.HashShard(2)}.ConvertKey(ds.NewKey("/a/b"))
+	require.Len(t, hashed.List(), 3)
+	require.Len(t, hashed.List()[1], 2)
+}
+
+func TestShardFuncLengths(t *testing.T) {
+	k := ds.NewKey("/a/b")
+	require.Panics(t, func() { kt.NextToLast(0) })
+	require.Panics(t, func() { kt.NextToLast(-1) })
+	require.Equal(t, "_", kt.NextToLast(1)(k))
+
+	require.Panics(t, func() { kt.HashShard(0) })
+	require.Panics(t, func() { kt.HashShard(65) })
+	require.Len(t, kt.HashShard(1)(k), 1)
+	require.Len(t, kt.HashShard(64)(k), 64)
+}
+
+func TestQueryForeignKeys(t *testing.T) {
+	ctx := context.Background()
+	child := ds.NewMapDatastore()
+	d := kt.Wrap(child, kt.ShardTransform{Shard: kt.NextToLast(2)})
+
+	require.NoError(t, d.Put(ctx, ds.NewKey("/abc"), []byte("v")))
+	// Keys the transform didn't convert are returned as errors, without
+	// ending the results.
+	require.NoError(t, child.Put(ctx, ds.NewKey("/x"), []byte("v")))
+	require.NoError(t, child.Put(ctx, ds.NewKey("/zz/x"), []byte("v")))
+
+	res, err := d.Query(ctx, dsq.Query{KeysOnly: true})
+	require.NoError(t, err)
+	var keys []string
+	errs := 0
+	for r := range res.Next() {
+		if r.Error != nil {
+			errs++
+			continue
+		}
+		keys = append(keys, r.Key)
+	}
+	require.Equal(t, []string{"/abc"}, keys)
+	require.Equal(t, 2, errs)
+}
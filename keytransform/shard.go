@@ -0,0 +1,102 @@
+package keytransform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// ShardFunc returns the name of the fan-out namespace a key is stored under.
+// It must be a valid, non-empty namespace.
+type ShardFunc func(k ds.Key) string
+
+// NextToLast returns a ShardFunc sharding keys by the n characters preceding
+// the last character of their last namespace, like flatfs' next-to-last/n.
+// Shorter namespaces are padded with '_', and characters other than ASCII
+// letters, digits and '-' are replaced with '_', so that shards are always
+// file name safe. It panics if n is less than 1.
+func NextToLast(n int) ShardFunc {
+	if n < 1 {
+		panic(fmt.Sprintf("keytransform: NextToLast shard length %d is less than 1", n))
+	}
+	return func(k ds.Key) string {
+		name := k.BaseNamespace()
+		name = strings.Repeat("_", max(n+1-len(name), 0)) + name
+		return strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+				return r
+			}
+			return '_'
+		}, name[len(name)-n-1:len(name)-1])
+	}
+}
+
+// HashShard returns a ShardFunc sharding keys by the first n hexadecimal
+// digits of the SHA-256 hash of the key, spreading keys evenly whatever their
+// names. It panics if n is not between 1 and 64, the length of the hash.
+func HashShard(n int) ShardFunc {
+	if n < 1 || n > hex.EncodedLen(sha256.Size) {
+		panic(fmt.Sprintf("keytransform: HashShard shard length %d is not between 1 and %d", n, hex.EncodedLen(sha256.Size)))
+	}
+	return func(k ds.Key) string {
+		sum := sha256.Sum256([]byte(k.String()))
+		return hex.EncodeToString(sum[:])[:n]
+	}
+}
+
+// ShardTransform inserts a fan-out namespace, named by Shard, before the last
+// namespace of keys, so that a datastore storing namespaces as directories,
+// like examples/fs, doesn't store too many entries in a single directory.
+//
+// Warning: InvertKey panics if a key doesn't hold the namespace Shard gives
+// it. This is to avoid insidious data inconsistency errors.
+type ShardTransform struct {
+	Shard ShardFunc
+}
+
+// ConvertKey inserts the shard of k before its last namespace.
+func (t ShardTransform) ConvertKey(k ds.Key) ds.Key {
+	if k.String() == "/" {
+		return k
+	}
+	l := k.List()
+	l = slices.Insert(l, len(l)-1, t.Shard(k))
+	return ds.RawKey("/" + strings.Join(l, "/"))
+}
+
+// InvertKey removes the shard of k. It panics if the shard is not found.
+func (t ShardTransform) InvertKey(k ds.Key) ds.Key {
+	return mustInvert(t.TryInvertKey(k))
+}
+
+// TryInvertKey implements Inverter.
+func (t ShardTransform) TryInvertKey(k ds.Key) (ds.Key, error) {
+	if k.String() == "/" {
+		return k, nil
+	}
+	l := k.List()
+	if len(l) < 2 {
+		return ds.Key{}, fmt.Errorf("keytransform: expected shard not found in %s", k)
+	}
+	shard := l[len(l)-2]
+	inv := ds.RawKey("/" + strings.Join(slices.Delete(l, len(l)-2, len(l)-1), "/"))
+	if shard != t.Shard(inv) {
+		return ds.Key{}, fmt.Errorf("keytransform: expected shard not found in %s", k)
+	}
+	return inv, nil
+}
+
+// Properties implements Declarer. Sharding preserves neither the order nor the
+// prefixes of keys.
+func (t ShardTransform) Properties() Properties {
+	return Properties{}
+}
+
+var (
+	_ Declarer = ShardTransform{}
+	_ Inverter = ShardTransform{}
+)
@@ -51,3 +51,11 @@ func (p PrefixTransform) InvertKey(k ds.Key) ds.Key {
 }
 
 var _ KeyTransform = (*PrefixTransform)(nil)
+
+// Properties implements Declarer. Adding a prefix preserves the order and the
+// prefixes of keys.
+func (p PrefixTransform) Properties() Properties {
+	return Properties{OrderPreserving: true, PrefixPreserving: true, PrefixInvertible: true}
+}
+
+var _ Declarer = PrefixTransform{}
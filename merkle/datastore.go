@@ -0,0 +1,283 @@
+package merkle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// Datastore wraps a datastore and keeps a Tree over its entries up to date
+// as writes go through it.
+//
+// To know which hash to remove from the tree, every write reads the previous
+// value of its key first, and writes are serialized. Writes that bypass the
+// wrapper (including transactions on the child) are not reflected in the tree
+// until it is rebuilt; for that reason the wrapper does not expose the
+// child's transactions, nor its TTLs, whose expiry would bypass it too.
+//
+// Datastore implements the other optional features whether or not the child
+// does; use scoped.Inherit to only expose the features the child supports.
+type Datastore struct {
+	ds.Datastore
+
+	writeLk sync.Mutex
+	tree    *Tree
+}
+
+var _ ds.Datastore = (*Datastore)(nil)
+var _ ds.Batching = (*Datastore)(nil)
+var _ ds.Shim = (*Datastore)(nil)
+var _ ds.PersistentDatastore = (*Datastore)(nil)
+var _ ds.CheckedDatastore = (*Datastore)(nil)
+var _ ds.ScrubbedDatastore = (*Datastore)(nil)
+var _ ds.GCDatastore = (*Datastore)(nil)
+
+// Wrap builds a tree over child with a full scan and returns a datastore that
+// keeps the tree up to date. See NewTree for leafSize.
+func Wrap(ctx context.Context, child ds.Datastore, leafSize int) (*Datastore, error) {
+	t, err := NewTree(ctx, child, leafSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Datastore{Datastore: child, tree: t}, nil
+}
+
+// Tree returns the tree over the datastore's entries.
+func (d *Datastore) Tree() *Tree {
+	return d.tree
+}
+
+// Children implements ds.Shim
+func (d *Datastore) Children() []ds.Datastore {
+	return []ds.Datastore{d.Datastore}
+}
+
+func (d *Datastore) currentHash(ctx context.Context, key ds.Key) (*Hash, error) {
+	v, err := d.Datastore.Get(ctx, key)
+	if errors.Is(err, ds.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	h := entryHash(key.String(), v)
+	return &h, nil
+}
+
+// Put implements ds.Datastore.Put
+func (d *Datastore) Put(ctx context.Context, key ds.Key, value []byte) error {
+	d.writeLk.Lock()
+	defer d.writeLk.Unlock()
+
+	old, err := d.currentHash(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := d.Datastore.Put(ctx, key, value); err != nil {
+		return err
+	}
+	h := entryHash(key.String(), value)
+	return d.tree.update(ctx, key.String(), old, &h)
+}
+
+// Delete implements ds.Datastore.Delete
+func (d *Datastore) Delete(ctx context.Context, key ds.Key) error {
+	d.writeLk.Lock()
+	defer d.writeLk.Unlock()
+
+	old, err := d.currentHash(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := d.Datastore.Delete(ctx, key); err != nil {
+		return err
+	}
+	return d.tree.update(ctx, key.String(), old, nil)
+}
+
+// Batch implements ds.Batching. If the child does not support batching, the
+// batch applies its operations one by one on Commit.
+func (d *Datastore) Batch(ctx context.Context) (ds.Batch, error) {
+	var child ds.Batch
+	if bds, ok := d.Datastore.(ds.Batching); ok {
+		var err error
+		if child, err = bds.Batch(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return &batch{d: d, child: child, ops: make(map[ds.Key]*[]byte)}, nil
+}
+
+// DiskUsage implements ds.PersistentDatastore.
+func (d *Datastore) DiskUsage(ctx context.Context) (uint64, error) {
+	return ds.DiskUsage(ctx, d.Datastore)
+}
+
+// Check implements ds.CheckedDatastore.
+func (d *Datastore) Check(ctx context.Context) error {
+	if c, ok := d.Datastore.(ds.CheckedDatastore); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+// Scrub implements ds.ScrubbedDatastore. Scrubbing may repair entries behind
+// the wrapper's back, so the tree is rebuilt afterwards.
+func (d *Datastore) Scrub(ctx context.Context) error {
+	c, ok := d.Datastore.(ds.ScrubbedDatastore)
+	if !ok {
+		return nil
+	}
+	d.writeLk.Lock()
+	defer d.writeLk.Unlock()
+	if err := c.Scrub(ctx); err != nil {
+		return err
+	}
+	t, err := NewTree(ctx, d.Datastore, d.tree.leafSize)
+	if err != nil {
+		return err
+	}
+	d.tree.mu.Lock()
+	d.tree.root = t.root
+	d.tree.mu.Unlock()
+	return nil
+}
+
+// CollectGarbage implements ds.GCDatastore.
+func (d *Datastore) CollectGarbage(ctx context.Context) error {
+	if c, ok := d.Datastore.(ds.GCDatastore); ok {
+		return c.CollectGarbage(ctx)
+	}
+	return nil
+}
+
+// reconcileRange writes the differences between the local entries in a range
+// and the given remote entries.
+func (d *Datastore) reconcileRange(ctx context.Context, re RangeEntries) (int, error) {
+	local, err := scanRange(ctx, d.Datastore, re.Range)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	remote := re.Entries
+	for len(local) > 0 || len(remote) > 0 {
+		cmp := 0
+		switch {
+		case len(local) == 0:
+			cmp = 1
+		case len(remote) == 0:
+			cmp = -1
+		default:
+			cmp = strings.Compare(local[0].Key, remote[0].Key)
+		}
+
+		switch {
+		case cmp < 0:
+			if err := d.Delete(ctx, ds.RawKey(local[0].Key)); err != nil {
+				return changed, err
+			}
+			changed++
+			local = local[1:]
+		case cmp > 0:
+			if err := d.Put(ctx, ds.RawKey(remote[0].Key), remote[0].Value); err != nil {
+				return changed, err
+			}
+			changed++
+			remote = remote[1:]
+		default:
+			if entryHash(local[0].Key, local[0].Value) != entryHash(remote[0].Key, remote[0].Value) {
+				if err := d.Put(ctx, ds.RawKey(remote[0].Key), remote[0].Value); err != nil {
+					return changed, err
+				}
+				changed++
+			}
+			local, remote = local[1:], remote[1:]
+		}
+	}
+	return changed, nil
+}
+
+type batch struct {
+	d     *Datastore
+	child ds.Batch
+
+	lk sync.Mutex
+	// ops maps keys to their new value, nil for deletes.
+	ops map[ds.Key]*[]byte
+}
+
+func (b *batch) Put(ctx context.Context, key ds.Key, value []byte) error {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	b.ops[key] = &value
+	return nil
+}
+
+func (b *batch) Delete(ctx context.Context, key ds.Key) error {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	b.ops[key] = nil
+	return nil
+}
+
+func (b *batch) Commit(ctx context.Context) error {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	b.d.writeLk.Lock()
+	defer b.d.writeLk.Unlock()
+
+	olds := make(map[ds.Key]*Hash, len(b.ops))
+	for k := range b.ops {
+		old, err := b.d.currentHash(ctx, k)
+		if err != nil {
+			return err
+		}
+		olds[k] = old
+	}
+
+	if b.child != nil {
+		for k, v := range b.ops {
+			var err error
+			if v == nil {
+				err = b.child.Delete(ctx, k)
+			} else {
+				err = b.child.Put(ctx, k, *v)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := b.child.Commit(ctx); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	for k, v := range b.ops {
+		if b.child == nil {
+			var err error
+			if v == nil {
+				err = b.d.Datastore.Delete(ctx, k)
+			} else {
+				err = b.d.Datastore.Put(ctx, k, *v)
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		var h *Hash
+		if v != nil {
+			nh := entryHash(k.String(), *v)
+			h = &nh
+		}
+		if err := b.d.tree.update(ctx, k.String(), olds[k], h); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
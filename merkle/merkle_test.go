@@ -0,0 +1,178 @@
+package merkle_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/diff"
+	"github.com/ipfs/go-datastore/merkle"
+	dsq "github.com/ipfs/go-datastore/query"
+	dstest "github.com/ipfs/go-datastore/test"
+	"github.com/stretchr/testify/require"
+)
+
+const leafSize = 8
+
+func populate(t *testing.T, d ds.Datastore, n int) {
+	t.Helper()
+	for i := range n {
+		k := ds.NewKey(fmt.Sprintf("/blocks/%04x", i*7919%65536))
+		require.NoError(t, d.Put(context.Background(), k, []byte(k.String())))
+	}
+}
+
+// jsonTransport sends requests to t through a JSON round trip, counting the
+// requests made.
+func jsonTransport(t *testing.T, tree *merkle.Tree, requests *int) merkle.Transport {
+	return func(ctx context.Context, req merkle.Request) (merkle.Response, error) {
+		*requests++
+		b, err := json.Marshal(req)
+		require.NoError(t, err)
+		var decodedReq merkle.Request
+		require.NoError(t, json.Unmarshal(b, &decodedReq))
+
+		resp, err := tree.Handle(ctx, decodedReq)
+		if err != nil {
+			return merkle.Response{}, err
+		}
+		b, err = json.Marshal(resp)
+		require.NoError(t, err)
+		var decodedResp merkle.Response
+		require.NoError(t, json.Unmarshal(b, &decodedResp))
+		return decodedResp, nil
+	}
+}
+
+func TestIncrementalMatchesRebuild(t *testing.T) {
+	ctx := context.Background()
+	child := ds.NewMapDatastore()
+	populate(t, child, 100)
+	d, err := merkle.Wrap(ctx, child, leafSize)
+	require.NoError(t, err)
+
+	rnd := rand.New(rand.NewSource(1))
+	for range 2000 {
+		k := ds.NewKey(fmt.Sprintf("/blocks/%03x", rnd.Intn(1024)))
+		if rnd.Intn(3) == 0 {
+			require.NoError(t, d.Delete(ctx, k))
+		} else {
+			require.NoError(t, d.Put(ctx, k, []byte{byte(rnd.Intn(4))}))
+		}
+	}
+	// keys that are byte prefixes of other keys
+	require.NoError(t, d.Put(ctx, ds.NewKey("/blocks"), []byte("parent")))
+	require.NoError(t, d.Put(ctx, ds.NewKey("/blocks/1"), []byte("short")))
+
+	b, err := d.Batch(ctx)
+	require.NoError(t, err)
+	require.NoError(t, b.Put(ctx, ds.NewKey("/batched"), []byte("x")))
+	require.NoError(t, b.Delete(ctx, ds.NewKey("/blocks/1")))
+	require.NoError(t, b.Commit(ctx))
+
+	rebuilt, err := merkle.NewTree(ctx, child, leafSize)
+	require.NoError(t, err)
+	require.Equal(t, rebuilt.Root(), d.Tree().Root())
+
+	ranges, err := merkle.Diff(ctx, d.Tree(), rebuilt.Handle)
+	require.NoError(t, err)
+	require.Empty(t, ranges)
+}
+
+// blockingQueries blocks queries on release once started is set.
+type blockingQueries struct {
+	*ds.MapDatastore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingQueries) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	if b.started != nil {
+		close(b.started)
+		<-b.release
+	}
+	return b.MapDatastore.Query(ctx, q)
+}
+
+func TestSplitDoesNotBlockReads(t *testing.T) {
+	ctx := context.Background()
+	child := &blockingQueries{MapDatastore: ds.NewMapDatastore()}
+	d, err := merkle.Wrap(ctx, child, leafSize)
+	require.NoError(t, err)
+	tree := d.Tree()
+	populate(t, d, leafSize)
+
+	// The next put splits the root, scanning the child.
+	child.started = make(chan struct{})
+	child.release = make(chan struct{})
+	done := make(chan error)
+	go func() { done <- d.Put(ctx, ds.NewKey("/split"), []byte("x")) }()
+	<-child.started
+
+	read := make(chan merkle.Node)
+	go func() { read <- tree.Root() }()
+	select {
+	case root := <-read:
+		require.Equal(t, uint64(leafSize+1), root.Count)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading the tree blocked on the split")
+	}
+	close(child.release)
+	require.NoError(t, <-done)
+
+	rebuilt, err := merkle.NewTree(ctx, child.MapDatastore, leafSize)
+	require.NoError(t, err)
+	require.Equal(t, rebuilt.Root(), tree.Root())
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+
+	primaryChild := ds.NewMapDatastore()
+	replicaChild := ds.NewMapDatastore()
+	populate(t, primaryChild, 2000)
+	populate(t, replicaChild, 2000)
+
+	primary, err := merkle.Wrap(ctx, primaryChild, leafSize)
+	require.NoError(t, err)
+	replica, err := merkle.Wrap(ctx, replicaChild, leafSize)
+	require.NoError(t, err)
+	require.Equal(t, primary.Tree().Root(), replica.Tree().Root())
+
+	require.NoError(t, primary.Put(ctx, ds.NewKey("/blocks/0000"), []byte("changed")))
+	require.NoError(t, primary.Put(ctx, ds.NewKey("/blocks/new"), []byte("new")))
+	require.NoError(t, primary.Put(ctx, ds.NewKey("/blocks"), []byte("exact")))
+	require.NoError(t, replica.Delete(ctx, ds.NewKey("/blocks/1eef")))
+	require.NoError(t, replica.Put(ctx, ds.NewKey("/stale/key"), []byte("stale")))
+
+	requests := 0
+	ranges, err := merkle.Diff(ctx, replica.Tree(), jsonTransport(t, primary.Tree(), &requests))
+	require.NoError(t, err)
+	require.NotEmpty(t, ranges)
+	// at most one request per byte of the longest key, however many keys
+	require.LessOrEqual(t, requests, len("/blocks/0000")+1)
+	for _, r := range ranges {
+		if !r.Exact {
+			require.NotEqual(t, "", r.Prefix)
+		}
+	}
+
+	n, err := merkle.Reconcile(ctx, replica, jsonTransport(t, primary.Tree(), &requests))
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+
+	equal, err := diff.Equal(ctx, primaryChild, replicaChild, ds.NewKey("/"))
+	require.NoError(t, err)
+	require.True(t, equal)
+	require.Equal(t, primary.Tree().Root(), replica.Tree().Root())
+}
+
+func TestSuite(t *testing.T) {
+	d, err := merkle.Wrap(context.Background(), dstest.NewTestDatastore(false), leafSize)
+	require.NoError(t, err)
+	dstest.SubtestAll(t, d)
+}
@@ -0,0 +1,184 @@
+package merkle
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Range identifies a set of keys: the keys starting with the byte prefix
+// Prefix, or only the key equal to Prefix if Exact is set.
+type Range struct {
+	Prefix string `json:"prefix"`
+	Exact  bool   `json:"exact,omitempty"`
+}
+
+// Node summarizes the entries in a Range.
+type Node struct {
+	Range
+	Count uint64 `json:"count"`
+	Hash  Hash   `json:"hash"`
+}
+
+// Entry is a key-value pair sent when reconciling a range.
+type Entry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// Request asks a tree to expand prefixes into the summaries of their
+// children, and to send the entries of ranges.
+type Request struct {
+	Expand []string `json:"expand,omitempty"`
+	Fetch  []Range  `json:"fetch,omitempty"`
+}
+
+// Expansion holds the children of an expanded prefix.
+type Expansion struct {
+	Prefix   string `json:"prefix"`
+	Children []Node `json:"children"`
+}
+
+// RangeEntries holds the entries of a fetched range, in key order.
+type RangeEntries struct {
+	Range   Range   `json:"range"`
+	Entries []Entry `json:"entries"`
+}
+
+// Response answers a Request. Expanded and Fetched are in the order of the
+// corresponding Request fields.
+type Response struct {
+	Expanded []Expansion    `json:"expanded,omitempty"`
+	Fetched  []RangeEntries `json:"fetched,omitempty"`
+}
+
+// Transport sends a request to a remote tree and returns its response. A
+// local tree's Handle method is a Transport.
+type Transport func(ctx context.Context, req Request) (Response, error)
+
+// FetchBatchSize is the maximum number of ranges fetched per request by
+// Reconcile.
+var FetchBatchSize = 64
+
+// Handle answers a request from a remote tree.
+func (t *Tree) Handle(ctx context.Context, req Request) (Response, error) {
+	var resp Response
+	for _, p := range req.Expand {
+		children, err := t.expand(ctx, p)
+		if err != nil {
+			return Response{}, fmt.Errorf("expanding %q: %w", p, err)
+		}
+		resp.Expanded = append(resp.Expanded, Expansion{Prefix: p, Children: children})
+	}
+	for _, r := range req.Fetch {
+		entries, err := scanRange(ctx, t.src, r)
+		if err != nil {
+			return Response{}, fmt.Errorf("fetching %q: %w", r.Prefix, err)
+		}
+		resp.Fetched = append(resp.Fetched, RangeEntries{Range: r, Entries: entries})
+	}
+	return resp, nil
+}
+
+// Diff walks the local and remote trees level by level and returns the
+// smallest ranges in which they differ. It sends one request per tree level
+// that contains differences.
+func Diff(ctx context.Context, local *Tree, remote Transport) ([]Range, error) {
+	var diffs []Range
+	pending := []string{""}
+	for len(pending) > 0 {
+		resp, err := remote(ctx, Request{Expand: pending})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Expanded) != len(pending) {
+			return nil, fmt.Errorf("merkle: expected %d expansions, got %d", len(pending), len(resp.Expanded))
+		}
+
+		var next []string
+		for i, p := range pending {
+			exp := resp.Expanded[i]
+			if exp.Prefix != p {
+				return nil, fmt.Errorf("merkle: expected expansion of %q, got %q", p, exp.Prefix)
+			}
+			localChildren, err := local.expand(ctx, p)
+			if err != nil {
+				return nil, err
+			}
+
+			nodes := make(map[Range][2]Node)
+			for _, n := range localChildren {
+				pair := nodes[n.Range]
+				pair[0] = n
+				nodes[n.Range] = pair
+			}
+			for _, n := range exp.Children {
+				pair := nodes[n.Range]
+				pair[1] = n
+				nodes[n.Range] = pair
+			}
+
+			for r, pair := range nodes {
+				l, rm := pair[0], pair[1]
+				if l.Count == rm.Count && l.Hash == rm.Hash {
+					continue
+				}
+				if r.Exact ||
+					(l.Count <= uint64(local.leafSize) && rm.Count <= uint64(local.leafSize)) {
+					diffs = append(diffs, r)
+				} else {
+					next = append(next, r.Prefix)
+				}
+			}
+		}
+		slices.Sort(next)
+		pending = next
+	}
+	slices.SortFunc(diffs, func(a, b Range) int {
+		if c := strings.Compare(a.Prefix, b.Prefix); c != 0 {
+			return c
+		}
+		switch {
+		case a.Exact == b.Exact:
+			return 0
+		case a.Exact:
+			return -1
+		default:
+			return 1
+		}
+	})
+	return diffs, nil
+}
+
+// Reconcile makes local hold the same entries as remote. It finds the
+// differing ranges with Diff, fetches the remote entries of those ranges and
+// writes the differences to local, which keeps local's tree up to date. It
+// returns the number of keys put or deleted.
+func Reconcile(ctx context.Context, local *Datastore, remote Transport) (int, error) {
+	ranges, err := Diff(ctx, local.tree, remote)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for len(ranges) > 0 {
+		n := min(len(ranges), FetchBatchSize)
+		resp, err := remote(ctx, Request{Fetch: ranges[:n]})
+		if err != nil {
+			return changed, err
+		}
+		if len(resp.Fetched) != n {
+			return changed, fmt.Errorf("merkle: expected %d fetched ranges, got %d", n, len(resp.Fetched))
+		}
+		for _, re := range resp.Fetched {
+			c, err := local.reconcileRange(ctx, re)
+			changed += c
+			if err != nil {
+				return changed, err
+			}
+		}
+		ranges = ranges[n:]
+	}
+	return changed, nil
+}
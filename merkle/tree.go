@@ -0,0 +1,409 @@
+// Package merkle maintains a hash tree over the keys of a datastore so that
+// two datastores can find the key ranges in which they differ by exchanging
+// a handful of hashes per tree level, instead of scanning and comparing every
+// entry.
+//
+// The tree is a trie over the bytes of the keys. Every node summarizes the
+// entries whose keys start with the node's prefix: the number of entries and
+// the XOR of the hashes of those entries. A node is split into children (one
+// per next key byte) once it summarizes more than leafSize entries, so the
+// tree stays shallow where keys are sparse and deepens where they are dense.
+// Because summaries are XORs, the summary of any prefix is independent of how
+// the tree happens to be split, and two trees with different shapes can still
+// be compared prefix by prefix.
+//
+// Use NewTree to build a tree over any ds.Read with a single ordered scan, or
+// Wrap to also keep it up to date as writes go through the wrapper. Trees talk
+// to each other with Request and Response messages, which are plain structs
+// that can be JSON encoded to cross a process boundary:
+//
+//	// on the replica holding the authoritative data
+//	primary, _ := merkle.Wrap(ctx, dstore, 256)
+//	serve(func(req merkle.Request) merkle.Response { ... primary.Tree().Handle(ctx, req) ... })
+//
+//	// on the replica to repair
+//	replica, _ := merkle.Wrap(ctx, other, 256)
+//	n, err := merkle.Reconcile(ctx, replica, transportTo(primary))
+package merkle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+	"sync"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+// Hash is the XOR of the hashes of a set of entries.
+type Hash [sha256.Size]byte
+
+// MarshalText implements encoding.TextMarshaler.
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h[:])), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (h *Hash) UnmarshalText(text []byte) error {
+	if hex.DecodedLen(len(text)) != len(h) {
+		return fmt.Errorf("merkle: invalid hash length %d", len(text))
+	}
+	_, err := hex.Decode(h[:], text)
+	return err
+}
+
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+func (h *Hash) xor(o Hash) {
+	for i := range h {
+		h[i] ^= o[i]
+	}
+}
+
+// entryHash hashes a key and its value. The key is length-prefixed so that
+// the boundary between key and value is unambiguous.
+func entryHash(key string, value []byte) Hash {
+	var l [binary.MaxVarintLen64]byte
+	hs := sha256.New()
+	hs.Write(l[:binary.PutUvarint(l[:], uint64(len(key)))])
+	hs.Write([]byte(key))
+	hs.Write(value)
+	var h Hash
+	hs.Sum(h[:0])
+	return h
+}
+
+type summary struct {
+	count uint64
+	hash  Hash
+}
+
+func (s *summary) apply(delta Hash, count int64) {
+	s.hash.xor(delta)
+	s.count = uint64(int64(s.count) + count)
+}
+
+type node struct {
+	summary
+	// children is nil for leaves.
+	children map[byte]*node
+	// self summarizes the key equal to the prefix of a split node.
+	self summary
+}
+
+// Tree is a hash tree over the entries of a datastore. It is safe for
+// concurrent use.
+type Tree struct {
+	mu       sync.RWMutex
+	src      ds.Read
+	leafSize int
+	root     *node
+}
+
+// NewTree builds a tree over the entries of src with a single key-ordered
+// scan. Nodes summarizing more than leafSize entries are split.
+//
+// The tree is a snapshot: writes made to src afterwards are not reflected.
+// Use Wrap for a tree that follows writes.
+func NewTree(ctx context.Context, src ds.Read, leafSize int) (*Tree, error) {
+	if leafSize < 1 {
+		leafSize = 1
+	}
+	t := &Tree{src: src, leafSize: leafSize}
+	root, err := t.scanBuild(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	t.root = root
+	return t, nil
+}
+
+// Root returns the summary of all entries in the tree.
+func (t *Tree) Root() Node {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return Node{Count: t.root.count, Hash: t.root.hash}
+}
+
+// update replaces the hash of key in the tree. A nil old or new hash means
+// the key was or is absent.
+func (t *Tree) update(ctx context.Context, key string, old, new *Hash) error {
+	var delta Hash
+	var count int64
+	if old != nil {
+		delta.xor(*old)
+		count--
+	}
+	if new != nil {
+		delta.xor(*new)
+		count++
+	}
+	if count == 0 && delta == (Hash{}) {
+		return nil
+	}
+
+	n, p, full := t.apply(key, delta, count)
+	if !full {
+		return nil
+	}
+
+	// The leaf is rebuilt without holding the lock, so that reads aren't
+	// blocked by the scan. It is swapped in only if it still summarizes the
+	// entries that were scanned: an oversized leaf is merely slower to expand.
+	split, err := t.scanBuild(ctx, p)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n.children == nil && n.summary == split.summary {
+		*n = *split
+	}
+	return nil
+}
+
+// apply applies the delta of key to the nodes on its path. It returns the
+// leaf holding key and its prefix, and whether the leaf must be split.
+func (t *Tree) apply(key string, delta Hash, count int64) (*node, string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n, p := t.root, ""
+	for {
+		n.apply(delta, count)
+		if n.children == nil {
+			break
+		}
+		if key == p {
+			n.self.apply(delta, count)
+			return n, p, false
+		}
+		c := key[len(p)]
+		child := n.children[c]
+		if child == nil {
+			child = &node{}
+			n.children[c] = child
+		}
+		n, p = child, key[:len(p)+1]
+	}
+	return n, p, n.count > uint64(t.leafSize)
+}
+
+// expand returns the summaries of the children of prefix p. The key equal to
+// p, if present, is returned as an exact node.
+func (t *Tree) expand(ctx context.Context, p string) ([]Node, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	n, q := t.root, ""
+	for n.children != nil && q != p {
+		n = n.children[p[len(q)]]
+		if n == nil {
+			return nil, nil
+		}
+		q = p[:len(q)+1]
+	}
+
+	if n.children != nil {
+		nodes := make([]Node, 0, len(n.children)+1)
+		if n.self.count > 0 {
+			nodes = append(nodes, Node{Range: Range{Prefix: p, Exact: true}, Count: n.self.count, Hash: n.self.hash})
+		}
+		for c, child := range n.children {
+			if child.count > 0 {
+				nodes = append(nodes, Node{Range: Range{Prefix: p + string(c)}, Count: child.count, Hash: child.hash})
+			}
+		}
+		return nodes, nil
+	}
+
+	// p lives inside a leaf, which is small enough to summarize from a scan.
+	byPrefix := map[Range]*Node{}
+	var nodes []*Node
+	for e, err := range scan(ctx, t.src, p) {
+		if err != nil {
+			return nil, err
+		}
+		r := Range{Prefix: p, Exact: true}
+		if e.Key != p {
+			r = Range{Prefix: e.Key[:len(p)+1]}
+		}
+		nd := byPrefix[r]
+		if nd == nil {
+			nd = &Node{Range: r}
+			byPrefix[r] = nd
+			nodes = append(nodes, nd)
+		}
+		nd.Count++
+		nd.Hash.xor(entryHash(e.Key, e.Value))
+	}
+	out := make([]Node, len(nodes))
+	for i, nd := range nodes {
+		out[i] = *nd
+	}
+	return out, nil
+}
+
+// scanBuild builds the subtree for prefix p from the source datastore.
+func (t *Tree) scanBuild(ctx context.Context, p string) (*node, error) {
+	next, stop := iter.Pull2(scan(ctx, t.src, p))
+	defer stop()
+	it := &peekIter{next: next}
+	n, err := t.build(p, it)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok, err := it.peek(); err != nil {
+		return nil, err
+	} else if ok {
+		return nil, fmt.Errorf("merkle: datastore returned keys outside of prefix %q", p)
+	}
+	return n, nil
+}
+
+// build consumes all the entries under prefix p from it and returns the node
+// summarizing them. It holds at most leafSize+1 entries per tree level.
+func (t *Tree) build(p string, it *peekIter) (*node, error) {
+	n := &node{}
+	var buf []hashedEntry
+	for len(buf) <= t.leafSize {
+		e, ok, err := it.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || !strings.HasPrefix(e.key, p) {
+			break
+		}
+		it.advance()
+		buf = append(buf, e)
+	}
+	if len(buf) <= t.leafSize {
+		for _, e := range buf {
+			n.apply(e.hash, 1)
+		}
+		return n, nil
+	}
+
+	it.pushBack(buf)
+	n.children = make(map[byte]*node)
+	for {
+		e, ok, err := it.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || !strings.HasPrefix(e.key, p) {
+			return n, nil
+		}
+		if e.key == p {
+			it.advance()
+			n.self.apply(e.hash, 1)
+			n.apply(e.hash, 1)
+			continue
+		}
+		c := e.key[len(p)]
+		child, err := t.build(p+string(c), it)
+		if err != nil {
+			return nil, err
+		}
+		if n.children[c] != nil {
+			return nil, fmt.Errorf("merkle: datastore returned keys out of order under %q", p+string(c))
+		}
+		n.children[c] = child
+		n.hash.xor(child.hash)
+		n.count += child.count
+	}
+}
+
+type hashedEntry struct {
+	key  string
+	hash Hash
+}
+
+// peekIter is a pull iterator over hashed entries with one entry of
+// lookahead and the ability to push entries back.
+type peekIter struct {
+	next    func() (dsq.Entry, error, bool)
+	pending []hashedEntry
+	err     error
+	done    bool
+	last    string
+}
+
+func (it *peekIter) peek() (hashedEntry, bool, error) {
+	if len(it.pending) > 0 {
+		return it.pending[0], true, nil
+	}
+	if it.done || it.err != nil {
+		return hashedEntry{}, false, it.err
+	}
+	e, err, ok := it.next()
+	if !ok {
+		it.done = true
+		return hashedEntry{}, false, nil
+	}
+	if err != nil {
+		it.err = err
+		return hashedEntry{}, false, err
+	}
+	if e.Key < it.last {
+		it.err = fmt.Errorf("merkle: datastore returned keys out of order (%q after %q)", e.Key, it.last)
+		return hashedEntry{}, false, it.err
+	}
+	it.last = e.Key
+	he := hashedEntry{key: e.Key, hash: entryHash(e.Key, e.Value)}
+	it.pending = append(it.pending, he)
+	return he, true, nil
+}
+
+func (it *peekIter) advance() {
+	it.pending = it.pending[1:]
+}
+
+func (it *peekIter) pushBack(es []hashedEntry) {
+	it.pending = append(es, it.pending...)
+}
+
+// scan returns the entries whose keys start with the byte prefix p, in key
+// order.
+func scan(ctx context.Context, src ds.Read, p string) iter.Seq2[dsq.Entry, error] {
+	q := dsq.Query{Orders: []dsq.Order{dsq.OrderByKey{}}}
+	if p != "" {
+		// Let the datastore narrow the scan down to the closest namespace,
+		// and filter out the rest of the namespace.
+		if i := strings.LastIndexByte(p, '/'); i > 0 {
+			q.Prefix = p[:i]
+		}
+		q.Filters = []dsq.Filter{dsq.FilterKeyPrefix{Prefix: p}}
+	}
+	return ds.QueryIter(ctx, src, q)
+}
+
+// scanRange returns the entries in r, in key order.
+func scanRange(ctx context.Context, src ds.Read, r Range) ([]Entry, error) {
+	if r.Exact {
+		v, err := src.Get(ctx, ds.RawKey(r.Prefix))
+		if errors.Is(err, ds.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []Entry{{Key: r.Prefix, Value: v}}, nil
+	}
+	var entries []Entry
+	for e, err := range scan(ctx, src, r.Prefix) {
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{Key: e.Key, Value: e.Value})
+	}
+	return entries, nil
+}
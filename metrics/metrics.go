@@ -0,0 +1,450 @@
+// Package metrics wraps a datastore, recording OpenTelemetry metrics for all
+// datastore interactions.
+//
+// The following instruments are recorded, all with a "datastore.operation"
+// attribute naming the operation (put, get, has, getsize, delete, query, sync,
+// disk-usage, check, scrub, gc, put-with-ttl, set-ttl, get-expiration, batch,
+// batch-put, batch-delete, batch-commit, txn, txn-get, txn-has, txn-getsize,
+// txn-query, txn-put, txn-delete, txn-commit and txn-discard), plus the
+// attributes given to New:
+//
+//   - datastore.operations: calls per operation.
+//   - datastore.errors: failed calls per operation, with an "error.type"
+//     attribute that is "not_found" for ds.ErrNotFound and "other" otherwise.
+//   - datastore.operation.duration: latency of each call, in seconds. For
+//     batch-commit and txn-commit, this is the commit latency.
+//   - datastore.value.size: sizes of the values put and got, in bytes.
+//   - datastore.query.results: entries returned by each query, recorded when
+//     its results are closed.
+//   - datastore.batch.size: operations per committed batch.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// AttributeOperation is the attribute key of the operation name.
+const AttributeOperation = attribute.Key("datastore.operation")
+
+// AttributeErrorType is the attribute key of the error type on
+// datastore.errors.
+const AttributeErrorType = attribute.Key("error.type")
+
+// New returns a datastore recording metrics for all interactions with ds, on
+// instruments created from meter. attrs are added to every measurement, e.g.
+// to tell apart the datastores mounted at different prefixes.
+//
+// The returned datastore implements every optional feature; use
+// scoped.Inherit to only expose the features ds supports.
+func New(ds ds.Datastore, meter metric.Meter, attrs ...attribute.KeyValue) (*Datastore, error) {
+	d := &Datastore{ds: ds, attrs: attrs}
+
+	var err, errs error
+	d.operations, err = meter.Int64Counter("datastore.operations",
+		metric.WithDescription("Number of datastore operations."),
+		metric.WithUnit("{operation}"))
+	errs = errors.Join(errs, err)
+	d.errors, err = meter.Int64Counter("datastore.errors",
+		metric.WithDescription("Number of failed datastore operations."),
+		metric.WithUnit("{operation}"))
+	errs = errors.Join(errs, err)
+	d.duration, err = meter.Float64Histogram("datastore.operation.duration",
+		metric.WithDescription("Duration of datastore operations."),
+		metric.WithUnit("s"))
+	errs = errors.Join(errs, err)
+	d.valueSize, err = meter.Int64Histogram("datastore.value.size",
+		metric.WithDescription("Size of the values put to and got from the datastore."),
+		metric.WithUnit("By"))
+	errs = errors.Join(errs, err)
+	d.queryResults, err = meter.Int64Histogram("datastore.query.results",
+		metric.WithDescription("Number of entries returned by datastore queries."),
+		metric.WithUnit("{entry}"))
+	errs = errors.Join(errs, err)
+	d.batchSize, err = meter.Int64Histogram("datastore.batch.size",
+		metric.WithDescription("Number of operations in committed datastore batches."),
+		metric.WithUnit("{operation}"))
+	errs = errors.Join(errs, err)
+	if errs != nil {
+		return nil, errs
+	}
+	return d, nil
+}
+
+// Datastore is an adapter that records metrics of inner datastore
+// interactions.
+type Datastore struct {
+	ds    ds.Datastore
+	attrs []attribute.KeyValue
+
+	operations   metric.Int64Counter
+	errors       metric.Int64Counter
+	duration     metric.Float64Histogram
+	valueSize    metric.Int64Histogram
+	queryResults metric.Int64Histogram
+	batchSize    metric.Int64Histogram
+}
+
+var (
+	_ ds.Datastore           = (*Datastore)(nil)
+	_ ds.Batching            = (*Datastore)(nil)
+	_ ds.PersistentDatastore = (*Datastore)(nil)
+	_ ds.TxnDatastore        = (*Datastore)(nil)
+	_ ds.CheckedDatastore    = (*Datastore)(nil)
+	_ ds.ScrubbedDatastore   = (*Datastore)(nil)
+	_ ds.GCDatastore         = (*Datastore)(nil)
+	_ ds.TTLDatastore        = (*Datastore)(nil)
+	_ ds.Shim                = (*Datastore)(nil)
+	_ io.Closer              = (*Datastore)(nil)
+)
+
+// opAttrs returns the attributes of measurements of op.
+func (m *Datastore) opAttrs(op string) metric.MeasurementOption {
+	return metric.WithAttributeSet(attribute.NewSet(append([]attribute.KeyValue{AttributeOperation.String(op)}, m.attrs...)...))
+}
+
+// record records a call of op that started at start and returned err.
+func (m *Datastore) record(ctx context.Context, op string, start time.Time, err error) {
+	attrs := m.opAttrs(op)
+	m.operations.Add(ctx, 1, attrs)
+	m.duration.Record(ctx, time.Since(start).Seconds(), attrs)
+	if err != nil {
+		m.recordError(ctx, op, err)
+	}
+}
+
+func (m *Datastore) recordError(ctx context.Context, op string, err error) {
+	errType := "other"
+	if errors.Is(err, ds.ErrNotFound) {
+		errType = "not_found"
+	}
+	kvs := append([]attribute.KeyValue{AttributeOperation.String(op), AttributeErrorType.String(errType)}, m.attrs...)
+	m.errors.Add(ctx, 1, metric.WithAttributeSet(attribute.NewSet(kvs...)))
+}
+
+func (m *Datastore) recordSize(ctx context.Context, op string, value []byte) {
+	m.valueSize.Record(ctx, int64(len(value)), m.opAttrs(op))
+}
+
+// countResults wraps res to record the number of entries it returns when it
+// is closed.
+func (m *Datastore) countResults(ctx context.Context, op string, res dsq.Results) dsq.Results {
+	var n int64
+	var once sync.Once
+	return dsq.ResultsFromIterator(res.Query(), dsq.Iterator{
+		Next: func() (dsq.Result, bool) {
+			r, ok := res.NextSync()
+			if ok {
+				if r.Error != nil {
+					m.recordError(ctx, op, r.Error)
+				} else {
+					n++
+				}
+			}
+			return r, ok
+		},
+		Close: func() error {
+			once.Do(func() {
+				m.queryResults.Record(ctx, n, m.opAttrs(op))
+			})
+			return res.Close()
+		},
+	})
+}
+
+// Children implements ds.Shim
+func (m *Datastore) Children() []ds.Datastore {
+	return []ds.Datastore{m.ds}
+}
+
+// Put implements the ds.Datastore interface.
+func (m *Datastore) Put(ctx context.Context, key ds.Key, value []byte) error {
+	start := time.Now()
+	err := m.ds.Put(ctx, key, value)
+	m.record(ctx, "put", start, err)
+	m.recordSize(ctx, "put", value)
+	return err
+}
+
+// Sync implements Datastore.Sync
+func (m *Datastore) Sync(ctx context.Context, prefix ds.Key) error {
+	start := time.Now()
+	err := m.ds.Sync(ctx, prefix)
+	m.record(ctx, "sync", start, err)
+	return err
+}
+
+// Get implements the ds.Datastore interface.
+func (m *Datastore) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	start := time.Now()
+	value, err := m.ds.Get(ctx, key)
+	m.record(ctx, "get", start, err)
+	if err == nil {
+		m.recordSize(ctx, "get", value)
+	}
+	return value, err
+}
+
+// Has implements the ds.Datastore interface.
+func (m *Datastore) Has(ctx context.Context, key ds.Key) (bool, error) {
+	start := time.Now()
+	exists, err := m.ds.Has(ctx, key)
+	m.record(ctx, "has", start, err)
+	return exists, err
+}
+
+// GetSize implements the ds.Datastore interface.
+func (m *Datastore) GetSize(ctx context.Context, key ds.Key) (int, error) {
+	start := time.Now()
+	size, err := m.ds.GetSize(ctx, key)
+	m.record(ctx, "getsize", start, err)
+	return size, err
+}
+
+// Delete implements the ds.Datastore interface.
+func (m *Datastore) Delete(ctx context.Context, key ds.Key) error {
+	start := time.Now()
+	err := m.ds.Delete(ctx, key)
+	m.record(ctx, "delete", start, err)
+	return err
+}
+
+// Query implements the ds.Datastore interface. The recorded duration is the
+// time to start the query; the number of results is recorded when they are
+// closed.
+func (m *Datastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	start := time.Now()
+	res, err := m.ds.Query(ctx, q)
+	m.record(ctx, "query", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return m.countResults(ctx, "query", res), nil
+}
+
+// Batch implements the ds.Batching interface.
+func (m *Datastore) Batch(ctx context.Context) (ds.Batch, error) {
+	start := time.Now()
+	var b ds.Batch
+	err := ds.ErrBatchUnsupported
+	if bds, ok := m.ds.(ds.Batching); ok {
+		b, err = bds.Batch(ctx)
+	}
+	m.record(ctx, "batch", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &batch{batch: b, m: m}, nil
+}
+
+// DiskUsage implements the ds.PersistentDatastore interface.
+func (m *Datastore) DiskUsage(ctx context.Context) (uint64, error) {
+	start := time.Now()
+	usage, err := ds.DiskUsage(ctx, m.ds)
+	m.record(ctx, "disk-usage", start, err)
+	return usage, err
+}
+
+// Check implements the ds.CheckedDatastore interface.
+func (m *Datastore) Check(ctx context.Context) error {
+	start := time.Now()
+	var err error
+	if c, ok := m.ds.(ds.CheckedDatastore); ok {
+		err = c.Check(ctx)
+	}
+	m.record(ctx, "check", start, err)
+	return err
+}
+
+// Scrub implements the ds.ScrubbedDatastore interface.
+func (m *Datastore) Scrub(ctx context.Context) error {
+	start := time.Now()
+	var err error
+	if c, ok := m.ds.(ds.ScrubbedDatastore); ok {
+		err = c.Scrub(ctx)
+	}
+	m.record(ctx, "scrub", start, err)
+	return err
+}
+
+// CollectGarbage implements the ds.GCDatastore interface.
+func (m *Datastore) CollectGarbage(ctx context.Context) error {
+	start := time.Now()
+	var err error
+	if c, ok := m.ds.(ds.GCDatastore); ok {
+		err = c.CollectGarbage(ctx)
+	}
+	m.record(ctx, "gc", start, err)
+	return err
+}
+
+// PutWithTTL implements the ds.TTL interface.
+func (m *Datastore) PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error {
+	start := time.Now()
+	err := ds.ErrTTLUnsupported
+	if tds, ok := m.ds.(ds.TTLDatastore); ok {
+		err = tds.PutWithTTL(ctx, key, value, ttl)
+	}
+	m.record(ctx, "put-with-ttl", start, err)
+	m.recordSize(ctx, "put-with-ttl", value)
+	return err
+}
+
+// SetTTL implements the ds.TTL interface.
+func (m *Datastore) SetTTL(ctx context.Context, key ds.Key, ttl time.Duration) error {
+	start := time.Now()
+	err := ds.ErrTTLUnsupported
+	if tds, ok := m.ds.(ds.TTLDatastore); ok {
+		err = tds.SetTTL(ctx, key, ttl)
+	}
+	m.record(ctx, "set-ttl", start, err)
+	return err
+}
+
+// GetExpiration implements the ds.TTL interface.
+func (m *Datastore) GetExpiration(ctx context.Context, key ds.Key) (time.Time, error) {
+	start := time.Now()
+	var exp time.Time
+	err := ds.ErrTTLUnsupported
+	if tds, ok := m.ds.(ds.TTLDatastore); ok {
+		exp, err = tds.GetExpiration(ctx, key)
+	}
+	m.record(ctx, "get-expiration", start, err)
+	return exp, err
+}
+
+// NewTransaction implements the ds.TxnDatastore interface.
+func (m *Datastore) NewTransaction(ctx context.Context, readOnly bool) (ds.Txn, error) {
+	start := time.Now()
+	var t ds.Txn
+	err := ds.ErrTxnUnsupported
+	if tds, ok := m.ds.(ds.TxnDatastore); ok {
+		t, err = tds.NewTransaction(ctx, readOnly)
+	}
+	m.record(ctx, "txn", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &txn{txn: t, m: m}, nil
+}
+
+// Close closes the inner datastore (if it implements the io.Closer interface).
+func (m *Datastore) Close() error {
+	if closer, ok := m.ds.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+type batch struct {
+	batch ds.Batch
+	m     *Datastore
+	ops   int64
+}
+
+var _ ds.Batch = (*batch)(nil)
+
+func (b *batch) Put(ctx context.Context, key ds.Key, value []byte) error {
+	start := time.Now()
+	err := b.batch.Put(ctx, key, value)
+	b.m.record(ctx, "batch-put", start, err)
+	b.m.recordSize(ctx, "batch-put", value)
+	b.ops++
+	return err
+}
+
+func (b *batch) Delete(ctx context.Context, key ds.Key) error {
+	start := time.Now()
+	err := b.batch.Delete(ctx, key)
+	b.m.record(ctx, "batch-delete", start, err)
+	b.ops++
+	return err
+}
+
+func (b *batch) Commit(ctx context.Context) error {
+	start := time.Now()
+	err := b.batch.Commit(ctx)
+	b.m.record(ctx, "batch-commit", start, err)
+	if err == nil {
+		b.m.batchSize.Record(ctx, b.ops, b.m.opAttrs("batch-commit"))
+		b.ops = 0
+	}
+	return err
+}
+
+type txn struct {
+	txn ds.Txn
+	m   *Datastore
+}
+
+var _ ds.Txn = (*txn)(nil)
+
+func (t *txn) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	start := time.Now()
+	value, err := t.txn.Get(ctx, key)
+	t.m.record(ctx, "txn-get", start, err)
+	if err == nil {
+		t.m.recordSize(ctx, "txn-get", value)
+	}
+	return value, err
+}
+
+func (t *txn) Has(ctx context.Context, key ds.Key) (bool, error) {
+	start := time.Now()
+	exists, err := t.txn.Has(ctx, key)
+	t.m.record(ctx, "txn-has", start, err)
+	return exists, err
+}
+
+func (t *txn) GetSize(ctx context.Context, key ds.Key) (int, error) {
+	start := time.Now()
+	size, err := t.txn.GetSize(ctx, key)
+	t.m.record(ctx, "txn-getsize", start, err)
+	return size, err
+}
+
+func (t *txn) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	start := time.Now()
+	res, err := t.txn.Query(ctx, q)
+	t.m.record(ctx, "txn-query", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return t.m.countResults(ctx, "txn-query", res), nil
+}
+
+func (t *txn) Put(ctx context.Context, key ds.Key, value []byte) error {
+	start := time.Now()
+	err := t.txn.Put(ctx, key, value)
+	t.m.record(ctx, "txn-put", start, err)
+	t.m.recordSize(ctx, "txn-put", value)
+	return err
+}
+
+func (t *txn) Delete(ctx context.Context, key ds.Key) error {
+	start := time.Now()
+	err := t.txn.Delete(ctx, key)
+	t.m.record(ctx, "txn-delete", start, err)
+	return err
+}
+
+func (t *txn) Commit(ctx context.Context) error {
+	start := time.Now()
+	err := t.txn.Commit(ctx)
+	t.m.record(ctx, "txn-commit", start, err)
+	return err
+}
+
+func (t *txn) Discard(ctx context.Context) {
+	start := time.Now()
+	t.txn.Discard(ctx)
+	t.m.record(ctx, "txn-discard", start, nil)
+}
@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dstest "github.com/ipfs/go-datastore/test"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func newTestDatastore(t *testing.T, attrs ...attribute.KeyValue) (*Datastore, *sdkmetric.ManualReader) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	d, err := New(datastore.NewMapDatastore(), provider.Meter("meter"), attrs...)
+	require.NoError(t, err)
+	return d, reader
+}
+
+// collect returns the data points of the named metric by operation.
+func collect[N int64 | float64](t *testing.T, reader *sdkmetric.ManualReader, name string) map[string][]attribute.Set {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	points := make(map[string][]attribute.Set)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			var sets []attribute.Set
+			switch data := m.Data.(type) {
+			case metricdata.Sum[N]:
+				for _, dp := range data.DataPoints {
+					sets = append(sets, dp.Attributes)
+				}
+			case metricdata.Histogram[N]:
+				for _, dp := range data.DataPoints {
+					sets = append(sets, dp.Attributes)
+				}
+			}
+			for _, set := range sets {
+				op, _ := set.Value(AttributeOperation)
+				points[op.AsString()] = append(points[op.AsString()], set)
+			}
+		}
+	}
+	return points
+}
+
+// histograms returns the histogram data points of the named metric by
+// operation.
+func histograms(t *testing.T, reader *sdkmetric.ManualReader, name string) map[string]metricdata.HistogramDataPoint[int64] {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	points := make(map[string]metricdata.HistogramDataPoint[int64])
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Histogram[int64]).DataPoints {
+				op, _ := dp.Attributes.Value(AttributeOperation)
+				points[op.AsString()] = dp
+			}
+		}
+	}
+	return points
+}
+
+// counts returns the values of the named counter by operation and error type.
+func counts(t *testing.T, reader *sdkmetric.ManualReader, name string) map[[2]string]int64 {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	out := make(map[[2]string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				op, _ := dp.Attributes.Value(AttributeOperation)
+				errType, _ := dp.Attributes.Value(AttributeErrorType)
+				out[[2]string{op.AsString(), errType.AsString()}] += dp.Value
+			}
+		}
+	}
+	return out
+}
+
+func TestMetricsAll(t *testing.T) {
+	d, _ := newTestDatastore(t)
+	dstest.SubtestAll(t, d)
+}
+
+func TestOperations(t *testing.T) {
+	ctx := context.Background()
+	d, reader := newTestDatastore(t)
+
+	key := datastore.NewKey("/a")
+	require.NoError(t, d.Put(ctx, key, []byte("hello")))
+	_, err := d.Get(ctx, key)
+	require.NoError(t, err)
+	_, err = d.Get(ctx, datastore.NewKey("/missing"))
+	require.ErrorIs(t, err, datastore.ErrNotFound)
+	_, err = d.NewTransaction(ctx, false)
+	require.ErrorIs(t, err, datastore.ErrTxnUnsupported)
+
+	require.Equal(t, map[[2]string]int64{
+		{"put", ""}: 1,
+		{"get", ""}: 2,
+		{"txn", ""}: 1,
+	}, counts(t, reader, "datastore.operations"))
+	require.Equal(t, map[[2]string]int64{
+		{"get", "not_found"}: 1,
+		{"txn", "other"}:     1,
+	}, counts(t, reader, "datastore.errors"))
+
+	durations := collect[float64](t, reader, "datastore.operation.duration")
+	require.Len(t, durations["put"], 1)
+	require.Len(t, durations["get"], 1)
+
+	sizes := histograms(t, reader, "datastore.value.size")
+	require.Equal(t, uint64(1), sizes["put"].Count)
+	require.Equal(t, int64(5), sizes["put"].Sum)
+	// Misses don't record a size.
+	require.Equal(t, uint64(1), sizes["get"].Count)
+	require.Equal(t, int64(5), sizes["get"].Sum)
+}
+
+func TestQueryResults(t *testing.T) {
+	ctx := context.Background()
+	d, reader := newTestDatastore(t)
+
+	for _, k := range []string{"/a", "/b", "/c"} {
+		require.NoError(t, d.Put(ctx, datastore.NewKey(k), []byte(k)))
+	}
+	res, err := d.Query(ctx, dsq.Query{})
+	require.NoError(t, err)
+	require.Empty(t, histograms(t, reader, "datastore.query.results"))
+
+	entries, err := res.Rest()
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	// Closing again doesn't record the results twice.
+	require.NoError(t, res.Close())
+
+	results := histograms(t, reader, "datastore.query.results")
+	require.Equal(t, uint64(1), results["query"].Count)
+	require.Equal(t, int64(3), results["query"].Sum)
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	d, reader := newTestDatastore(t)
+
+	b, err := d.Batch(ctx)
+	require.NoError(t, err)
+	require.NoError(t, b.Put(ctx, datastore.NewKey("/a"), []byte("1")))
+	require.NoError(t, b.Put(ctx, datastore.NewKey("/b"), []byte("22")))
+	require.NoError(t, b.Delete(ctx, datastore.NewKey("/c")))
+	require.NoError(t, b.Commit(ctx))
+
+	sizes := histograms(t, reader, "datastore.batch.size")
+	require.Equal(t, uint64(1), sizes["batch-commit"].Count)
+	require.Equal(t, int64(3), sizes["batch-commit"].Sum)
+
+	values := histograms(t, reader, "datastore.value.size")
+	require.Equal(t, int64(3), values["batch-put"].Sum)
+
+	durations := collect[float64](t, reader, "datastore.operation.duration")
+	require.Len(t, durations["batch-commit"], 1)
+}
+
+func TestAttributes(t *testing.T) {
+	ctx := context.Background()
+	d, reader := newTestDatastore(t, attribute.String("mount", "/blocks"))
+
+	_, err := d.Has(ctx, datastore.NewKey("/a"))
+	require.NoError(t, err)
+
+	points := collect[int64](t, reader, "datastore.operations")
+	require.Len(t, points["has"], 1)
+	mount, ok := points["has"][0].Value("mount")
+	require.True(t, ok)
+	require.Equal(t, "/blocks", mount.AsString())
+}
@@ -1,6 +1,7 @@
 package mount
 
 import (
+	"slices"
 	"testing"
 
 	datastore "github.com/ipfs/go-datastore"
@@ -43,3 +44,43 @@ func TestLookup(t *testing.T) {
 		t.Errorf("expected to find the mountpoint /foo, got %v", mnt)
 	}
 }
+
+// TestLookupMatchesScan checks the trie against a linear scan of the mounts.
+func TestLookupMatchesScan(t *testing.T) {
+	var mounts []Mount
+	for _, p := range []string{"/", "/a", "/a/b", "/a/b/c", "/ab", "/b/c", "/b/c/d/e", "/c"} {
+		mounts = append(mounts, Mount{Prefix: datastore.NewKey(p), Datastore: datastore.NewMapDatastore()})
+	}
+	m := New(mounts)
+
+	keys := []string{"/", "/a", "/a/b", "/a/b/c", "/a/b/c/d", "/a/bc", "/ab/c", "/b", "/b/c", "/b/c/d", "/b/c/d/e/f", "/c/x", "/d"}
+	for _, k := range keys {
+		key := datastore.NewKey(k)
+
+		var want Mount
+		for _, mnt := range m.Mounts() {
+			if mnt.Prefix.IsAncestorOf(key) {
+				want = mnt
+				break
+			}
+		}
+		dstore, mnt, _ := m.lookup(key)
+		if dstore != want.Datastore || (dstore != nil && mnt != want.Prefix) {
+			t.Errorf("lookup(%s) = %s, want %s", k, mnt, want.Prefix)
+		}
+
+		var wantAll []datastore.Key
+		for _, mnt := range m.Mounts() {
+			if mnt.Prefix.IsDescendantOf(key) {
+				wantAll = append(wantAll, mnt.Prefix)
+			} else if mnt.Prefix.Equal(key) || mnt.Prefix.IsAncestorOf(key) {
+				wantAll = append(wantAll, mnt.Prefix)
+				break
+			}
+		}
+		_, all, _ := m.lookupAll(key)
+		if !slices.Equal(all, wantAll) {
+			t.Errorf("lookupAll(%s) = %v, want %v", k, all, wantAll)
+		}
+	}
+}
@@ -7,18 +7,25 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	ds "github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
 )
 
 var (
-	ErrNoMount = errors.New("no datastore mounted for this key")
+	ErrNoMount     = errors.New("no datastore mounted for this key")
+	ErrMountExists = errors.New("a datastore is already mounted at this prefix")
 )
 
+// DefaultBatchConcurrency is the default number of mounts a batch commits to
+// at once.
+const DefaultBatchConcurrency = 8
+
 // Mount defines a datastore mount. It mounts the given datastore at the given
 // prefix.
 type Mount struct {
@@ -31,13 +38,23 @@ type Mount struct {
 //
 // The order of the mounts does not matter, they will be applied most specific
 // to least specific.
+//
+// The returned datastore routes TTL operations and transactions to mounts
+// implementing them. Check, Scrub, CollectGarbage and DiskUsage skip mounts
+// that don't support them, so to only expose TTL and transactions when all
+// mounts support them, use:
+//
+//	scoped.Inherit(mount.New(mounts), ds.FeatureNameChecked, ds.FeatureNameScrubbed,
+//		ds.FeatureNameGC, ds.FeatureNamePersistent)
+//
+// Mounts can be added and removed later with Mount, MountAndMigrate and
+// Unmount.
 func New(mounts []Mount) *Datastore {
-	// make a copy so we're sure it doesn't mutate
-	m := slices.Clone(mounts)
-	slices.SortFunc(m, func(a, b Mount) int {
-		return strings.Compare(b.Prefix.String(), a.Prefix.String())
-	})
-	return &Datastore{mounts: m}
+	d := &Datastore{trie: new(trie)}
+	for _, m := range mounts {
+		d.add(m)
+	}
+	return d
 }
 
 // Datastore is a mount datastore. In this datastore, keys live under the most
@@ -63,8 +80,17 @@ func New(mounts []Mount) *Datastore {
 // * Get - Returns datastore.ErrNotFound.
 // * Query - Returns no results.
 // * Put - Returns ErrNoMount.
+//
+// Datastores can be mounted and unmounted while the datastore is in use.
 type Datastore struct {
+	// BatchConcurrency bounds the number of mounts a batch commits to at
+	// once. 0 means DefaultBatchConcurrency.
+	BatchConcurrency int
+
+	lk sync.RWMutex
+	// mounts holds the mounts in lookup order, and trie indexes them.
 	mounts []Mount
+	trie   *trie
 }
 
 var _ ds.Datastore = (*Datastore)(nil)
@@ -73,17 +99,155 @@ var _ ds.PersistentDatastore = (*Datastore)(nil)
 var _ ds.CheckedDatastore = (*Datastore)(nil)
 var _ ds.ScrubbedDatastore = (*Datastore)(nil)
 var _ ds.GCDatastore = (*Datastore)(nil)
+var _ ds.TTLDatastore = (*Datastore)(nil)
+var _ ds.TxnDatastore = (*Datastore)(nil)
+var _ ds.Shim = (*Datastore)(nil)
+var _ query.Explainer = (*Datastore)(nil)
+
+// Children implements Shim. It returns the mounted datastores, in lookup
+// order.
+func (d *Datastore) Children() []ds.Datastore {
+	mounts := d.Mounts()
+	children := make([]ds.Datastore, len(mounts))
+	for i, m := range mounts {
+		children[i] = m.Datastore
+	}
+	return children
+}
+
+// Mounts returns the current mounts, in lookup order: most specific first.
+func (d *Datastore) Mounts() []Mount {
+	d.lk.RLock()
+	defer d.lk.RUnlock()
+	return slices.Clone(d.mounts)
+}
+
+// add mounts m, replacing the mount at the same prefix, if any. d.lk must be
+// held for writing.
+func (d *Datastore) add(m Mount) {
+	d.trie.insert(m)
+	mounts := slices.DeleteFunc(d.mounts, func(o Mount) bool {
+		return o.Prefix.Equal(m.Prefix)
+	})
+	i, _ := slices.BinarySearchFunc(mounts, m.Prefix, func(o Mount, p ds.Key) int {
+		return strings.Compare(p.String(), o.Prefix.String())
+	})
+	d.mounts = slices.Insert(mounts, i, m)
+}
+
+// Mount mounts dstore at prefix. Keys under prefix that were stored in a less
+// specific mount are masked until dstore is unmounted; use MountAndMigrate to
+// move them into dstore instead.
+//
+// Returns ErrMountExists if a datastore is already mounted at prefix.
+func (d *Datastore) Mount(prefix ds.Key, dstore ds.Datastore) error {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if d.trie.get(prefix) != nil {
+		return ErrMountExists
+	}
+	d.add(Mount{Prefix: prefix, Datastore: dstore})
+	return nil
+}
+
+// MountAndMigrate mounts dstore at prefix, moving the keys under prefix from
+// the mount they lived in into dstore. Other operations block until the
+// migration is done.
+//
+// The keys are copied before dstore is mounted: if copying fails, dstore is
+// not mounted. Errors deleting the migrated keys from their previous mount
+// are returned after mounting dstore; the keys left behind are masked by
+// dstore.
+//
+// Returns ErrMountExists if a datastore is already mounted at prefix.
+func (d *Datastore) MountAndMigrate(ctx context.Context, prefix ds.Key, dstore ds.Datastore) error {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if d.trie.get(prefix) != nil {
+		return ErrMountExists
+	}
+
+	old := d.trie.owner(prefix)
+	if old == nil {
+		d.add(Mount{Prefix: prefix, Datastore: dstore})
+		return nil
+	}
+	moved, err := d.copyOwned(ctx, old, prefix, dstore)
+	if err != nil {
+		return fmt.Errorf("migrating keys under %s: %w", prefix, err)
+	}
+
+	d.add(Mount{Prefix: prefix, Datastore: dstore})
+
+	var errs []error
+	for _, k := range moved {
+		if err := old.Datastore.Delete(ctx, k); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("deleting migrated keys under %s from %s: %w", prefix, old.Prefix, err)
+	}
+	return nil
+}
+
+// copyOwned copies the keys under prefix that live in the mount old into
+// dstore, and returns them, relative to old. d.lk must be held.
+func (d *Datastore) copyOwned(ctx context.Context, old *Mount, prefix ds.Key, dstore ds.Datastore) ([]ds.Key, error) {
+	rest := strings.TrimPrefix(prefix.String(), old.Prefix.String())
+	results, err := old.Datastore.Query(ctx, query.Query{Prefix: ds.NewKey(rest).String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	var moved []ds.Key
+	for _, e := range entries {
+		k := ds.RawKey(e.Key)
+		full := old.Prefix.Child(k)
+		if d.trie.owner(full) != old {
+			// Masked by a more specific mount.
+			continue
+		}
+		dst := ds.NewKey(strings.TrimPrefix(full.String(), prefix.String()))
+		if err := dstore.Put(ctx, dst, e.Value); err != nil {
+			return nil, err
+		}
+		moved = append(moved, k)
+	}
+	return moved, nil
+}
+
+// Unmount unmounts the datastore mounted at prefix, and returns it without
+// closing it. Keys under prefix then live in the next most specific mount.
+//
+// Returns ErrNoMount if no datastore is mounted at prefix.
+func (d *Datastore) Unmount(prefix ds.Key) (ds.Datastore, error) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	m := d.trie.remove(prefix)
+	if m == nil {
+		return nil, ErrNoMount
+	}
+	d.mounts = slices.DeleteFunc(d.mounts, func(o Mount) bool {
+		return o.Prefix.Equal(prefix)
+	})
+	return m.Datastore, nil
+}
 
 // lookup looks up the datastore in which the given key lives.
 func (d *Datastore) lookup(key ds.Key) (ds.Datastore, ds.Key, ds.Key) {
-	for _, m := range d.mounts {
-		if m.Prefix.IsAncestorOf(key) {
-			s := strings.TrimPrefix(key.String(), m.Prefix.String())
-			k := ds.NewKey(s)
-			return m.Datastore, m.Prefix, k
-		}
+	d.lk.RLock()
+	m := d.trie.owner(key)
+	d.lk.RUnlock()
+	if m == nil {
+		return nil, ds.NewKey("/"), key
 	}
-	return nil, ds.NewKey("/"), key
+	s := strings.TrimPrefix(key.String(), m.Prefix.String())
+	return m.Datastore, m.Prefix, ds.NewKey(s)
 }
 
 type queryResults struct {
@@ -113,6 +277,9 @@ func (qr *queryResults) advance() bool {
 type querySet struct {
 	query query.Query
 	heads []*queryResults
+	// limit is the number of results left to return, or -1 if unlimited.
+	// Once it is reached, the mounted datastores' results are closed.
+	limit int
 }
 
 func (h *querySet) Len() int {
@@ -158,12 +325,22 @@ func (h *querySet) addResults(mount ds.Key, results query.Results) {
 }
 
 func (h *querySet) next() (query.Result, bool) {
-	if len(h.heads) == 0 {
+	if len(h.heads) == 0 || h.limit == 0 {
 		return query.Result{}, false
 	}
 	head := h.heads[0]
 	next := head.next
 
+	// Only entries count toward the limit: the residual query applies
+	// Offset and Limit to entries, and passes errors through.
+	if h.limit > 0 && next.Error == nil {
+		h.limit--
+		if h.limit == 0 {
+			h.close()
+			return next, true
+		}
+	}
+
 	if head.advance() {
 		heap.Fix(h, 0)
 	} else {
@@ -200,23 +377,20 @@ func (h *querySet) next() (query.Result, bool) {
 // * /bar/foo  -> ([/bar], [/foo])                          # the datastore mounted at /bar, rest is /foo
 // * /ba       -> ([/], [/])                                # the root; only full components are matched.
 func (d *Datastore) lookupAll(key ds.Key) (dst []ds.Datastore, mountpoint, rest []ds.Key) {
-	for _, m := range d.mounts {
-		if m.Prefix.IsDescendantOf(key) {
-			dst = append(dst, m.Datastore)
-			mountpoint = append(mountpoint, m.Prefix)
-			rest = append(rest, ds.NewKey("/"))
-		} else if m.Prefix.Equal(key) || m.Prefix.IsAncestorOf(key) {
-			r := strings.TrimPrefix(key.String(), m.Prefix.String())
-
-			dst = append(dst, m.Datastore)
-			mountpoint = append(mountpoint, m.Prefix)
-			rest = append(rest, ds.NewKey(r))
-
-			// We've found an ancestor (or equal) key. We might have
-			// more general datastores, but they won't contain keys
-			// with this prefix so there's no point in searching them.
-			break
+	d.lk.RLock()
+	mounts := d.trie.covering(key)
+	d.lk.RUnlock()
+
+	for _, m := range mounts {
+		r := "/"
+		if !m.Prefix.IsDescendantOf(key) {
+			// The ancestor (or equal) mount, always last. More general
+			// datastores won't contain keys with this prefix.
+			r = strings.TrimPrefix(key.String(), m.Prefix.String())
 		}
+		dst = append(dst, m.Datastore)
+		mountpoint = append(mountpoint, m.Prefix)
+		rest = append(rest, ds.NewKey(r))
 	}
 	return dst, mountpoint, rest
 }
@@ -295,38 +469,46 @@ func (d *Datastore) Delete(ctx context.Context, key ds.Key) error {
 // according to the given orders.
 //
 // If a query prefix is specified, Query will avoid querying datastores mounted
-// outside that prefix.
+// outside that prefix. Filters on keys and values, and their combinations, are
+// pushed down to the mounted datastores, and so are Limit and Offset, as a
+// limit of Offset+Limit results per datastore, when every filter could be
+// pushed down and the results are ordered by keys or values, if at all. Use
+// Explain to see what is pushed down, or datastore.Explain to also see how
+// the mounts run their queries.
 func (d *Datastore) Query(ctx context.Context, master query.Query) (query.Results, error) {
-	childQuery := query.Query{
-		Prefix:            master.Prefix,
-		Orders:            master.Orders,
-		KeysOnly:          master.KeysOnly,
-		ReturnExpirations: master.ReturnExpirations,
-		ReturnsSizes:      master.ReturnsSizes,
-	}
+	return d.query(ctx, master, func(m MountQuery) (ds.Read, error) {
+		return m.dstore, nil
+	})
+}
 
-	prefix := ds.NewKey(childQuery.Prefix)
-	dses, mounts, rests := d.lookupAll(prefix)
+// query runs master on the mounts, reading each mount through open.
+func (d *Datastore) query(ctx context.Context, master query.Query, open func(m MountQuery) (ds.Read, error)) (query.Results, error) {
+	plan := d.plan(master)
 
 	queries := &querySet{
-		query: childQuery,
-		heads: make([]*queryResults, 0, len(dses)),
+		query: master,
+		heads: make([]*queryResults, 0, len(plan.Mounts)),
+		limit: -1,
+	}
+	if plan.LimitPushed {
+		queries.limit = master.Offset + master.Limit
 	}
 
-	for i := range dses {
-		mount := mounts[i]
-		dstore := dses[i]
-		rest := rests[i]
-
-		qi := childQuery
-		qi.Prefix = rest.String()
-		results, err := dstore.Query(ctx, qi)
-
+	for _, m := range plan.Mounts {
+		if m.Skipped {
+			continue
+		}
+		r, err := open(m)
 		if err != nil {
 			queries.close()
 			return nil, err
 		}
-		queries.addResults(mount, results)
+		results, err := r.Query(ctx, m.Query)
+		if err != nil {
+			queries.close()
+			return nil, err
+		}
+		queries.addResults(m.Prefix, results)
 	}
 
 	qr := query.ResultsFromIterator(master, query.Iterator{
@@ -334,27 +516,13 @@ func (d *Datastore) Query(ctx context.Context, master query.Query) (query.Result
 		Close: queries.close,
 	})
 
-	if len(master.Filters) > 0 {
-		for _, f := range master.Filters {
-			qr = query.NaiveFilter(qr, f)
-		}
-	}
-
-	if master.Offset > 0 {
-		qr = query.NaiveOffset(qr, master.Offset)
-	}
-
-	if master.Limit > 0 {
-		qr = query.NaiveLimit(qr, master.Limit)
-	}
-
-	return qr, nil
+	return query.NaiveQueryApply(plan.residual(), qr), nil
 }
 
 // Close closes all mounted datastores.
 func (d *Datastore) Close() error {
 	var errs []error
-	for _, d := range d.mounts {
+	for _, d := range d.Mounts() {
 		err := d.Datastore.Close()
 		if err != nil {
 			err = fmt.Errorf("closing datastore at %s: %w", d.Prefix.String(), err)
@@ -371,7 +539,7 @@ func (d *Datastore) DiskUsage(ctx context.Context) (uint64, error) {
 		errs    []error
 		duTotal uint64 = 0
 	)
-	for _, d := range d.mounts {
+	for _, d := range d.Mounts() {
 		du, err := ds.DiskUsage(ctx, d.Datastore)
 		duTotal += du
 		if err != nil {
@@ -382,8 +550,48 @@ func (d *Datastore) DiskUsage(ctx context.Context) (uint64, error) {
 	return duTotal, errors.Join(errs...)
 }
 
+// CommitError is returned by the Commit of batches when committing to some of
+// the mounts failed.
+type CommitError struct {
+	// Committed lists the mounts the batch was committed to.
+	Committed []ds.Key
+	// Failed lists the mounts on which the commit failed.
+	Failed []MountError
+}
+
+func (e *CommitError) Error() string {
+	msgs := make([]string, len(e.Failed))
+	for i, f := range e.Failed {
+		msgs[i] = f.Error()
+	}
+	return fmt.Sprintf("batch failed to commit to %d of %d mounts: %s",
+		len(e.Failed), len(e.Failed)+len(e.Committed), strings.Join(msgs, "; "))
+}
+
+func (e *CommitError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, f := range e.Failed {
+		errs[i] = f
+	}
+	return errs
+}
+
+// MountError is the error of committing a batch to a mount.
+type MountError struct {
+	Prefix ds.Key
+	Err    error
+}
+
+func (e MountError) Error() string {
+	return fmt.Sprintf("committing batch to datastore at %s: %s", e.Prefix, e.Err)
+}
+
+func (e MountError) Unwrap() error {
+	return e.Err
+}
+
 type mountBatch struct {
-	mounts map[string]ds.Batch
+	mounts map[string]*batchMount
 	lk     sync.Mutex
 
 	d *Datastore
@@ -391,70 +599,156 @@ type mountBatch struct {
 
 var _ ds.Batch = (*mountBatch)(nil)
 
+// batchMount is the batch of a mount. Its operations are recorded, so that
+// they can be replayed on a new batch of the mount if the commit fails.
+type batchMount struct {
+	dstore ds.Batching
+	// batch is nil after a failed commit.
+	batch ds.Batch
+	ops   []batchOp
+}
+
+type batchOp struct {
+	key    ds.Key
+	value  []byte
+	delete bool
+}
+
 // Batch returns a batch that operates over all mounted datastores.
+//
+// Commit commits the batches of the mounted datastores in parallel, up to
+// BatchConcurrency at once. If some of them fail, it returns a *CommitError,
+// and the batch keeps the changes to the failed mounts: calling Commit again
+// retries those only, by replaying their changes on new batches of the
+// mounts.
 func (d *Datastore) Batch(ctx context.Context) (ds.Batch, error) {
 	return &mountBatch{
-		mounts: make(map[string]ds.Batch),
+		mounts: make(map[string]*batchMount),
 		d:      d,
 	}, nil
 }
 
-func (mt *mountBatch) lookupBatch(ctx context.Context, key ds.Key) (ds.Batch, ds.Key, error) {
-	mt.lk.Lock()
-	defer mt.lk.Unlock()
-
+func (mt *mountBatch) lookupBatch(ctx context.Context, key ds.Key) (*batchMount, ds.Key, error) {
 	child, loc, rest := mt.d.lookup(key)
-	t, ok := mt.mounts[loc.String()]
+	m, ok := mt.mounts[loc.String()]
 	if !ok {
 		bds, ok := child.(ds.Batching)
 		if !ok {
 			return nil, ds.NewKey(""), ds.ErrBatchUnsupported
 		}
-		var err error
-		t, err = bds.Batch(ctx)
+		b, err := bds.Batch(ctx)
 		if err != nil {
 			return nil, ds.NewKey(""), err
 		}
-		mt.mounts[loc.String()] = t
+		m = &batchMount{dstore: bds, batch: b}
+		mt.mounts[loc.String()] = m
 	}
-	return t, rest, nil
+	return m, rest, nil
 }
 
 func (mt *mountBatch) Put(ctx context.Context, key ds.Key, val []byte) error {
-	t, rest, err := mt.lookupBatch(ctx, key)
+	mt.lk.Lock()
+	defer mt.lk.Unlock()
+
+	m, rest, err := mt.lookupBatch(ctx, key)
 	if err != nil {
 		return err
 	}
-
-	return t.Put(ctx, rest, val)
+	if m.batch != nil {
+		if err := m.batch.Put(ctx, rest, val); err != nil {
+			return err
+		}
+	}
+	m.ops = append(m.ops, batchOp{key: rest, value: val})
+	return nil
 }
 
 func (mt *mountBatch) Delete(ctx context.Context, key ds.Key) error {
-	t, rest, err := mt.lookupBatch(ctx, key)
+	mt.lk.Lock()
+	defer mt.lk.Unlock()
+
+	m, rest, err := mt.lookupBatch(ctx, key)
 	if err != nil {
 		return err
 	}
+	if m.batch != nil {
+		if err := m.batch.Delete(ctx, rest); err != nil {
+			return err
+		}
+	}
+	m.ops = append(m.ops, batchOp{key: rest, delete: true})
+	return nil
+}
 
-	return t.Delete(ctx, rest)
+// commit commits the batch of m. After a failed commit, the operations are
+// replayed on a new batch first, as the failed one can't be reused.
+func (m *batchMount) commit(ctx context.Context) error {
+	if m.batch == nil {
+		b, err := m.dstore.Batch(ctx)
+		if err != nil {
+			return err
+		}
+		for _, op := range m.ops {
+			if op.delete {
+				err = b.Delete(ctx, op.key)
+			} else {
+				err = b.Put(ctx, op.key, op.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		m.batch = b
+	}
+	err := m.batch.Commit(ctx)
+	if err != nil {
+		m.batch = nil
+	}
+	return err
 }
 
 func (mt *mountBatch) Commit(ctx context.Context) error {
 	mt.lk.Lock()
 	defer mt.lk.Unlock()
 
-	var errs []error
-	for p, t := range mt.mounts {
-		if err := t.Commit(ctx); err != nil {
-			err = fmt.Errorf("committing batch to datastore at %s: %w", p, err)
-			errs = append(errs, err)
+	prefixes := slices.Sorted(maps.Keys(mt.mounts))
+	slices.Reverse(prefixes)
+	workers := mt.d.BatchConcurrency
+	if workers <= 0 {
+		workers = DefaultBatchConcurrency
+	}
+
+	errs := make([]error, len(prefixes))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, p := range prefixes {
+		m := mt.mounts[p]
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			errs[i] = m.commit(ctx)
+		})
+	}
+	wg.Wait()
+
+	var cerr CommitError
+	for i, p := range prefixes {
+		if errs[i] != nil {
+			cerr.Failed = append(cerr.Failed, MountError{Prefix: ds.RawKey(p), Err: errs[i]})
+			continue
 		}
+		cerr.Committed = append(cerr.Committed, ds.RawKey(p))
+		delete(mt.mounts, p)
 	}
-	return errors.Join(errs...)
+	if len(cerr.Failed) > 0 {
+		return &cerr
+	}
+	return nil
 }
 
 func (d *Datastore) Check(ctx context.Context) error {
 	var errs []error
-	for _, m := range d.mounts {
+	for _, m := range d.Mounts() {
 		if c, ok := m.Datastore.(ds.CheckedDatastore); ok {
 			if err := c.Check(ctx); err != nil {
 				err = fmt.Errorf("checking datastore at %s: %w", m.Prefix.String(), err)
@@ -467,7 +761,7 @@ func (d *Datastore) Check(ctx context.Context) error {
 
 func (d *Datastore) Scrub(ctx context.Context) error {
 	var errs []error
-	for _, m := range d.mounts {
+	for _, m := range d.Mounts() {
 		if c, ok := m.Datastore.(ds.ScrubbedDatastore); ok {
 			if err := c.Scrub(ctx); err != nil {
 				err = fmt.Errorf("scrubbing datastore at %s: %w", m.Prefix.String(), err)
@@ -480,7 +774,7 @@ func (d *Datastore) Scrub(ctx context.Context) error {
 
 func (d *Datastore) CollectGarbage(ctx context.Context) error {
 	var errs []error
-	for _, m := range d.mounts {
+	for _, m := range d.Mounts() {
 		if c, ok := m.Datastore.(ds.GCDatastore); ok {
 			if err := c.CollectGarbage(ctx); err != nil {
 				err = fmt.Errorf("gc on datastore at %s: %w", m.Prefix.String(), err)
@@ -490,3 +784,45 @@ func (d *Datastore) CollectGarbage(ctx context.Context) error {
 	}
 	return errors.Join(errs...)
 }
+
+// PutWithTTL stores a key/value that expires after ttl in the appropriate
+// datastore, which must implement TTL.
+func (d *Datastore) PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error {
+	cds, _, k := d.lookup(key)
+	if cds == nil {
+		return ErrNoMount
+	}
+	tds, ok := cds.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	return tds.PutWithTTL(ctx, k, value, ttl)
+}
+
+// SetTTL sets the time-to-live of key in the appropriate datastore, which must
+// implement TTL.
+func (d *Datastore) SetTTL(ctx context.Context, key ds.Key, ttl time.Duration) error {
+	cds, _, k := d.lookup(key)
+	if cds == nil {
+		return ds.ErrNotFound
+	}
+	tds, ok := cds.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	return tds.SetTTL(ctx, k, ttl)
+}
+
+// GetExpiration returns the expiration time of key in the appropriate
+// datastore, which must implement TTL.
+func (d *Datastore) GetExpiration(ctx context.Context, key ds.Key) (time.Time, error) {
+	cds, _, k := d.lookup(key)
+	if cds == nil {
+		return time.Time{}, ds.ErrNotFound
+	}
+	tds, ok := cds.(ds.TTLDatastore)
+	if !ok {
+		return time.Time{}, ds.ErrTTLUnsupported
+	}
+	return tds.GetExpiration(ctx, k)
+}
@@ -3,14 +3,19 @@ package mount_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	gosync "sync"
 	"testing"
+	"time"
 
 	datastore "github.com/ipfs/go-datastore"
 	autobatch "github.com/ipfs/go-datastore/autobatch"
+	"github.com/ipfs/go-datastore/failstore"
 	mount "github.com/ipfs/go-datastore/mount"
 	query "github.com/ipfs/go-datastore/query"
 	sync "github.com/ipfs/go-datastore/sync"
 	dstest "github.com/ipfs/go-datastore/test"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPutBadNothing(t *testing.T) {
@@ -874,3 +879,419 @@ func TestSuite(t *testing.T) {
 	})
 	dstest.SubtestAll(t, m)
 }
+
+func TestMountUnmount(t *testing.T) {
+	ctx := context.Background()
+	root := datastore.NewMapDatastore()
+	tenant := datastore.NewMapDatastore()
+	m := mount.New([]mount.Mount{{Prefix: datastore.NewKey("/"), Datastore: root}})
+
+	require.NoError(t, m.Mount(datastore.NewKey("/tenant"), tenant))
+	require.ErrorIs(t, m.Mount(datastore.NewKey("/tenant"), tenant), mount.ErrMountExists)
+	require.Equal(t, []datastore.Key{datastore.NewKey("/tenant"), datastore.NewKey("/")}, prefixes(m.Mounts()))
+
+	require.NoError(t, m.Put(ctx, datastore.NewKey("/tenant/a"), []byte("a")))
+	ok, err := tenant.Has(ctx, datastore.NewKey("/a"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	d, err := m.Unmount(datastore.NewKey("/tenant"))
+	require.NoError(t, err)
+	require.Equal(t, datastore.Datastore(tenant), d)
+	_, err = m.Unmount(datastore.NewKey("/tenant"))
+	require.ErrorIs(t, err, mount.ErrNoMount)
+	require.Equal(t, []datastore.Key{datastore.NewKey("/")}, prefixes(m.Mounts()))
+
+	_, err = m.Get(ctx, datastore.NewKey("/tenant/a"))
+	require.ErrorIs(t, err, datastore.ErrNotFound)
+}
+
+func TestMountAndMigrate(t *testing.T) {
+	ctx := context.Background()
+	root := datastore.NewMapDatastore()
+	deeper := datastore.NewMapDatastore()
+	m := mount.New([]mount.Mount{
+		{Prefix: datastore.NewKey("/"), Datastore: root},
+		{Prefix: datastore.NewKey("/t/deep"), Datastore: deeper},
+	})
+	for _, k := range []string{"/t", "/t/a", "/t/b/c", "/t/deep/x", "/u"} {
+		require.NoError(t, m.Put(ctx, datastore.NewKey(k), []byte(k)))
+	}
+	// Masked by /t/deep, so not migrated.
+	require.NoError(t, root.Put(ctx, datastore.NewKey("/t/deep/masked"), nil))
+
+	tenant := datastore.NewMapDatastore()
+	require.NoError(t, m.MountAndMigrate(ctx, datastore.NewKey("/t"), tenant))
+
+	for _, k := range []string{"/t", "/t/a", "/t/b/c", "/t/deep/x", "/u"} {
+		v, err := m.Get(ctx, datastore.NewKey(k))
+		require.NoError(t, err, k)
+		require.Equal(t, []byte(k), v)
+	}
+	res, err := tenant.Query(ctx, query.Query{KeysOnly: true})
+	require.NoError(t, err)
+	entries, err := res.Rest()
+	require.NoError(t, err)
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	require.ElementsMatch(t, []string{"/a", "/b/c"}, keys)
+
+	for k, want := range map[string]bool{"/t": true, "/t/a": false, "/t/b/c": false, "/t/deep/masked": true} {
+		ok, err := root.Has(ctx, datastore.NewKey(k))
+		require.NoError(t, err)
+		require.Equal(t, want, ok, k)
+	}
+
+	require.ErrorIs(t, m.MountAndMigrate(ctx, datastore.NewKey("/t"), tenant), mount.ErrMountExists)
+}
+
+func TestMountConcurrent(t *testing.T) {
+	ctx := context.Background()
+	m := mount.New([]mount.Mount{{Prefix: datastore.NewKey("/"), Datastore: sync.MutexWrap(datastore.NewMapDatastore())}})
+
+	var wg gosync.WaitGroup
+	for i := range 8 {
+		prefix := datastore.NewKey(fmt.Sprintf("/tenant%d", i))
+		wg.Go(func() {
+			for range 50 {
+				if err := m.Mount(prefix, sync.MutexWrap(datastore.NewMapDatastore())); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := m.Put(ctx, prefix.ChildString("k"), nil); err != nil {
+					t.Error(err)
+				}
+				if _, err := m.Unmount(prefix); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+		wg.Go(func() {
+			for range 50 {
+				if _, err := m.Has(ctx, prefix.ChildString("k")); err != nil {
+					t.Error(err)
+				}
+				m.Mounts()
+			}
+		})
+	}
+	wg.Wait()
+	require.Len(t, m.Mounts(), 1)
+}
+
+func prefixes(mounts []mount.Mount) []datastore.Key {
+	var out []datastore.Key
+	for _, m := range mounts {
+		out = append(out, m.Prefix)
+	}
+	return out
+}
+
+func TestQueryPushdownMatchesNaive(t *testing.T) {
+	ctx := context.Background()
+	m := mount.New([]mount.Mount{
+		{Prefix: datastore.NewKey("/"), Datastore: datastore.NewMapDatastore()},
+		{Prefix: datastore.NewKey("/a"), Datastore: datastore.NewMapDatastore()},
+		{Prefix: datastore.NewKey("/a/b"), Datastore: datastore.NewMapDatastore()},
+		{Prefix: datastore.NewKey("/c"), Datastore: datastore.NewMapDatastore()},
+	})
+	var all []query.Entry
+	for i := range 60 {
+		key := fmt.Sprintf("/%s/%02d", []string{"a", "a/b", "ab", "c", "d"}[i%5], i)
+		value := []byte(fmt.Sprint(i % 7))
+		require.NoError(t, m.Put(ctx, datastore.NewKey(key), value))
+		all = append(all, query.Entry{Key: key, Value: value, Size: len(value)})
+	}
+
+	filters := [][]query.Filter{
+		nil,
+		{query.FilterKeyPrefix{Prefix: "/a/"}},
+		{query.FilterKeyCompare{Op: query.GreaterThan, Key: "/a/b/30"}},
+		{query.FilterKeyCompare{Op: query.LessThanOrEqual, Key: "/c"}, query.FilterValueCompare{Op: query.NotEqual, Value: []byte("3")}},
+		{query.FilterKeyCompare{Op: query.Equal, Key: "/c/13"}},
+		{query.Or(query.FilterKeyPrefix{Prefix: "/a/b/"}, query.Not(query.FilterKeyCompare{Op: query.LessThan, Key: "/c"}))},
+		{query.Not(query.And(query.FilterKeyPrefix{Prefix: "/a/"}, query.FilterValuePrefix{Prefix: []byte("2")}))},
+		{query.Or(query.FilterKeyGlob{Pattern: "/a/?5"}, query.FilterSize{Op: query.GreaterThan, Size: 1})},
+	}
+	orders := [][]query.Order{nil, {query.OrderByKey{}}, {query.OrderByKeyDescending{}}, {query.OrderByValue{}}}
+	for _, f := range filters {
+		for _, o := range orders {
+			for _, page := range [][2]int{{0, 0}, {0, 5}, {3, 4}, {7, 0}} {
+				q := query.Query{Filters: f, Orders: o, Offset: page[0], Limit: page[1]}
+				res, err := m.Query(ctx, q)
+				require.NoError(t, err)
+				got, err := res.Rest()
+				require.NoError(t, err)
+
+				want, err := query.NaiveQueryApply(q, query.ResultsWithEntries(q, all)).Rest()
+				require.NoError(t, err)
+				if len(o) == 0 {
+					// Unordered: only the number of results is defined.
+					require.Len(t, got, len(want), q.String())
+					continue
+				}
+				require.Equal(t, want, got, q.String())
+			}
+		}
+	}
+}
+
+// countingDatastore counts the results pulled from its queries.
+type countingDatastore struct {
+	datastore.Datastore
+	pulled int
+}
+
+func (c *countingDatastore) Query(ctx context.Context, q query.Query) (query.Results, error) {
+	res, err := c.Datastore.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return query.ResultsFromIterator(q, query.Iterator{
+		Next: func() (query.Result, bool) {
+			r, ok := res.NextSync()
+			if ok {
+				c.pulled++
+			}
+			return r, ok
+		},
+		Close: res.Close,
+	}), nil
+}
+
+func TestQueryLimitStopsEarly(t *testing.T) {
+	ctx := context.Background()
+	a := &countingDatastore{Datastore: datastore.NewMapDatastore()}
+	b := &countingDatastore{Datastore: datastore.NewMapDatastore()}
+	m := mount.New([]mount.Mount{
+		{Prefix: datastore.NewKey("/a"), Datastore: a},
+		{Prefix: datastore.NewKey("/b"), Datastore: b},
+	})
+	for i := range 50 {
+		require.NoError(t, m.Put(ctx, datastore.NewKey(fmt.Sprintf("/a/%02d", i)), nil))
+		require.NoError(t, m.Put(ctx, datastore.NewKey(fmt.Sprintf("/b/%02d", i)), nil))
+	}
+
+	res, err := m.Query(ctx, query.Query{Orders: []query.Order{query.OrderByKey{}}, Offset: 2, Limit: 3})
+	require.NoError(t, err)
+	entries, err := res.Rest()
+	require.NoError(t, err)
+	require.Equal(t, []string{"/a/02", "/a/03", "/a/04"}, keysOf(entries))
+	require.LessOrEqual(t, a.pulled, 5)
+	require.LessOrEqual(t, b.pulled, 5)
+}
+
+// errResultDatastore returns an error result before the results of its
+// queries.
+type errResultDatastore struct {
+	datastore.Datastore
+}
+
+func (d *errResultDatastore) Query(ctx context.Context, q query.Query) (query.Results, error) {
+	res, err := d.Datastore.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	sent := false
+	return query.ResultsFromIterator(q, query.Iterator{
+		Next: func() (query.Result, bool) {
+			if !sent {
+				sent = true
+				return query.Result{Error: errors.New("test error")}, true
+			}
+			return res.NextSync()
+		},
+		Close: res.Close,
+	}), nil
+}
+
+func TestQueryLimitSkipsErrors(t *testing.T) {
+	ctx := context.Background()
+	m := mount.New([]mount.Mount{
+		{Prefix: datastore.NewKey("/a"), Datastore: &errResultDatastore{Datastore: datastore.NewMapDatastore()}},
+		{Prefix: datastore.NewKey("/b"), Datastore: datastore.NewMapDatastore()},
+	})
+	for i := range 5 {
+		require.NoError(t, m.Put(ctx, datastore.NewKey(fmt.Sprintf("/a/%02d", i)), nil))
+	}
+
+	res, err := m.Query(ctx, query.Query{Orders: []query.Order{query.OrderByKey{}}, Offset: 1, Limit: 2})
+	require.NoError(t, err)
+	var keys []string
+	errs := 0
+	for r := range res.Next() {
+		if r.Error != nil {
+			errs++
+			continue
+		}
+		keys = append(keys, r.Key)
+	}
+	require.Equal(t, 1, errs)
+	require.Equal(t, []string{"/a/01", "/a/02"}, keys)
+}
+
+func keysOf(entries []query.Entry) []string {
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	return keys
+}
+
+// commitGate blocks batch commits until release is closed, tracking how many
+// run at once.
+type commitGate struct {
+	release   chan struct{}
+	lk        gosync.Mutex
+	running   int
+	peak      int
+	committed int
+}
+
+type slowBatching struct {
+	*datastore.MapDatastore
+	gate *commitGate
+}
+
+func (d *slowBatching) Batch(ctx context.Context) (datastore.Batch, error) {
+	return &slowBatch{Batch: datastore.NewBasicBatch(d.MapDatastore), gate: d.gate}, nil
+}
+
+type slowBatch struct {
+	datastore.Batch
+	gate *commitGate
+}
+
+func (b *slowBatch) Commit(ctx context.Context) error {
+	g := b.gate
+	g.lk.Lock()
+	g.running++
+	g.peak = max(g.peak, g.running)
+	g.lk.Unlock()
+	<-g.release
+	g.lk.Lock()
+	g.running--
+	g.committed++
+	g.lk.Unlock()
+	return b.Batch.Commit(ctx)
+}
+
+func TestBatchCommitParallel(t *testing.T) {
+	ctx := context.Background()
+	gate := &commitGate{release: make(chan struct{})}
+	var mounts []mount.Mount
+	for i := range 6 {
+		mounts = append(mounts, mount.Mount{
+			Prefix:    datastore.NewKey(fmt.Sprintf("/%d", i)),
+			Datastore: &slowBatching{MapDatastore: datastore.NewMapDatastore(), gate: gate},
+		})
+	}
+	m := mount.New(mounts)
+	m.BatchConcurrency = 3
+
+	b, err := m.Batch(ctx)
+	require.NoError(t, err)
+	for i := range 6 {
+		require.NoError(t, b.Put(ctx, datastore.NewKey(fmt.Sprintf("/%d/k", i)), nil))
+	}
+	done := make(chan error)
+	go func() { done <- b.Commit(ctx) }()
+	require.Eventually(t, func() bool {
+		gate.lk.Lock()
+		defer gate.lk.Unlock()
+		return gate.running == 3
+	}, time.Second, time.Millisecond)
+	close(gate.release)
+	require.NoError(t, <-done)
+	require.Equal(t, 3, gate.peak)
+	require.Equal(t, 6, gate.committed)
+	for i := range 6 {
+		require.True(t, hasKey(t, m, fmt.Sprintf("/%d/k", i)))
+	}
+}
+
+func TestBatchCommitErrorAndRetry(t *testing.T) {
+	ctx := context.Background()
+	errCommit := errors.New("commit failure")
+	good := datastore.NewMapDatastore()
+	flaky := failstore.NewRuleFailstore(datastore.NewMapDatastore(), 1,
+		failstore.Rule{Op: "batch-commit", Nth: 1, Err: errCommit})
+	m := mount.New([]mount.Mount{
+		{Prefix: datastore.NewKey("/good"), Datastore: good},
+		{Prefix: datastore.NewKey("/flaky"), Datastore: flaky},
+	})
+
+	b, err := m.Batch(ctx)
+	require.NoError(t, err)
+	require.NoError(t, b.Put(ctx, datastore.NewKey("/good/a"), nil))
+	require.NoError(t, b.Put(ctx, datastore.NewKey("/flaky/a"), nil))
+
+	err = b.Commit(ctx)
+	require.ErrorIs(t, err, errCommit)
+	var cerr *mount.CommitError
+	require.ErrorAs(t, err, &cerr)
+	require.Equal(t, []datastore.Key{datastore.NewKey("/good")}, cerr.Committed)
+	require.Len(t, cerr.Failed, 1)
+	require.Equal(t, datastore.NewKey("/flaky"), cerr.Failed[0].Prefix)
+	require.EqualError(t, err, "batch failed to commit to 1 of 2 mounts: committing batch to datastore at /flaky: commit failure")
+	require.True(t, hasKey(t, m, "/good/a"))
+	require.False(t, hasKey(t, m, "/flaky/a"))
+
+	// Only the failed mount is committed again.
+	require.NoError(t, good.Delete(ctx, datastore.NewKey("/a")))
+	require.NoError(t, b.Commit(ctx))
+	require.True(t, hasKey(t, m, "/flaky/a"))
+	require.False(t, hasKey(t, m, "/good/a"))
+}
+
+// forgetfulBatching hands out batches that forget their operations once
+// committed, whether the commit succeeded or not, like many backends do.
+type forgetfulBatching struct {
+	datastore.Batching
+}
+
+func (d *forgetfulBatching) Batch(ctx context.Context) (datastore.Batch, error) {
+	b, err := d.Batching.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &forgetfulBatch{Batch: b, d: d}, nil
+}
+
+type forgetfulBatch struct {
+	datastore.Batch
+	d *forgetfulBatching
+}
+
+func (b *forgetfulBatch) Commit(ctx context.Context) error {
+	err := b.Batch.Commit(ctx)
+	fresh, berr := b.d.Batching.Batch(ctx)
+	if berr != nil {
+		return berr
+	}
+	b.Batch = fresh
+	return err
+}
+
+func TestBatchCommitRetryReplays(t *testing.T) {
+	ctx := context.Background()
+	errCommit := errors.New("commit failure")
+	flaky := &forgetfulBatching{Batching: failstore.NewRuleFailstore(datastore.NewMapDatastore(), 1,
+		failstore.Rule{Op: "batch-commit", Nth: 1, Err: errCommit})}
+	m := mount.New([]mount.Mount{{Prefix: datastore.NewKey("/flaky"), Datastore: flaky}})
+
+	b, err := m.Batch(ctx)
+	require.NoError(t, err)
+	require.NoError(t, b.Put(ctx, datastore.NewKey("/flaky/a"), []byte("a")))
+	require.NoError(t, b.Put(ctx, datastore.NewKey("/flaky/b"), []byte("b")))
+	require.NoError(t, b.Delete(ctx, datastore.NewKey("/flaky/a")))
+	require.ErrorIs(t, b.Commit(ctx), errCommit)
+
+	// The failed batch forgot its operations, so they are replayed on a new
+	// one.
+	require.NoError(t, b.Commit(ctx))
+	require.False(t, hasKey(t, m, "/flaky/a"))
+	require.True(t, hasKey(t, m, "/flaky/b"))
+}
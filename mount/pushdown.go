@@ -0,0 +1,303 @@
+package mount
+
+import (
+	"fmt"
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// Plan describes how Query runs a query across the mounts. See Explain.
+type Plan struct {
+	// Mounts holds the queries sent to the mounts, in lookup order.
+	Mounts []MountQuery
+	// Filters are the filters, simplified with query.Simplify, that could
+	// not be pushed to every mount, and are applied to the merged results.
+	Filters []query.Filter
+	// Offset and Limit are applied to the merged results.
+	Offset int
+	Limit  int
+	// LimitPushed is true if the mounts were asked for at most Offset+Limit
+	// results each.
+	LimitPushed bool
+
+	// pushed are the filters pushed to every mount, or settled for each.
+	pushed []query.Filter
+}
+
+// MountQuery is the query sent to a mount.
+type MountQuery struct {
+	Prefix ds.Key
+	Query  query.Query
+	// Skipped is true if the filters exclude every key of the mount, which
+	// is then not queried.
+	Skipped bool
+
+	dstore ds.Datastore
+}
+
+// String returns a description of the plan, one line per mount followed by
+// the operations applied to the merged results.
+func (p Plan) String() string {
+	var s strings.Builder
+	for _, m := range p.Mounts {
+		if m.Skipped {
+			fmt.Fprintf(&s, "mount %s: skipped\n", m.Prefix)
+		} else {
+			fmt.Fprintf(&s, "mount %s: %s\n", m.Prefix, m.Query)
+		}
+	}
+	s.WriteString("merge:")
+	if len(p.Filters) > 0 {
+		fmt.Fprintf(&s, " FILTER %s", p.Filters)
+	}
+	if p.Offset > 0 {
+		fmt.Fprintf(&s, " OFFSET %d", p.Offset)
+	}
+	if p.Limit > 0 {
+		fmt.Fprintf(&s, " LIMIT %d", p.Limit)
+	}
+	return s.String()
+}
+
+// Explain returns the plan Query would follow for q, without running it.
+func (d *Datastore) Explain(q query.Query) Plan {
+	return d.plan(q)
+}
+
+// ExplainQuery implements query.Explainer, describing the plan Query would
+// follow for q along with the queries of the mounts.
+func (d *Datastore) ExplainQuery(q query.Query) query.Explain {
+	plan := d.plan(q)
+	e := query.Explain{Query: q, Native: q, Residual: plan.residual()}
+	e.Native.Filters = plan.pushed
+	e.Native.Offset, e.Native.Limit = 0, 0
+	if plan.LimitPushed {
+		e.Native.Limit = q.Offset + q.Limit
+	}
+
+	for _, f := range plan.Filters {
+		e.Notef("filter %s is not supported by every mount", f)
+	}
+	if q.Limit > 0 && !plan.LimitPushed {
+		e.Notef("limit applies after the merge, as filters are residual or orders depend on full keys")
+	}
+	for _, m := range plan.Mounts {
+		if m.Skipped {
+			e.Notef("mount %s is skipped, as no key passes the filters", m.Prefix)
+			continue
+		}
+		c := ds.Explain(m.dstore, m.Query)
+		c.Datastore = fmt.Sprintf("%s: %s", m.Prefix, c.Datastore)
+		e.Children = append(e.Children, c)
+	}
+	return e
+}
+
+// residual returns the query applied to the merged results.
+func (p Plan) residual() query.Query {
+	r := query.Query{Filters: p.Filters, Offset: p.Offset}
+	if !p.LimitPushed {
+		r.Limit = p.Limit
+	}
+	return r
+}
+
+func (d *Datastore) plan(master query.Query) Plan {
+	childQuery := query.Query{
+		Prefix:            master.Prefix,
+		Orders:            master.Orders,
+		KeysOnly:          master.KeysOnly,
+		ReturnExpirations: master.ReturnExpirations,
+		ReturnsSizes:      master.ReturnsSizes,
+	}
+
+	master.Filters = query.Simplify(master.Filters)
+	dses, mounts, rests := d.lookupAll(ds.NewKey(master.Prefix))
+	plan := Plan{Offset: master.Offset, Limit: master.Limit}
+	kept := make([]bool, len(master.Filters))
+	for i := range dses {
+		mq := MountQuery{Prefix: mounts[i], Query: childQuery, dstore: dses[i]}
+		mq.Query.Prefix = rests[i].String()
+		mq.Query.Filters = nil
+		for j, f := range master.Filters {
+			switch pf, push := translateFilter(mounts[i], f); push {
+			case pushUnsupported:
+				kept[j] = true
+			case pushFilter:
+				mq.Query.Filters = append(mq.Query.Filters, pf)
+			case pushNever:
+				mq.Skipped = true
+			}
+		}
+		plan.Mounts = append(plan.Mounts, mq)
+	}
+	for j, f := range master.Filters {
+		if kept[j] {
+			plan.Filters = append(plan.Filters, f)
+		} else {
+			plan.pushed = append(plan.pushed, f)
+		}
+	}
+
+	// With every filter pushed down, and orders the mounts sort by in the
+	// same way as the merge, the first Offset+Limit merged results are
+	// among the first Offset+Limit results of each mount.
+	if master.Limit > 0 && len(plan.Filters) == 0 && pushableOrders(master.Orders) {
+		plan.LimitPushed = true
+		for i := range plan.Mounts {
+			plan.Mounts[i].Query.Limit = master.Offset + master.Limit
+		}
+	}
+	return plan
+}
+
+// pushableOrders returns whether the mounts order results like the merge
+// does. Arbitrary orders may depend on the full keys of the entries.
+func pushableOrders(orders []query.Order) bool {
+	for _, o := range orders {
+		switch o.(type) {
+		case query.OrderByKey, *query.OrderByKey,
+			query.OrderByKeyDescending, *query.OrderByKeyDescending,
+			query.OrderByValue, *query.OrderByValue,
+			query.OrderByValueDescending, *query.OrderByValueDescending:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type pushdown int
+
+const (
+	// pushUnsupported means the filter must be applied after the merge.
+	pushUnsupported pushdown = iota
+	// pushFilter means the filter can be sent to the mount.
+	pushFilter
+	// pushAlways means every key of the mount passes the filter.
+	pushAlways
+	// pushNever means no key of the mount passes the filter.
+	pushNever
+)
+
+// translateFilter translates f, which applies to the keys of the mount
+// datastore, into a filter on the keys of the datastore mounted at mount.
+func translateFilter(mount ds.Key, f query.Filter) (query.Filter, pushdown) {
+	// Keys of the mounted datastore all start with "/", and are prefixed
+	// with p in the mount datastore.
+	p := mount.String()
+	if p == "/" {
+		p = ""
+	}
+
+	switch f := f.(type) {
+	case query.FilterValueCompare, *query.FilterValueCompare,
+		query.FilterValuePrefix, *query.FilterValuePrefix,
+		query.FilterValueContains, *query.FilterValueContains,
+		query.FilterSize, *query.FilterSize,
+		query.FilterExpiration, *query.FilterExpiration:
+		return f, pushFilter
+	case query.FilterKeyPrefix:
+		return pushKeyPrefix(p, f.Prefix)
+	case *query.FilterKeyPrefix:
+		return pushKeyPrefix(p, f.Prefix)
+	case query.FilterKeyCompare:
+		return pushKeyCompare(p, f.Op, f.Key)
+	case *query.FilterKeyCompare:
+		return pushKeyCompare(p, f.Op, f.Key)
+	case query.FilterAnd:
+		return translateJunction(mount, f.Filters, false)
+	case query.FilterOr:
+		return translateJunction(mount, f.Filters, true)
+	case query.FilterNot:
+		switch pf, push := translateFilter(mount, f.Negated); push {
+		case pushFilter:
+			return query.FilterNot{Negated: pf}, pushFilter
+		case pushAlways:
+			return nil, pushNever
+		case pushNever:
+			return nil, pushAlways
+		}
+		return nil, pushUnsupported
+	default:
+		return nil, pushUnsupported
+	}
+}
+
+// translateJunction translates the conjunction of filters, or their
+// disjunction if or is set. It can only be pushed down if all of the filters
+// can.
+func translateJunction(mount ds.Key, filters []query.Filter, or bool) (query.Filter, pushdown) {
+	// A filter passing every key of the mount settles a disjunction, and
+	// one passing none settles a conjunction.
+	settled, neutral := pushNever, pushAlways
+	if or {
+		settled, neutral = pushAlways, pushNever
+	}
+
+	var pushed []query.Filter
+	for _, f := range filters {
+		switch pf, push := translateFilter(mount, f); push {
+		case pushUnsupported:
+			return nil, pushUnsupported
+		case pushFilter:
+			pushed = append(pushed, pf)
+		case settled:
+			return nil, settled
+		}
+	}
+	switch {
+	case len(pushed) == 0:
+		return nil, neutral
+	case len(pushed) == 1:
+		return pushed[0], pushFilter
+	case or:
+		return query.FilterOr{Filters: pushed}, pushFilter
+	default:
+		return query.FilterAnd{Filters: pushed}, pushFilter
+	}
+}
+
+func pushKeyPrefix(p, prefix string) (query.Filter, pushdown) {
+	switch {
+	case len(prefix) <= len(p) && strings.HasPrefix(p, prefix):
+		return nil, pushAlways
+	case strings.HasPrefix(prefix, p):
+		return query.FilterKeyPrefix{Prefix: prefix[len(p):]}, pushFilter
+	default:
+		return nil, pushNever
+	}
+}
+
+func pushKeyCompare(p string, op query.Op, key string) (query.Filter, pushdown) {
+	if strings.HasPrefix(key, p) {
+		return query.FilterKeyCompare{Op: op, Key: key[len(p):]}, pushFilter
+	}
+
+	// The keys of the mount all compare to key like p does.
+	n := min(len(p), len(key))
+	cmp := strings.Compare(p[:n], key[:n])
+	if cmp == 0 {
+		// key is a prefix of p, so shorter than the keys of the mount.
+		cmp = 1
+	}
+	var pass bool
+	switch op {
+	case query.Equal:
+		pass = false
+	case query.NotEqual:
+		pass = true
+	case query.GreaterThan, query.GreaterThanOrEqual:
+		pass = cmp > 0
+	case query.LessThan, query.LessThanOrEqual:
+		pass = cmp < 0
+	default:
+		return nil, pushUnsupported
+	}
+	if pass {
+		return nil, pushAlways
+	}
+	return nil, pushNever
+}
@@ -0,0 +1,137 @@
+package mount
+
+import (
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateFilter(t *testing.T) {
+	cases := []struct {
+		mount  string
+		filter query.Filter
+		want   query.Filter
+		push   pushdown
+	}{
+		{"/", query.FilterKeyPrefix{Prefix: "/a"}, query.FilterKeyPrefix{Prefix: "/a"}, pushFilter},
+		{"/a", query.FilterKeyPrefix{Prefix: "/a/b"}, query.FilterKeyPrefix{Prefix: "/b"}, pushFilter},
+		{"/a/b", query.FilterKeyPrefix{Prefix: "/a"}, nil, pushAlways},
+		{"/b", query.FilterKeyPrefix{Prefix: "/a"}, nil, pushNever},
+		{"/a", query.FilterKeyCompare{Op: query.GreaterThan, Key: "/a/m"}, query.FilterKeyCompare{Op: query.GreaterThan, Key: "/m"}, pushFilter},
+		{"/a", query.FilterKeyCompare{Op: query.GreaterThan, Key: "/b"}, nil, pushNever},
+		{"/a", query.FilterKeyCompare{Op: query.LessThan, Key: "/b"}, nil, pushAlways},
+		{"/ab", query.FilterKeyCompare{Op: query.GreaterThan, Key: "/a"}, nil, pushAlways},
+		{"/a", query.FilterKeyCompare{Op: query.Equal, Key: "/b/c"}, nil, pushNever},
+		{"/a", query.FilterKeyCompare{Op: query.NotEqual, Key: "/b/c"}, nil, pushAlways},
+		{"/a", query.FilterValueCompare{Op: query.Equal, Value: []byte("v")}, query.FilterValueCompare{Op: query.Equal, Value: []byte("v")}, pushFilter},
+		{"/a", query.FilterKeyPrefix{Prefix: "/a"}, nil, pushAlways},
+		{"/a", query.FilterSize{Op: query.LessThan, Size: 3}, query.FilterSize{Op: query.LessThan, Size: 3}, pushFilter},
+		{"/a", query.Not(query.FilterKeyPrefix{Prefix: "/a/b"}), query.Not(query.FilterKeyPrefix{Prefix: "/b"}), pushFilter},
+		{"/a", query.Not(query.FilterKeyPrefix{Prefix: "/b"}), nil, pushAlways},
+		{"/a", query.Or(query.FilterKeyPrefix{Prefix: "/a/b"}, query.FilterKeyPrefix{Prefix: "/c"}), query.FilterKeyPrefix{Prefix: "/b"}, pushFilter},
+		{"/a", query.Or(query.FilterKeyPrefix{Prefix: "/b"}, query.FilterKeyPrefix{Prefix: "/c"}), nil, pushNever},
+		{"/a", query.Or(query.FilterKeyPrefix{Prefix: "/a"}, query.FilterKeyGlob{Pattern: "/*"}), nil, pushAlways},
+		{"/a", query.And(query.FilterKeyPrefix{Prefix: "/a"}, query.FilterKeyGlob{Pattern: "/*"}), nil, pushUnsupported},
+		{"/a", query.And(query.FilterKeyPrefix{Prefix: "/b"}, query.FilterKeyGlob{Pattern: "/*"}), nil, pushNever},
+		{
+			"/a",
+			query.And(query.FilterKeyPrefix{Prefix: "/a/b"}, query.FilterValuePrefix{Prefix: []byte("v")}),
+			query.And(query.FilterKeyPrefix{Prefix: "/b"}, query.FilterValuePrefix{Prefix: []byte("v")}),
+			pushFilter,
+		},
+	}
+	for _, c := range cases {
+		got, push := translateFilter(datastore.NewKey(c.mount), c.filter)
+		require.Equal(t, c.push, push, "%s at %s", c.filter, c.mount)
+		require.Equal(t, c.want, got, "%s at %s", c.filter, c.mount)
+	}
+
+	_, push := translateFilter(datastore.NewKey("/a"), filterFunc(func(query.Entry) bool { return true }))
+	require.Equal(t, pushUnsupported, push)
+}
+
+type filterFunc func(query.Entry) bool
+
+func (f filterFunc) Filter(e query.Entry) bool { return f(e) }
+
+func TestExplain(t *testing.T) {
+	m := New([]Mount{
+		{Prefix: datastore.NewKey("/"), Datastore: datastore.NewMapDatastore()},
+		{Prefix: datastore.NewKey("/a"), Datastore: datastore.NewMapDatastore()},
+		{Prefix: datastore.NewKey("/b"), Datastore: datastore.NewMapDatastore()},
+	})
+
+	plan := m.Explain(query.Query{
+		Filters: []query.Filter{query.FilterKeyCompare{Op: query.GreaterThanOrEqual, Key: "/a/x"}},
+		Orders:  []query.Order{query.OrderByKey{}},
+		Offset:  5,
+		Limit:   10,
+	})
+	require.True(t, plan.LimitPushed)
+	require.Empty(t, plan.Filters)
+	require.Equal(t, `mount /b: SELECT keys,vals FROM "/" ORDER [KEY] LIMIT 15
+mount /a: SELECT keys,vals FROM "/" FILTER [KEY >= "/x"] ORDER [KEY] LIMIT 15
+mount /: SELECT keys,vals FROM "/" FILTER [KEY >= "/a/x"] ORDER [KEY] LIMIT 15
+merge: OFFSET 5 LIMIT 10`, plan.String())
+
+	plan = m.Explain(query.Query{
+		Prefix:  "/a",
+		Filters: []query.Filter{filterFunc(func(query.Entry) bool { return true })},
+		Limit:   10,
+	})
+	require.False(t, plan.LimitPushed)
+	require.Len(t, plan.Filters, 1)
+	require.Len(t, plan.Mounts, 1)
+	require.Equal(t, 0, plan.Mounts[0].Query.Limit)
+
+	plan = m.Explain(query.Query{Filters: []query.Filter{
+		query.Not(query.FilterKeyCompare{Op: query.LessThan, Key: "/a/x"}),
+		query.Or(query.FilterKeyGlob{Pattern: "/b/*"}, query.FilterKeyPrefix{Prefix: "/a/"}),
+	}})
+	require.Equal(t, `mount /b: SELECT keys,vals FROM "/"
+mount /a: SELECT keys,vals FROM "/" FILTER [KEY >= "/x"]
+mount /: SELECT keys,vals FROM "/" FILTER [KEY >= "/a/x"]
+merge: FILTER [OR(GLOB("/b/*"), PREFIX("/a/"))]`, plan.String())
+
+	plan = m.Explain(query.Query{Filters: []query.Filter{query.FilterKeyPrefix{Prefix: "/b/"}}})
+	var skipped []string
+	for _, mq := range plan.Mounts {
+		if mq.Skipped {
+			skipped = append(skipped, mq.Prefix.String())
+		}
+	}
+	require.Equal(t, []string{"/a"}, skipped)
+}
+
+func TestExplainQuery(t *testing.T) {
+	m := New([]Mount{
+		{Prefix: datastore.NewKey("/a"), Datastore: datastore.NewMapDatastore()},
+		{Prefix: datastore.NewKey("/b"), Datastore: datastore.NewMapDatastore()},
+	})
+
+	e := datastore.Explain(m, query.Query{
+		Filters: []query.Filter{
+			query.FilterKeyPrefix{Prefix: "/a/"},
+			filterFunc(func(query.Entry) bool { return true }),
+		},
+		Limit: 10,
+	})
+	require.Equal(t, "*mount.Datastore", e.Datastore)
+	require.Equal(t, []query.Filter{query.FilterKeyPrefix{Prefix: "/a/"}}, e.Native.Filters)
+	require.Zero(t, e.Native.Limit)
+	require.Len(t, e.Residual.Filters, 1)
+	require.Equal(t, 10, e.Residual.Limit)
+	require.Len(t, e.Notes, 3)
+	require.Contains(t, e.Notes, "mount /b is skipped, as no key passes the filters")
+	require.Len(t, e.Children, 1)
+	require.Equal(t, "/a: *datastore.MapDatastore", e.Children[0].Datastore)
+	require.Equal(t, `SELECT keys,vals FROM "/" FILTER [PREFIX("/")]`, e.Children[0].Query.String())
+
+	e = m.ExplainQuery(query.Query{Orders: []query.Order{query.OrderByKey{}}, Offset: 1, Limit: 2})
+	require.Equal(t, 3, e.Native.Limit)
+	require.Equal(t, query.Query{Offset: 1}, e.Residual)
+	require.Empty(t, e.Notes)
+	require.Len(t, e.Children, 2)
+}
@@ -0,0 +1,138 @@
+package mount
+
+import (
+	"slices"
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// trie indexes mounts by the namespaces of their prefixes, so that looking up
+// a key costs the depth of the key rather than the number of mounts.
+type trie struct {
+	children map[string]*trie
+	mount    *Mount
+}
+
+// namespaces returns the path of key in the trie. The root key has an empty
+// path.
+func namespaces(key ds.Key) []string {
+	if key.String() == "/" {
+		return nil
+	}
+	return key.List()
+}
+
+// insert adds m to the trie, replacing the mount at the same prefix, if any.
+func (t *trie) insert(m Mount) {
+	n := t
+	for _, ns := range namespaces(m.Prefix) {
+		child, ok := n.children[ns]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[string]*trie)
+			}
+			child = new(trie)
+			n.children[ns] = child
+		}
+		n = child
+	}
+	n.mount = &m
+}
+
+// get returns the mount at prefix, or nil.
+func (t *trie) get(prefix ds.Key) *Mount {
+	n := t
+	for _, ns := range namespaces(prefix) {
+		if n = n.children[ns]; n == nil {
+			return nil
+		}
+	}
+	return n.mount
+}
+
+// remove removes the mount at prefix, pruning the nodes left empty, and
+// returns it.
+func (t *trie) remove(prefix ds.Key) *Mount {
+	path := namespaces(prefix)
+	nodes := []*trie{t}
+	for _, ns := range path {
+		n := nodes[len(nodes)-1].children[ns]
+		if n == nil {
+			return nil
+		}
+		nodes = append(nodes, n)
+	}
+	m := nodes[len(path)].mount
+	nodes[len(path)].mount = nil
+	for i := len(path); i > 0; i-- {
+		if n := nodes[i]; n.mount != nil || len(n.children) > 0 {
+			break
+		}
+		delete(nodes[i-1].children, path[i-1])
+	}
+	return m
+}
+
+// owner returns the mount key lives in: the most specific mount whose prefix
+// is a strict ancestor of key. It returns nil if there is none.
+func (t *trie) owner(key ds.Key) *Mount {
+	path := namespaces(key)
+	if len(path) == 0 {
+		return nil
+	}
+	owner := t.mount
+	n := t
+	for _, ns := range path[:len(path)-1] {
+		if n = n.children[ns]; n == nil {
+			break
+		}
+		if n.mount != nil {
+			owner = n.mount
+		}
+	}
+	return owner
+}
+
+// covering returns the mounts that may hold strict descendants of key: the
+// mounts under key, most specific first, followed by the most specific mount
+// at or above key.
+func (t *trie) covering(key ds.Key) []*Mount {
+	var ancestor *Mount
+	n := t
+	for _, ns := range namespaces(key) {
+		if n.mount != nil {
+			ancestor = n.mount
+		}
+		if n = n.children[ns]; n == nil {
+			break
+		}
+	}
+
+	var mounts []*Mount
+	if n != nil {
+		if n.mount != nil {
+			ancestor = n.mount
+		}
+		for _, child := range n.children {
+			child.collect(&mounts)
+		}
+		slices.SortFunc(mounts, func(a, b *Mount) int {
+			return strings.Compare(b.Prefix.String(), a.Prefix.String())
+		})
+	}
+	if ancestor != nil {
+		mounts = append(mounts, ancestor)
+	}
+	return mounts
+}
+
+// collect appends the mounts of t and its descendants to mounts.
+func (t *trie) collect(mounts *[]*Mount) {
+	if t.mount != nil {
+		*mounts = append(*mounts, t.mount)
+	}
+	for _, child := range t.children {
+		child.collect(mounts)
+	}
+}
@@ -0,0 +1,208 @@
+package mount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// PreparedTxn is implemented by transactions supporting two-phase commits.
+type PreparedTxn interface {
+	ds.Txn
+
+	// Prepare checks that the transaction can be committed, and makes sure
+	// that a following Commit only fails on I/O errors. Discard releases
+	// what Prepare reserved.
+	Prepare(ctx context.Context) error
+}
+
+// txn is a transaction over the mounted datastores. It opens a transaction on
+// each mounted datastore it touches, on first use.
+type txn struct {
+	d        *Datastore
+	readOnly bool
+
+	lk     sync.Mutex
+	mounts map[string]*mountTxn
+}
+
+type mountTxn struct {
+	prefix ds.Key
+	txn    ds.Txn
+}
+
+var _ ds.Txn = (*txn)(nil)
+
+// NewTransaction returns a transaction over the mounted datastores, which
+// must implement transactions. Transactions on the mounted datastores are
+// opened as keys under them are first read or written.
+//
+// Commit commits the transactions of the mounted datastores one after the
+// other, in lookup order, so that each mount sees all or none of the writes
+// under it. If every transaction touched implements PreparedTxn, they are
+// all prepared first, and none are committed if one fails to prepare.
+// Otherwise, a failure to commit on one mount leaves the mounts committed
+// before it committed; the error lists the mounts on which the commit
+// failed or was abandoned.
+func (d *Datastore) NewTransaction(ctx context.Context, readOnly bool) (ds.Txn, error) {
+	return &txn{
+		d:        d,
+		readOnly: readOnly,
+		mounts:   make(map[string]*mountTxn),
+	}, nil
+}
+
+// open returns the transaction on the datastore mounted at prefix, opening it
+// if needed.
+func (t *txn) open(ctx context.Context, prefix ds.Key, child ds.Datastore) (ds.Txn, error) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	if mt, ok := t.mounts[prefix.String()]; ok {
+		return mt.txn, nil
+	}
+	tds, ok := child.(ds.TxnFeature)
+	if !ok {
+		return nil, fmt.Errorf("datastore at %s: %w", prefix, ds.ErrTxnUnsupported)
+	}
+	ctxn, err := tds.NewTransaction(ctx, t.readOnly)
+	if err != nil {
+		return nil, err
+	}
+	t.mounts[prefix.String()] = &mountTxn{prefix: prefix, txn: ctxn}
+	return ctxn, nil
+}
+
+// lookup returns the transaction of the mount key lives in, opening it if
+// needed, and the key within the mount. It returns a nil transaction if no
+// datastore is mounted for key.
+func (t *txn) lookup(ctx context.Context, key ds.Key) (ds.Txn, ds.Key, error) {
+	child, prefix, rest := t.d.lookup(key)
+	if child == nil {
+		return nil, rest, nil
+	}
+	ctxn, err := t.open(ctx, prefix, child)
+	return ctxn, rest, err
+}
+
+func (t *txn) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	ctxn, k, err := t.lookup(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if ctxn == nil {
+		return nil, ds.ErrNotFound
+	}
+	return ctxn.Get(ctx, k)
+}
+
+func (t *txn) Has(ctx context.Context, key ds.Key) (bool, error) {
+	ctxn, k, err := t.lookup(ctx, key)
+	if err != nil || ctxn == nil {
+		return false, err
+	}
+	return ctxn.Has(ctx, k)
+}
+
+func (t *txn) GetSize(ctx context.Context, key ds.Key) (int, error) {
+	ctxn, k, err := t.lookup(ctx, key)
+	if err != nil {
+		return -1, err
+	}
+	if ctxn == nil {
+		return -1, ds.ErrNotFound
+	}
+	return ctxn.GetSize(ctx, k)
+}
+
+func (t *txn) Query(ctx context.Context, q query.Query) (query.Results, error) {
+	return t.d.query(ctx, q, func(m MountQuery) (ds.Read, error) {
+		return t.open(ctx, m.Prefix, m.dstore)
+	})
+}
+
+func (t *txn) Put(ctx context.Context, key ds.Key, value []byte) error {
+	ctxn, k, err := t.lookup(ctx, key)
+	if err != nil {
+		return err
+	}
+	if ctxn == nil {
+		return ErrNoMount
+	}
+	return ctxn.Put(ctx, k, value)
+}
+
+func (t *txn) Delete(ctx context.Context, key ds.Key) error {
+	ctxn, k, err := t.lookup(ctx, key)
+	if err != nil || ctxn == nil {
+		return err
+	}
+	return ctxn.Delete(ctx, k)
+}
+
+// touched returns the transactions opened so far, in lookup order. t.lk must
+// be held.
+func (t *txn) touched() []*mountTxn {
+	mounts := slices.Collect(maps.Values(t.mounts))
+	slices.SortFunc(mounts, func(a, b *mountTxn) int {
+		return strings.Compare(b.prefix.String(), a.prefix.String())
+	})
+	return mounts
+}
+
+func (t *txn) Commit(ctx context.Context) error {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	mounts := t.touched()
+	clear(t.mounts)
+	if len(mounts) > 1 && prepared(mounts) {
+		for i, mt := range mounts {
+			if err := mt.txn.(PreparedTxn).Prepare(ctx); err != nil {
+				for _, mt := range mounts {
+					mt.txn.Discard(ctx)
+				}
+				return fmt.Errorf("preparing transaction on datastore at %s: %w", mounts[i].prefix, err)
+			}
+		}
+	}
+
+	for i, mt := range mounts {
+		if err := mt.txn.Commit(ctx); err != nil {
+			errs := []error{fmt.Errorf("committing transaction on datastore at %s: %w", mt.prefix, err)}
+			for _, mt := range mounts[i+1:] {
+				mt.txn.Discard(ctx)
+				errs = append(errs, fmt.Errorf("transaction on datastore at %s abandoned", mt.prefix))
+			}
+			return errors.Join(errs...)
+		}
+	}
+	return nil
+}
+
+// prepared returns whether all of the transactions support two-phase commits.
+func prepared(mounts []*mountTxn) bool {
+	for _, mt := range mounts {
+		if _, ok := mt.txn.(PreparedTxn); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *txn) Discard(ctx context.Context) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	for _, mt := range t.touched() {
+		mt.txn.Discard(ctx)
+	}
+	clear(t.mounts)
+}
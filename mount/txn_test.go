@@ -0,0 +1,213 @@
+package mount_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	mount "github.com/ipfs/go-datastore/mount"
+	query "github.com/ipfs/go-datastore/query"
+	"github.com/stretchr/testify/require"
+)
+
+var errTxn = errors.New("txn failure")
+
+// txnDatastore is a map datastore whose transactions buffer their writes.
+type txnDatastore struct {
+	*datastore.MapDatastore
+	opened     int
+	twoPhase   bool
+	failCommit error
+	failPrep   error
+}
+
+func newTxnDatastore(twoPhase bool) *txnDatastore {
+	return &txnDatastore{MapDatastore: datastore.NewMapDatastore(), twoPhase: twoPhase}
+}
+
+func (d *txnDatastore) NewTransaction(ctx context.Context, readOnly bool) (datastore.Txn, error) {
+	d.opened++
+	t := &bufferedTxn{d: d, writes: make(map[datastore.Key][]byte)}
+	if d.twoPhase {
+		return &preparedTxn{t}, nil
+	}
+	return t, nil
+}
+
+type bufferedTxn struct {
+	d      *txnDatastore
+	writes map[datastore.Key][]byte
+}
+
+func (t *bufferedTxn) Get(ctx context.Context, key datastore.Key) ([]byte, error) {
+	if v, ok := t.writes[key]; ok {
+		return v, nil
+	}
+	return t.d.Get(ctx, key)
+}
+
+func (t *bufferedTxn) Has(ctx context.Context, key datastore.Key) (bool, error) {
+	if _, ok := t.writes[key]; ok {
+		return true, nil
+	}
+	return t.d.Has(ctx, key)
+}
+
+func (t *bufferedTxn) GetSize(ctx context.Context, key datastore.Key) (int, error) {
+	if v, ok := t.writes[key]; ok {
+		return len(v), nil
+	}
+	return t.d.GetSize(ctx, key)
+}
+
+func (t *bufferedTxn) Query(ctx context.Context, q query.Query) (query.Results, error) {
+	var entries []query.Entry
+	for k, v := range t.writes {
+		entries = append(entries, query.Entry{Key: k.String(), Value: v, Size: len(v)})
+	}
+	return query.NaiveQueryApply(q, query.ResultsWithEntries(q, entries)), nil
+}
+
+func (t *bufferedTxn) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	t.writes[key] = value
+	return nil
+}
+
+func (t *bufferedTxn) Delete(ctx context.Context, key datastore.Key) error {
+	delete(t.writes, key)
+	return nil
+}
+
+func (t *bufferedTxn) Commit(ctx context.Context) error {
+	if t.d.failCommit != nil {
+		return t.d.failCommit
+	}
+	for k, v := range t.writes {
+		if err := t.d.Put(ctx, k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *bufferedTxn) Discard(ctx context.Context) {
+	clear(t.writes)
+}
+
+type preparedTxn struct {
+	*bufferedTxn
+}
+
+func (t *preparedTxn) Prepare(ctx context.Context) error {
+	return t.d.failPrep
+}
+
+func hasKey(t *testing.T, d datastore.Datastore, key string) bool {
+	ok, err := d.Has(context.Background(), datastore.NewKey(key))
+	require.NoError(t, err)
+	return ok
+}
+
+func TestTxnOpensMountsLazily(t *testing.T) {
+	ctx := context.Background()
+	a, b := newTxnDatastore(false), newTxnDatastore(false)
+	m := mount.New([]mount.Mount{
+		{Prefix: datastore.NewKey("/a"), Datastore: a},
+		{Prefix: datastore.NewKey("/b"), Datastore: b},
+		{Prefix: datastore.NewKey("/c"), Datastore: datastore.NewMapDatastore()},
+	})
+
+	txn, err := m.NewTransaction(ctx, false)
+	require.NoError(t, err)
+	require.NoError(t, txn.Put(ctx, datastore.NewKey("/a/1"), []byte("1")))
+	v, err := txn.Get(ctx, datastore.NewKey("/a/1"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), v)
+	require.Equal(t, 1, a.opened)
+	require.Zero(t, b.opened)
+
+	require.ErrorIs(t, txn.Put(ctx, datastore.NewKey("/c/1"), nil), datastore.ErrTxnUnsupported)
+	require.ErrorIs(t, txn.Put(ctx, datastore.NewKey("/d"), nil), mount.ErrNoMount)
+	_, err = txn.Get(ctx, datastore.NewKey("/d"))
+	require.ErrorIs(t, err, datastore.ErrNotFound)
+
+	require.False(t, hasKey(t, m, "/a/1"))
+	require.NoError(t, txn.Commit(ctx))
+	require.True(t, hasKey(t, m, "/a/1"))
+	require.Zero(t, b.opened)
+}
+
+func TestTxnQueryAndDiscard(t *testing.T) {
+	ctx := context.Background()
+	a, b := newTxnDatastore(false), newTxnDatastore(false)
+	m := mount.New([]mount.Mount{
+		{Prefix: datastore.NewKey("/a"), Datastore: a},
+		{Prefix: datastore.NewKey("/b"), Datastore: b},
+	})
+
+	txn, err := m.NewTransaction(ctx, false)
+	require.NoError(t, err)
+	require.NoError(t, txn.Put(ctx, datastore.NewKey("/a/1"), nil))
+	require.NoError(t, txn.Put(ctx, datastore.NewKey("/b/2"), nil))
+	res, err := txn.Query(ctx, query.Query{Orders: []query.Order{query.OrderByKey{}}})
+	require.NoError(t, err)
+	entries, err := res.Rest()
+	require.NoError(t, err)
+	require.Equal(t, []string{"/a/1", "/b/2"}, keysOf(entries))
+
+	txn.Discard(ctx)
+	require.False(t, hasKey(t, m, "/a/1"))
+	require.False(t, hasKey(t, m, "/b/2"))
+}
+
+func TestTxnTwoPhaseCommit(t *testing.T) {
+	ctx := context.Background()
+	a, b := newTxnDatastore(true), newTxnDatastore(true)
+	m := mount.New([]mount.Mount{
+		{Prefix: datastore.NewKey("/a"), Datastore: a},
+		{Prefix: datastore.NewKey("/b"), Datastore: b},
+	})
+	a.failPrep = errTxn
+
+	txn, err := m.NewTransaction(ctx, false)
+	require.NoError(t, err)
+	require.NoError(t, txn.Put(ctx, datastore.NewKey("/a/1"), nil))
+	require.NoError(t, txn.Put(ctx, datastore.NewKey("/b/1"), nil))
+	err = txn.Commit(ctx)
+	require.ErrorIs(t, err, errTxn)
+	require.ErrorContains(t, err, "preparing transaction on datastore at /a")
+	require.False(t, hasKey(t, m, "/a/1"))
+	require.False(t, hasKey(t, m, "/b/1"))
+
+	a.failPrep = nil
+	txn, err = m.NewTransaction(ctx, false)
+	require.NoError(t, err)
+	require.NoError(t, txn.Put(ctx, datastore.NewKey("/a/1"), nil))
+	require.NoError(t, txn.Put(ctx, datastore.NewKey("/b/1"), nil))
+	require.NoError(t, txn.Commit(ctx))
+	require.True(t, hasKey(t, m, "/a/1"))
+	require.True(t, hasKey(t, m, "/b/1"))
+}
+
+func TestTxnPartialCommit(t *testing.T) {
+	ctx := context.Background()
+	a, b := newTxnDatastore(false), newTxnDatastore(false)
+	m := mount.New([]mount.Mount{
+		{Prefix: datastore.NewKey("/a"), Datastore: a},
+		{Prefix: datastore.NewKey("/b"), Datastore: b},
+	})
+	a.failCommit = errTxn
+
+	txn, err := m.NewTransaction(ctx, false)
+	require.NoError(t, err)
+	require.NoError(t, txn.Put(ctx, datastore.NewKey("/a/1"), nil))
+	require.NoError(t, txn.Put(ctx, datastore.NewKey("/b/1"), nil))
+	err = txn.Commit(ctx)
+	require.ErrorIs(t, err, errTxn)
+	require.ErrorContains(t, err, "committing transaction on datastore at /a")
+
+	// Mounts are committed in lookup order: /b before /a.
+	require.True(t, hasKey(t, m, "/b/1"))
+	require.False(t, hasKey(t, m, "/a/1"))
+}
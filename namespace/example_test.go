@@ -6,6 +6,7 @@ import (
 
 	ds "github.com/ipfs/go-datastore"
 	nsds "github.com/ipfs/go-datastore/namespace"
+	dsq "github.com/ipfs/go-datastore/query"
 )
 
 func Example() {
@@ -33,3 +34,30 @@ func Example() {
 	// ns.Get /beep -> boop
 	// mp.Get /foo/bar/beep -> boop
 }
+
+// The explain shows the glob filter can't go through the namespace, and that
+// the MapDatastore applies every part of the query itself.
+func Example_explain() {
+	ns := nsds.Wrap(ds.NewMapDatastore(), ds.NewKey("/foo/bar"))
+
+	fmt.Print(ds.Explain(ns, dsq.Query{
+		Prefix:  "/beep",
+		Filters: []dsq.Filter{dsq.FilterKeyGlob{Pattern: "/beep/*"}, dsq.FilterValuePrefix{Prefix: []byte("b")}},
+		Orders:  []dsq.Order{dsq.OrderByKey{}},
+		Limit:   10,
+	}))
+	// Output:
+	// *keytransform.Datastore
+	//   query:    SELECT keys,vals FROM "/beep" FILTER [GLOB("/beep/*"), VALUE PREFIX("b")] ORDER [KEY] LIMIT 10
+	//   native:   SELECT keys,vals FROM "/beep" FILTER [VALUE PREFIX("b")] ORDER [KEY]
+	//   residual: FILTER [GLOB("/beep/*")] LIMIT 10
+	//   note:     filter GLOB("/beep/*") is not supported
+	//   note:     offset and limit apply after the residual query
+	//   *datastore.MapDatastore
+	//     query:    SELECT keys,vals FROM "/foo/bar/beep" FILTER [VALUE PREFIX("b")] ORDER [KEY]
+	//     native:   SELECT keys,vals
+	//     residual: FROM "/foo/bar/beep" FILTER [VALUE PREFIX("b")] ORDER [KEY]
+	//     note:     prefix "/foo/bar/beep" is not supported
+	//     note:     filter VALUE PREFIX("b") is not supported
+	//     note:     order KEY is not supported
+}
@@ -17,6 +17,9 @@ func PrefixTransform(prefix ds.Key) ktds.PrefixTransform {
 }
 
 // Wrap wraps a given datastore with a key-prefix.
+//
+// Like keytransform.Wrap, the returned datastore implements every optional
+// feature; use scoped.Inherit to only expose the features child supports.
 func Wrap(child ds.Datastore, prefix ds.Key) *ktds.Datastore {
 	if child == nil {
 		panic("child (ds.Datastore) is nil")
@@ -0,0 +1,123 @@
+package overlay
+
+import (
+	"context"
+	"errors"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+// cursor reads the results of a layer, ordered by key.
+type cursor struct {
+	results dsq.Results
+	next    dsq.Result
+	ok      bool
+}
+
+func (c *cursor) advance() {
+	c.next, c.ok = c.results.NextSync()
+}
+
+// merger merges the results of the layers, ordered by key. A key is read from
+// the topmost layer holding it, and skipped if it is whited out and the upper
+// datastore doesn't hold it.
+type merger struct {
+	whiteouts *cursor
+	// layers holds the upper datastore's values first, then the lower
+	// datastores.
+	layers []*cursor
+	done   bool
+}
+
+// merge queries the layers with q, which must be ordered by key.
+func (d *Datastore) merge(ctx context.Context, q dsq.Query) (*merger, error) {
+	m := &merger{}
+	open := func(r ds.Read, q dsq.Query) (*cursor, error) {
+		res, err := r.Query(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		c := &cursor{results: res}
+		c.advance()
+		return c, nil
+	}
+
+	wq := dsq.Query{Prefix: q.Prefix, Orders: q.Orders, KeysOnly: true}
+	var err error
+	if m.whiteouts, err = open(d.whiteouts, wq); err != nil {
+		return nil, err
+	}
+	for _, l := range d.layers() {
+		c, err := open(l, q)
+		if err != nil {
+			m.close()
+			return nil, err
+		}
+		m.layers = append(m.layers, c)
+	}
+	return m, nil
+}
+
+func (m *merger) next() (dsq.Result, bool) {
+	for !m.done {
+		if r, ok := m.failed(); ok {
+			m.done = true
+			return r, true
+		}
+
+		var key string
+		found := false
+		for _, c := range m.layers {
+			if c.ok && (!found || c.next.Key < key) {
+				key = c.next.Key
+				found = true
+			}
+		}
+		if !found {
+			break
+		}
+
+		var out dsq.Result
+		top := -1
+		for i, c := range m.layers {
+			if c.ok && c.next.Key == key {
+				if top < 0 {
+					out, top = c.next, i
+				}
+				c.advance()
+			}
+		}
+
+		w := m.whiteouts
+		for w.ok && w.next.Error == nil && w.next.Key < key {
+			w.advance()
+		}
+		if top > 0 && w.ok && w.next.Key == key {
+			continue
+		}
+		return out, true
+	}
+	m.done = true
+	return dsq.Result{}, false
+}
+
+// failed returns the first error read from the layers, if any.
+func (m *merger) failed() (dsq.Result, bool) {
+	for _, c := range append([]*cursor{m.whiteouts}, m.layers...) {
+		if c.ok && c.next.Error != nil {
+			return c.next, true
+		}
+	}
+	return dsq.Result{}, false
+}
+
+func (m *merger) close() error {
+	var errs []error
+	for _, c := range append([]*cursor{m.whiteouts}, m.layers...) {
+		if c != nil {
+			errs = append(errs, c.results.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,330 @@
+// Package overlay implements a datastore layering a writable upper datastore
+// over read-only lower datastores, like a union filesystem. It makes cheap
+// copy-on-write forks of a large dataset: the fork only stores what changed.
+package overlay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+var (
+	// DataPrefix is the namespace of the upper datastore holding the
+	// values written to the overlay.
+	DataPrefix = ds.NewKey("/data")
+	// WhiteoutPrefix is the namespace of the upper datastore holding the
+	// whiteouts: markers of the keys deleted from the overlay that the
+	// lower datastores still hold.
+	WhiteoutPrefix = ds.NewKey("/whiteout")
+)
+
+// ErrNoLower is returned by Commit when the overlay has no lower datastore to
+// fold the upper one into.
+var ErrNoLower = errors.New("overlay: no lower datastore")
+
+// Datastore is an overlay datastore. Reads look up the upper datastore, then
+// each lower datastore in turn. Writes only go to the upper datastore, and
+// deletes of keys held by the lower datastores record a whiteout hiding them.
+//
+// The upper datastore stores values under DataPrefix and whiteouts under
+// WhiteoutPrefix, so it should not be shared with other users. Writes to a
+// key update both namespaces: concurrent writes to the same key must be
+// serialized, for example with sync.MutexWrap.
+type Datastore struct {
+	upper     ds.Datastore
+	data      ds.Datastore
+	whiteouts ds.Datastore
+	lowers    []ds.Datastore
+}
+
+var (
+	_ ds.Datastore           = (*Datastore)(nil)
+	_ ds.Batching            = (*Datastore)(nil)
+	_ ds.CheckedDatastore    = (*Datastore)(nil)
+	_ ds.ScrubbedDatastore   = (*Datastore)(nil)
+	_ ds.GCDatastore         = (*Datastore)(nil)
+	_ ds.PersistentDatastore = (*Datastore)(nil)
+	_ ds.Shim                = (*Datastore)(nil)
+)
+
+// New returns an overlay of upper over lowers. Lower datastores are listed
+// from the topmost down: a key held by several of them is read from the first
+// one.
+//
+// The returned datastore implements Batching, and checks, scrubs, collects
+// garbage and sums the disk usage of the layers supporting it, whether or not
+// any does; use scoped.Inherit to only expose the features every layer
+// supports, naming ds.FeatureNameBatching to keep it.
+func New(upper ds.Datastore, lowers ...ds.Datastore) *Datastore {
+	return &Datastore{
+		upper:     upper,
+		data:      namespace.Wrap(upper, DataPrefix),
+		whiteouts: namespace.Wrap(upper, WhiteoutPrefix),
+		lowers:    lowers,
+	}
+}
+
+// Children implements ds.Shim. It returns the upper datastore followed by the
+// lower ones.
+func (d *Datastore) Children() []ds.Datastore {
+	return append([]ds.Datastore{d.upper}, d.lowers...)
+}
+
+// layers returns the datastores values are read from, from the topmost down.
+func (d *Datastore) layers() []ds.Datastore {
+	return append([]ds.Datastore{d.data}, d.lowers...)
+}
+
+// find returns the layer holding key, or nil if it was deleted or is held by
+// no layer.
+func (d *Datastore) find(ctx context.Context, key ds.Key) (ds.Datastore, error) {
+	if ok, err := d.data.Has(ctx, key); err != nil || ok {
+		return d.data, err
+	}
+	if ok, err := d.whiteouts.Has(ctx, key); err != nil || ok {
+		return nil, err
+	}
+	return d.findLower(ctx, key, d.lowers)
+}
+
+// findLower returns the first of lowers holding key, or nil.
+func (d *Datastore) findLower(ctx context.Context, key ds.Key, lowers []ds.Datastore) (ds.Datastore, error) {
+	for _, l := range lowers {
+		if ok, err := l.Has(ctx, key); err != nil || ok {
+			return l, err
+		}
+	}
+	return nil, nil
+}
+
+// Get implements Datastore.Get
+func (d *Datastore) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	l, err := d.find(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, ds.ErrNotFound
+	}
+	return l.Get(ctx, key)
+}
+
+// Has implements Datastore.Has
+func (d *Datastore) Has(ctx context.Context, key ds.Key) (bool, error) {
+	l, err := d.find(ctx, key)
+	return l != nil, err
+}
+
+// GetSize implements Datastore.GetSize
+func (d *Datastore) GetSize(ctx context.Context, key ds.Key) (int, error) {
+	l, err := d.find(ctx, key)
+	if err != nil {
+		return -1, err
+	}
+	if l == nil {
+		return -1, ds.ErrNotFound
+	}
+	return l.GetSize(ctx, key)
+}
+
+// Put implements Datastore.Put, writing to the upper datastore.
+func (d *Datastore) Put(ctx context.Context, key ds.Key, value []byte) error {
+	if err := d.data.Put(ctx, key, value); err != nil {
+		return err
+	}
+	return d.whiteouts.Delete(ctx, key)
+}
+
+// Delete implements Datastore.Delete. If a lower datastore holds key, it
+// records a whiteout hiding it.
+func (d *Datastore) Delete(ctx context.Context, key ds.Key) error {
+	l, err := d.findLower(ctx, key, d.lowers)
+	if err != nil {
+		return err
+	}
+	if l != nil {
+		if err := d.whiteouts.Put(ctx, key, nil); err != nil {
+			return err
+		}
+	}
+	return d.data.Delete(ctx, key)
+}
+
+// Sync implements Datastore.Sync, syncing the upper datastore.
+func (d *Datastore) Sync(ctx context.Context, prefix ds.Key) error {
+	return errors.Join(d.data.Sync(ctx, prefix), d.whiteouts.Sync(ctx, prefix))
+}
+
+// Query implements Datastore.Query, merging the layers. Filters, orders other
+// than by key, offset and limit are applied to the merged results.
+func (d *Datastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	layerQuery := dsq.Query{
+		Prefix:            q.Prefix,
+		Orders:            []dsq.Order{dsq.OrderByKey{}},
+		KeysOnly:          q.KeysOnly,
+		ReturnExpirations: q.ReturnExpirations,
+		ReturnsSizes:      q.ReturnsSizes,
+	}
+	m, err := d.merge(ctx, layerQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	r := dsq.ResultsFromIterator(q, dsq.Iterator{Next: m.next, Close: m.close})
+	for _, f := range q.Filters {
+		r = dsq.NaiveFilter(r, f)
+	}
+	if !orderedByKey(q.Orders) {
+		r = dsq.NaiveOrder(r, q.Orders...)
+	}
+	if q.Offset > 0 {
+		r = dsq.NaiveOffset(r, q.Offset)
+	}
+	if q.Limit > 0 {
+		r = dsq.NaiveLimit(r, q.Limit)
+	}
+	return r, nil
+}
+
+// orderedByKey returns whether results ordered by key satisfy orders.
+func orderedByKey(orders []dsq.Order) bool {
+	switch len(orders) {
+	case 0:
+		return true
+	case 1:
+		switch orders[0].(type) {
+		case dsq.OrderByKey, *dsq.OrderByKey:
+			return true
+		}
+	}
+	return false
+}
+
+// Batch implements Batching.Batch.
+func (d *Datastore) Batch(ctx context.Context) (ds.Batch, error) {
+	return ds.NewBasicBatch(d), nil
+}
+
+// Commit flattens the overlay: it folds the upper datastore into the topmost
+// lower datastore, writing the values and deleting the keys whited out, then
+// empties the upper datastore. Whiteouts of keys that deeper lower datastores
+// still hold are kept.
+//
+// Commit must not run concurrently with writes to the overlay. If it fails,
+// calling it again resumes it.
+func (d *Datastore) Commit(ctx context.Context) error {
+	if len(d.lowers) == 0 {
+		return ErrNoLower
+	}
+	top := d.lowers[0]
+
+	values, err := d.data.Query(ctx, dsq.Query{})
+	if err != nil {
+		return err
+	}
+	entries, err := values.Rest()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := top.Put(ctx, ds.RawKey(e.Key), e.Value); err != nil {
+			return fmt.Errorf("overlay: committing %s: %w", e.Key, err)
+		}
+	}
+
+	whiteouts, err := d.whiteouts.Query(ctx, dsq.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	deleted, err := whiteouts.Rest()
+	if err != nil {
+		return err
+	}
+	for _, e := range deleted {
+		if err := top.Delete(ctx, ds.RawKey(e.Key)); err != nil {
+			return fmt.Errorf("overlay: committing deletion of %s: %w", e.Key, err)
+		}
+	}
+	if err := top.Sync(ctx, ds.NewKey("/")); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := d.data.Delete(ctx, ds.RawKey(e.Key)); err != nil {
+			return err
+		}
+	}
+	for _, e := range deleted {
+		key := ds.RawKey(e.Key)
+		l, err := d.findLower(ctx, key, d.lowers[1:])
+		if err != nil {
+			return err
+		}
+		if l == nil {
+			if err := d.whiteouts.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
+	return d.upper.Sync(ctx, ds.NewKey("/"))
+}
+
+// Close implements Datastore.Close. It closes the upper datastore, but not the
+// lower ones, which may be shared by several overlays.
+func (d *Datastore) Close() error {
+	return d.upper.Close()
+}
+
+// Check implements CheckedDatastore.Check on every layer supporting it.
+func (d *Datastore) Check(ctx context.Context) error {
+	var errs []error
+	for _, l := range d.Children() {
+		if c, ok := l.(ds.CheckedFeature); ok {
+			errs = append(errs, c.Check(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Scrub implements ScrubbedDatastore.Scrub on every layer supporting it.
+func (d *Datastore) Scrub(ctx context.Context) error {
+	var errs []error
+	for _, l := range d.Children() {
+		if c, ok := l.(ds.ScrubbedFeature); ok {
+			errs = append(errs, c.Scrub(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CollectGarbage implements GCDatastore.CollectGarbage on every layer
+// supporting it.
+func (d *Datastore) CollectGarbage(ctx context.Context) error {
+	var errs []error
+	for _, l := range d.Children() {
+		if c, ok := l.(ds.GCFeature); ok {
+			errs = append(errs, c.CollectGarbage(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DiskUsage implements PersistentDatastore.DiskUsage, summing the disk usage
+// of every layer.
+func (d *Datastore) DiskUsage(ctx context.Context) (uint64, error) {
+	var (
+		total uint64
+		errs  []error
+	)
+	for _, l := range d.Children() {
+		du, err := ds.DiskUsage(ctx, l)
+		total += du
+		errs = append(errs, err)
+	}
+	return total, errors.Join(errs...)
+}
@@ -0,0 +1,104 @@
+package overlay_test
+
+import (
+	"context"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/overlay"
+	dsq "github.com/ipfs/go-datastore/query"
+	dstest "github.com/ipfs/go-datastore/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlayAll(t *testing.T) {
+	dstest.SubtestAll(t, overlay.New(ds.NewMapDatastore(), ds.NewMapDatastore()))
+}
+
+func put(t *testing.T, d ds.Datastore, kvs ...string) {
+	for i := 0; i < len(kvs); i += 2 {
+		require.NoError(t, d.Put(context.Background(), ds.NewKey(kvs[i]), []byte(kvs[i+1])))
+	}
+}
+
+func get(t *testing.T, d ds.Datastore, key string) string {
+	v, err := d.Get(context.Background(), ds.NewKey(key))
+	if err == ds.ErrNotFound {
+		return ""
+	}
+	require.NoError(t, err)
+	return string(v)
+}
+
+func query(t *testing.T, d ds.Datastore, q dsq.Query) []string {
+	res, err := d.Query(context.Background(), q)
+	require.NoError(t, err)
+	entries, err := res.Rest()
+	require.NoError(t, err)
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Key+"="+string(e.Value))
+	}
+	return out
+}
+
+func TestLayers(t *testing.T) {
+	ctx := context.Background()
+	upper, mid, base := ds.NewMapDatastore(), ds.NewMapDatastore(), ds.NewMapDatastore()
+	put(t, base, "/a", "base", "/b", "base", "/c", "base", "/x/1", "base")
+	put(t, mid, "/b", "mid", "/x/2", "mid")
+	d := overlay.New(upper, mid, base)
+
+	require.Equal(t, "base", get(t, d, "/a"))
+	require.Equal(t, "mid", get(t, d, "/b"))
+
+	put(t, d, "/a", "upper", "/d", "upper")
+	require.Equal(t, "upper", get(t, d, "/a"))
+	require.Equal(t, "base", get(t, base, "/a"))
+
+	require.NoError(t, d.Delete(ctx, ds.NewKey("/b")))
+	require.NoError(t, d.Delete(ctx, ds.NewKey("/d")))
+	require.Empty(t, get(t, d, "/b"))
+	require.Empty(t, get(t, d, "/d"))
+	ok, err := d.Has(ctx, ds.NewKey("/b"))
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, "mid", get(t, mid, "/b"))
+
+	// Only deletes of keys held below record whiteouts.
+	require.Equal(t, []string{"/whiteout/b="}, query(t, upper, dsq.Query{Prefix: "/whiteout"}))
+
+	require.Equal(t, []string{"/a=upper", "/c=base", "/x/1=base", "/x/2=mid"},
+		query(t, d, dsq.Query{Orders: []dsq.Order{dsq.OrderByKey{}}}))
+	require.Equal(t, []string{"/x/2=mid", "/x/1=base"},
+		query(t, d, dsq.Query{Prefix: "/x", Orders: []dsq.Order{dsq.OrderByKeyDescending{}}}))
+	require.Equal(t, []string{"/c=base", "/x/1=base"},
+		query(t, d, dsq.Query{Filters: []dsq.Filter{dsq.FilterValueCompare{Op: dsq.Equal, Value: []byte("base")}}}))
+	require.Equal(t, []string{"/c=base"}, query(t, d, dsq.Query{Offset: 1, Limit: 1}))
+
+	// Writing a whited out key brings it back.
+	put(t, d, "/b", "again")
+	require.Equal(t, "again", get(t, d, "/b"))
+	require.Empty(t, query(t, upper, dsq.Query{Prefix: "/whiteout"}))
+}
+
+func TestCommit(t *testing.T) {
+	ctx := context.Background()
+	upper, mid, base := ds.NewMapDatastore(), ds.NewMapDatastore(), ds.NewMapDatastore()
+	put(t, base, "/a", "base", "/b", "base")
+	put(t, mid, "/b", "mid", "/c", "mid")
+	d := overlay.New(upper, mid, base)
+
+	require.ErrorIs(t, overlay.New(ds.NewMapDatastore()).Commit(ctx), overlay.ErrNoLower)
+
+	put(t, d, "/d", "upper")
+	require.NoError(t, d.Delete(ctx, ds.NewKey("/b")))
+	require.NoError(t, d.Delete(ctx, ds.NewKey("/c")))
+	before := query(t, d, dsq.Query{Orders: []dsq.Order{dsq.OrderByKey{}}})
+
+	require.NoError(t, d.Commit(ctx))
+	require.Equal(t, before, query(t, d, dsq.Query{Orders: []dsq.Order{dsq.OrderByKey{}}}))
+	require.Equal(t, []string{"/d=upper"}, query(t, mid, dsq.Query{}))
+	// /b is still held by base, so its whiteout stays.
+	require.Equal(t, []string{"/whiteout/b="}, query(t, upper, dsq.Query{}))
+}
@@ -0,0 +1,643 @@
+package query
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// Queries are encoded in JSON by EncodeQuery as objects with the fields of
+// Query, and their filters and orders as objects with a "type" field:
+//
+//	{"prefix":"/a","filters":[{"type":"key","op":">","key":"/a/b"}],"orders":[{"type":"key_desc"}],"limit":10}
+//
+// Custom filters and orders registered with RegisterFilterType and
+// RegisterOrderType are encoded with encoding/json, under "args". The binary
+// encoding of EncodeQueryBinary holds the same fields, with varints and length-prefixed strings.
+
+// ErrNotSerializable is returned when encoding a query using filters or
+// orders that can't be encoded.
+var ErrNotSerializable = errors.New("query: not serializable")
+
+var (
+	filterTypes     = make(map[string]reflect.Type)
+	filterTypeNames = make(map[reflect.Type]string)
+	orderTypes      = make(map[string]reflect.Type)
+	orderTypeNames  = make(map[reflect.Type]string)
+)
+
+// The names under which built-in filters and orders are encoded.
+var (
+	builtinFilterTypes = []string{"key", "value", "prefix", "glob", "regexp", "value_prefix", "value_contains", "size", "expiration", "and", "or", "not"}
+	builtinOrderTypes  = []string{"key", "key_desc", "value", "value_desc"}
+)
+
+// RegisterFilterType registers the type of f, a custom filter, for encoding
+// under name. Filters of that type are encoded with encoding/json, so their
+// state must be held in exported fields.
+//
+// RegisterFilterType is meant to be called from init functions. It panics if
+// name is the name of a built-in filter, or if the name or the type of f is
+// already registered.
+func RegisterFilterType(name string, f Filter) {
+	t := reflect.TypeOf(f)
+	if slices.Contains(builtinFilterTypes, name) {
+		panic("query: RegisterFilterType of built-in filter " + name)
+	}
+	if _, dup := filterTypes[name]; dup {
+		panic("query: RegisterFilterType called twice for filter " + name)
+	}
+	if _, dup := filterTypeNames[t]; dup {
+		panic(fmt.Sprintf("query: RegisterFilterType called twice for type %v", t))
+	}
+	filterTypes[name] = t
+	filterTypeNames[t] = name
+}
+
+// RegisterOrderType registers the type of o, a custom order, for encoding,
+// like RegisterFilterType.
+func RegisterOrderType(name string, o Order) {
+	t := reflect.TypeOf(o)
+	if slices.Contains(builtinOrderTypes, name) {
+		panic("query: RegisterOrderType of built-in order " + name)
+	}
+	if _, dup := orderTypes[name]; dup {
+		panic("query: RegisterOrderType called twice for order " + name)
+	}
+	if _, dup := orderTypeNames[t]; dup {
+		panic(fmt.Sprintf("query: RegisterOrderType called twice for type %v", t))
+	}
+	orderTypes[name] = t
+	orderTypeNames[t] = name
+}
+
+// wireQuery is the encoded form of a Query.
+type wireQuery struct {
+	Prefix            string       `json:"prefix,omitempty"`
+	Filters           []wireFilter `json:"filters,omitempty"`
+	Orders            []wireOrder  `json:"orders,omitempty"`
+	Limit             int          `json:"limit,omitempty"`
+	Offset            int          `json:"offset,omitempty"`
+	KeysOnly          bool         `json:"keysOnly,omitempty"`
+	ReturnExpirations bool         `json:"returnExpirations,omitempty"`
+	ReturnsSizes      bool         `json:"returnsSizes,omitempty"`
+}
+
+// wireFilter is the encoded form of a Filter. Each type of filter only sets
+// some of the fields.
+type wireFilter struct {
+	Type       string          `json:"type"`
+	Op         Op              `json:"op,omitempty"`
+	Key        string          `json:"key,omitempty"`
+	Prefix     string          `json:"prefix,omitempty"`
+	Pattern    string          `json:"pattern,omitempty"`
+	Value      []byte          `json:"value,omitempty"`
+	Size       int             `json:"size,omitempty"`
+	Expiration *time.Time      `json:"expiration,omitempty"`
+	Filters    []wireFilter    `json:"filters,omitempty"`
+	Negated    *wireFilter     `json:"negated,omitempty"`
+	Args       json.RawMessage `json:"args,omitempty"`
+}
+
+// wireOrder is the encoded form of an Order.
+type wireOrder struct {
+	Type string          `json:"type"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// EncodeQuery returns the JSON encoding of q. It fails with
+// ErrNotSerializable if q uses an OrderByFunction, or filters or orders of
+// unregistered types.
+func EncodeQuery(q Query) ([]byte, error) {
+	w, err := toWireQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(w)
+}
+
+// DecodeQuery decodes a query encoded by EncodeQuery.
+func DecodeQuery(data []byte) (Query, error) {
+	var w wireQuery
+	if err := json.Unmarshal(data, &w); err != nil {
+		return Query{}, err
+	}
+	var q Query
+	err := fromWireQuery(w, &q)
+	return q, err
+}
+
+// EncodeQueryBinary returns the binary encoding of q, with the same
+// limitations as EncodeQuery.
+func EncodeQueryBinary(q Query) ([]byte, error) {
+	w, err := toWireQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	return w.appendBinary([]byte{binaryVersion}), nil
+}
+
+// DecodeQueryBinary decodes a query encoded by EncodeQueryBinary.
+func DecodeQueryBinary(data []byte) (Query, error) {
+	if len(data) == 0 || data[0] != binaryVersion {
+		return Query{}, errors.New("query: unknown binary encoding version")
+	}
+	r := &binaryReader{b: data[1:]}
+	var w wireQuery
+	w.readBinary(r)
+	if r.err == nil && len(r.b) > 0 {
+		r.err = errors.New("trailing data")
+	}
+	if r.err != nil {
+		return Query{}, fmt.Errorf("query: decoding binary query: %w", r.err)
+	}
+	var q Query
+	err := fromWireQuery(w, &q)
+	return q, err
+}
+
+func toWireQuery(q Query) (wireQuery, error) {
+	w := wireQuery{
+		Prefix:            q.Prefix,
+		Limit:             q.Limit,
+		Offset:            q.Offset,
+		KeysOnly:          q.KeysOnly,
+		ReturnExpirations: q.ReturnExpirations,
+		ReturnsSizes:      q.ReturnsSizes,
+	}
+	var err error
+	if w.Filters, err = toWireFilters(q.Filters); err != nil {
+		return w, err
+	}
+	for _, o := range q.Orders {
+		wo, err := toWireOrder(o)
+		if err != nil {
+			return w, err
+		}
+		w.Orders = append(w.Orders, wo)
+	}
+	return w, nil
+}
+
+func fromWireQuery(w wireQuery, q *Query) error {
+	*q = Query{
+		Prefix:            w.Prefix,
+		Limit:             w.Limit,
+		Offset:            w.Offset,
+		KeysOnly:          w.KeysOnly,
+		ReturnExpirations: w.ReturnExpirations,
+		ReturnsSizes:      w.ReturnsSizes,
+	}
+	var err error
+	if q.Filters, err = fromWireFilters(w.Filters); err != nil {
+		return err
+	}
+	for _, wo := range w.Orders {
+		o, err := fromWireOrder(wo)
+		if err != nil {
+			return err
+		}
+		q.Orders = append(q.Orders, o)
+	}
+	return nil
+}
+
+func toWireFilters(filters []Filter) ([]wireFilter, error) {
+	var out []wireFilter
+	for _, f := range filters {
+		w, err := toWireFilter(f)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, nil
+}
+
+// toWireFilter encodes f. Pointers to the filters of this package are
+// encoded as values.
+func toWireFilter(f Filter) (wireFilter, error) {
+	if v := reflect.ValueOf(f); v.Kind() == reflect.Pointer && !v.IsNil() && v.Type().Elem().PkgPath() == pkgPath {
+		f = v.Elem().Interface().(Filter)
+	}
+
+	switch f := f.(type) {
+	case FilterKeyCompare:
+		return wireFilter{Type: "key", Op: f.Op, Key: f.Key}, nil
+	case FilterValueCompare:
+		return wireFilter{Type: "value", Op: f.Op, Value: f.Value}, nil
+	case FilterKeyPrefix:
+		return wireFilter{Type: "prefix", Prefix: f.Prefix}, nil
+	case FilterKeyGlob:
+		return wireFilter{Type: "glob", Pattern: f.Pattern}, nil
+	case FilterKeyRegexp:
+		if f.Regexp == nil {
+			return wireFilter{}, fmt.Errorf("%w: regexp filter without a Regexp", ErrNotSerializable)
+		}
+		return wireFilter{Type: "regexp", Pattern: f.Regexp.String()}, nil
+	case FilterValuePrefix:
+		return wireFilter{Type: "value_prefix", Value: f.Prefix}, nil
+	case FilterValueContains:
+		return wireFilter{Type: "value_contains", Value: f.Value}, nil
+	case FilterSize:
+		return wireFilter{Type: "size", Op: f.Op, Size: f.Size}, nil
+	case FilterExpiration:
+		return wireFilter{Type: "expiration", Op: f.Op, Expiration: &f.Expiration}, nil
+	case FilterAnd:
+		filters, err := toWireFilters(f.Filters)
+		return wireFilter{Type: "and", Filters: filters}, err
+	case FilterOr:
+		filters, err := toWireFilters(f.Filters)
+		return wireFilter{Type: "or", Filters: filters}, err
+	case FilterNot:
+		negated, err := toWireFilter(f.Negated)
+		return wireFilter{Type: "not", Negated: &negated}, err
+	}
+
+	name, ok := filterTypeNames[reflect.TypeOf(f)]
+	if !ok {
+		return wireFilter{}, fmt.Errorf("%w: filter of type %T is not registered with RegisterFilterType", ErrNotSerializable, f)
+	}
+	args, err := json.Marshal(f)
+	if err != nil {
+		return wireFilter{}, fmt.Errorf("query: encoding filter %s: %w", name, err)
+	}
+	return wireFilter{Type: name, Args: args}, nil
+}
+
+func fromWireFilters(ws []wireFilter) ([]Filter, error) {
+	var out []Filter
+	for _, w := range ws {
+		f, err := fromWireFilter(w)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+func fromWireFilter(w wireFilter) (Filter, error) {
+	switch w.Type {
+	case "key":
+		return FilterKeyCompare{Op: w.Op, Key: w.Key}, validOp(w.Op)
+	case "value":
+		return FilterValueCompare{Op: w.Op, Value: w.Value}, validOp(w.Op)
+	case "prefix":
+		return FilterKeyPrefix{Prefix: w.Prefix}, nil
+	case "glob":
+		return FilterKeyGlob{Pattern: w.Pattern}, nil
+	case "regexp":
+		re, err := regexp.Compile(w.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("query: decoding regexp filter: %w", err)
+		}
+		return FilterKeyRegexp{Regexp: re}, nil
+	case "value_prefix":
+		return FilterValuePrefix{Prefix: w.Value}, nil
+	case "value_contains":
+		return FilterValueContains{Value: w.Value}, nil
+	case "size":
+		return FilterSize{Op: w.Op, Size: w.Size}, validOp(w.Op)
+	case "expiration":
+		var exp time.Time
+		if w.Expiration != nil {
+			exp = *w.Expiration
+		}
+		return FilterExpiration{Op: w.Op, Expiration: exp}, validOp(w.Op)
+	case "and":
+		filters, err := fromWireFilters(w.Filters)
+		return FilterAnd{Filters: filters}, err
+	case "or":
+		filters, err := fromWireFilters(w.Filters)
+		return FilterOr{Filters: filters}, err
+	case "not":
+		if w.Negated == nil {
+			return nil, errors.New("query: decoding not filter: missing negated filter")
+		}
+		negated, err := fromWireFilter(*w.Negated)
+		return FilterNot{Negated: negated}, err
+	}
+
+	t, ok := filterTypes[w.Type]
+	if !ok {
+		return nil, fmt.Errorf("query: unknown filter type %q", w.Type)
+	}
+	v, err := decodeArgs(t, w.Args)
+	if err != nil {
+		return nil, fmt.Errorf("query: decoding filter %s: %w", w.Type, err)
+	}
+	return v.(Filter), nil
+}
+
+func toWireOrder(o Order) (wireOrder, error) {
+	switch o.(type) {
+	case OrderByKey, *OrderByKey:
+		return wireOrder{Type: "key"}, nil
+	case OrderByKeyDescending, *OrderByKeyDescending:
+		return wireOrder{Type: "key_desc"}, nil
+	case OrderByValue, *OrderByValue:
+		return wireOrder{Type: "value"}, nil
+	case OrderByValueDescending, *OrderByValueDescending:
+		return wireOrder{Type: "value_desc"}, nil
+	case OrderByFunction:
+		return wireOrder{}, fmt.Errorf("%w: OrderByFunction orders by a function", ErrNotSerializable)
+	}
+
+	name, ok := orderTypeNames[reflect.TypeOf(o)]
+	if !ok {
+		return wireOrder{}, fmt.Errorf("%w: order of type %T is not registered with RegisterOrderType", ErrNotSerializable, o)
+	}
+	args, err := json.Marshal(o)
+	if err != nil {
+		return wireOrder{}, fmt.Errorf("query: encoding order %s: %w", name, err)
+	}
+	return wireOrder{Type: name, Args: args}, nil
+}
+
+func fromWireOrder(w wireOrder) (Order, error) {
+	switch w.Type {
+	case "key":
+		return OrderByKey{}, nil
+	case "key_desc":
+		return OrderByKeyDescending{}, nil
+	case "value":
+		return OrderByValue{}, nil
+	case "value_desc":
+		return OrderByValueDescending{}, nil
+	}
+
+	t, ok := orderTypes[w.Type]
+	if !ok {
+		return nil, fmt.Errorf("query: unknown order type %q", w.Type)
+	}
+	v, err := decodeArgs(t, w.Args)
+	if err != nil {
+		return nil, fmt.Errorf("query: decoding order %s: %w", w.Type, err)
+	}
+	return v.(Order), nil
+}
+
+// pkgPath is the import path of this package.
+var pkgPath = reflect.TypeOf(Query{}).PkgPath()
+
+// decodeArgs decodes a value of type t from args.
+func decodeArgs(t reflect.Type, args json.RawMessage) (any, error) {
+	v := reflect.New(t)
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, v.Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return v.Elem().Interface(), nil
+}
+
+func validOp(op Op) error {
+	switch op {
+	case Equal, NotEqual, GreaterThan, GreaterThanOrEqual, LessThan, LessThanOrEqual:
+		return nil
+	}
+	return fmt.Errorf("query: unknown operator %q", op)
+}
+
+// binaryVersion is the first byte of binary encoded queries.
+const binaryVersion = 1
+
+// Fields of binary encoded filters, present if their bit is set.
+const (
+	hasOp = 1 << iota
+	hasKey
+	hasPrefix
+	hasPattern
+	hasValue
+	hasSize
+	hasExpiration
+	hasFilters
+	hasNegated
+	hasArgs
+)
+
+// Flags of binary encoded queries.
+const (
+	flagKeysOnly = 1 << iota
+	flagReturnExpirations
+	flagReturnsSizes
+)
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func (w wireQuery) appendBinary(b []byte) []byte {
+	var flags uint64
+	if w.KeysOnly {
+		flags |= flagKeysOnly
+	}
+	if w.ReturnExpirations {
+		flags |= flagReturnExpirations
+	}
+	if w.ReturnsSizes {
+		flags |= flagReturnsSizes
+	}
+	b = binary.AppendUvarint(b, flags)
+	b = appendString(b, w.Prefix)
+	b = binary.AppendVarint(b, int64(w.Limit))
+	b = binary.AppendVarint(b, int64(w.Offset))
+	b = binary.AppendUvarint(b, uint64(len(w.Filters)))
+	for _, f := range w.Filters {
+		b = f.appendBinary(b)
+	}
+	b = binary.AppendUvarint(b, uint64(len(w.Orders)))
+	for _, o := range w.Orders {
+		b = appendString(b, o.Type)
+		b = appendString(b, string(o.Args))
+	}
+	return b
+}
+
+func (w *wireQuery) readBinary(r *binaryReader) {
+	flags := r.uvarint()
+	w.KeysOnly = flags&flagKeysOnly != 0
+	w.ReturnExpirations = flags&flagReturnExpirations != 0
+	w.ReturnsSizes = flags&flagReturnsSizes != 0
+	w.Prefix = r.string()
+	w.Limit = int(r.varint())
+	w.Offset = int(r.varint())
+	w.Filters = r.filters()
+	for n := r.count(); n > 0; n-- {
+		o := wireOrder{Type: r.string()}
+		if args := r.string(); args != "" {
+			o.Args = json.RawMessage(args)
+		}
+		w.Orders = append(w.Orders, o)
+	}
+}
+
+func (w wireFilter) appendBinary(b []byte) []byte {
+	var fields uint64
+	for bit, set := range []bool{
+		w.Op != "", w.Key != "", w.Prefix != "", w.Pattern != "", w.Value != nil,
+		w.Size != 0, w.Expiration != nil, w.Filters != nil, w.Negated != nil, w.Args != nil,
+	} {
+		if set {
+			fields |= 1 << bit
+		}
+	}
+
+	b = appendString(b, w.Type)
+	b = binary.AppendUvarint(b, fields)
+	if fields&hasOp != 0 {
+		b = appendString(b, string(w.Op))
+	}
+	if fields&hasKey != 0 {
+		b = appendString(b, w.Key)
+	}
+	if fields&hasPrefix != 0 {
+		b = appendString(b, w.Prefix)
+	}
+	if fields&hasPattern != 0 {
+		b = appendString(b, w.Pattern)
+	}
+	if fields&hasValue != 0 {
+		b = appendString(b, string(w.Value))
+	}
+	if fields&hasSize != 0 {
+		b = binary.AppendVarint(b, int64(w.Size))
+	}
+	if fields&hasExpiration != 0 {
+		// Only fails on out of range offsets, which time.Time can't hold.
+		exp, _ := w.Expiration.MarshalBinary()
+		b = appendString(b, string(exp))
+	}
+	if fields&hasFilters != 0 {
+		b = binary.AppendUvarint(b, uint64(len(w.Filters)))
+		for _, f := range w.Filters {
+			b = f.appendBinary(b)
+		}
+	}
+	if fields&hasNegated != 0 {
+		b = w.Negated.appendBinary(b)
+	}
+	if fields&hasArgs != 0 {
+		b = appendString(b, string(w.Args))
+	}
+	return b
+}
+
+func (r *binaryReader) filter() wireFilter {
+	// Guard against deeply nested filters.
+	r.depth++
+	defer func() { r.depth-- }()
+	if r.depth > maxFilterDepth {
+		r.fail(errors.New("filters nested too deeply"))
+	}
+
+	var w wireFilter
+	w.Type = r.string()
+	fields := r.uvarint()
+	if fields&hasOp != 0 {
+		w.Op = Op(r.string())
+	}
+	if fields&hasKey != 0 {
+		w.Key = r.string()
+	}
+	if fields&hasPrefix != 0 {
+		w.Prefix = r.string()
+	}
+	if fields&hasPattern != 0 {
+		w.Pattern = r.string()
+	}
+	if fields&hasValue != 0 {
+		w.Value = []byte(r.string())
+	}
+	if fields&hasSize != 0 {
+		w.Size = int(r.varint())
+	}
+	if fields&hasExpiration != 0 {
+		var exp time.Time
+		if err := exp.UnmarshalBinary([]byte(r.string())); err != nil && r.err == nil {
+			r.fail(err)
+		}
+		w.Expiration = &exp
+	}
+	if fields&hasFilters != 0 {
+		w.Filters = r.filters()
+	}
+	if fields&hasNegated != 0 {
+		negated := r.filter()
+		w.Negated = &negated
+	}
+	if fields&hasArgs != 0 {
+		w.Args = json.RawMessage(r.string())
+	}
+	return w
+}
+
+func (r *binaryReader) filters() []wireFilter {
+	var filters []wireFilter
+	for n := r.count(); n > 0 && r.err == nil; n-- {
+		filters = append(filters, r.filter())
+	}
+	return filters
+}
+
+// maxFilterDepth bounds the nesting of decoded binary filters.
+const maxFilterDepth = 1000
+
+// binaryReader reads binary encoded values from b. After the first error,
+// which it records, it reads zero values.
+type binaryReader struct {
+	b     []byte
+	err   error
+	depth int
+}
+
+func (r *binaryReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+	r.b = nil
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.fail(errors.New("invalid varint"))
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.fail(errors.New("invalid varint"))
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+// count reads a number of items, each taking at least a byte.
+func (r *binaryReader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.b)) {
+		r.fail(errors.New("invalid length"))
+		return 0
+	}
+	return int(n)
+}
+
+func (r *binaryReader) string() string {
+	n := r.count()
+	s := string(r.b[:n])
+	r.b = r.b[n:]
+	return s
+}
@@ -0,0 +1,208 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	RegisterFilterType("even", filterEven{})
+	RegisterOrderType("length", orderByLength{})
+}
+
+func TestQueryEncoding(t *testing.T) {
+	queries := append(parseQueries, Query{Filters: []Filter{
+		&FilterKeyPrefix{Prefix: "/ptr"},
+		FilterExpiration{Op: LessThan, Expiration: time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("", 3600))},
+		FilterValueCompare{Op: Equal, Value: []byte{}},
+	}})
+
+	var jsonSize, binarySize int
+	for _, q := range queries {
+		// Decoded queries render like the original, as the pointer is
+		// decoded as a value, and empty values may be decoded as nil.
+		data, err := EncodeQuery(q)
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		decoded, err := DecodeQuery(data)
+		if err != nil {
+			t.Fatalf("%s: decoding %s: %v", q, data, err)
+		}
+		if decoded.String() != q.String() {
+			t.Errorf("JSON: decoded %s as %s", q, decoded)
+		}
+
+		bin, err := EncodeQueryBinary(q)
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		jsonSize += len(data)
+		binarySize += len(bin)
+		if decoded, err = DecodeQueryBinary(bin); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		if decoded.String() != q.String() {
+			t.Errorf("binary: decoded %s as %s", q, decoded)
+		}
+	}
+	if binarySize >= jsonSize {
+		t.Errorf("binary encodings take %d bytes, JSON %d", binarySize, jsonSize)
+	}
+
+	// Custom filters are decoded to their registered type.
+	q := Query{Filters: []Filter{Not(filterEven{Odd: true})}, Orders: []Order{orderByLength{}}}
+	data, err := EncodeQuery(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"filters":[{"type":"not","negated":{"type":"even","args":{"Odd":true}}}],"orders":[{"type":"length","args":{}}]}`; string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+	decoded, err := DecodeQuery(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, q) {
+		t.Errorf("decoded %s as %s", q, decoded)
+	}
+}
+
+// The encodings are separate from the default JSON encoding of queries and
+// results, which is left unchanged.
+func TestDefaultJSONEncoding(t *testing.T) {
+	for _, v := range []any{Query{}, Result{}} {
+		if _, ok := v.(json.Marshaler); ok {
+			t.Errorf("%T implements json.Marshaler", v)
+		}
+	}
+}
+
+func TestRegisterTypePanics(t *testing.T) {
+	for name, register := range map[string]func(){
+		"built-in filter":       func() { RegisterFilterType("glob", filterEven{}) },
+		"duplicate filter":      func() { RegisterFilterType("even", testFilterFunc(nil)) },
+		"duplicate filter type": func() { RegisterFilterType("odd", filterEven{}) },
+		"built-in order":        func() { RegisterOrderType("key_desc", orderByLength{}) },
+		"duplicate order type":  func() { RegisterOrderType("len", orderByLength{}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			register()
+		}()
+	}
+}
+
+func TestQueryEncodingErrors(t *testing.T) {
+	for _, q := range []Query{
+		{Orders: []Order{OrderByFunction(func(a, b Entry) int { return 0 })}},
+		{Filters: []Filter{Or(testFilterFunc(func(Entry) bool { return true }))}},
+		{Filters: []Filter{FilterKeyRegexp{}}},
+	} {
+		if _, err := EncodeQuery(q); !errors.Is(err, ErrNotSerializable) {
+			t.Errorf("%s: expected ErrNotSerializable, got %v", q, err)
+		}
+		if _, err := EncodeQueryBinary(q); !errors.Is(err, ErrNotSerializable) {
+			t.Errorf("%s: expected ErrNotSerializable, got %v", q, err)
+		}
+	}
+
+	for _, data := range []string{
+		`{"filters":[{"type":"fuzzy"}]}`,
+		`{"filters":[{"type":"key","op":"~"}]}`,
+		`{"filters":[{"type":"regexp","pattern":"("}]}`,
+		`{"filters":[{"type":"not"}]}`,
+		`{"orders":[{"type":"random"}]}`,
+	} {
+		if _, err := DecodeQuery([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+
+	bin, err := EncodeQueryBinary(Query{Prefix: "/a", Filters: []Filter{FilterKeyPrefix{Prefix: "/a"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range bin {
+		if _, err := DecodeQueryBinary(bin[:i]); err == nil {
+			t.Errorf("truncated to %d bytes: expected an error", i)
+		}
+	}
+}
+
+type testFilterFunc func(Entry) bool
+
+func (f testFilterFunc) Filter(e Entry) bool { return f(e) }
+
+func TestResultsEncoding(t *testing.T) {
+	exp := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	results := []Result{
+		{Entry: Entry{Key: "/a", Value: []byte("v"), Size: 1}},
+		{Entry: Entry{Key: "/b", Value: []byte{}, Size: 0, Expiration: exp}},
+		{Entry: Entry{Key: "/c", Size: -1}},
+		{Error: errors.New("boom")},
+		{Entry: Entry{Key: "/unreachable"}},
+	}
+	source := func() Results {
+		i := 0
+		return ResultsFromIterator(Query{}, Iterator{Next: func() (Result, bool) {
+			if i == len(results) {
+				return Result{}, false
+			}
+			i++
+			return results[i-1], true
+		}})
+	}
+
+	for _, enc := range []struct {
+		name  string
+		write func(*bytes.Buffer, Results) (int, error)
+		read  func(Query, *bytes.Buffer) Results
+	}{
+		{"json", func(b *bytes.Buffer, r Results) (int, error) { return WriteResults(b, r) }, func(q Query, b *bytes.Buffer) Results { return ReadResults(q, b) }},
+		{"binary", func(b *bytes.Buffer, r Results) (int, error) { return WriteResultsBinary(b, r) }, func(q Query, b *bytes.Buffer) Results { return ReadResultsBinary(q, b) }},
+	} {
+		var buf bytes.Buffer
+		n, err := enc.write(&buf, source())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 4 {
+			t.Errorf("%s: wrote %d results, want 4", enc.name, n)
+		}
+		encoded := buf.String()
+
+		q := Query{Prefix: "/"}
+		res := enc.read(q, &buf)
+		if res.Query().Prefix != "/" {
+			t.Errorf("%s: lost the query", enc.name)
+		}
+		var got []Result
+		for r := range res.Next() {
+			got = append(got, r)
+		}
+		if len(got) != 4 || got[3].Error == nil || got[3].Error.Error() != "boom" {
+			t.Fatalf("%s: got %v", enc.name, got)
+		}
+		got[3].Error = results[3].Error
+		if !reflect.DeepEqual(got, results[:4]) {
+			t.Errorf("%s: got %v, want %v", enc.name, got, results[:4])
+		}
+
+		// Truncated streams end with an error.
+		truncated := bytes.NewBufferString(encoded[:len(encoded)/2])
+		_, err = enc.read(q, truncated).Rest()
+		if err == nil || !strings.Contains(err.Error(), "query: reading result") {
+			t.Errorf("%s: expected a decoding error, got %v", enc.name, err)
+		}
+	}
+}
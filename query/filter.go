@@ -3,7 +3,10 @@ package query
 import (
 	"bytes"
 	"fmt"
+	"path"
+	"regexp"
 	"strings"
+	"time"
 )
 
 // Filter is an object that tests ResultEntries
@@ -100,3 +103,193 @@ func (f FilterKeyPrefix) Filter(e Entry) bool {
 func (f FilterKeyPrefix) String() string {
 	return fmt.Sprintf("PREFIX(%q)", f.Prefix)
 }
+
+// FilterAnd passes entries passing all of its filters, like Query.Filters.
+type FilterAnd struct {
+	Filters []Filter
+}
+
+// And returns a filter passing entries passing all of filters.
+func And(filters ...Filter) FilterAnd {
+	return FilterAnd{Filters: filters}
+}
+
+func (f FilterAnd) Filter(e Entry) bool {
+	for _, f := range f.Filters {
+		if !f.Filter(e) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f FilterAnd) String() string {
+	return fmt.Sprintf("AND(%s)", joinFilters(f.Filters))
+}
+
+// FilterOr passes entries passing any of its filters.
+type FilterOr struct {
+	Filters []Filter
+}
+
+// Or returns a filter passing entries passing any of filters.
+func Or(filters ...Filter) FilterOr {
+	return FilterOr{Filters: filters}
+}
+
+func (f FilterOr) Filter(e Entry) bool {
+	for _, f := range f.Filters {
+		if f.Filter(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f FilterOr) String() string {
+	return fmt.Sprintf("OR(%s)", joinFilters(f.Filters))
+}
+
+// FilterNot passes entries the Negated filter rejects.
+type FilterNot struct {
+	Negated Filter
+}
+
+// Not returns a filter passing entries f rejects.
+func Not(f Filter) FilterNot {
+	return FilterNot{Negated: f}
+}
+
+func (f FilterNot) Filter(e Entry) bool {
+	return !f.Negated.Filter(e)
+}
+
+func (f FilterNot) String() string {
+	return fmt.Sprintf("NOT(%s)", f.Negated)
+}
+
+func joinFilters(filters []Filter) string {
+	s := make([]string, len(filters))
+	for i, f := range filters {
+		s[i] = fmt.Sprint(f)
+	}
+	return strings.Join(s, ", ")
+}
+
+// FilterKeyGlob passes entries whose key matches Pattern, with the syntax of
+// path.Match: '*' matches any sequence of characters but '/'. No key matches
+// a malformed pattern.
+type FilterKeyGlob struct {
+	Pattern string
+}
+
+func (f FilterKeyGlob) Filter(e Entry) bool {
+	ok, err := path.Match(f.Pattern, e.Key)
+	return ok && err == nil
+}
+
+func (f FilterKeyGlob) String() string {
+	return fmt.Sprintf("GLOB(%q)", f.Pattern)
+}
+
+// FilterKeyRegexp passes entries whose key matches Regexp. The match is not
+// anchored unless the expression is. No key matches a nil Regexp.
+type FilterKeyRegexp struct {
+	Regexp *regexp.Regexp
+}
+
+func (f FilterKeyRegexp) Filter(e Entry) bool {
+	return f.Regexp != nil && f.Regexp.MatchString(e.Key)
+}
+
+func (f FilterKeyRegexp) String() string {
+	if f.Regexp == nil {
+		return "REGEXP(nil)"
+	}
+	return fmt.Sprintf("REGEXP(%q)", f.Regexp)
+}
+
+// FilterValuePrefix passes entries whose value starts with Prefix. It needs
+// the values of the entries: it rejects all entries of KeysOnly queries.
+type FilterValuePrefix struct {
+	Prefix []byte
+}
+
+func (f FilterValuePrefix) Filter(e Entry) bool {
+	return e.Value != nil && bytes.HasPrefix(e.Value, f.Prefix)
+}
+
+func (f FilterValuePrefix) String() string {
+	return fmt.Sprintf("VALUE PREFIX(%q)", string(f.Prefix))
+}
+
+// FilterValueContains passes entries whose value contains Value. It needs the
+// values of the entries: it rejects all entries of KeysOnly queries.
+type FilterValueContains struct {
+	Value []byte
+}
+
+func (f FilterValueContains) Filter(e Entry) bool {
+	return e.Value != nil && bytes.Contains(e.Value, f.Value)
+}
+
+func (f FilterValueContains) String() string {
+	return fmt.Sprintf("VALUE CONTAINS(%q)", string(f.Value))
+}
+
+// FilterSize compares the size of the values of entries to Size. Entries of
+// unknown size, -1, are compared by the length of their value: KeysOnly
+// queries filtering by size should set ReturnsSizes.
+type FilterSize struct {
+	Op   Op
+	Size int
+}
+
+func (f FilterSize) Filter(e Entry) bool {
+	size := e.Size
+	if size < 0 {
+		size = len(e.Value)
+	}
+	return compare(f.Op, size-f.Size)
+}
+
+func (f FilterSize) String() string {
+	return fmt.Sprintf("SIZE %s %d", f.Op, f.Size)
+}
+
+// FilterExpiration compares the expiration of entries to Expiration. Entries
+// without expiration have a zero Expiration: queries filtering by expiration
+// should set ReturnExpirations.
+type FilterExpiration struct {
+	Op         Op
+	Expiration time.Time
+}
+
+func (f FilterExpiration) Filter(e Entry) bool {
+	return compare(f.Op, e.Expiration.Compare(f.Expiration))
+}
+
+func (f FilterExpiration) String() string {
+	return fmt.Sprintf("EXPIRATION %s %q", f.Op, f.Expiration.Format(time.RFC3339Nano))
+}
+
+// compare returns whether a value comparing to another as cmp, negative if
+// lesser, 0 if equal and positive if greater, satisfies op.
+func compare(op Op, cmp int) bool {
+	switch op {
+	case Equal:
+		return cmp == 0
+	case NotEqual:
+		return cmp != 0
+	case LessThan:
+		return cmp < 0
+	case LessThanOrEqual:
+		return cmp <= 0
+	case GreaterThan:
+		return cmp > 0
+	case GreaterThanOrEqual:
+		return cmp >= 0
+	default:
+		panic(fmt.Errorf("unknown operation: %s", op))
+	}
+}
@@ -1,8 +1,11 @@
 package query
 
 import (
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 func testKeyFilter(t *testing.T, f Filter, keys []string, expect []string) {
@@ -67,4 +70,123 @@ func TestFilterKeyPrefix(t *testing.T) {
 		"/ab/ef",
 		"/ab/fg",
 	})
+	testKeyFilter(t, FilterKeyRegexp{}, sampleKeys, nil)
+	if s := (FilterKeyRegexp{}).String(); s != "REGEXP(nil)" {
+		t.Errorf("got %s", s)
+	}
+}
+
+func TestFilterCombinators(t *testing.T) {
+	testKeyFilter(t, And(FilterKeyPrefix{"/ab"}, FilterKeyCompare{LessThan, "/ab/e"}), sampleKeys, []string{
+		"/ab/c",
+		"/ab/cd",
+		"/ab",
+	})
+	testKeyFilter(t, Or(FilterKeyCompare{Equal, "/a"}, FilterKeyPrefix{"/abc"}), sampleKeys, []string{
+		"/a",
+		"/abce",
+		"/abcf",
+	})
+	testKeyFilter(t, Not(FilterKeyPrefix{"/ab"}), sampleKeys, []string{"/a"})
+	testKeyFilter(t, And(), sampleKeys, sampleKeys)
+	testKeyFilter(t, Or(), sampleKeys, nil)
+}
+
+func TestFilterKeyPatterns(t *testing.T) {
+	testKeyFilter(t, FilterKeyGlob{"/ab/?"}, sampleKeys, []string{"/ab/c"})
+	testKeyFilter(t, FilterKeyGlob{"/ab*"}, sampleKeys, []string{"/abce", "/abcf", "/ab"})
+	testKeyFilter(t, FilterKeyGlob{"/ab["}, sampleKeys, nil)
+	testKeyFilter(t, FilterKeyRegexp{regexp.MustCompile("^/ab/[cf]")}, sampleKeys, []string{
+		"/ab/c",
+		"/ab/cd",
+		"/ab/fg",
+	})
+}
+
+func TestFilterValues(t *testing.T) {
+	now := time.Now()
+	entries := []Entry{
+		{Key: "/a", Value: []byte("hello world"), Size: 11, Expiration: now.Add(time.Hour)},
+		{Key: "/b", Value: []byte("help"), Size: 4},
+		{Key: "/c", Value: []byte("world"), Size: -1, Expiration: now.Add(-time.Hour)},
+		{Key: "/d", Size: 7},
+	}
+	run := func(f Filter) []string {
+		t.Helper()
+		res, err := NaiveFilter(ResultsWithEntries(Query{}, entries), f).Rest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, e := range res {
+			keys = append(keys, e.Key)
+		}
+		return keys
+	}
+
+	cases := []struct {
+		filter Filter
+		want   []string
+	}{
+		{FilterValuePrefix{[]byte("hel")}, []string{"/a", "/b"}},
+		{FilterValuePrefix{[]byte("")}, []string{"/a", "/b", "/c"}},
+		{FilterValueContains{[]byte("world")}, []string{"/a", "/c"}},
+		{FilterSize{GreaterThanOrEqual, 5}, []string{"/a", "/c", "/d"}},
+		{FilterSize{Equal, 4}, []string{"/b"}},
+		{FilterExpiration{GreaterThan, now}, []string{"/a"}},
+		{FilterExpiration{Equal, time.Time{}}, []string{"/b", "/d"}},
+	}
+	for _, c := range cases {
+		if got := run(c.filter); strings.Join(got, " ") != strings.Join(c.want, " ") {
+			t.Errorf("%s: got %v, want %v", c.filter, got, c.want)
+		}
+	}
+}
+
+func TestFilterString(t *testing.T) {
+	exp := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	q := Query{Filters: []Filter{
+		Or(FilterKeyPrefix{"/a"}, Not(FilterKeyGlob{"/b/*"})),
+		And(FilterKeyRegexp{regexp.MustCompile("x+")}, FilterValuePrefix{[]byte("v")}),
+		FilterValueContains{[]byte("c")},
+		FilterSize{LessThan, 10},
+		FilterExpiration{GreaterThan, exp},
+	}}
+	want := `SELECT keys,vals FILTER [OR(PREFIX("/a"), NOT(GLOB("/b/*"))), AND(REGEXP("x+"), VALUE PREFIX("v")), ` +
+		`VALUE CONTAINS("c"), SIZE < 10, EXPIRATION > "2026-01-02T03:04:05Z"]`
+	if s := q.String(); s != want {
+		t.Errorf("got %s, want %s", s, want)
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	a := FilterKeyPrefix{"/a"}
+	b := FilterKeyGlob{"/b/*"}
+	c := FilterValueContains{[]byte("c")}
+
+	cases := []struct {
+		in   []Filter
+		want []Filter
+	}{
+		{nil, nil},
+		{[]Filter{a, And(b, And(c))}, []Filter{a, b, c}},
+		{[]Filter{&FilterKeyCompare{GreaterThan, "/k"}}, []Filter{FilterKeyCompare{GreaterThan, "/k"}}},
+		{[]Filter{Not(Not(a))}, []Filter{a}},
+		{[]Filter{Not(FilterKeyCompare{LessThan, "/k"})}, []Filter{FilterKeyCompare{GreaterThanOrEqual, "/k"}}},
+		{[]Filter{Not(&FilterSize{Equal, 3})}, []Filter{FilterSize{NotEqual, 3}}},
+		{[]Filter{Not(And(a, b))}, []Filter{Or(Not(a), Not(b))}},
+		{[]Filter{Not(Or(a, FilterValueCompare{Equal, []byte("v")}))}, []Filter{Not(a), FilterValueCompare{NotEqual, []byte("v")}}},
+		{[]Filter{Or(a, Or(b, c))}, []Filter{Or(a, b, c)}},
+		{[]Filter{Or(a)}, []Filter{a}},
+		{[]Filter{Or(a, And())}, nil},
+		{[]Filter{a, Or()}, []Filter{Or()}},
+		{[]Filter{Not(Or())}, nil},
+		{[]Filter{Or(And(a, b), c)}, []Filter{Or(And(a, b), c)}},
+	}
+	for _, c := range cases {
+		got := Simplify(c.in)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Simplify(%v) = %v, want %v", c.in, got, c.want)
+		}
+	}
 }
@@ -0,0 +1,533 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FilterParser parses the arguments of a custom filter: the text between the
+// parentheses following its name, or "" if there are none.
+type FilterParser func(args string) (Filter, error)
+
+// OrderParser parses the arguments of a custom order, like FilterParser.
+type OrderParser func(args string) (Order, error)
+
+var (
+	filterParsers = make(map[string]FilterParser)
+	orderParsers  = make(map[string]OrderParser)
+)
+
+// The names parsed as built-in filters and orders.
+var (
+	builtinFilters = []string{"KEY", "VALUE", "PREFIX", "GLOB", "REGEXP", "SIZE", "EXPIRATION", "AND", "OR", "NOT"}
+	builtinOrders  = []string{"KEY", "VALUE", "desc"}
+)
+
+// RegisterFilter registers the parser of custom filters whose String method
+// renders them as name, or as name followed by arguments in parentheses.
+// Quoted strings in the arguments may contain unbalanced parentheses.
+//
+// RegisterFilter is meant to be called from init functions. It panics if
+// parse is nil, if name is the name of a built-in filter, or if it is called
+// twice with the same name.
+func RegisterFilter(name string, parse FilterParser) {
+	if parse == nil {
+		panic("query: RegisterFilter parser is nil")
+	}
+	if slices.Contains(builtinFilters, name) {
+		panic("query: RegisterFilter of built-in filter " + name)
+	}
+	if _, dup := filterParsers[name]; dup {
+		panic("query: RegisterFilter called twice for filter " + name)
+	}
+	filterParsers[name] = parse
+}
+
+// RegisterOrder registers the parser of custom orders, like RegisterFilter.
+func RegisterOrder(name string, parse OrderParser) {
+	if parse == nil {
+		panic("query: RegisterOrder parser is nil")
+	}
+	if slices.Contains(builtinOrders, name) {
+		panic("query: RegisterOrder of built-in order " + name)
+	}
+	if _, dup := orderParsers[name]; dup {
+		panic("query: RegisterOrder called twice for order " + name)
+	}
+	orderParsers[name] = parse
+}
+
+// ParseError is returned when parsing a query fails.
+type ParseError struct {
+	// Offset is the byte offset in the input where the error occurred.
+	Offset int
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("query: offset %d: %s", e.Offset, e.Msg)
+}
+
+// Parse parses a query in the form rendered by Query.String:
+//
+//	SELECT keys,vals,exps,sizes FROM "/prefix" FILTER [KEY > "/a", SIZE < 10] ORDER [desc(KEY)] OFFSET 5 LIMIT 10
+//
+// Every clause but SELECT keys is optional, and Parse(q.String()) returns q
+// for queries using the filters and orders of this package, and custom ones
+// registered with RegisterFilter and RegisterOrder. Expirations compared by
+// FilterExpiration are parsed in the time zone of their offset.
+func Parse(s string) (Query, error) {
+	p := &parser{s: s}
+	q, err := p.query()
+	if err != nil {
+		return Query{}, err
+	}
+	return q, nil
+}
+
+// ParseFilter parses a filter in the form rendered by its String method.
+func ParseFilter(s string) (Filter, error) {
+	p := &parser{s: s}
+	f, err := p.filter()
+	if err == nil {
+		err = p.end()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ParseOrder parses an order in the form rendered by its String method.
+func ParseOrder(s string) (Order, error) {
+	p := &parser{s: s}
+	o, err := p.order()
+	if err == nil {
+		err = p.end()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// parser is a recursive descent parser of queries. Its methods skip the
+// spaces preceding what they read.
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) errorf(offset int, format string, args ...any) error {
+	return &ParseError{Offset: offset, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n' || p.s[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+// found describes what comes next, for error messages.
+func (p *parser) found() string {
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return "end of input"
+	}
+	if w := p.peekWord(); w != "" {
+		return strconv.Quote(w)
+	}
+	return strconv.Quote(p.s[p.pos : p.pos+1])
+}
+
+// peekWord returns the word coming next, without reading it.
+func (p *parser) peekWord() string {
+	p.skipSpace()
+	end := p.pos
+	for end < len(p.s) && isWordByte(p.s[end]) {
+		end++
+	}
+	return p.s[p.pos:end]
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// word reads the next word.
+func (p *parser) word() (string, int) {
+	w := p.peekWord()
+	start := p.pos
+	p.pos += len(w)
+	return w, start
+}
+
+// accept reads tok if it comes next.
+func (p *parser) accept(tok string) bool {
+	p.skipSpace()
+	if !strings.HasPrefix(p.s[p.pos:], tok) {
+		return false
+	}
+	// Don't read a word out of a longer one.
+	if w := p.peekWord(); w != "" && w != tok {
+		return false
+	}
+	p.pos += len(tok)
+	return true
+}
+
+func (p *parser) expect(tok string) error {
+	if !p.accept(tok) {
+		return p.errorf(p.pos, "expected %q, found %s", tok, p.found())
+	}
+	return nil
+}
+
+func (p *parser) end() error {
+	p.skipSpace()
+	if p.pos != len(p.s) {
+		return p.errorf(p.pos, "expected end of input, found %s", p.found())
+	}
+	return nil
+}
+
+// quoted reads a double quoted string, with the escapes of Go strings.
+func (p *parser) quoted() (string, error) {
+	p.skipSpace()
+	if p.pos == len(p.s) || p.s[p.pos] != '"' {
+		return "", p.errorf(p.pos, "expected quoted string, found %s", p.found())
+	}
+	start := p.pos
+	end := start + 1
+	for ; end < len(p.s) && p.s[end] != '"'; end++ {
+		if p.s[end] == '\\' {
+			end++
+		}
+	}
+	if end >= len(p.s) {
+		return "", p.errorf(start, "unterminated string")
+	}
+	s, err := strconv.Unquote(p.s[start : end+1])
+	if err != nil {
+		return "", p.errorf(start, "invalid string %s", p.s[start:end+1])
+	}
+	p.pos = end + 1
+	return s, nil
+}
+
+// quotedArg reads a quoted string in parentheses.
+func (p *parser) quotedArg() (string, error) {
+	if err := p.expect("("); err != nil {
+		return "", err
+	}
+	s, err := p.quoted()
+	if err != nil {
+		return "", err
+	}
+	return s, p.expect(")")
+}
+
+// integer reads a decimal integer.
+func (p *parser) integer() (int, error) {
+	p.skipSpace()
+	start := p.pos
+	end := start
+	if end < len(p.s) && p.s[end] == '-' {
+		end++
+	}
+	for end < len(p.s) && p.s[end] >= '0' && p.s[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(p.s[start:end])
+	if err != nil {
+		return 0, p.errorf(start, "expected integer, found %s", p.found())
+	}
+	p.pos = end
+	return n, nil
+}
+
+// op reads a comparison operator.
+func (p *parser) op() (Op, error) {
+	// Longest operators first.
+	for _, op := range []Op{Equal, NotEqual, GreaterThanOrEqual, LessThanOrEqual, GreaterThan, LessThan} {
+		if p.accept(string(op)) {
+			return op, nil
+		}
+	}
+	return "", p.errorf(p.pos, "expected comparison operator, found %s", p.found())
+}
+
+// args reads the arguments of a custom filter or order: the text in the
+// parentheses coming next, if any.
+func (p *parser) args() (string, error) {
+	if !p.accept("(") {
+		return "", nil
+	}
+	start := p.pos
+	depth := 1
+	for i := start; i < len(p.s); i++ {
+		switch p.s[i] {
+		case '"':
+			for i++; i < len(p.s) && p.s[i] != '"'; i++ {
+				if p.s[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				p.pos = i + 1
+				return p.s[start:i], nil
+			}
+		}
+	}
+	return "", p.errorf(start-1, "unbalanced parenthesis")
+}
+
+func (p *parser) query() (Query, error) {
+	var q Query
+	if err := p.expect("SELECT"); err != nil {
+		return q, err
+	}
+	if err := p.expect("keys"); err != nil {
+		return q, err
+	}
+	q.KeysOnly = true
+	for p.accept(",") {
+		switch w, pos := p.word(); w {
+		case "vals":
+			q.KeysOnly = false
+		case "exps":
+			q.ReturnExpirations = true
+		case "sizes":
+			q.ReturnsSizes = true
+		default:
+			return q, p.errorf(pos, "expected vals, exps or sizes, found %q", w)
+		}
+	}
+
+	var err error
+	if p.accept("FROM") {
+		if q.Prefix, err = p.quoted(); err != nil {
+			return q, err
+		}
+	}
+	if p.accept("FILTER") {
+		if err := p.expect("["); err != nil {
+			return q, err
+		}
+		if q.Filters, err = p.filters("]"); err != nil {
+			return q, err
+		}
+	}
+	if p.accept("ORDER") {
+		if err := p.expect("["); err != nil {
+			return q, err
+		}
+		for {
+			o, err := p.order()
+			if err != nil {
+				return q, err
+			}
+			q.Orders = append(q.Orders, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect("]"); err != nil {
+			return q, err
+		}
+	}
+	if p.accept("OFFSET") {
+		if q.Offset, err = p.count(); err != nil {
+			return q, err
+		}
+	}
+	if p.accept("LIMIT") {
+		if q.Limit, err = p.count(); err != nil {
+			return q, err
+		}
+	}
+	return q, p.end()
+}
+
+// count reads a positive integer.
+func (p *parser) count() (int, error) {
+	p.skipSpace()
+	start := p.pos
+	n, err := p.integer()
+	if err == nil && n <= 0 {
+		err = p.errorf(start, "expected positive integer, found %d", n)
+	}
+	return n, err
+}
+
+// filters reads a list of filters separated by commas, up to the closing
+// token, which it reads.
+func (p *parser) filters(closing string) ([]Filter, error) {
+	var filters []Filter
+	if p.accept(closing) {
+		return filters, nil
+	}
+	for {
+		f, err := p.filter()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return filters, p.expect(closing)
+}
+
+func (p *parser) filter() (Filter, error) {
+	w, pos := p.word()
+	switch w {
+	case "KEY":
+		op, err := p.op()
+		if err != nil {
+			return nil, err
+		}
+		key, err := p.quoted()
+		return FilterKeyCompare{Op: op, Key: key}, err
+	case "VALUE":
+		switch {
+		case p.accept("PREFIX"):
+			v, err := p.quotedArg()
+			return FilterValuePrefix{Prefix: []byte(v)}, err
+		case p.accept("CONTAINS"):
+			v, err := p.quotedArg()
+			return FilterValueContains{Value: []byte(v)}, err
+		}
+		op, err := p.op()
+		if err != nil {
+			return nil, err
+		}
+		v, err := p.quoted()
+		return FilterValueCompare{Op: op, Value: []byte(v)}, err
+	case "PREFIX":
+		prefix, err := p.quotedArg()
+		return FilterKeyPrefix{Prefix: prefix}, err
+	case "GLOB":
+		pattern, err := p.quotedArg()
+		return FilterKeyGlob{Pattern: pattern}, err
+	case "REGEXP":
+		start := p.pos
+		expr, err := p.quotedArg()
+		if err != nil {
+			return nil, err
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, p.errorf(start, "%v", err)
+		}
+		return FilterKeyRegexp{Regexp: re}, nil
+	case "SIZE":
+		op, err := p.op()
+		if err != nil {
+			return nil, err
+		}
+		size, err := p.integer()
+		return FilterSize{Op: op, Size: size}, err
+	case "EXPIRATION":
+		op, err := p.op()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		start := p.pos
+		s, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		exp, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, p.errorf(start, "invalid expiration: %v", err)
+		}
+		return FilterExpiration{Op: op, Expiration: exp}, nil
+	case "AND", "OR":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		filters, err := p.filters(")")
+		if w == "AND" {
+			return FilterAnd{Filters: filters}, err
+		}
+		return FilterOr{Filters: filters}, err
+	case "NOT":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		f, err := p.filter()
+		if err != nil {
+			return nil, err
+		}
+		return FilterNot{Negated: f}, p.expect(")")
+	}
+
+	parse, ok := filterParsers[w]
+	if !ok {
+		if w == "" {
+			return nil, p.errorf(pos, "expected filter, found %s", p.found())
+		}
+		return nil, p.errorf(pos, "unknown filter %q", w)
+	}
+	args, err := p.args()
+	if err != nil {
+		return nil, err
+	}
+	f, err := parse(args)
+	if err != nil {
+		return nil, p.errorf(pos, "filter %s: %v", w, err)
+	}
+	return f, nil
+}
+
+func (p *parser) order() (Order, error) {
+	w, pos := p.word()
+	switch w {
+	case "KEY":
+		return OrderByKey{}, nil
+	case "VALUE":
+		return OrderByValue{}, nil
+	case "desc":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		var o Order
+		switch w, pos := p.word(); w {
+		case "KEY":
+			o = OrderByKeyDescending{}
+		case "VALUE":
+			o = OrderByValueDescending{}
+		default:
+			return nil, p.errorf(pos, "expected KEY or VALUE, found %q", w)
+		}
+		return o, p.expect(")")
+	}
+
+	parse, ok := orderParsers[w]
+	if !ok {
+		if w == "" {
+			return nil, p.errorf(pos, "expected order, found %s", p.found())
+		}
+		return nil, p.errorf(pos, "unknown order %q", w)
+	}
+	args, err := p.args()
+	if err != nil {
+		return nil, err
+	}
+	o, err := parse(args)
+	if err != nil {
+		return nil, p.errorf(pos, "order %s: %v", w, err)
+	}
+	return o, nil
+}
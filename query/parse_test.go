@@ -0,0 +1,202 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// filterEven passes entries whose key has an even length, or an odd one if
+// Odd is set. It is registered as EVEN, to test custom filters.
+type filterEven struct {
+	Odd bool
+}
+
+func (f filterEven) Filter(e Entry) bool { return len(e.Key)%2 == 1 == f.Odd }
+
+func (f filterEven) String() string {
+	if f.Odd {
+		return `EVEN(odd, ")")`
+	}
+	return "EVEN"
+}
+
+// orderByLength orders entries by the length of their keys. It is registered
+// as LEN, to test custom orders.
+type orderByLength struct{}
+
+func (orderByLength) Compare(a, b Entry) int { return len(a.Key) - len(b.Key) }
+func (orderByLength) String() string         { return "LEN()" }
+
+func init() {
+	RegisterFilter("EVEN", func(args string) (Filter, error) {
+		switch args {
+		case "":
+			return filterEven{}, nil
+		case `odd, ")"`:
+			return filterEven{Odd: true}, nil
+		}
+		return nil, fmt.Errorf("unexpected arguments %q", args)
+	})
+	RegisterOrder("LEN", func(args string) (Order, error) {
+		return orderByLength{}, nil
+	})
+}
+
+var parseQueries = []Query{
+	{},
+	{KeysOnly: true},
+	{Prefix: "/a", ReturnExpirations: true, ReturnsSizes: true, Offset: 5, Limit: 10},
+	{Prefix: "/", Orders: []Order{OrderByKey{}, OrderByValueDescending{}, OrderByValue{}, OrderByKeyDescending{}}},
+	{Filters: []Filter{
+		FilterKeyCompare{Op: GreaterThanOrEqual, Key: "/a \"b\"\n"},
+		FilterValueCompare{Op: NotEqual, Value: []byte("\x00\xff")},
+		FilterKeyPrefix{Prefix: "/p"},
+		FilterKeyGlob{Pattern: "/a/*"},
+		FilterKeyRegexp{Regexp: regexp.MustCompile(`^/a/\d+$`)},
+		FilterValuePrefix{Prefix: []byte("v")},
+		FilterValueContains{Value: []byte("(")},
+		FilterSize{Op: LessThan, Size: -1},
+		FilterExpiration{Op: Equal, Expiration: time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)},
+	}},
+	{Filters: []Filter{
+		And(Or(Not(FilterKeyPrefix{Prefix: "/a"}), FilterSize{Op: Equal, Size: 3}), And()),
+		Or(),
+		filterEven{},
+		Not(filterEven{Odd: true}),
+	}, Orders: []Order{orderByLength{}}, Limit: 1},
+}
+
+func TestParse(t *testing.T) {
+	for _, q := range parseQueries {
+		parsed, err := Parse(q.String())
+		if err != nil {
+			t.Errorf("%s: %v", q, err)
+			continue
+		}
+		if !reflect.DeepEqual(parsed, q) {
+			t.Errorf("parsed %s as %s", q, parsed)
+		}
+	}
+
+	q, err := Parse(" SELECT keys , vals\tFILTER [ KEY>\"/a\",SIZE<=2 ] ORDER [desc( KEY )]  LIMIT 3 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `SELECT keys,vals FILTER [KEY > "/a", SIZE <= 2] ORDER [desc(KEY)] LIMIT 3`; q.String() != want {
+		t.Errorf("got %s, want %s", q, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		in     string
+		offset int
+		msg    string
+	}{
+		{"", 0, `expected "SELECT", found end of input`},
+		{"SELECT keys,values", 12, `expected vals, exps or sizes, found "values"`},
+		{"SELECT keys FROM /a", 17, `expected quoted string, found "/"`},
+		{`SELECT keys FROM "/a`, 17, `unterminated string`},
+		{`SELECT keys FILTER [KEY ~ "/a"]`, 24, `expected comparison operator, found "~"`},
+		{`SELECT keys FILTER [KEY > "/a"`, 30, `expected "]", found end of input`},
+		{`SELECT keys FILTER [FOO("x")]`, 20, `unknown filter "FOO"`},
+		{`SELECT keys FILTER [REGEXP("(")]`, 26, "error parsing regexp: missing closing ): `(`"},
+		{`SELECT keys FILTER [EXPIRATION > "soon"]`, 33, `invalid expiration: parsing time "soon" as "2006-01-02T15:04:05.999999999Z07:00": cannot parse "soon" as "2006"`},
+		{`SELECT keys FILTER [EVEN(x)]`, 20, `filter EVEN: unexpected arguments "x"`},
+		{`SELECT keys FILTER [EVEN(")]`, 24, `unbalanced parenthesis`},
+		{`SELECT keys ORDER [desc(SIZE)]`, 24, `expected KEY or VALUE, found "SIZE"`},
+		{`SELECT keys ORDER [FN]`, 19, `unknown order "FN"`},
+		{`SELECT keys LIMIT 0`, 18, `expected positive integer, found 0`},
+		{`SELECT keys LIMIT 10 OFFSET 2`, 21, `expected end of input, found "OFFSET"`},
+	}
+	for _, c := range cases {
+		_, err := Parse(c.in)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: expected a ParseError, got %v", c.in, err)
+			continue
+		}
+		if perr.Offset != c.offset || perr.Msg != c.msg {
+			t.Errorf("%s: got error %q at %d, want %q at %d", c.in, perr.Msg, perr.Offset, c.msg, c.offset)
+		}
+	}
+}
+
+func TestParseFilterAndOrder(t *testing.T) {
+	f, err := ParseFilter(`NOT(VALUE CONTAINS("x"))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f, Not(FilterValueContains{Value: []byte("x")})) {
+		t.Errorf("got %s", f)
+	}
+	if _, err := ParseFilter(`PREFIX("/a") x`); err == nil {
+		t.Error("expected trailing input to fail")
+	}
+
+	o, err := ParseOrder("desc(VALUE)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o != (OrderByValueDescending{}) {
+		t.Errorf("got %s", o)
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	parseFilter := func(string) (Filter, error) { return filterEven{}, nil }
+	parseOrder := func(string) (Order, error) { return orderByLength{}, nil }
+	for name, register := range map[string]func(){
+		"built-in filter":  func() { RegisterFilter("PREFIX", parseFilter) },
+		"duplicate filter": func() { RegisterFilter("EVEN", parseFilter) },
+		"nil filter":       func() { RegisterFilter("ODD", nil) },
+		"built-in order":   func() { RegisterOrder("desc", parseOrder) },
+		"duplicate order":  func() { RegisterOrder("LEN", parseOrder) },
+		"nil order":        func() { RegisterOrder("SHORT", nil) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			register()
+		}()
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, q := range parseQueries {
+		f.Add(q.String())
+	}
+	f.Add(`SELECT keys FILTER [AND(OR(NOT(KEY == "\x00")))]`)
+	f.Add(`SELECT keys,exps FILTER [EXPIRATION < "2026-01-02T03:04:05+02:00"]`)
+
+	f.Fuzz(func(t *testing.T, s string) {
+		q, err := Parse(s)
+		if err != nil {
+			var perr *ParseError
+			if !errors.As(err, &perr) || perr.Offset < 0 || perr.Offset > len(s) {
+				t.Fatalf("%s: unexpected error %v", strconv.Quote(s), err)
+			}
+			return
+		}
+		rendered := q.String()
+		parsed, err := Parse(rendered)
+		if err != nil {
+			t.Fatalf("%s: parsing %s: %v", strconv.Quote(s), rendered, err)
+		}
+		if !reflect.DeepEqual(parsed, q) {
+			t.Fatalf("%s: parsed %s as %s", strconv.Quote(s), rendered, parsed)
+		}
+		if !strings.HasPrefix(rendered, "SELECT keys") {
+			t.Fatalf("unexpected rendering %s", rendered)
+		}
+	})
+}
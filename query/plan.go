@@ -0,0 +1,267 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capabilities describes the parts of a Query a datastore executes natively,
+// rather than by applying them to its results with NaiveQueryApply. See Plan.
+//
+// Conjunctions, disjunctions and negations of filters are native when the
+// filters they combine are. Filters and orders unknown to this package, and
+// OrderByFunction, never are.
+type Capabilities struct {
+	// Prefix is set if the datastore handles Query.Prefix.
+	Prefix bool
+	// KeyPrefixes is set if the datastore handles FilterKeyPrefix.
+	KeyPrefixes bool
+	// KeyRanges is set if the datastore handles FilterKeyCompare.
+	KeyRanges bool
+	// KeyPatterns is set if the datastore handles FilterKeyGlob and
+	// FilterKeyRegexp.
+	KeyPatterns bool
+	// ValueFilters is set if the datastore handles the filters on values,
+	// sizes and expirations: FilterValueCompare, FilterValuePrefix,
+	// FilterValueContains, FilterSize and FilterExpiration.
+	ValueFilters bool
+	// KeyOrders is set if the datastore handles OrderByKey and
+	// OrderByKeyDescending.
+	KeyOrders bool
+	// ValueOrders is set if the datastore handles OrderByValue and
+	// OrderByValueDescending.
+	ValueOrders bool
+	// Limit is set if the datastore handles Offset and Limit.
+	Limit bool
+}
+
+// Capable is implemented by datastores advertising the parts of queries they
+// execute natively.
+type Capable interface {
+	QueryCapabilities() Capabilities
+}
+
+// Explain describes how a datastore runs a query: the part it executes
+// natively, or passes on to the datastores it wraps, and the residual part it
+// applies to their results.
+type Explain struct {
+	// Datastore names the datastore, usually by its type.
+	Datastore string
+	// Query is the query the datastore received.
+	Query Query
+	// Native is the part of the query the datastore executes natively. For
+	// wrappers, it is expressed in the keys of the wrapper, and is the part
+	// they pass on to the datastores they wrap.
+	Native Query
+	// Residual is the part of the query applied to the results of Native,
+	// with NaiveQueryApply or an equivalent.
+	Residual Query
+	// Notes explain why parts of the query are residual.
+	Notes []string
+	// Children explain the queries sent to the datastores the datastore
+	// wraps.
+	Children []Explain
+}
+
+// Explainer is implemented by datastores describing how they run queries,
+// including the datastores they wrap.
+type Explainer interface {
+	ExplainQuery(q Query) Explain
+}
+
+// Notef appends a note to e.
+func (e *Explain) Notef(format string, args ...any) {
+	e.Notes = append(e.Notes, fmt.Sprintf(format, args...))
+}
+
+// String returns a description of the plan, indenting the plans of the
+// children:
+//
+//	*keytransform.Datastore
+//	  query:    SELECT keys,vals FILTER [GLOB("/a/*")] LIMIT 10
+//	  native:   SELECT keys,vals
+//	  residual: FILTER [GLOB("/a/*")] LIMIT 10
+//	  note:     filter GLOB("/a/*") is not supported
+//	  note:     offset and limit apply after the residual query
+//	  *datastore.MapDatastore
+//	    ...
+func (e Explain) String() string {
+	var s strings.Builder
+	e.write(&s, "")
+	return s.String()
+}
+
+func (e Explain) write(s *strings.Builder, indent string) {
+	fmt.Fprintf(s, "%s%s\n", indent, e.Datastore)
+	fmt.Fprintf(s, "%s  query:    %s\n", indent, e.Query)
+	fmt.Fprintf(s, "%s  native:   %s\n", indent, e.Native)
+	if ops := e.Residual.operations(); ops != "" {
+		fmt.Fprintf(s, "%s  residual: %s\n", indent, ops[:len(ops)-1])
+	}
+	for _, n := range e.Notes {
+		fmt.Fprintf(s, "%s  note:     %s\n", indent, n)
+	}
+	for _, c := range e.Children {
+		c.write(s, indent+"  ")
+	}
+}
+
+// Plan splits q into the part a datastore with capabilities c executes
+// natively, and the residual part to apply to its results with
+// NaiveQueryApply:
+//
+//   - the prefix is residual if not supported,
+//   - filters, simplified with Simplify, are residual if not supported,
+//   - orders are all residual if one of them is not supported, as the
+//     residual sort has to sort everything anyway. Orders following a key
+//     order are dropped, as keys are unique,
+//   - offset and limit are residual if not supported, or if any other part
+//     of the query is.
+//
+// When residual filters or orders need values or expirations, the native
+// query returns them, even if q doesn't. The values are then dropped by the
+// residual query, which is KeysOnly.
+func Plan(q Query, c Capabilities) Explain {
+	e := Explain{Query: q, Native: q}
+	native, residual := &e.Native, &e.Residual
+
+	if !c.Prefix {
+		native.Prefix = ""
+		if cleanPrefix(q.Prefix) != "/" {
+			residual.Prefix = q.Prefix
+			e.Notef("prefix %q is not supported", q.Prefix)
+		}
+	}
+
+	native.Filters = nil
+	for _, f := range Simplify(q.Filters) {
+		if c.filter(f) {
+			native.Filters = append(native.Filters, f)
+		} else {
+			residual.Filters = append(residual.Filters, f)
+			e.Notef("filter %s is not supported", f)
+		}
+	}
+
+	for i, o := range q.Orders {
+		if !c.order(o) {
+			native.Orders = nil
+			residual.Orders = q.Orders
+			e.Notef("order %s is not supported", o)
+			break
+		}
+		if isKeyOrder(o) {
+			native.Orders = q.Orders[:i+1]
+			break
+		}
+	}
+
+	if q.Offset > 0 || q.Limit > 0 {
+		pushed := false
+		switch {
+		case !c.Limit:
+			e.Notef("offset and limit are not supported")
+		case residual.Prefix != "" || len(residual.Filters) > 0 || len(residual.Orders) > 0:
+			e.Notef("offset and limit apply after the residual query")
+		default:
+			pushed = true
+		}
+		if !pushed {
+			native.Offset, native.Limit = 0, 0
+			residual.Offset, residual.Limit = q.Offset, q.Limit
+		}
+	}
+
+	values, expirations := needs(residual.Filters, residual.Orders)
+	if values && native.KeysOnly {
+		native.KeysOnly = false
+		residual.KeysOnly = true
+		e.Notef("values are returned for the residual query")
+	}
+	if expirations && !native.ReturnExpirations {
+		native.ReturnExpirations = true
+		e.Notef("expirations are returned for the residual query")
+	}
+	return e
+}
+
+// filter returns whether f, simplified with Simplify, is native.
+func (c Capabilities) filter(f Filter) bool {
+	switch f := f.(type) {
+	case FilterKeyPrefix:
+		return c.KeyPrefixes
+	case FilterKeyCompare:
+		return c.KeyRanges
+	case FilterKeyGlob, FilterKeyRegexp:
+		return c.KeyPatterns
+	case FilterValueCompare, FilterValuePrefix, FilterValueContains, FilterSize, FilterExpiration:
+		return c.ValueFilters
+	case FilterNot:
+		return c.filter(f.Negated)
+	case FilterAnd:
+		return c.filters(f.Filters)
+	case FilterOr:
+		return c.filters(f.Filters)
+	}
+	return false
+}
+
+func (c Capabilities) filters(filters []Filter) bool {
+	for _, f := range filters {
+		if !c.filter(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// order returns whether o is native.
+func (c Capabilities) order(o Order) bool {
+	switch o.(type) {
+	case OrderByKey, *OrderByKey, OrderByKeyDescending, *OrderByKeyDescending:
+		return c.KeyOrders
+	case OrderByValue, *OrderByValue, OrderByValueDescending, *OrderByValueDescending:
+		return c.ValueOrders
+	}
+	return false
+}
+
+func isKeyOrder(o Order) bool {
+	switch o.(type) {
+	case OrderByKey, *OrderByKey, OrderByKeyDescending, *OrderByKeyDescending:
+		return true
+	}
+	return false
+}
+
+// needs returns whether the filters, simplified with Simplify, and orders of
+// this package need the values or expirations of entries.
+func needs(filters []Filter, orders []Order) (values, expirations bool) {
+	for _, f := range filters {
+		v, e := needsFilter(f)
+		values, expirations = values || v, expirations || e
+	}
+	for _, o := range orders {
+		switch o.(type) {
+		case OrderByValue, *OrderByValue, OrderByValueDescending, *OrderByValueDescending:
+			values = true
+		}
+	}
+	return values, expirations
+}
+
+func needsFilter(f Filter) (values, expirations bool) {
+	switch f := f.(type) {
+	case FilterValueCompare, FilterValuePrefix, FilterValueContains, FilterSize:
+		return true, false
+	case FilterExpiration:
+		return false, true
+	case FilterNot:
+		return needsFilter(f.Negated)
+	case FilterAnd:
+		return needs(f.Filters, nil)
+	case FilterOr:
+		return needs(f.Filters, nil)
+	}
+	return false, false
+}
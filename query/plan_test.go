@@ -0,0 +1,129 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	all := Capabilities{
+		Prefix: true, KeyPrefixes: true, KeyRanges: true, KeyPatterns: true,
+		ValueFilters: true, KeyOrders: true, ValueOrders: true, Limit: true,
+	}
+	keys := Capabilities{Prefix: true, KeyPrefixes: true, KeyRanges: true, KeyOrders: true, Limit: true}
+
+	cases := []struct {
+		q                Query
+		c                Capabilities
+		native, residual Query
+		notes            int
+	}{
+		{
+			q:      Query{Prefix: "/a", Filters: []Filter{&FilterKeyPrefix{Prefix: "/a/b"}}, Orders: []Order{OrderByValue{}}, Limit: 1},
+			c:      all,
+			native: Query{Prefix: "/a", Filters: []Filter{FilterKeyPrefix{Prefix: "/a/b"}}, Orders: []Order{OrderByValue{}}, Limit: 1},
+		},
+		{
+			q:        Query{Prefix: "/a", Orders: []Order{OrderByKey{}}, Offset: 2, Limit: 1},
+			c:        Capabilities{},
+			residual: Query{Prefix: "/a", Orders: []Order{OrderByKey{}}, Offset: 2, Limit: 1},
+			notes:    3,
+		},
+		{
+			// An empty prefix needs no residual filter.
+			q:      Query{Prefix: "/", KeysOnly: true},
+			c:      Capabilities{},
+			native: Query{KeysOnly: true},
+		},
+		{
+			// Orders after a key order are dropped.
+			q:      Query{Orders: []Order{OrderByKeyDescending{}, OrderByValue{}}},
+			c:      keys,
+			native: Query{Orders: []Order{OrderByKeyDescending{}}},
+		},
+		{
+			q:        Query{Orders: []Order{OrderByValue{}, OrderByKey{}}, KeysOnly: true, Limit: 3},
+			c:        keys,
+			native:   Query{},
+			residual: Query{Orders: []Order{OrderByValue{}, OrderByKey{}}, Limit: 3, KeysOnly: true},
+			notes:    3,
+		},
+		{
+			q: Query{Filters: []Filter{
+				Or(FilterKeyCompare{Op: LessThan, Key: "/b"}, Not(FilterKeyPrefix{Prefix: "/c"})),
+				And(FilterKeyGlob{Pattern: "/*"}, FilterExpiration{Op: GreaterThan}),
+				Or(FilterKeyPrefix{Prefix: "/a"}, FilterValuePrefix{Prefix: []byte("v")}),
+				filterEven{},
+			}, Orders: []Order{OrderByKey{}}, Limit: 1, KeysOnly: true},
+			c: keys,
+			native: Query{Filters: []Filter{
+				Or(FilterKeyCompare{Op: LessThan, Key: "/b"}, Not(FilterKeyPrefix{Prefix: "/c"})),
+			}, Orders: []Order{OrderByKey{}}, ReturnExpirations: true},
+			residual: Query{Filters: []Filter{
+				FilterKeyGlob{Pattern: "/*"},
+				FilterExpiration{Op: GreaterThan},
+				Or(FilterKeyPrefix{Prefix: "/a"}, FilterValuePrefix{Prefix: []byte("v")}),
+				filterEven{},
+			}, Limit: 1, KeysOnly: true},
+			notes: 7,
+		},
+		{
+			// Values fetched for a residual filter are dropped again.
+			q:        Query{Filters: []Filter{FilterValuePrefix{Prefix: []byte("v")}}, KeysOnly: true},
+			c:        keys,
+			residual: Query{Filters: []Filter{FilterValuePrefix{Prefix: []byte("v")}}, KeysOnly: true},
+			notes:    2,
+		},
+	}
+	for _, c := range cases {
+		e := Plan(c.q, c.c)
+		if !reflect.DeepEqual(e.Query, c.q) {
+			t.Errorf("%s: got query %s", c.q, e.Query)
+		}
+		if !reflect.DeepEqual(e.Native, c.native) {
+			t.Errorf("%s: got native %s, want %s", c.q, e.Native, c.native)
+		}
+		if !reflect.DeepEqual(e.Residual, c.residual) {
+			t.Errorf("%s: got residual %s, want %s", c.q, e.Residual, c.residual)
+		}
+		if len(e.Notes) != c.notes {
+			t.Errorf("%s: got notes %q", c.q, e.Notes)
+		}
+	}
+}
+
+func TestPlanKeysOnlyValueFilter(t *testing.T) {
+	q := Query{Filters: []Filter{FilterValuePrefix{Prefix: []byte("v")}}, KeysOnly: true}
+	e := Plan(q, Capabilities{})
+	entries := []Entry{
+		{Key: "/a", Value: []byte("v1"), Size: 2},
+		{Key: "/b", Value: []byte("w2"), Size: 2},
+	}
+	res, err := NaiveQueryApply(e.Residual, ResultsWithEntries(e.Native, entries)).Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{{Key: "/a", Size: 2}}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("got %v, want %v", res, want)
+	}
+}
+
+func TestExplainString(t *testing.T) {
+	e := Plan(Query{Prefix: "/a", Filters: []Filter{FilterKeyGlob{Pattern: "/a/*"}}, Limit: 10}, Capabilities{Prefix: true, Limit: true})
+	e.Datastore = "parent"
+	e.Children = []Explain{{Datastore: "child", Query: e.Native, Native: e.Native}}
+	want := `parent
+  query:    SELECT keys,vals FROM "/a" FILTER [GLOB("/a/*")] LIMIT 10
+  native:   SELECT keys,vals FROM "/a"
+  residual: FILTER [GLOB("/a/*")] LIMIT 10
+  note:     filter GLOB("/a/*") is not supported
+  note:     offset and limit apply after the residual query
+  child
+    query:    SELECT keys,vals FROM "/a"
+    native:   SELECT keys,vals FROM "/a"
+`
+	if e.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", e, want)
+	}
+}
@@ -78,9 +78,21 @@ func (q Query) String() string {
 	if q.ReturnExpirations {
 		s.WriteString(",exps")
 	}
+	if q.ReturnsSizes {
+		s.WriteString(",sizes")
+	}
 
 	s.WriteString(" ")
+	s.WriteString(q.operations())
+
+	// Will always end with a space, strip it.
+	return s.String()[:len(s.String())-1]
+}
 
+// operations returns the operations of q in the syntax of String, each
+// followed by a space.
+func (q Query) operations() string {
+	var s strings.Builder
 	if q.Prefix != "" {
 		s.WriteString(fmt.Sprintf("FROM %q ", q.Prefix))
 	}
@@ -108,8 +120,7 @@ func (q Query) String() string {
 	if q.Limit > 0 {
 		s.WriteString(fmt.Sprintf("LIMIT %d ", q.Limit))
 	}
-	// Will always end with a space, strip it.
-	return s.String()[:len(s.String())-1]
+	return s.String()
 }
 
 // Entry is a query result entry.
@@ -71,65 +71,29 @@ func NaiveOffset(qr Results, offset int) Results {
 	})
 }
 
-// NaiveOrder reorders results according to given orders.
-// WARNING: this is the only non-stream friendly operation!
+// NaiveOrder reorders results according to given orders, with DefaultSorter.
+// WARNING: this is the only non-stream friendly operation! Unless
+// DefaultSorter.MemoryLimit is set, every result is kept in memory.
 func NaiveOrder(qr Results, orders ...Order) Results {
-	// Short circuit.
-	if len(orders) == 0 {
-		return qr
-	}
-
-	var entries []Entry
-	var errs []Result
-	for res := range qr.Next() {
-		if res.Error != nil {
-			errs = append(errs, res)
-			continue
-		}
-		entries = append(entries, res.Entry)
-	}
-
-	Sort(orders, entries)
-
-	return ResultsFromIterator(qr.Query(), Iterator{
-		Next: func() (Result, bool) {
-			if len(errs) != 0 {
-				errResult := errs[0]
-				errs = errs[1:]
-				return errResult, true
-			}
-			if len(entries) == 0 {
-				return Result{}, false
-			}
-			next := entries[0]
-			entries = entries[1:]
-			return Result{Entry: next}, true
-		},
-	})
+	return DefaultSorter.Order(qr, orders...)
 }
 
+// NaiveQueryApply applies q to the results of a datastore. When q has both
+// orders and a limit, only the first Offset+Limit entries are kept while
+// sorting, with NaiveTopK. When q is KeysOnly, the values of the results are
+// dropped.
 func NaiveQueryApply(q Query, qr Results) Results {
-	if q.Prefix != "" {
-		// Clean the prefix as a key and append / so a prefix of /bar
-		// only finds /bar/baz, not /barbaz.
-		prefix := q.Prefix
-		if len(prefix) == 0 {
-			prefix = "/"
-		} else {
-			if prefix[0] != '/' {
-				prefix = "/" + prefix
-			}
-			prefix = path.Clean(prefix)
-		}
-		// If the prefix is empty, ignore it.
-		if prefix != "/" {
-			qr = NaiveFilter(qr, FilterKeyPrefix{prefix + "/"})
-		}
+	// Append / to the prefix so a prefix of /bar only finds /bar/baz, not
+	// /barbaz. If the prefix is empty, ignore it.
+	if prefix := cleanPrefix(q.Prefix); prefix != "/" {
+		qr = NaiveFilter(qr, FilterKeyPrefix{prefix + "/"})
 	}
 	for _, f := range q.Filters {
 		qr = NaiveFilter(qr, f)
 	}
-	if len(q.Orders) > 0 {
+	if len(q.Orders) > 0 && q.Limit > 0 {
+		qr = NaiveTopK(qr, q.Offset+q.Limit, q.Orders...)
+	} else if len(q.Orders) > 0 {
 		qr = NaiveOrder(qr, q.Orders...)
 	}
 	if q.Offset != 0 {
@@ -138,9 +102,37 @@ func NaiveQueryApply(q Query, qr Results) Results {
 	if q.Limit != 0 {
 		qr = NaiveLimit(qr, q.Limit)
 	}
+	if q.KeysOnly {
+		qr = naiveKeysOnly(qr)
+	}
 	return qr
 }
 
+// naiveKeysOnly drops the values of the results, keeping their sizes.
+func naiveKeysOnly(qr Results) Results {
+	return ResultsFromIterator(qr.Query(), Iterator{
+		Next: func() (Result, bool) {
+			r, ok := qr.NextSync()
+			r.Value = nil
+			return r, ok
+		},
+		Close: func() error {
+			return qr.Close()
+		},
+	})
+}
+
+// cleanPrefix cleans the prefix of a query as a key.
+func cleanPrefix(prefix string) string {
+	if len(prefix) == 0 {
+		return "/"
+	}
+	if prefix[0] != '/' {
+		prefix = "/" + prefix
+	}
+	return path.Clean(prefix)
+}
+
 func ResultEntriesFrom(keys []string, vals [][]byte) []Entry {
 	re := make([]Entry, len(keys))
 	for i, k := range keys {
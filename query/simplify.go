@@ -0,0 +1,141 @@
+package query
+
+// Simplify returns filters equivalent to the conjunction of filters, in a
+// normal form making it easier for datastores to recognize the filters they
+// can apply themselves:
+//
+//   - pointers to the filters of this package are replaced by values,
+//   - nested conjunctions are flattened into the returned filters, and nested
+//     disjunctions into their parent,
+//   - negations are pushed down to the leaves of the tree, negated
+//     comparisons replaced with the opposite comparison, and double negations
+//     removed,
+//   - conjunctions and disjunctions of a single filter are replaced with the
+//     filter. An empty FilterAnd passes everything, and is dropped from
+//     conjunctions, and an empty FilterOr passes nothing, and is returned
+//     alone if part of the conjunction.
+//
+// Filters unknown to this package are kept as they are.
+func Simplify(filters []Filter) []Filter {
+	f := simplify(FilterAnd{Filters: filters}, false)
+	if and, ok := f.(FilterAnd); ok {
+		return and.Filters
+	}
+	return []Filter{f}
+}
+
+// simplify returns the normal form of f, or of its negation if negate is set.
+func simplify(f Filter, negate bool) Filter {
+	switch f := f.(type) {
+	case *FilterAnd:
+		return simplify(*f, negate)
+	case *FilterOr:
+		return simplify(*f, negate)
+	case *FilterNot:
+		return simplify(*f, negate)
+	case *FilterKeyCompare:
+		return simplify(*f, negate)
+	case *FilterKeyPrefix:
+		return simplify(*f, negate)
+	case *FilterValueCompare:
+		return simplify(*f, negate)
+	case *FilterKeyGlob:
+		return simplify(*f, negate)
+	case *FilterKeyRegexp:
+		return simplify(*f, negate)
+	case *FilterValuePrefix:
+		return simplify(*f, negate)
+	case *FilterValueContains:
+		return simplify(*f, negate)
+	case *FilterSize:
+		return simplify(*f, negate)
+	case *FilterExpiration:
+		return simplify(*f, negate)
+
+	case FilterAnd:
+		// not (a and b) == (not a) or (not b)
+		return junction(f.Filters, negate, negate)
+	case FilterOr:
+		return junction(f.Filters, negate, !negate)
+	case FilterNot:
+		return simplify(f.Negated, !negate)
+
+	case FilterKeyCompare:
+		if op, ok := negateOp(f.Op); ok && negate {
+			return FilterKeyCompare{Op: op, Key: f.Key}
+		}
+	case FilterValueCompare:
+		if op, ok := negateOp(f.Op); ok && negate {
+			return FilterValueCompare{Op: op, Value: f.Value}
+		}
+	case FilterSize:
+		if op, ok := negateOp(f.Op); ok && negate {
+			return FilterSize{Op: op, Size: f.Size}
+		}
+	case FilterExpiration:
+		if op, ok := negateOp(f.Op); ok && negate {
+			return FilterExpiration{Op: op, Expiration: f.Expiration}
+		}
+	}
+	if negate {
+		return FilterNot{Negated: f}
+	}
+	return f
+}
+
+// junction returns the normal form of the conjunction of filters, or of their
+// disjunction if or is set, each filter being negated if negate is set.
+func junction(filters []Filter, negate, or bool) Filter {
+	var out []Filter
+	for _, f := range filters {
+		f = simplify(f, negate)
+		switch f := f.(type) {
+		case FilterAnd:
+			if !or {
+				out = append(out, f.Filters...)
+				continue
+			}
+			if len(f.Filters) == 0 {
+				return FilterAnd{}
+			}
+		case FilterOr:
+			if or {
+				out = append(out, f.Filters...)
+				continue
+			}
+			if len(f.Filters) == 0 {
+				return FilterOr{}
+			}
+		}
+		out = append(out, f)
+	}
+
+	switch {
+	case len(out) == 1:
+		return out[0]
+	case or:
+		return FilterOr{Filters: out}
+	default:
+		return FilterAnd{Filters: out}
+	}
+}
+
+// negateOp returns the operator comparing the other way round from op.
+func negateOp(op Op) (Op, bool) {
+	switch op {
+	case Equal:
+		return NotEqual, true
+	case NotEqual:
+		return Equal, true
+	case LessThan:
+		return GreaterThanOrEqual, true
+	case LessThanOrEqual:
+		return GreaterThan, true
+	case GreaterThan:
+		return LessThanOrEqual, true
+	case GreaterThanOrEqual:
+		return LessThan, true
+	default:
+		return "", false
+	}
+}
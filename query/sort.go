@@ -0,0 +1,348 @@
+package query
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Sorter sorts results like NaiveOrder, bounding the memory it uses: once the
+// buffered entries reach MemoryLimit, they are sorted and written to a
+// temporary file, as a run. The runs are then merged back as the sorted
+// results are read, and removed once the results are closed or exhausted.
+type Sorter struct {
+	// MemoryLimit is the approximate number of bytes of entries kept in
+	// memory. Zero means no limit, and nothing is written to disk.
+	MemoryLimit int
+	// TempDir is the directory of the runs, or the default directory for
+	// temporary files if empty.
+	TempDir string
+}
+
+// DefaultSorter is the Sorter used by NaiveOrder, and so by NaiveQueryApply.
+// Set its MemoryLimit, in an init function, to let them spill to disk.
+var DefaultSorter Sorter
+
+// maxRuns is the number of runs merged at once. Reaching it, the runs are
+// merged into a single run.
+const maxRuns = 64
+
+// entryOverhead approximates the size of an Entry on 64-bit platforms, to
+// account for the memory of entries beside their keys and values.
+const entryOverhead = 72
+
+func entrySize(e Entry) int {
+	return entryOverhead + len(e.Key) + len(e.Value)
+}
+
+// Order reorders the results of qr according to orders. Like NaiveOrder, it
+// reads every result first, and returns the errors before the entries. A
+// failure to write or read the runs is returned as an error result.
+func (s Sorter) Order(qr Results, orders ...Order) Results {
+	// Short circuit.
+	if len(orders) == 0 {
+		return qr
+	}
+
+	sp := &spill{dir: s.TempDir, orders: orders}
+	var entries []Entry
+	var errs []Result
+	size := 0
+	for res := range qr.Next() {
+		if res.Error != nil {
+			errs = append(errs, res)
+			continue
+		}
+		entries = append(entries, res.Entry)
+		size += entrySize(res.Entry)
+		if s.MemoryLimit <= 0 || size < s.MemoryLimit {
+			continue
+		}
+		Sort(orders, entries)
+		if err := sp.add(sliceSource(entries)); err != nil {
+			qr.Close()
+			sp.close()
+			return resultsWithResults(qr.Query(), append(errs, Result{Error: err}))
+		}
+		clear(entries)
+		entries = entries[:0]
+		size = 0
+	}
+	Sort(orders, entries)
+
+	var next func() (Result, bool)
+	if len(sp.runs) == 0 {
+		next = sliceSource(entries)
+	} else {
+		sources, err := sp.open()
+		if err != nil {
+			sp.close()
+			return resultsWithResults(qr.Query(), append(errs, Result{Error: err}))
+		}
+		next = merge(orders, append(sources, sliceSource(entries)))
+	}
+
+	done := false
+	return ResultsFromIterator(qr.Query(), Iterator{
+		Next: func() (Result, bool) {
+			if len(errs) != 0 {
+				errResult := errs[0]
+				errs = errs[1:]
+				return errResult, true
+			}
+			if done {
+				return Result{}, false
+			}
+			r, ok := next()
+			if !ok || r.Error != nil {
+				done = true
+				sp.close()
+			}
+			return r, ok
+		},
+		Close: func() error {
+			done = true
+			return sp.close()
+		},
+	})
+}
+
+// resultsWithResults returns the given results, which may be errors.
+func resultsWithResults(q Query, res []Result) Results {
+	i := 0
+	return ResultsFromIterator(q, Iterator{
+		Next: func() (Result, bool) {
+			if i >= len(res) {
+				return Result{}, false
+			}
+			next := res[i]
+			i++
+			return next, true
+		},
+	})
+}
+
+// sliceSource returns the entries one by one.
+func sliceSource(entries []Entry) func() (Result, bool) {
+	return func() (Result, bool) {
+		if len(entries) == 0 {
+			return Result{}, false
+		}
+		next := entries[0]
+		entries = entries[1:]
+		return Result{Entry: next}, true
+	}
+}
+
+// spill holds the runs written to disk by a Sorter.
+type spill struct {
+	dir    string
+	orders []Order
+	runs   []*os.File
+}
+
+// add writes the results of next, sorted, as a run. Reaching maxRuns, the
+// runs are merged into one.
+func (sp *spill) add(next func() (Result, bool)) error {
+	f, err := os.CreateTemp(sp.dir, "datastore-sort-")
+	if err != nil {
+		return fmt.Errorf("query: creating sort run: %w", err)
+	}
+	sp.runs = append(sp.runs, f)
+	if err := writeRun(f, next); err != nil {
+		return fmt.Errorf("query: writing sort run: %w", err)
+	}
+	if len(sp.runs) < maxRuns {
+		return nil
+	}
+
+	sources, err := sp.open()
+	if err != nil {
+		return err
+	}
+	runs := sp.runs
+	sp.runs = nil
+	err = sp.add(merge(sp.orders, sources))
+	for _, f := range runs {
+		err = errors.Join(err, removeRun(f))
+	}
+	return err
+}
+
+func writeRun(f *os.File, next func() (Result, bool)) error {
+	w := bufio.NewWriter(f)
+	var b []byte
+	for {
+		r, ok := next()
+		if !ok {
+			break
+		}
+		if r.Error != nil {
+			return r.Error
+		}
+		data, err := appendResultBinary(nil, r)
+		if err != nil {
+			return err
+		}
+		b = binary.AppendUvarint(b[:0], uint64(len(data)))
+		if _, err := w.Write(append(b, data...)); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// open returns the sources reading the runs from their beginning.
+func (sp *spill) open() ([]func() (Result, bool), error) {
+	sources := make([]func() (Result, bool), len(sp.runs))
+	for i, f := range sp.runs {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("query: reading sort run: %w", err)
+		}
+		sources[i] = ReadResultsBinary(Query{}, f).NextSync
+	}
+	return sources, nil
+}
+
+// close removes the runs. It may be called more than once.
+func (sp *spill) close() error {
+	var errs []error
+	for _, f := range sp.runs {
+		errs = append(errs, removeRun(f))
+	}
+	sp.runs = nil
+	return errors.Join(errs...)
+}
+
+func removeRun(f *os.File) error {
+	return errors.Join(f.Close(), os.Remove(f.Name()))
+}
+
+// merge returns the results of the sources, each sorted according to orders,
+// in order. Entries comparing equal are returned in the order of their
+// sources. An error result ends the merge.
+func merge(orders []Order, sources []func() (Result, bool)) func() (Result, bool) {
+	h := &mergeHeap{orders: orders}
+	var errResult *Result
+	for i, next := range sources {
+		if r, ok := next(); ok {
+			if r.Error != nil {
+				errResult = &r
+				break
+			}
+			h.heads = append(h.heads, mergeHead{Entry: r.Entry, source: i, next: next})
+		}
+	}
+	heap.Init(h)
+
+	return func() (Result, bool) {
+		if errResult != nil {
+			r := *errResult
+			errResult = nil
+			h.heads = nil
+			return r, true
+		}
+		if len(h.heads) == 0 {
+			return Result{}, false
+		}
+		head := &h.heads[0]
+		e := head.Entry
+		if r, ok := head.next(); !ok {
+			heap.Pop(h)
+		} else if r.Error != nil {
+			h.heads = nil
+			errResult = &r
+		} else {
+			head.Entry = r.Entry
+			heap.Fix(h, 0)
+		}
+		return Result{Entry: e}, true
+	}
+}
+
+type mergeHead struct {
+	Entry
+	source int
+	next   func() (Result, bool)
+}
+
+type mergeHeap struct {
+	orders []Order
+	heads  []mergeHead
+}
+
+func (h *mergeHeap) Len() int { return len(h.heads) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	if c := Compare(h.orders, h.heads[i].Entry, h.heads[j].Entry); c != 0 {
+		return c < 0
+	}
+	return h.heads[i].source < h.heads[j].source
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.heads[i], h.heads[j] = h.heads[j], h.heads[i] }
+
+func (h *mergeHeap) Push(x any) { h.heads = append(h.heads, x.(mergeHead)) }
+
+func (h *mergeHeap) Pop() any {
+	last := h.heads[len(h.heads)-1]
+	h.heads = h.heads[:len(h.heads)-1]
+	return last
+}
+
+// NaiveTopK returns the first k results of qr according to orders, keeping at
+// most k entries in memory. Like NaiveOrder, it reads every result first, and
+// returns the errors before the entries. If k isn't positive, it reorders all
+// the results with NaiveOrder.
+func NaiveTopK(qr Results, k int, orders ...Order) Results {
+	if k <= 0 || len(orders) == 0 {
+		return NaiveOrder(qr, orders...)
+	}
+
+	h := &topK{orders: orders}
+	var errs []Result
+	for res := range qr.Next() {
+		switch {
+		case res.Error != nil:
+			errs = append(errs, res)
+		case len(h.entries) < k:
+			heap.Push(h, res.Entry)
+		case Compare(orders, res.Entry, h.entries[0]) < 0:
+			h.entries[0] = res.Entry
+			heap.Fix(h, 0)
+		}
+	}
+	Sort(orders, h.entries)
+
+	results := errs
+	for _, e := range h.entries {
+		results = append(results, Result{Entry: e})
+	}
+	return resultsWithResults(qr.Query(), results)
+}
+
+// topK is a heap of entries with the last one according to orders on top.
+type topK struct {
+	orders  []Order
+	entries []Entry
+}
+
+func (h *topK) Len() int { return len(h.entries) }
+
+func (h *topK) Less(i, j int) bool {
+	return Compare(h.orders, h.entries[i], h.entries[j]) > 0
+}
+
+func (h *topK) Swap(i, j int) { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+
+func (h *topK) Push(x any) { h.entries = append(h.entries, x.(Entry)) }
+
+func (h *topK) Pop() any {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
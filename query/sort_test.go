@@ -0,0 +1,141 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// sortEntries returns n entries with random values, some of them empty or
+// nil, to sort by value.
+func sortEntries(n int) []Entry {
+	r := rand.New(rand.NewSource(1))
+	entries := make([]Entry, n)
+	for i := range entries {
+		e := Entry{Key: fmt.Sprintf("/%d", i), Size: -1}
+		switch r.Intn(10) {
+		case 0:
+		case 1:
+			e.Value = []byte{}
+		default:
+			e.Value = fmt.Appendf(nil, "%x", r.Intn(1000))
+		}
+		entries[i] = e
+	}
+	return entries
+}
+
+func sorted(orders []Order, entries []Entry) []Entry {
+	s := append([]Entry(nil), entries...)
+	Sort(orders, s)
+	return s
+}
+
+func TestSorter(t *testing.T) {
+	orders := []Order{OrderByValueDescending{}}
+	entries := sortEntries(5000)
+	want := sorted(orders, entries)
+
+	for _, limit := range []int{0, 1, 2000, 1 << 20} {
+		dir := t.TempDir()
+		s := Sorter{MemoryLimit: limit, TempDir: dir}
+		got, err := s.Order(ResultsWithEntries(Query{}, entries), orders...).Rest()
+		if err != nil {
+			t.Fatalf("limit %d: %v", limit, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("limit %d: entries are not sorted", limit)
+		}
+		if files, _ := os.ReadDir(dir); len(files) != 0 {
+			t.Errorf("limit %d: %d runs left", limit, len(files))
+		}
+	}
+
+	// Closing the results early removes the runs.
+	dir := t.TempDir()
+	res := Sorter{MemoryLimit: 2000, TempDir: dir}.Order(ResultsWithEntries(Query{}, entries), orders...)
+	if files, _ := os.ReadDir(dir); len(files) == 0 {
+		t.Error("expected runs to be written")
+	}
+	if r, ok := res.NextSync(); !ok || !reflect.DeepEqual(r.Entry, want[0]) {
+		t.Errorf("got %v, want %v", r, want[0])
+	}
+	if err := res.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d runs left after Close", len(files))
+	}
+
+	// Errors are returned first, and so are failures to write the runs.
+	boom := errors.New("boom")
+	withErr := ResultsFromIterator(Query{}, Iterator{Next: sliceSourceWithError(entries[:10], boom)})
+	all := Sorter{MemoryLimit: 1, TempDir: t.TempDir()}.Order(withErr, orders...)
+	if r, ok := all.NextSync(); !ok || r.Error != boom {
+		t.Errorf("expected the error first, got %v", r)
+	}
+	if got, err := all.Rest(); err != nil || !reflect.DeepEqual(got, sorted(orders, entries[:10])) {
+		t.Errorf("got %v, %v", got, err)
+	}
+
+	_, err := Sorter{MemoryLimit: 1, TempDir: "/nonexistent"}.Order(ResultsWithEntries(Query{}, entries), orders...).Rest()
+	if err == nil {
+		t.Error("expected an error creating the runs")
+	}
+}
+
+// sliceSourceWithError returns the entries, followed by an error.
+func sliceSourceWithError(entries []Entry, err error) func() (Result, bool) {
+	next := sliceSource(entries)
+	return func() (Result, bool) {
+		if r, ok := next(); ok {
+			return r, true
+		}
+		if err != nil {
+			r := Result{Error: err}
+			err = nil
+			return r, true
+		}
+		return Result{}, false
+	}
+}
+
+func TestNaiveTopK(t *testing.T) {
+	orders := []Order{OrderByValue{}, OrderByKeyDescending{}}
+	entries := sortEntries(1000)
+	want := sorted(orders, entries)
+
+	for _, k := range []int{-1, 0, 1, 10, 999, 1000, 2000} {
+		got, err := NaiveTopK(ResultsWithEntries(Query{}, entries), k, orders...).Rest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := len(want)
+		if k > 0 && k < n {
+			n = k
+		}
+		if !reflect.DeepEqual(got, want[:n]) {
+			t.Errorf("k %d: got %d entries, not the first %d", k, len(got), n)
+		}
+	}
+
+	res := NaiveTopK(ResultsFromIterator(Query{}, Iterator{Next: sliceSourceWithError(entries, errors.New("boom"))}), 3, orders...)
+	if r, ok := res.NextSync(); !ok || r.Error == nil {
+		t.Errorf("expected the error first, got %v", r)
+	}
+	if got, err := res.Rest(); err != nil || !reflect.DeepEqual(got, want[:3]) {
+		t.Errorf("got %v, %v", got, err)
+	}
+
+	q := Query{Orders: orders, Offset: 5, Limit: 10}
+	got, err := NaiveQueryApply(q, ResultsWithEntries(q, entries)).Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want[5:15]) {
+		t.Errorf("got %v, want %v", got, want[5:15])
+	}
+}
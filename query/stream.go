@@ -0,0 +1,245 @@
+package query
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Results are encoded in JSON by WriteResults as one object per line, holding
+// the fields of the entry, or the error message:
+//
+//	{"key":"/a","value":"YmFy","size":3}
+//	{"error":"datastore closed"}
+//
+// Values are base64 encoded, as encoding/json does for byte slices. In the
+// binary encoding of WriteResultsBinary, each result is prefixed by its length.
+
+// wireResult is the encoded form of a Result.
+type wireResult struct {
+	Key        string     `json:"key,omitempty"`
+	Value      *[]byte    `json:"value,omitempty"`
+	Expiration *time.Time `json:"expiration,omitempty"`
+	Size       int        `json:"size,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Flags of binary encoded results.
+const (
+	resultError = 1 << iota
+	resultValue
+	resultExpiration
+)
+
+// maxResultSize bounds the size of the binary encoded results ReadResults
+// accepts.
+const maxResultSize = 1 << 30
+
+// toWireResult returns the JSON form of r. Errors are encoded by their
+// message.
+func toWireResult(r Result) wireResult {
+	if r.Error != nil {
+		return wireResult{Error: r.Error.Error()}
+	}
+	w := wireResult{Key: r.Key, Size: r.Size}
+	if r.Value != nil {
+		w.Value = &r.Value
+	}
+	if !r.Expiration.IsZero() {
+		w.Expiration = &r.Expiration
+	}
+	return w
+}
+
+func (w wireResult) result() Result {
+	if w.Error != "" {
+		return Result{Error: errors.New(w.Error)}
+	}
+	r := Result{Entry: Entry{Key: w.Key, Size: w.Size}}
+	if w.Value != nil {
+		r.Value = *w.Value
+	}
+	if w.Expiration != nil {
+		r.Expiration = *w.Expiration
+	}
+	return r
+}
+
+// appendResultBinary appends the binary encoding of r to b. Errors are
+// encoded by their message.
+func appendResultBinary(b []byte, r Result) ([]byte, error) {
+	if r.Error != nil {
+		return appendString(binary.AppendUvarint(b, resultError), r.Error.Error()), nil
+	}
+
+	var flags uint64
+	var exp []byte
+	if r.Value != nil {
+		flags |= resultValue
+	}
+	if !r.Expiration.IsZero() {
+		flags |= resultExpiration
+		var err error
+		if exp, err = r.Expiration.MarshalBinary(); err != nil {
+			return nil, err
+		}
+	}
+	b = binary.AppendUvarint(b, flags)
+	b = appendString(b, r.Key)
+	if flags&resultValue != 0 {
+		b = appendString(b, string(r.Value))
+	}
+	if flags&resultExpiration != 0 {
+		b = appendString(b, string(exp))
+	}
+	return binary.AppendVarint(b, int64(r.Size)), nil
+}
+
+// decodeResultBinary decodes a result encoded by appendResultBinary.
+func decodeResultBinary(data []byte) (Result, error) {
+	br := &binaryReader{b: data}
+	var r Result
+	flags := br.uvarint()
+	if flags&resultError != 0 {
+		r.Error = errors.New(br.string())
+	} else {
+		r.Key = br.string()
+		if flags&resultValue != 0 {
+			r.Value = []byte(br.string())
+		}
+		if flags&resultExpiration != 0 {
+			if err := r.Expiration.UnmarshalBinary([]byte(br.string())); err != nil {
+				br.fail(err)
+			}
+		}
+		r.Size = int(br.varint())
+	}
+	if br.err == nil && len(br.b) > 0 {
+		br.err = errors.New("trailing data")
+	}
+	if br.err != nil {
+		return Result{}, fmt.Errorf("query: decoding binary result: %w", br.err)
+	}
+	return r, nil
+}
+
+// WriteResults writes the results of res to w, one JSON object per line, and
+// closes res. It stops after writing an error result, and returns the number
+// of results written.
+func WriteResults(w io.Writer, res Results) (int, error) {
+	return writeResults(w, res, func(w *bufio.Writer, r Result) error {
+		b, err := json.Marshal(toWireResult(r))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	})
+}
+
+// WriteResultsBinary writes the results of res to w like WriteResults, each
+// binary encoded and prefixed by its length as a uvarint.
+func WriteResultsBinary(w io.Writer, res Results) (int, error) {
+	return writeResults(w, res, func(w *bufio.Writer, r Result) error {
+		b, err := appendResultBinary(nil, r)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(binary.AppendUvarint(nil, uint64(len(b)))); err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	})
+}
+
+func writeResults(w io.Writer, res Results, write func(*bufio.Writer, Result) error) (int, error) {
+	defer res.Close()
+
+	bw := bufio.NewWriter(w)
+	n := 0
+	for {
+		r, ok := res.NextSync()
+		if !ok {
+			break
+		}
+		if err := write(bw, r); err != nil {
+			return n, err
+		}
+		n++
+		if r.Error != nil {
+			break
+		}
+	}
+	return n, bw.Flush()
+}
+
+// ReadResults returns the results written by WriteResults to r, as the
+// results of q. A result that can't be decoded is returned as an error, and
+// ends the results.
+func ReadResults(q Query, r io.Reader) Results {
+	dec := json.NewDecoder(r)
+	return readResults(q, func() (Result, error) {
+		var w wireResult
+		if err := dec.Decode(&w); err != nil {
+			return Result{}, err
+		}
+		return w.result(), nil
+	})
+}
+
+// ReadResultsBinary returns the results written by WriteResultsBinary to r,
+// like ReadResults.
+func ReadResultsBinary(q Query, r io.Reader) Results {
+	br := bufio.NewReader(r)
+	var buf []byte
+	return readResults(q, func() (Result, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return Result{}, err
+		}
+		if n > maxResultSize {
+			return Result{}, fmt.Errorf("query: result of %d bytes is too large", n)
+		}
+		if uint64(cap(buf)) < n {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if _, err := io.ReadFull(br, buf); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return Result{}, err
+		}
+		return decodeResultBinary(buf)
+	})
+}
+
+func readResults(q Query, decode func() (Result, error)) Results {
+	done := false
+	n := 0
+	return ResultsFromIterator(q, Iterator{
+		Next: func() (Result, bool) {
+			if done {
+				return Result{}, false
+			}
+			r, err := decode()
+			switch {
+			case err == io.EOF:
+				done = true
+				return Result{}, false
+			case err != nil:
+				done = true
+				return Result{Error: fmt.Errorf("query: reading result %d: %w", n+1, err)}, true
+			case r.Error != nil:
+				done = true
+			}
+			n++
+			return r, true
+		},
+	})
+}
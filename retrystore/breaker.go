@@ -0,0 +1,85 @@
+package retrystore
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by operations failed fast by an open Breaker.
+var ErrCircuitOpen = errors.New("retrystore: circuit breaker open")
+
+// Breaker is a circuit breaker. It opens after Threshold consecutive
+// temporary errors, failing all operations with ErrCircuitOpen. After
+// Cooldown, it lets a single probe operation through: the breaker closes
+// again if the probe doesn't hit a temporary error, and stays open for
+// another Cooldown otherwise.
+//
+// A Breaker may be shared by several datastores, and must not be copied after
+// first use.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// Open returns whether the breaker is open, including while probing.
+func (b *Breaker) Open() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.isOpen()
+}
+
+func (b *Breaker) isOpen() bool {
+	return b.Threshold > 0 && b.failures >= b.Threshold
+}
+
+// allow returns ErrCircuitOpen if an operation must fail fast. Otherwise, it
+// returns whether the operation is the probe of an open breaker, to pass on
+// to record.
+func (b *Breaker) allow() (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.isOpen() {
+		return false, nil
+	}
+	if b.probing || time.Since(b.openedAt) < b.Cooldown {
+		return false, ErrCircuitOpen
+	}
+	b.probing = true
+	return true, nil
+}
+
+// record records the outcome of an operation let through. Only the outcome of
+// the probe closes an open breaker, or keeps it open: operations let through
+// before it opened don't count once it is open.
+func (b *Breaker) record(probe, temporary bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	} else if b.isOpen() {
+		return
+	}
+	if !temporary {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.isOpen() {
+		b.openedAt = time.Now()
+	}
+}
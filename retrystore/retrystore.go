@@ -5,9 +5,12 @@ package retrystore
 import (
 	"context"
 	"fmt"
+	"math"
+	"math/rand/v2"
 	"time"
 
 	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
 )
 
 // Datastore wraps a Batching datastore with a
@@ -16,29 +19,112 @@ import (
 // -which specify how many times to retry an operation after
 // a temporal error- and a base Delay, which is multiplied by the
 // current retry and performs a pause before attempting the operation again.
+//
+// Setting Backoff makes the delays grow exponentially instead, MaxDelay caps
+// them and Jitter randomizes them. Retries stop when the context of the
+// operation is done, or when its deadline would pass before the next attempt.
+//
+// Batch commits are retried by replaying the batch on a new batch of the
+// wrapped datastore. Queries are resumed after a temporary error, from the
+// last key delivered; see Query.
+//
+// Datastore implements every optional feature; use scoped.Inherit to only
+// expose the features the wrapped datastore supports.
 type Datastore struct {
 	TempErrFunc func(error) bool
 	Retries     int
 	Delay       time.Duration
 
+	// Backoff is the factor the delay grows by after each retry. Values up
+	// to 1 keep the delay linear in the number of retries.
+	Backoff float64
+	// MaxDelay caps the delay between retries, if set.
+	MaxDelay time.Duration
+	// Jitter shortens each delay by a random fraction of up to Jitter, so
+	// that clients failing together don't retry together. Values above 1
+	// are treated as 1.
+	Jitter float64
+	// Breaker, if set, fails operations fast after repeated temporary
+	// errors.
+	Breaker *Breaker
+
 	ds.Batching
 }
 
 var _ ds.Datastore = (*Datastore)(nil)
 var _ ds.Batching = (*Datastore)(nil)
 var _ ds.PersistentDatastore = (*Datastore)(nil)
+var _ ds.CheckedDatastore = (*Datastore)(nil)
+var _ ds.ScrubbedDatastore = (*Datastore)(nil)
+var _ ds.GCDatastore = (*Datastore)(nil)
+var _ ds.TTLDatastore = (*Datastore)(nil)
+var _ ds.TxnDatastore = (*Datastore)(nil)
+var _ ds.Shim = (*Datastore)(nil)
+
+// Children implements ds.Shim
+func (d *Datastore) Children() []ds.Datastore {
+	return []ds.Datastore{d.Batching}
+}
+
+// delay returns the pause before retry number i, counting from 0.
+func (d *Datastore) delay(i int) time.Duration {
+	var delay time.Duration
+	if d.Backoff > 1 {
+		delay = time.Duration(float64(d.Delay) * math.Pow(d.Backoff, float64(i)))
+	} else {
+		delay = time.Duration(i+1) * d.Delay
+	}
+	if d.MaxDelay > 0 && (delay > d.MaxDelay || delay < 0) {
+		delay = d.MaxDelay
+	}
+	if d.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * min(d.Jitter, 1) * float64(delay))
+	}
+	return delay
+}
+
+// wait pauses before retry number i after err, returning an error if ctx is
+// done first.
+func (d *Datastore) wait(ctx context.Context, i int, err error) error {
+	delay := d.delay(i)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return fmt.Errorf("deadline too close to retry temporary error: %w: %w", context.DeadlineExceeded, err)
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("stopped retrying temporary error: %w: %w", ctx.Err(), err)
+	}
+}
+
+// attempt runs op once, through the breaker.
+func (d *Datastore) attempt(op func() error) (temporary bool, err error) {
+	probe, err := d.Breaker.allow()
+	if err != nil {
+		return false, err
+	}
+	err = op()
+	temporary = err != nil && d.TempErrFunc(err)
+	d.Breaker.record(probe, temporary)
+	return temporary, err
+}
 
-func (d *Datastore) runOp(op func() error) error {
-	err := op()
-	if err == nil || !d.TempErrFunc(err) {
+func (d *Datastore) runOp(ctx context.Context, op func() error) error {
+	temporary, err := d.attempt(op)
+	if !temporary {
 		return err
 	}
 
 	for i := 0; i < d.Retries; i++ {
-		time.Sleep(time.Duration(i+1) * d.Delay)
+		if werr := d.wait(ctx, i, err); werr != nil {
+			return werr
+		}
 
-		err = op()
-		if err == nil || !d.TempErrFunc(err) {
+		temporary, err = d.attempt(op)
+		if !temporary {
 			return err
 		}
 	}
@@ -49,7 +135,7 @@ func (d *Datastore) runOp(op func() error) error {
 // DiskUsage implements the PersistentDatastore interface.
 func (d *Datastore) DiskUsage(ctx context.Context) (uint64, error) {
 	var size uint64
-	err := d.runOp(func() error {
+	err := d.runOp(ctx, func() error {
 		var err error
 		size, err = ds.DiskUsage(ctx, d.Batching)
 		return err
@@ -60,7 +146,7 @@ func (d *Datastore) DiskUsage(ctx context.Context) (uint64, error) {
 // Get retrieves a value given a key.
 func (d *Datastore) Get(ctx context.Context, k ds.Key) ([]byte, error) {
 	var val []byte
-	err := d.runOp(func() error {
+	err := d.runOp(ctx, func() error {
 		var err error
 		val, err = d.Batching.Get(ctx, k)
 		return err
@@ -71,14 +157,14 @@ func (d *Datastore) Get(ctx context.Context, k ds.Key) ([]byte, error) {
 
 // Put stores a key/value.
 func (d *Datastore) Put(ctx context.Context, k ds.Key, val []byte) error {
-	return d.runOp(func() error {
+	return d.runOp(ctx, func() error {
 		return d.Batching.Put(ctx, k, val)
 	})
 }
 
 // Sync implements Datastore.Sync
 func (d *Datastore) Sync(ctx context.Context, prefix ds.Key) error {
-	return d.runOp(func() error {
+	return d.runOp(ctx, func() error {
 		return d.Batching.Sync(ctx, prefix)
 	})
 }
@@ -86,7 +172,7 @@ func (d *Datastore) Sync(ctx context.Context, prefix ds.Key) error {
 // Has checks if a key is stored.
 func (d *Datastore) Has(ctx context.Context, k ds.Key) (bool, error) {
 	var has bool
-	err := d.runOp(func() error {
+	err := d.runOp(ctx, func() error {
 		var err error
 		has, err = d.Batching.Has(ctx, k)
 		return err
@@ -97,10 +183,284 @@ func (d *Datastore) Has(ctx context.Context, k ds.Key) (bool, error) {
 // GetSize returns the size of the value in the datastore, if present.
 func (d *Datastore) GetSize(ctx context.Context, k ds.Key) (int, error) {
 	var size int
-	err := d.runOp(func() error {
+	err := d.runOp(ctx, func() error {
 		var err error
 		size, err = d.Batching.GetSize(ctx, k)
 		return err
 	})
 	return size, err
 }
+
+// Check implements the CheckedDatastore interface.
+func (d *Datastore) Check(ctx context.Context) error {
+	c, ok := d.Batching.(ds.CheckedDatastore)
+	if !ok {
+		return nil
+	}
+	return d.runOp(ctx, func() error {
+		return c.Check(ctx)
+	})
+}
+
+// Scrub implements the ScrubbedDatastore interface.
+func (d *Datastore) Scrub(ctx context.Context) error {
+	c, ok := d.Batching.(ds.ScrubbedDatastore)
+	if !ok {
+		return nil
+	}
+	return d.runOp(ctx, func() error {
+		return c.Scrub(ctx)
+	})
+}
+
+// CollectGarbage implements the GCDatastore interface.
+func (d *Datastore) CollectGarbage(ctx context.Context) error {
+	c, ok := d.Batching.(ds.GCDatastore)
+	if !ok {
+		return nil
+	}
+	return d.runOp(ctx, func() error {
+		return c.CollectGarbage(ctx)
+	})
+}
+
+// PutWithTTL stores a key/value that expires after the given ttl.
+func (d *Datastore) PutWithTTL(ctx context.Context, k ds.Key, val []byte, ttl time.Duration) error {
+	tds, ok := d.Batching.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	return d.runOp(ctx, func() error {
+		return tds.PutWithTTL(ctx, k, val, ttl)
+	})
+}
+
+// SetTTL sets the time-to-live of a key.
+func (d *Datastore) SetTTL(ctx context.Context, k ds.Key, ttl time.Duration) error {
+	tds, ok := d.Batching.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	return d.runOp(ctx, func() error {
+		return tds.SetTTL(ctx, k, ttl)
+	})
+}
+
+// GetExpiration returns the expiration time of a key.
+func (d *Datastore) GetExpiration(ctx context.Context, k ds.Key) (time.Time, error) {
+	tds, ok := d.Batching.(ds.TTLDatastore)
+	if !ok {
+		return time.Time{}, ds.ErrTTLUnsupported
+	}
+	var exp time.Time
+	err := d.runOp(ctx, func() error {
+		var err error
+		exp, err = tds.GetExpiration(ctx, k)
+		return err
+	})
+	return exp, err
+}
+
+// NewTransaction starts a transaction. Only starting the transaction is
+// retried: operations on the transaction are not, as a failed commit may need
+// the whole transaction to be redone.
+func (d *Datastore) NewTransaction(ctx context.Context, readOnly bool) (ds.Txn, error) {
+	tds, ok := d.Batching.(ds.TxnDatastore)
+	if !ok {
+		return nil, ds.ErrTxnUnsupported
+	}
+	var txn ds.Txn
+	err := d.runOp(ctx, func() error {
+		var err error
+		txn, err = tds.NewTransaction(ctx, readOnly)
+		return err
+	})
+	return txn, err
+}
+
+// Query starts a query, retrying to start it after temporary errors.
+//
+// Queries without orders, or ordered by key only, are also resumed after a
+// temporary error in their results: the query is started again for the keys
+// after the last one delivered. Queries without orders are therefore sent to
+// the wrapped datastore ordered by key. Other queries return errors in their
+// results as they are.
+func (d *Datastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	resumable := len(q.Orders) == 0 || (len(q.Orders) == 1 && q.Orders[0] == dsq.Order(dsq.OrderByKey{}))
+	if resumable {
+		q.Orders = []dsq.Order{dsq.OrderByKey{}}
+	}
+
+	var res dsq.Results
+	err := d.runOp(ctx, func() error {
+		var err error
+		res, err = d.Batching.Query(ctx, q)
+		return err
+	})
+	if err != nil || !resumable {
+		return res, err
+	}
+
+	r := &resumingResults{d: d, ctx: ctx, q: q, res: res}
+	return dsq.ResultsFromIterator(q, dsq.Iterator{Next: r.next, Close: r.close}), nil
+}
+
+// resumingResults resumes a query ordered by key after temporary errors.
+type resumingResults struct {
+	d   *Datastore
+	ctx context.Context
+	q   dsq.Query
+	res dsq.Results
+
+	last      string
+	delivered int
+	retries   int
+	// done is set once resuming failed, ending the results.
+	done bool
+}
+
+func (r *resumingResults) next() (dsq.Result, bool) {
+	for {
+		if r.done {
+			return dsq.Result{}, false
+		}
+		res, ok := r.res.NextSync()
+		if !ok {
+			return res, false
+		}
+		if res.Error == nil {
+			r.last = res.Key
+			r.delivered++
+			r.retries = 0
+			return res, true
+		}
+		if !r.d.TempErrFunc(res.Error) {
+			return res, true
+		}
+		if r.q.Limit > 0 && r.delivered >= r.q.Limit {
+			return dsq.Result{}, false
+		}
+		if err := r.resume(res.Error); err != nil {
+			r.done = true
+			r.close()
+			return dsq.Result{Error: err}, true
+		}
+	}
+}
+
+// resume restarts the query after the last key delivered.
+func (r *resumingResults) resume(err error) error {
+	r.d.Breaker.record(false, true)
+	if r.retries >= r.d.Retries {
+		return fmt.Errorf("ran out of retries trying to get past temporary error: %w", err)
+	}
+	if werr := r.d.wait(r.ctx, r.retries, err); werr != nil {
+		return werr
+	}
+	r.retries++
+
+	q := r.q
+	if r.delivered > 0 {
+		q.Filters = append(append([]dsq.Filter{}, q.Filters...), dsq.FilterKeyCompare{Op: dsq.GreaterThan, Key: r.last})
+		q.Offset = 0
+		if q.Limit > 0 {
+			q.Limit -= r.delivered
+		}
+	}
+	r.close()
+	return r.d.runOp(r.ctx, func() error {
+		var err error
+		r.res, err = r.d.Batching.Query(r.ctx, q)
+		return err
+	})
+}
+
+func (r *resumingResults) close() error {
+	if r.res == nil {
+		return nil
+	}
+	err := r.res.Close()
+	r.res = nil
+	return err
+}
+
+// Batch returns a batch whose commit is retried after temporary errors, by
+// replaying it on a new batch of the wrapped datastore.
+func (d *Datastore) Batch(ctx context.Context) (ds.Batch, error) {
+	var b ds.Batch
+	err := d.runOp(ctx, func() error {
+		var err error
+		b, err = d.Batching.Batch(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &batch{d: d, b: b}, nil
+}
+
+type batchOp struct {
+	key    ds.Key
+	value  []byte
+	delete bool
+}
+
+type batch struct {
+	d   *Datastore
+	b   ds.Batch
+	ops []batchOp
+}
+
+func (b *batch) Put(ctx context.Context, key ds.Key, value []byte) error {
+	if err := b.b.Put(ctx, key, value); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, batchOp{key: key, value: value})
+	return nil
+}
+
+func (b *batch) Delete(ctx context.Context, key ds.Key) error {
+	if err := b.b.Delete(ctx, key); err != nil {
+		return err
+	}
+	b.ops = append(b.ops, batchOp{key: key, delete: true})
+	return nil
+}
+
+func (b *batch) Commit(ctx context.Context) error {
+	retry := false
+	err := b.d.runOp(ctx, func() error {
+		if retry {
+			if err := b.replay(ctx); err != nil {
+				return err
+			}
+		}
+		retry = true
+		return b.b.Commit(ctx)
+	})
+	if err == nil {
+		b.ops = nil
+	}
+	return err
+}
+
+// replay replaces the wrapped batch with a new one holding the same
+// operations.
+func (b *batch) replay(ctx context.Context) error {
+	nb, err := b.d.Batching.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for _, op := range b.ops {
+		if op.delete {
+			err = nb.Delete(ctx, op.key)
+		} else {
+			err = nb.Put(ctx, op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	b.b = nb
+	return nil
+}
@@ -2,12 +2,16 @@ package retrystore
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	ds "github.com/ipfs/go-datastore"
 	failstore "github.com/ipfs/go-datastore/failstore"
+	dsq "github.com/ipfs/go-datastore/query"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRetryFailure(t *testing.T) {
@@ -155,3 +159,240 @@ func TestSuccessAfterTemp(t *testing.T) {
 		t.Fatal("got wrong value")
 	}
 }
+
+func TestRetryHonorsContext(t *testing.T) {
+	tempErr := errors.New("temp")
+	rds := &Datastore{
+		Batching: failstore.NewFailstore(ds.NewMapDatastore(), func(string) error {
+			return tempErr
+		}),
+		Retries:     5,
+		Delay:       time.Hour,
+		TempErrFunc: func(err error) bool { return err == tempErr },
+	}
+
+	// Retries that can't finish before the deadline aren't attempted.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err := rds.Get(ctx, ds.NewKey("/a"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorIs(t, err, tempErr)
+
+	// Retries stop when the context is canceled.
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = rds.Get(ctx, ds.NewKey("/a"))
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), time.Minute)
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Datastore{Delay: 10 * time.Millisecond}
+	for i, want := range []time.Duration{10, 20, 30} {
+		require.Equal(t, want*time.Millisecond, d.delay(i))
+	}
+
+	d = &Datastore{Delay: 10 * time.Millisecond, Backoff: 2, MaxDelay: 50 * time.Millisecond}
+	for i, want := range []time.Duration{10, 20, 40, 50, 50} {
+		require.Equal(t, want*time.Millisecond, d.delay(i))
+	}
+
+	d.Jitter = 0.5
+	for i, max := range []time.Duration{10, 20, 40, 50, 50} {
+		delay := d.delay(i)
+		require.LessOrEqual(t, delay, max*time.Millisecond)
+		require.GreaterOrEqual(t, delay, max*time.Millisecond/2)
+	}
+
+	// Jitter above 1 doesn't make delays negative.
+	d.Jitter = 3
+	for i := range 100 {
+		require.GreaterOrEqual(t, d.delay(i%5), time.Duration(0))
+	}
+}
+
+func TestRetryBatchCommit(t *testing.T) {
+	ctx := context.Background()
+	tempErr := errors.New("temp")
+	child := ds.NewMapDatastore()
+	rds := &Datastore{
+		Batching:    failstore.NewRuleFailstore(child, 1, failstore.Rule{Op: "batch-commit", Nth: 1, Err: tempErr}),
+		Retries:     2,
+		TempErrFunc: func(err error) bool { return err == tempErr },
+	}
+
+	b, err := rds.Batch(ctx)
+	require.NoError(t, err)
+	require.NoError(t, b.Put(ctx, ds.NewKey("/a"), []byte("a")))
+	require.NoError(t, b.Delete(ctx, ds.NewKey("/b")))
+	require.NoError(t, b.Commit(ctx))
+
+	v, err := child.Get(ctx, ds.NewKey("/a"))
+	require.NoError(t, err)
+	require.Equal(t, "a", string(v))
+}
+
+func TestQueryResume(t *testing.T) {
+	ctx := context.Background()
+	tempErr := errors.New("temp")
+	child := ds.NewMapDatastore()
+	var keys []string
+	for i := range 10 {
+		key := fmt.Sprintf("/k%d", i)
+		keys = append(keys, key)
+		require.NoError(t, child.Put(ctx, ds.NewKey(key), []byte(key)))
+	}
+
+	for _, c := range []struct {
+		name string
+		q    dsq.Query
+		want []string
+	}{
+		{name: "all", q: dsq.Query{}, want: keys},
+		{name: "limit", q: dsq.Query{Limit: 6}, want: keys[:6]},
+		{name: "offset", q: dsq.Query{Offset: 1, Orders: []dsq.Order{dsq.OrderByKey{}}}, want: keys[1:]},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			rds := &Datastore{
+				// The query fails after 3 results, then right away, then after 2.
+				Batching: failstore.NewRuleFailstore(child, 1,
+					failstore.Rule{Op: "query", Nth: 1, Partial: true, After: 3, Err: tempErr},
+					failstore.Rule{Op: "query", Nth: 2, Partial: true, After: 0, Err: tempErr},
+					failstore.Rule{Op: "query", Nth: 3, Partial: true, After: 2, Err: tempErr},
+				),
+				Retries:     2,
+				TempErrFunc: func(err error) bool { return err == tempErr },
+			}
+			res, err := rds.Query(ctx, c.q)
+			require.NoError(t, err)
+			entries, err := res.Rest()
+			require.NoError(t, err)
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Key)
+			}
+			require.Equal(t, c.want, got)
+		})
+	}
+
+	// Queries in other orders aren't resumed.
+	rds := &Datastore{
+		Batching:    failstore.NewRuleFailstore(child, 1, failstore.Rule{Op: "query", Partial: true, After: 3, Err: tempErr}),
+		Retries:     2,
+		TempErrFunc: func(err error) bool { return err == tempErr },
+	}
+	res, err := rds.Query(ctx, dsq.Query{Orders: []dsq.Order{dsq.OrderByKeyDescending{}}})
+	require.NoError(t, err)
+	_, err = res.Rest()
+	require.ErrorIs(t, err, tempErr)
+}
+
+func TestQueryResumeFails(t *testing.T) {
+	ctx := context.Background()
+	tempErr := errors.New("temp")
+	permErr := errors.New("perm")
+	child := ds.NewMapDatastore()
+	for i := range 10 {
+		require.NoError(t, child.Put(ctx, ds.NewKey(fmt.Sprintf("/k%d", i)), nil))
+	}
+	rds := &Datastore{
+		// The query fails after 3 results, and resuming it fails.
+		Batching: failstore.NewRuleFailstore(child, 1,
+			failstore.Rule{Op: "query", Nth: 1, Partial: true, After: 3, Err: tempErr},
+			failstore.Rule{Op: "query", Nth: 2, Err: permErr},
+		),
+		Retries:     2,
+		TempErrFunc: func(err error) bool { return err == tempErr },
+	}
+	res, err := rds.Query(ctx, dsq.Query{})
+	require.NoError(t, err)
+
+	// The results end with the error, also through the channel of Next.
+	var errs []error
+	n := 0
+	for r := range res.Next() {
+		if r.Error != nil {
+			errs = append(errs, r.Error)
+			continue
+		}
+		n++
+	}
+	require.Equal(t, 3, n)
+	require.Len(t, errs, 1)
+	require.ErrorIs(t, errs[0], permErr)
+	require.NoError(t, res.Close())
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	tempErr := errors.New("temp")
+	var calls int
+	failing := true
+	rds := &Datastore{
+		Batching: failstore.NewFailstore(ds.NewMapDatastore(), func(string) error {
+			calls++
+			if failing {
+				return tempErr
+			}
+			return nil
+		}),
+		Retries:     1,
+		TempErrFunc: func(err error) bool { return err == tempErr },
+		Breaker:     &Breaker{Threshold: 3, Cooldown: 20 * time.Millisecond},
+	}
+
+	_, err := rds.Has(ctx, ds.NewKey("/a"))
+	require.ErrorIs(t, err, tempErr)
+	require.False(t, rds.Breaker.Open())
+	_, err = rds.Has(ctx, ds.NewKey("/a"))
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.True(t, rds.Breaker.Open())
+	require.Equal(t, 3, calls)
+
+	// Fails fast while open.
+	_, err = rds.Has(ctx, ds.NewKey("/a"))
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, 3, calls)
+
+	// A failed probe keeps it open.
+	time.Sleep(30 * time.Millisecond)
+	_, err = rds.Has(ctx, ds.NewKey("/a"))
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, 4, calls)
+	require.True(t, rds.Breaker.Open())
+
+	// A successful probe closes it.
+	failing = false
+	time.Sleep(30 * time.Millisecond)
+	_, err = rds.Has(ctx, ds.NewKey("/a"))
+	require.NoError(t, err)
+	require.False(t, rds.Breaker.Open())
+}
+
+func TestBreakerLateOutcomes(t *testing.T) {
+	b := &Breaker{Threshold: 1, Cooldown: time.Hour}
+
+	// An operation let through while closed succeeds after another one
+	// opened the breaker: it stays open.
+	late, err := b.allow()
+	require.NoError(t, err)
+	require.False(t, late)
+	probe, err := b.allow()
+	require.NoError(t, err)
+	b.record(probe, true)
+	require.True(t, b.Open())
+	b.record(late, false)
+	require.True(t, b.Open())
+
+	// Only the probe's outcome ends the probe.
+	b.Cooldown = 0
+	probe, err = b.allow()
+	require.NoError(t, err)
+	require.True(t, probe)
+	b.record(false, false)
+	_, err = b.allow()
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	b.record(probe, false)
+	require.False(t, b.Open())
+}
@@ -20,6 +20,7 @@ package scoped
 
 import (
 	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
 )
 
 {{ range $idx, $features := .StructFeatures -}}
@@ -32,6 +33,9 @@ type ds{{ $idx }} struct {
 func (d *ds{{ $idx }}) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds{{ $idx }}) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 {{ end }}
 var ctors = map[uint]func(ds.Datastore) ds.Datastore{
 	{{- range $idx, $features := .StructFeatures }}
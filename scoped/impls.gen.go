@@ -4,6 +4,7 @@ package scoped
 
 import (
 	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
 )
 
 type ds0 struct {
@@ -13,6 +14,9 @@ type ds0 struct {
 func (d *ds0) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds0) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds1 struct {
 	ds.Datastore
@@ -22,6 +26,9 @@ type ds1 struct {
 func (d *ds1) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds1) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds2 struct {
 	ds.Datastore
@@ -31,6 +38,9 @@ type ds2 struct {
 func (d *ds2) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds2) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds3 struct {
 	ds.Datastore
@@ -41,6 +51,9 @@ type ds3 struct {
 func (d *ds3) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds3) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds4 struct {
 	ds.Datastore
@@ -50,6 +63,9 @@ type ds4 struct {
 func (d *ds4) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds4) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds5 struct {
 	ds.Datastore
@@ -60,6 +76,9 @@ type ds5 struct {
 func (d *ds5) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds5) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds6 struct {
 	ds.Datastore
@@ -70,6 +89,9 @@ type ds6 struct {
 func (d *ds6) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds6) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds7 struct {
 	ds.Datastore
@@ -81,6 +103,9 @@ type ds7 struct {
 func (d *ds7) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds7) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds8 struct {
 	ds.Datastore
@@ -90,6 +115,9 @@ type ds8 struct {
 func (d *ds8) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds8) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds9 struct {
 	ds.Datastore
@@ -100,6 +128,9 @@ type ds9 struct {
 func (d *ds9) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds9) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds10 struct {
 	ds.Datastore
@@ -110,6 +141,9 @@ type ds10 struct {
 func (d *ds10) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds10) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds11 struct {
 	ds.Datastore
@@ -121,6 +155,9 @@ type ds11 struct {
 func (d *ds11) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds11) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds12 struct {
 	ds.Datastore
@@ -131,6 +168,9 @@ type ds12 struct {
 func (d *ds12) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds12) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds13 struct {
 	ds.Datastore
@@ -142,6 +182,9 @@ type ds13 struct {
 func (d *ds13) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds13) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds14 struct {
 	ds.Datastore
@@ -153,6 +196,9 @@ type ds14 struct {
 func (d *ds14) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds14) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds15 struct {
 	ds.Datastore
@@ -165,6 +211,9 @@ type ds15 struct {
 func (d *ds15) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds15) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds16 struct {
 	ds.Datastore
@@ -174,6 +223,9 @@ type ds16 struct {
 func (d *ds16) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds16) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds17 struct {
 	ds.Datastore
@@ -184,6 +236,9 @@ type ds17 struct {
 func (d *ds17) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds17) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds18 struct {
 	ds.Datastore
@@ -194,6 +249,9 @@ type ds18 struct {
 func (d *ds18) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds18) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds19 struct {
 	ds.Datastore
@@ -205,6 +263,9 @@ type ds19 struct {
 func (d *ds19) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds19) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds20 struct {
 	ds.Datastore
@@ -215,6 +276,9 @@ type ds20 struct {
 func (d *ds20) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds20) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds21 struct {
 	ds.Datastore
@@ -226,6 +290,9 @@ type ds21 struct {
 func (d *ds21) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds21) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds22 struct {
 	ds.Datastore
@@ -237,6 +304,9 @@ type ds22 struct {
 func (d *ds22) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds22) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds23 struct {
 	ds.Datastore
@@ -249,6 +319,9 @@ type ds23 struct {
 func (d *ds23) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds23) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds24 struct {
 	ds.Datastore
@@ -259,6 +332,9 @@ type ds24 struct {
 func (d *ds24) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds24) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds25 struct {
 	ds.Datastore
@@ -270,6 +346,9 @@ type ds25 struct {
 func (d *ds25) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds25) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds26 struct {
 	ds.Datastore
@@ -281,6 +360,9 @@ type ds26 struct {
 func (d *ds26) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds26) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds27 struct {
 	ds.Datastore
@@ -293,6 +375,9 @@ type ds27 struct {
 func (d *ds27) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds27) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds28 struct {
 	ds.Datastore
@@ -304,6 +389,9 @@ type ds28 struct {
 func (d *ds28) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds28) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds29 struct {
 	ds.Datastore
@@ -316,6 +404,9 @@ type ds29 struct {
 func (d *ds29) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds29) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds30 struct {
 	ds.Datastore
@@ -328,6 +419,9 @@ type ds30 struct {
 func (d *ds30) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds30) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds31 struct {
 	ds.Datastore
@@ -341,6 +435,9 @@ type ds31 struct {
 func (d *ds31) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds31) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds32 struct {
 	ds.Datastore
@@ -350,6 +447,9 @@ type ds32 struct {
 func (d *ds32) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds32) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds33 struct {
 	ds.Datastore
@@ -360,6 +460,9 @@ type ds33 struct {
 func (d *ds33) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds33) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds34 struct {
 	ds.Datastore
@@ -370,6 +473,9 @@ type ds34 struct {
 func (d *ds34) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds34) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds35 struct {
 	ds.Datastore
@@ -381,6 +487,9 @@ type ds35 struct {
 func (d *ds35) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds35) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds36 struct {
 	ds.Datastore
@@ -391,6 +500,9 @@ type ds36 struct {
 func (d *ds36) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds36) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds37 struct {
 	ds.Datastore
@@ -402,6 +514,9 @@ type ds37 struct {
 func (d *ds37) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds37) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds38 struct {
 	ds.Datastore
@@ -413,6 +528,9 @@ type ds38 struct {
 func (d *ds38) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds38) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds39 struct {
 	ds.Datastore
@@ -425,6 +543,9 @@ type ds39 struct {
 func (d *ds39) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds39) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds40 struct {
 	ds.Datastore
@@ -435,6 +556,9 @@ type ds40 struct {
 func (d *ds40) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds40) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds41 struct {
 	ds.Datastore
@@ -446,6 +570,9 @@ type ds41 struct {
 func (d *ds41) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds41) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds42 struct {
 	ds.Datastore
@@ -457,6 +584,9 @@ type ds42 struct {
 func (d *ds42) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds42) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds43 struct {
 	ds.Datastore
@@ -469,6 +599,9 @@ type ds43 struct {
 func (d *ds43) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds43) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds44 struct {
 	ds.Datastore
@@ -480,6 +613,9 @@ type ds44 struct {
 func (d *ds44) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds44) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds45 struct {
 	ds.Datastore
@@ -492,6 +628,9 @@ type ds45 struct {
 func (d *ds45) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds45) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds46 struct {
 	ds.Datastore
@@ -504,6 +643,9 @@ type ds46 struct {
 func (d *ds46) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds46) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds47 struct {
 	ds.Datastore
@@ -517,6 +659,9 @@ type ds47 struct {
 func (d *ds47) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds47) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds48 struct {
 	ds.Datastore
@@ -527,6 +672,9 @@ type ds48 struct {
 func (d *ds48) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds48) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds49 struct {
 	ds.Datastore
@@ -538,6 +686,9 @@ type ds49 struct {
 func (d *ds49) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds49) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds50 struct {
 	ds.Datastore
@@ -549,6 +700,9 @@ type ds50 struct {
 func (d *ds50) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds50) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds51 struct {
 	ds.Datastore
@@ -561,6 +715,9 @@ type ds51 struct {
 func (d *ds51) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds51) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds52 struct {
 	ds.Datastore
@@ -572,6 +729,9 @@ type ds52 struct {
 func (d *ds52) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds52) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds53 struct {
 	ds.Datastore
@@ -584,6 +744,9 @@ type ds53 struct {
 func (d *ds53) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds53) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds54 struct {
 	ds.Datastore
@@ -596,6 +759,9 @@ type ds54 struct {
 func (d *ds54) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds54) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds55 struct {
 	ds.Datastore
@@ -609,6 +775,9 @@ type ds55 struct {
 func (d *ds55) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds55) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds56 struct {
 	ds.Datastore
@@ -620,6 +789,9 @@ type ds56 struct {
 func (d *ds56) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds56) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds57 struct {
 	ds.Datastore
@@ -632,6 +804,9 @@ type ds57 struct {
 func (d *ds57) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds57) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds58 struct {
 	ds.Datastore
@@ -644,6 +819,9 @@ type ds58 struct {
 func (d *ds58) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds58) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds59 struct {
 	ds.Datastore
@@ -657,6 +835,9 @@ type ds59 struct {
 func (d *ds59) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds59) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds60 struct {
 	ds.Datastore
@@ -669,6 +850,9 @@ type ds60 struct {
 func (d *ds60) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds60) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds61 struct {
 	ds.Datastore
@@ -682,6 +866,9 @@ type ds61 struct {
 func (d *ds61) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds61) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds62 struct {
 	ds.Datastore
@@ -695,6 +882,9 @@ type ds62 struct {
 func (d *ds62) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds62) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds63 struct {
 	ds.Datastore
@@ -709,6 +899,9 @@ type ds63 struct {
 func (d *ds63) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds63) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds64 struct {
 	ds.Datastore
@@ -718,6 +911,9 @@ type ds64 struct {
 func (d *ds64) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds64) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds65 struct {
 	ds.Datastore
@@ -728,6 +924,9 @@ type ds65 struct {
 func (d *ds65) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds65) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds66 struct {
 	ds.Datastore
@@ -738,6 +937,9 @@ type ds66 struct {
 func (d *ds66) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds66) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds67 struct {
 	ds.Datastore
@@ -749,6 +951,9 @@ type ds67 struct {
 func (d *ds67) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds67) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds68 struct {
 	ds.Datastore
@@ -759,6 +964,9 @@ type ds68 struct {
 func (d *ds68) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds68) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds69 struct {
 	ds.Datastore
@@ -770,6 +978,9 @@ type ds69 struct {
 func (d *ds69) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds69) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds70 struct {
 	ds.Datastore
@@ -781,6 +992,9 @@ type ds70 struct {
 func (d *ds70) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds70) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds71 struct {
 	ds.Datastore
@@ -793,6 +1007,9 @@ type ds71 struct {
 func (d *ds71) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds71) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds72 struct {
 	ds.Datastore
@@ -803,6 +1020,9 @@ type ds72 struct {
 func (d *ds72) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds72) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds73 struct {
 	ds.Datastore
@@ -814,6 +1034,9 @@ type ds73 struct {
 func (d *ds73) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds73) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds74 struct {
 	ds.Datastore
@@ -825,6 +1048,9 @@ type ds74 struct {
 func (d *ds74) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds74) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds75 struct {
 	ds.Datastore
@@ -837,6 +1063,9 @@ type ds75 struct {
 func (d *ds75) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds75) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds76 struct {
 	ds.Datastore
@@ -848,6 +1077,9 @@ type ds76 struct {
 func (d *ds76) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds76) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds77 struct {
 	ds.Datastore
@@ -860,6 +1092,9 @@ type ds77 struct {
 func (d *ds77) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds77) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds78 struct {
 	ds.Datastore
@@ -872,6 +1107,9 @@ type ds78 struct {
 func (d *ds78) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds78) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds79 struct {
 	ds.Datastore
@@ -885,6 +1123,9 @@ type ds79 struct {
 func (d *ds79) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds79) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds80 struct {
 	ds.Datastore
@@ -895,6 +1136,9 @@ type ds80 struct {
 func (d *ds80) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds80) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds81 struct {
 	ds.Datastore
@@ -906,6 +1150,9 @@ type ds81 struct {
 func (d *ds81) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds81) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds82 struct {
 	ds.Datastore
@@ -917,6 +1164,9 @@ type ds82 struct {
 func (d *ds82) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds82) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds83 struct {
 	ds.Datastore
@@ -929,6 +1179,9 @@ type ds83 struct {
 func (d *ds83) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds83) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds84 struct {
 	ds.Datastore
@@ -940,6 +1193,9 @@ type ds84 struct {
 func (d *ds84) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds84) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds85 struct {
 	ds.Datastore
@@ -952,6 +1208,9 @@ type ds85 struct {
 func (d *ds85) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds85) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds86 struct {
 	ds.Datastore
@@ -964,6 +1223,9 @@ type ds86 struct {
 func (d *ds86) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds86) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds87 struct {
 	ds.Datastore
@@ -977,6 +1239,9 @@ type ds87 struct {
 func (d *ds87) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds87) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds88 struct {
 	ds.Datastore
@@ -988,6 +1253,9 @@ type ds88 struct {
 func (d *ds88) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds88) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds89 struct {
 	ds.Datastore
@@ -1000,6 +1268,9 @@ type ds89 struct {
 func (d *ds89) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds89) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds90 struct {
 	ds.Datastore
@@ -1012,6 +1283,9 @@ type ds90 struct {
 func (d *ds90) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds90) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds91 struct {
 	ds.Datastore
@@ -1025,6 +1299,9 @@ type ds91 struct {
 func (d *ds91) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds91) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds92 struct {
 	ds.Datastore
@@ -1037,6 +1314,9 @@ type ds92 struct {
 func (d *ds92) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds92) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds93 struct {
 	ds.Datastore
@@ -1050,6 +1330,9 @@ type ds93 struct {
 func (d *ds93) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds93) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds94 struct {
 	ds.Datastore
@@ -1063,6 +1346,9 @@ type ds94 struct {
 func (d *ds94) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds94) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds95 struct {
 	ds.Datastore
@@ -1077,6 +1363,9 @@ type ds95 struct {
 func (d *ds95) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds95) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds96 struct {
 	ds.Datastore
@@ -1087,6 +1376,9 @@ type ds96 struct {
 func (d *ds96) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds96) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds97 struct {
 	ds.Datastore
@@ -1098,6 +1390,9 @@ type ds97 struct {
 func (d *ds97) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds97) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds98 struct {
 	ds.Datastore
@@ -1109,6 +1404,9 @@ type ds98 struct {
 func (d *ds98) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds98) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds99 struct {
 	ds.Datastore
@@ -1121,6 +1419,9 @@ type ds99 struct {
 func (d *ds99) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds99) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds100 struct {
 	ds.Datastore
@@ -1132,6 +1433,9 @@ type ds100 struct {
 func (d *ds100) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds100) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds101 struct {
 	ds.Datastore
@@ -1144,6 +1448,9 @@ type ds101 struct {
 func (d *ds101) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds101) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds102 struct {
 	ds.Datastore
@@ -1156,6 +1463,9 @@ type ds102 struct {
 func (d *ds102) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds102) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds103 struct {
 	ds.Datastore
@@ -1169,6 +1479,9 @@ type ds103 struct {
 func (d *ds103) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds103) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds104 struct {
 	ds.Datastore
@@ -1180,6 +1493,9 @@ type ds104 struct {
 func (d *ds104) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds104) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds105 struct {
 	ds.Datastore
@@ -1192,6 +1508,9 @@ type ds105 struct {
 func (d *ds105) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds105) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds106 struct {
 	ds.Datastore
@@ -1204,6 +1523,9 @@ type ds106 struct {
 func (d *ds106) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds106) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds107 struct {
 	ds.Datastore
@@ -1217,6 +1539,9 @@ type ds107 struct {
 func (d *ds107) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds107) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds108 struct {
 	ds.Datastore
@@ -1229,6 +1554,9 @@ type ds108 struct {
 func (d *ds108) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds108) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds109 struct {
 	ds.Datastore
@@ -1242,6 +1570,9 @@ type ds109 struct {
 func (d *ds109) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds109) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds110 struct {
 	ds.Datastore
@@ -1255,6 +1586,9 @@ type ds110 struct {
 func (d *ds110) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds110) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds111 struct {
 	ds.Datastore
@@ -1269,6 +1603,9 @@ type ds111 struct {
 func (d *ds111) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds111) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds112 struct {
 	ds.Datastore
@@ -1280,6 +1617,9 @@ type ds112 struct {
 func (d *ds112) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds112) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds113 struct {
 	ds.Datastore
@@ -1292,6 +1632,9 @@ type ds113 struct {
 func (d *ds113) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds113) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds114 struct {
 	ds.Datastore
@@ -1304,6 +1647,9 @@ type ds114 struct {
 func (d *ds114) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds114) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds115 struct {
 	ds.Datastore
@@ -1317,6 +1663,9 @@ type ds115 struct {
 func (d *ds115) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds115) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds116 struct {
 	ds.Datastore
@@ -1329,6 +1678,9 @@ type ds116 struct {
 func (d *ds116) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds116) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds117 struct {
 	ds.Datastore
@@ -1342,6 +1694,9 @@ type ds117 struct {
 func (d *ds117) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds117) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds118 struct {
 	ds.Datastore
@@ -1355,6 +1710,9 @@ type ds118 struct {
 func (d *ds118) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds118) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds119 struct {
 	ds.Datastore
@@ -1369,6 +1727,9 @@ type ds119 struct {
 func (d *ds119) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds119) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds120 struct {
 	ds.Datastore
@@ -1381,6 +1742,9 @@ type ds120 struct {
 func (d *ds120) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds120) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds121 struct {
 	ds.Datastore
@@ -1394,6 +1758,9 @@ type ds121 struct {
 func (d *ds121) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds121) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds122 struct {
 	ds.Datastore
@@ -1407,6 +1774,9 @@ type ds122 struct {
 func (d *ds122) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds122) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds123 struct {
 	ds.Datastore
@@ -1421,6 +1791,9 @@ type ds123 struct {
 func (d *ds123) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds123) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds124 struct {
 	ds.Datastore
@@ -1434,6 +1807,9 @@ type ds124 struct {
 func (d *ds124) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds124) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds125 struct {
 	ds.Datastore
@@ -1448,6 +1824,9 @@ type ds125 struct {
 func (d *ds125) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds125) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds126 struct {
 	ds.Datastore
@@ -1462,6 +1841,9 @@ type ds126 struct {
 func (d *ds126) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds126) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 type ds127 struct {
 	ds.Datastore
@@ -1477,6 +1859,9 @@ type ds127 struct {
 func (d *ds127) Children() []ds.Datastore {
 	return []ds.Datastore{d.Datastore}
 }
+func (d *ds127) ExplainQuery(q query.Query) query.Explain {
+	return ds.Explain(d.Datastore, q)
+}
 
 var ctors = map[uint]func(ds.Datastore) ds.Datastore{
 	0: func(dstore ds.Datastore) ds.Datastore {
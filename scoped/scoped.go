@@ -1,6 +1,8 @@
 package scoped
 
 import (
+	"slices"
+
 	ds "github.com/ipfs/go-datastore"
 )
 
@@ -40,3 +42,33 @@ func WithFeatures(dstore ds.Datastore, features []ds.Feature) ds.Datastore {
 	}
 	return ctors[ctor](dstore)
 }
+
+// Inherit returns the wrapper d scoped down to the features supported by all of
+// its children (see ds.Shim), so that it implements an optional feature exactly
+// when the datastores it forwards to do.
+//
+// Wrappers that implement a feature on their own, e.g. batching emulated on
+// top of a non-batching child, name it in own to keep it regardless of their
+// children.
+func Inherit(d ds.Shim, own ...string) ds.Datastore {
+	if d == nil {
+		return nil
+	}
+	var features []ds.Feature
+	for i, child := range d.Children() {
+		childFeatures := ds.FeaturesForDatastore(child)
+		if i == 0 {
+			features = childFeatures
+			continue
+		}
+		features = slices.DeleteFunc(features, func(f ds.Feature) bool {
+			return !slices.Contains(childFeatures, f)
+		})
+	}
+	for _, name := range own {
+		if f, ok := ds.FeatureByName(name); ok && !slices.Contains(features, f) {
+			features = append(features, f)
+		}
+	}
+	return WithFeatures(d, features)
+}
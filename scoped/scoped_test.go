@@ -71,3 +71,49 @@ func TestWithFeatures(t *testing.T) {
 		})
 	}
 }
+
+// multiShim is a shim with several children that implements all features.
+type multiShim struct {
+	*ds.LogDatastore
+	children []ds.Datastore
+}
+
+func (m *multiShim) Children() []ds.Datastore {
+	return m.children
+}
+
+func TestInherit(t *testing.T) {
+	cases := []struct {
+		name     string
+		children []ds.Datastore
+		own      []string
+
+		expectedFeatures []ds.Feature
+	}{
+		{
+			name:             "single child",
+			children:         []ds.Datastore{&ds.NullDatastore{}},
+			expectedFeatures: featuresByNames("Batching", "Checked", "GC", "Persistent", "Scrubbed", "Transaction"),
+		},
+		{
+			name:             "intersection of children",
+			children:         []ds.Datastore{&ds.NullDatastore{}, &ds.MapDatastore{}},
+			expectedFeatures: featuresByNames("Batching"),
+		},
+		{
+			name:             "own features",
+			children:         []ds.Datastore{&ds.MapDatastore{}},
+			own:              []string{"GC", "TTL"},
+			expectedFeatures: featuresByNames("Batching", "GC", "TTL"),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &multiShim{LogDatastore: ds.NewLogDatastore(ds.NewNullDatastore(), ""), children: c.children}
+			newFeats := ds.FeaturesForDatastore(Inherit(s, c.own...))
+			if !reflect.DeepEqual(newFeats, c.expectedFeatures) {
+				t.Fatalf("expected features %v, got %v", c.expectedFeatures, newFeats)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SkipChildren is used as a return value from a WalkFunc to indicate that the
+// children of the datastore passed to the call are to be skipped.
+var SkipChildren = errors.New("skip children")
+
+// WalkFunc is the type of the function called by Walk for each datastore in a
+// stack. depth is 0 for the root of the stack, 1 for its children and so on.
+type WalkFunc func(d Datastore, depth int) error
+
+// Walk walks the stack of datastores rooted at d, depth first, calling fn for
+// each datastore. Children are found through the Shim interface; walking stops
+// at datastores that don't implement it.
+//
+// If fn returns SkipChildren, Walk doesn't descend into the children of that
+// datastore. Any other error stops the walk and is returned by Walk.
+func Walk(d Datastore, fn WalkFunc) error {
+	return walk(d, 0, fn)
+}
+
+func walk(d Datastore, depth int, fn WalkFunc) error {
+	err := fn(d, depth)
+	if err == SkipChildren {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	shim, ok := d.(Shim)
+	if !ok {
+		return nil
+	}
+	for _, child := range shim.Children() {
+		if err := walk(child, depth+1, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errFound = errors.New("found")
+
+// Find returns the first datastore in the stack rooted at d, in Walk order,
+// that is a T. T may be a concrete datastore type, to locate a specific layer,
+// or an interface, to locate the layer providing a feature:
+//
+//	m, ok := Find[*mount.Datastore](d)
+//	txn, ok := Find[TxnFeature](d)
+//
+// Most wrappers implement every optional feature whether or not their child
+// does, unless scoped down with scoped.Inherit.
+func Find[T any](d Datastore) (T, bool) {
+	var found T
+	var ok bool
+	Walk(d, func(d Datastore, _ int) error {
+		found, ok = d.(T)
+		if ok {
+			return errFound
+		}
+		return nil
+	})
+	return found, ok
+}
+
+// PrintStack writes the stack of datastores rooted at d to w, one layer per
+// line, indented by depth and followed by the features the layer implements.
+//
+//	*mount.Datastore [Batching Checked GC Persistent Scrubbed]
+//	  *sync.MutexDatastore [Batching Checked GC Persistent Scrubbed]
+//	    *datastore.MapDatastore [Batching]
+func PrintStack(w io.Writer, d Datastore) error {
+	return Walk(d, func(d Datastore, depth int) error {
+		var names []string
+		for _, f := range FeaturesForDatastore(d) {
+			names = append(names, f.Name)
+		}
+		_, err := fmt.Fprintf(w, "%s%T [%s]\n", strings.Repeat("  ", depth), d, strings.Join(names, " "))
+		return err
+	})
+}
@@ -0,0 +1,128 @@
+package datastore_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/delayed"
+	"github.com/ipfs/go-datastore/mount"
+	"github.com/ipfs/go-datastore/scoped"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/go-datastore/trace"
+	delay "github.com/ipfs/go-ipfs-delay"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalkWrappers(t *testing.T) {
+	base := datastore.NewMapDatastore()
+	for name, w := range wrappers {
+		t.Run(name, func(t *testing.T) {
+			d := w.wrap(base)
+			var layers []datastore.Datastore
+			require.NoError(t, datastore.Walk(d, func(d datastore.Datastore, depth int) error {
+				require.Equal(t, len(layers), depth)
+				layers = append(layers, d)
+				return nil
+			}))
+			require.Same(t, d, layers[0])
+			require.Same(t, base, layers[len(layers)-1])
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	a := datastore.NewMapDatastore()
+	b := datastore.NewNullDatastore()
+	sa := dssync.MutexWrap(a)
+	m := mount.New([]mount.Mount{
+		{Prefix: datastore.NewKey("/a"), Datastore: sa},
+		{Prefix: datastore.NewKey("/b"), Datastore: b},
+	})
+	top := datastore.NewLogDatastore(m, "")
+
+	var layers []datastore.Datastore
+	var depths []int
+	err := datastore.Walk(top, func(d datastore.Datastore, depth int) error {
+		layers = append(layers, d)
+		depths = append(depths, depth)
+		return nil
+	})
+	require.NoError(t, err)
+	// Mounts are visited in lookup order.
+	require.Equal(t, []datastore.Datastore{top, m, b, sa, a}, layers)
+	require.Equal(t, []int{0, 1, 2, 2, 3}, depths)
+
+	layers = nil
+	err = datastore.Walk(top, func(d datastore.Datastore, depth int) error {
+		layers = append(layers, d)
+		if d == datastore.Datastore(sa) {
+			return datastore.SkipChildren
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []datastore.Datastore{top, m, b, sa}, layers)
+
+	stop := errors.New("stop")
+	layers = nil
+	err = datastore.Walk(top, func(d datastore.Datastore, depth int) error {
+		layers = append(layers, d)
+		if d == datastore.Datastore(sa) {
+			return stop
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, []datastore.Datastore{top, m, b, sa}, layers)
+}
+
+func TestFind(t *testing.T) {
+	base := datastore.NewMapDatastore()
+	m := mount.New([]mount.Mount{{Prefix: datastore.NewKey("/"), Datastore: base}})
+	top := dssync.MutexWrap(delayed.New(m, delay.Fixed(0)))
+
+	found, ok := datastore.Find[*mount.Datastore](top)
+	require.True(t, ok)
+	require.Same(t, m, found)
+
+	mds, ok := datastore.Find[*datastore.MapDatastore](top)
+	require.True(t, ok)
+	require.Same(t, base, mds)
+
+	_, ok = datastore.Find[*trace.Datastore](top)
+	require.False(t, ok)
+
+	// Find returns the topmost layer providing an interface.
+	gc, ok := datastore.Find[datastore.GCFeature](top)
+	require.True(t, ok)
+	require.Same(t, top, gc)
+
+	_, ok = datastore.Find[datastore.TxnFeature](base)
+	require.False(t, ok)
+}
+
+func TestPrintStack(t *testing.T) {
+	m := mount.New([]mount.Mount{
+		{Prefix: datastore.NewKey("/a"), Datastore: dssync.MutexWrap(datastore.NewMapDatastore())},
+		{Prefix: datastore.NewKey("/b"), Datastore: datastore.NewNullDatastore()},
+	})
+
+	var sb strings.Builder
+	require.NoError(t, datastore.PrintStack(&sb, delayed.New(m, delay.Fixed(0))))
+	require.Equal(t, `*delayed.Delayed [Batching Checked GC Persistent Scrubbed TTL Transaction]
+  *mount.Datastore [Batching Checked GC Persistent Scrubbed TTL Transaction]
+    *datastore.NullDatastore [Batching Checked GC Persistent Scrubbed Transaction]
+    *sync.MutexDatastore [Batching Checked GC Persistent Scrubbed TTL Transaction]
+      *datastore.MapDatastore [Batching]
+`, sb.String())
+
+	// Scoped views show up as layers of their own.
+	sb.Reset()
+	require.NoError(t, datastore.PrintStack(&sb, scoped.Inherit(dssync.MutexWrap(datastore.NewMapDatastore()))))
+	require.Equal(t, `*scoped.ds1 [Batching]
+  *sync.MutexDatastore [Batching Checked GC Persistent Scrubbed TTL Transaction]
+    *datastore.MapDatastore [Batching]
+`, sb.String())
+}
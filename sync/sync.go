@@ -3,6 +3,7 @@ package sync
 import (
 	"context"
 	"sync"
+	"time"
 
 	ds "github.com/ipfs/go-datastore"
 	dsq "github.com/ipfs/go-datastore/query"
@@ -23,9 +24,14 @@ var _ ds.PersistentDatastore = (*MutexDatastore)(nil)
 var _ ds.CheckedDatastore = (*MutexDatastore)(nil)
 var _ ds.ScrubbedDatastore = (*MutexDatastore)(nil)
 var _ ds.GCDatastore = (*MutexDatastore)(nil)
+var _ ds.TTLDatastore = (*MutexDatastore)(nil)
+var _ ds.TxnDatastore = (*MutexDatastore)(nil)
 
 // MutexWrap constructs a datastore with a coarse lock around the entire
 // datastore, for every single operation.
+//
+// The returned datastore implements every optional feature; use
+// scoped.Inherit to only expose the features d supports.
 func MutexWrap(d ds.Datastore) *MutexDatastore {
 	return &MutexDatastore{child: d}
 }
@@ -180,3 +186,115 @@ func (d *MutexDatastore) CollectGarbage(ctx context.Context) error {
 	}
 	return nil
 }
+
+func (d *MutexDatastore) PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error {
+	tds, ok := d.child.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	d.Lock()
+	defer d.Unlock()
+	return tds.PutWithTTL(ctx, key, value, ttl)
+}
+
+func (d *MutexDatastore) SetTTL(ctx context.Context, key ds.Key, ttl time.Duration) error {
+	tds, ok := d.child.(ds.TTLDatastore)
+	if !ok {
+		return ds.ErrTTLUnsupported
+	}
+	d.Lock()
+	defer d.Unlock()
+	return tds.SetTTL(ctx, key, ttl)
+}
+
+func (d *MutexDatastore) GetExpiration(ctx context.Context, key ds.Key) (time.Time, error) {
+	tds, ok := d.child.(ds.TTLDatastore)
+	if !ok {
+		return time.Time{}, ds.ErrTTLUnsupported
+	}
+	d.RLock()
+	defer d.RUnlock()
+	return tds.GetExpiration(ctx, key)
+}
+
+// NewTransaction implements TxnDatastore. Operations on the transaction take
+// the lock like operations on the datastore.
+func (d *MutexDatastore) NewTransaction(ctx context.Context, readOnly bool) (ds.Txn, error) {
+	tds, ok := d.child.(ds.TxnDatastore)
+	if !ok {
+		return nil, ds.ErrTxnUnsupported
+	}
+	d.Lock()
+	defer d.Unlock()
+	txn, err := tds.NewTransaction(ctx, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &syncTxn{txn: txn, mds: d}, nil
+}
+
+type syncTxn struct {
+	txn ds.Txn
+	mds *MutexDatastore
+}
+
+var _ ds.Txn = (*syncTxn)(nil)
+
+func (t *syncTxn) Get(ctx context.Context, key ds.Key) ([]byte, error) {
+	t.mds.RLock()
+	defer t.mds.RUnlock()
+	return t.txn.Get(ctx, key)
+}
+
+func (t *syncTxn) Has(ctx context.Context, key ds.Key) (bool, error) {
+	t.mds.RLock()
+	defer t.mds.RUnlock()
+	return t.txn.Has(ctx, key)
+}
+
+func (t *syncTxn) GetSize(ctx context.Context, key ds.Key) (int, error) {
+	t.mds.RLock()
+	defer t.mds.RUnlock()
+	return t.txn.GetSize(ctx, key)
+}
+
+func (t *syncTxn) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	t.mds.RLock()
+	defer t.mds.RUnlock()
+
+	// Like MutexDatastore.Query, apply the entire query while locked.
+	results, err := t.txn.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	results.Close()
+	if err != nil {
+		return nil, err
+	}
+	return dsq.ResultsWithEntries(q, entries), nil
+}
+
+func (t *syncTxn) Put(ctx context.Context, key ds.Key, val []byte) error {
+	t.mds.Lock()
+	defer t.mds.Unlock()
+	return t.txn.Put(ctx, key, val)
+}
+
+func (t *syncTxn) Delete(ctx context.Context, key ds.Key) error {
+	t.mds.Lock()
+	defer t.mds.Unlock()
+	return t.txn.Delete(ctx, key)
+}
+
+func (t *syncTxn) Commit(ctx context.Context) error {
+	t.mds.Lock()
+	defer t.mds.Unlock()
+	return t.txn.Commit(ctx)
+}
+
+func (t *syncTxn) Discard(ctx context.Context) {
+	t.mds.Lock()
+	defer t.mds.Unlock()
+	t.txn.Discard(ctx)
+}
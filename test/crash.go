@@ -0,0 +1,104 @@
+package dstest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	dstore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/crash"
+)
+
+// CrashWorkload describes a workload run by RunCrashWorkload.
+type CrashWorkload struct {
+	// Seed seeds the choice of crash points and of the writes lost.
+	Seed uint64
+	// Steps is the number of workload steps.
+	Steps int
+	// CrashProbability is the probability of crashing before each step. The
+	// datastore always crashes once more after the last step.
+	CrashProbability float64
+	// Loss describes the un-synced writes lost in each crash.
+	Loss crash.Loss
+
+	// Open builds the datastore stack under test on top of the crash
+	// datastore. It is called at the start and after every crash, like
+	// reopening after a reboot; the previous stack is abandoned without
+	// being closed. If nil, the crash datastore is used directly.
+	Open func(ctx context.Context, d *crash.Datastore) (dstore.Datastore, error)
+	// Step runs step i of the workload. The writes it reports through ack
+	// must survive any later crash: a nil value acknowledges a delete.
+	// Keys must only be rewritten by acknowledged writes once acknowledged.
+	Step func(ctx context.Context, d dstore.Datastore, i int, ack func(key dstore.Key, value []byte)) error
+	// Check, if set, asserts further invariants after each crash.
+	Check func(ctx context.Context, d dstore.Datastore) error
+}
+
+// RunCrashWorkload runs w against a crash datastore, crashing it at random
+// points. After each crash, it reopens the stack and checks that every
+// acknowledged write survived, then runs w.Check.
+func RunCrashWorkload(t *testing.T, w CrashWorkload) {
+	ctx := t.Context()
+	rng := rand.New(rand.NewPCG(w.Seed, 0))
+	base := crash.New(w.Seed)
+	acked := make(map[dstore.Key][]byte)
+	ack := func(key dstore.Key, value []byte) {
+		acked[key] = bytes.Clone(value)
+	}
+
+	open := func() dstore.Datastore {
+		if w.Open == nil {
+			return base
+		}
+		d, err := w.Open(ctx, base)
+		if err != nil {
+			t.Fatalf("reopen after %d crashes: %v", base.Crashes(), err)
+		}
+		return d
+	}
+	crashAndCheck := func(step int) dstore.Datastore {
+		base.Crash(w.Loss)
+		d := open()
+		if err := checkAcked(ctx, d, acked); err != nil {
+			t.Fatalf("crash before step %d: %v", step, err)
+		}
+		if w.Check != nil {
+			if err := w.Check(ctx, d); err != nil {
+				t.Fatalf("crash before step %d: %v", step, err)
+			}
+		}
+		return d
+	}
+
+	d := open()
+	for i := range w.Steps {
+		if rng.Float64() < w.CrashProbability {
+			d = crashAndCheck(i)
+		}
+		if err := w.Step(ctx, d, i, ack); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+	crashAndCheck(w.Steps)
+}
+
+// checkAcked returns an error describing the acknowledged writes d lost.
+func checkAcked(ctx context.Context, d dstore.Datastore, acked map[dstore.Key][]byte) error {
+	var errs []error
+	for key, want := range acked {
+		got, err := d.Get(ctx, key)
+		switch {
+		case want == nil && errors.Is(err, dstore.ErrNotFound):
+		case want == nil && err == nil:
+			errs = append(errs, fmt.Errorf("acknowledged delete of %s was lost", key))
+		case err != nil:
+			errs = append(errs, fmt.Errorf("acknowledged write of %s was lost: %w", key, err))
+		case !bytes.Equal(got, want):
+			errs = append(errs, fmt.Errorf("acknowledged write of %s was rolled back", key))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,121 @@
+package dstest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	dstore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/keytransform"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+// TransformKeys are the keys CheckTransform uses when given none. They mix
+// nested keys, keys sharing string prefixes but not namespaces, and unusual
+// characters.
+var TransformKeys = []string{
+	"/a", "/a/b", "/a/b/c", "/a/bc", "/ab", "/ab/c", "/b", "/B", "/b/a",
+	"/foo", "/foo/bar", "/foo.bar", "/foo-bar/baz", "/foo bar", "/%2F",
+	"/CIQ", "/ciq/x", "/été", "/z/y/x/w", "/0", "/00/1", "/_",
+}
+
+// CheckTransform checks that t round-trips keys, and has the Properties it
+// declares, on keys, or TransformKeys if keys is nil. It then checks that
+// queries through a datastore wrapped with t return the same results as
+// naively applying them to the keys.
+func CheckTransform(t *testing.T, tr keytransform.KeyTransform, keys []dstore.Key) {
+	if keys == nil {
+		for _, k := range TransformKeys {
+			keys = append(keys, dstore.NewKey(k))
+		}
+	}
+	props, _ := keytransform.PropertiesOf(tr)
+
+	converted := make([]dstore.Key, len(keys))
+	for i, k := range keys {
+		converted[i] = tr.ConvertKey(k)
+		if inv := tr.InvertKey(converted[i]); !inv.Equal(k) {
+			t.Errorf("%s converts to %s, which inverts to %s", k, converted[i], inv)
+		}
+	}
+
+	// Queries without a prefix use the root as prefix.
+	if root := tr.ConvertKey(dstore.NewKey("/")); props.PrefixPreserving && root.String() != "/" {
+		for i, k := range keys {
+			if !root.IsAncestorOf(converted[i]) {
+				t.Errorf("%s converts to %s, which is not under the converted root %s", k, converted[i], root)
+			}
+		}
+	}
+
+	for i, a := range keys {
+		ca := converted[i]
+		for j, b := range keys {
+			cb := converted[j]
+			if props.OrderPreserving && (a.String() < b.String()) != (ca.String() < cb.String()) {
+				t.Errorf("order of %s and %s is not preserved: %s, %s", a, b, ca, cb)
+			}
+			if props.PrefixPreserving && a.IsAncestorOf(b) != ca.IsAncestorOf(cb) {
+				t.Errorf("ancestry of %s and %s is not preserved: %s, %s", a, b, ca, cb)
+			}
+			if props.PrefixInvertible {
+				for n := 1; n <= len(a.String()); n++ {
+					s := a.String()[:n]
+					cs := keytransform.ConvertPrefix(tr, s)
+					if strings.HasPrefix(b.String(), s) != strings.HasPrefix(cb.String(), cs) {
+						t.Errorf("string prefix %q of %s is not preserved: %q, %s", s, b, cs, cb)
+					}
+				}
+			}
+		}
+	}
+	if t.Failed() {
+		return
+	}
+
+	checkTransformQueries(t, tr, keys)
+}
+
+func checkTransformQueries(t *testing.T, tr keytransform.KeyTransform, keys []dstore.Key) {
+	ctx := context.Background()
+	d := keytransform.Wrap(dstore.NewMapDatastore(), tr)
+	var entries []dsq.Entry
+	for _, k := range keys {
+		if err := d.Put(ctx, k, []byte(k.String())); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, dsq.Entry{Key: k.String(), Value: []byte(k.String()), Size: len(k.String())})
+	}
+
+	var queries []dsq.Query
+	for _, k := range keys[:min(len(keys), 4)] {
+		queries = append(queries,
+			dsq.Query{Prefix: k.String(), Orders: []dsq.Order{dsq.OrderByKey{}}},
+			dsq.Query{Filters: []dsq.Filter{dsq.FilterKeyPrefix{Prefix: k.String()}}, Orders: []dsq.Order{dsq.OrderByKey{}}},
+			dsq.Query{Filters: []dsq.Filter{dsq.FilterKeyCompare{Op: dsq.GreaterThan, Key: k.String()}}, Orders: []dsq.Order{dsq.OrderByKeyDescending{}}, Limit: 3},
+		)
+	}
+	queries = append(queries,
+		dsq.Query{Orders: []dsq.Order{dsq.OrderByKey{}}, Offset: 2, Limit: 5},
+		dsq.Query{Orders: []dsq.Order{dsq.OrderByKeyDescending{}}},
+	)
+
+	for _, q := range queries {
+		res, err := d.Query(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := res.Rest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := dsq.NaiveQueryApply(q, dsq.ResultsWithEntries(q, entries)).Rest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.EqualFunc(got, want, func(a, b dsq.Entry) bool { return a.Key == b.Key }) {
+			t.Errorf("%s: got %v, want %v", q, dstore.EntryKeys(got), dstore.EntryKeys(want))
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package trace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// KeyPolicy controls how keys, which can contain user data, are recorded on
+// spans.
+type KeyPolicy string
+
+const (
+	// KeyFull records keys and queries as they are. It is the default.
+	KeyFull KeyPolicy = "full"
+	// KeyHashed records the hex-encoded SHA-256 hash of keys, so that
+	// operations on the same key can be correlated.
+	KeyHashed KeyPolicy = "hashed"
+	// KeyPrefix records the first namespace of keys, e.g. "/blocks" for
+	// "/blocks/CIQA", and "/" for keys with a single namespace.
+	KeyPrefix KeyPolicy = "prefix"
+	// KeyOmitted doesn't record keys.
+	KeyOmitted KeyPolicy = "omitted"
+)
+
+// ParseKeyPolicy returns the key policy with the given name.
+func ParseKeyPolicy(name string) (KeyPolicy, error) {
+	switch p := KeyPolicy(name); p {
+	case KeyFull, KeyHashed, KeyPrefix, KeyOmitted:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown key policy %q", name)
+}
+
+// Key returns the value recorded for key, and false if it isn't recorded.
+func (p KeyPolicy) Key(key ds.Key) (string, bool) {
+	switch p {
+	case KeyHashed:
+		sum := sha256.Sum256(key.Bytes())
+		return hex.EncodeToString(sum[:]), true
+	case KeyPrefix:
+		if list := key.List(); len(list) > 1 {
+			return "/" + list[0], true
+		}
+		return "/", true
+	case KeyOmitted:
+		return "", false
+	default:
+		return key.String(), true
+	}
+}
+
+// attrs returns the attributes recording key, followed by extra.
+func (p KeyPolicy) attrs(key ds.Key, extra ...attribute.KeyValue) []attribute.KeyValue {
+	if v, ok := p.Key(key); ok {
+		return append([]attribute.KeyValue{attribute.String("key", v)}, extra...)
+	}
+	return extra
+}
+
+// queryAttrs returns the attributes recording q. Unless keys are recorded in
+// full, only the query prefix is recorded, as filters and orders can hold
+// keys and values too.
+func (p KeyPolicy) queryAttrs(q dsq.Query) []attribute.KeyValue {
+	if p == "" || p == KeyFull {
+		return []attribute.KeyValue{attribute.String("query", q.String())}
+	}
+	if v, ok := p.Key(ds.NewKey(q.Prefix)); ok {
+		return []attribute.KeyValue{attribute.String("prefix", v)}
+	}
+	return nil
+}
@@ -4,8 +4,9 @@ package trace
 
 import (
 	"context"
-	"fmt"
 	"io"
+	"sync"
+	"time"
 
 	ds "github.com/ipfs/go-datastore"
 	dsq "github.com/ipfs/go-datastore/query"
@@ -15,14 +16,29 @@ import (
 )
 
 // New returns a new traced datastore. All datastore interactions are traced.
+//
+// Keys are recorded in full; set KeyPolicy on the returned datastore to
+// redact them.
+//
+// The returned datastore implements every optional feature; use scoped.Inherit
+// to only expose the features ds supports. Batching falls back to a basic
+// batch on datastores that don't support it, and can be kept by naming
+// ds.FeatureNameBatching.
 func New(ds ds.Datastore, tracer otel.Tracer) *Datastore {
 	return &Datastore{ds: ds, tracer: tracer}
 }
 
 // Datastore is an adapter that traces inner datastore interactions.
+//
+// Query spans cover the whole lifetime of the results, ending when they are
+// closed, and record the number of entries returned. Batch commit spans record
+// the number of puts and deletes and the bytes put.
 type Datastore struct {
 	ds     ds.Datastore
 	tracer otel.Tracer
+
+	// KeyPolicy controls how keys are recorded on spans.
+	KeyPolicy KeyPolicy
 }
 
 var (
@@ -33,12 +49,19 @@ var (
 	_ ds.CheckedDatastore    = (*Datastore)(nil)
 	_ ds.ScrubbedDatastore   = (*Datastore)(nil)
 	_ ds.GCDatastore         = (*Datastore)(nil)
+	_ ds.TTLDatastore        = (*Datastore)(nil)
 	_ io.Closer              = (*Datastore)(nil)
+	_ ds.Shim                = (*Datastore)(nil)
 )
 
+// Children implements ds.Shim
+func (t *Datastore) Children() []ds.Datastore {
+	return []ds.Datastore{t.ds}
+}
+
 // Put implements the ds.Datastore interface.
 func (t *Datastore) Put(ctx context.Context, key ds.Key, value []byte) error {
-	ctx, span := t.tracer.Start(ctx, "Put", otel.WithAttributes(attribute.String("key", key.String())))
+	ctx, span := t.tracer.Start(ctx, "Put", otel.WithAttributes(t.KeyPolicy.attrs(key)...))
 	defer span.End()
 
 	err := t.ds.Put(ctx, key, value)
@@ -52,7 +75,7 @@ func (t *Datastore) Put(ctx context.Context, key ds.Key, value []byte) error {
 
 // Sync implements Datastore.Sync
 func (t *Datastore) Sync(ctx context.Context, key ds.Key) error {
-	ctx, span := t.tracer.Start(ctx, "Sync", otel.WithAttributes(attribute.String("key", key.String())))
+	ctx, span := t.tracer.Start(ctx, "Sync", otel.WithAttributes(t.KeyPolicy.attrs(key)...))
 	defer span.End()
 
 	err := t.ds.Sync(ctx, key)
@@ -66,7 +89,7 @@ func (t *Datastore) Sync(ctx context.Context, key ds.Key) error {
 
 // Get implements the ds.Datastore interface.
 func (t *Datastore) Get(ctx context.Context, key ds.Key) (value []byte, err error) {
-	ctx, span := t.tracer.Start(ctx, "Get", otel.WithAttributes(attribute.String("key", key.String())))
+	ctx, span := t.tracer.Start(ctx, "Get", otel.WithAttributes(t.KeyPolicy.attrs(key)...))
 	defer span.End()
 
 	val, err := t.ds.Get(ctx, key)
@@ -80,7 +103,7 @@ func (t *Datastore) Get(ctx context.Context, key ds.Key) (value []byte, err erro
 
 // Has implements the ds.Datastore interface.
 func (t *Datastore) Has(ctx context.Context, key ds.Key) (bool, error) {
-	ctx, span := t.tracer.Start(ctx, "Has", otel.WithAttributes(attribute.String("key", key.String())))
+	ctx, span := t.tracer.Start(ctx, "Has", otel.WithAttributes(t.KeyPolicy.attrs(key)...))
 	defer span.End()
 
 	exists, err := t.ds.Has(ctx, key)
@@ -94,7 +117,7 @@ func (t *Datastore) Has(ctx context.Context, key ds.Key) (bool, error) {
 
 // GetSize implements the ds.Datastore interface.
 func (t *Datastore) GetSize(ctx context.Context, key ds.Key) (int, error) {
-	ctx, span := t.tracer.Start(ctx, "GetSize", otel.WithAttributes(attribute.String("key", key.String())))
+	ctx, span := t.tracer.Start(ctx, "GetSize", otel.WithAttributes(t.KeyPolicy.attrs(key)...))
 	defer span.End()
 
 	size, err := t.ds.GetSize(ctx, key)
@@ -108,7 +131,7 @@ func (t *Datastore) GetSize(ctx context.Context, key ds.Key) (int, error) {
 
 // Delete implements the ds.Datastore interface.
 func (t *Datastore) Delete(ctx context.Context, key ds.Key) error {
-	ctx, span := t.tracer.Start(ctx, "Delete", otel.WithAttributes(attribute.String("key", key.String())))
+	ctx, span := t.tracer.Start(ctx, "Delete", otel.WithAttributes(t.KeyPolicy.attrs(key)...))
 	defer span.End()
 
 	err := t.ds.Delete(ctx, key)
@@ -120,18 +143,20 @@ func (t *Datastore) Delete(ctx context.Context, key ds.Key) error {
 	return err
 }
 
-// Query implements the ds.Datastore interface.
+// Query implements the ds.Datastore interface. The span ends when the
+// results are closed.
 func (t *Datastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
-	ctx, span := t.tracer.Start(ctx, "Query", otel.WithAttributes(attribute.String("query", q.String())))
-	defer span.End()
+	ctx, span := t.tracer.Start(ctx, "Query", otel.WithAttributes(t.KeyPolicy.queryAttrs(q)...))
 
 	res, err := t.ds.Query(ctx, q)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
 	}
 
-	return res, err
+	return traceResults(res, span), nil
 }
 
 // Batch implements the ds.Batching interface.
@@ -140,15 +165,16 @@ func (t *Datastore) Batch(ctx context.Context) (ds.Batch, error) {
 	defer span.End()
 
 	if dstore, ok := t.ds.(ds.Batching); ok {
-		batch, err := dstore.Batch(ctx)
+		b, err := dstore.Batch(ctx)
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
+			return nil, err
 		}
-		return batch, err
+		return &batch{batch: b, tracer: t.tracer}, nil
 	}
 
-	return ds.NewBasicBatch(t), nil
+	return &batch{batch: ds.NewBasicBatch(t), tracer: t.tracer}, nil
 }
 
 // DiskUsage implements the ds.PersistentDatastore interface.
@@ -170,7 +196,7 @@ func (t *Datastore) Scrub(ctx context.Context) error {
 	ctx, span := t.tracer.Start(ctx, "Scrub")
 	defer span.End()
 
-	if dstore, ok := t.tracer.(ds.ScrubbedDatastore); ok {
+	if dstore, ok := t.ds.(ds.ScrubbedDatastore); ok {
 		err := dstore.Scrub(ctx)
 		if err != nil {
 			span.RecordError(err)
@@ -187,7 +213,7 @@ func (t *Datastore) CollectGarbage(ctx context.Context) error {
 	ctx, span := t.tracer.Start(ctx, "CollectGarbage")
 	defer span.End()
 
-	if dstore, ok := t.tracer.(ds.GCDatastore); ok {
+	if dstore, ok := t.ds.(ds.GCDatastore); ok {
 		err := dstore.CollectGarbage(ctx)
 		if err != nil {
 			span.RecordError(err)
@@ -204,7 +230,7 @@ func (t *Datastore) Check(ctx context.Context) error {
 	ctx, span := t.tracer.Start(ctx, "Check")
 	defer span.End()
 
-	if dstore, ok := t.tracer.(ds.CheckedDatastore); ok {
+	if dstore, ok := t.ds.(ds.CheckedDatastore); ok {
 		err := dstore.Check(ctx)
 		if err != nil {
 			span.RecordError(err)
@@ -228,10 +254,62 @@ func (t *Datastore) NewTransaction(ctx context.Context, readOnly bool) (ds.Txn,
 			span.SetStatus(codes.Error, err.Error())
 			return nil, err
 		}
-		return &Txn{txn: txn, tracer: t.tracer}, nil
+		return &Txn{txn: txn, tracer: t.tracer, keys: t.KeyPolicy}, nil
+	}
+
+	return nil, ds.ErrTxnUnsupported
+}
+
+// PutWithTTL implements the ds.TTL interface.
+func (t *Datastore) PutWithTTL(ctx context.Context, key ds.Key, value []byte, ttl time.Duration) error {
+	ctx, span := t.tracer.Start(ctx, "PutWithTTL", otel.WithAttributes(t.KeyPolicy.attrs(key, attribute.String("ttl", ttl.String()))...))
+	defer span.End()
+
+	err := ds.ErrTTLUnsupported
+	if ttlDs, ok := t.ds.(ds.TTLDatastore); ok {
+		err = ttlDs.PutWithTTL(ctx, key, value, ttl)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// SetTTL implements the ds.TTL interface.
+func (t *Datastore) SetTTL(ctx context.Context, key ds.Key, ttl time.Duration) error {
+	ctx, span := t.tracer.Start(ctx, "SetTTL", otel.WithAttributes(t.KeyPolicy.attrs(key, attribute.String("ttl", ttl.String()))...))
+	defer span.End()
+
+	err := ds.ErrTTLUnsupported
+	if ttlDs, ok := t.ds.(ds.TTLDatastore); ok {
+		err = ttlDs.SetTTL(ctx, key, ttl)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+// GetExpiration implements the ds.TTL interface.
+func (t *Datastore) GetExpiration(ctx context.Context, key ds.Key) (time.Time, error) {
+	ctx, span := t.tracer.Start(ctx, "GetExpiration", otel.WithAttributes(t.KeyPolicy.attrs(key)...))
+	defer span.End()
+
+	var exp time.Time
+	err := ds.ErrTTLUnsupported
+	if ttlDs, ok := t.ds.(ds.TTLDatastore); ok {
+		exp, err = ttlDs.GetExpiration(ctx, key)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	}
 
-	return nil, fmt.Errorf("transactions are unsupported by traced datastore")
+	return exp, err
 }
 
 // Close closes the inner datastore (if it implements the io.Closer interface).
@@ -246,13 +324,14 @@ func (t *Datastore) Close() error {
 type Txn struct {
 	txn    ds.Txn
 	tracer otel.Tracer
+	keys   KeyPolicy
 }
 
 var _ ds.Txn = (*Txn)(nil)
 
 // Put implements the ds.Txn interface.
 func (t *Txn) Put(ctx context.Context, key ds.Key, value []byte) error {
-	ctx, span := t.tracer.Start(ctx, "Put", otel.WithAttributes(attribute.String("key", key.String())))
+	ctx, span := t.tracer.Start(ctx, "Put", otel.WithAttributes(t.keys.attrs(key)...))
 	defer span.End()
 
 	err := t.txn.Put(ctx, key, value)
@@ -266,7 +345,7 @@ func (t *Txn) Put(ctx context.Context, key ds.Key, value []byte) error {
 
 // Get implements the ds.Txn interface.
 func (t *Txn) Get(ctx context.Context, key ds.Key) (value []byte, err error) {
-	ctx, span := t.tracer.Start(ctx, "Get", otel.WithAttributes(attribute.String("key", key.String())))
+	ctx, span := t.tracer.Start(ctx, "Get", otel.WithAttributes(t.keys.attrs(key)...))
 	defer span.End()
 
 	val, err := t.txn.Get(ctx, key)
@@ -280,7 +359,7 @@ func (t *Txn) Get(ctx context.Context, key ds.Key) (value []byte, err error) {
 
 // Has implements the ds.Txn interface.
 func (t *Txn) Has(ctx context.Context, key ds.Key) (bool, error) {
-	ctx, span := t.tracer.Start(ctx, "Has", otel.WithAttributes(attribute.String("key", key.String())))
+	ctx, span := t.tracer.Start(ctx, "Has", otel.WithAttributes(t.keys.attrs(key)...))
 	defer span.End()
 
 	exists, err := t.txn.Has(ctx, key)
@@ -294,7 +373,7 @@ func (t *Txn) Has(ctx context.Context, key ds.Key) (bool, error) {
 
 // GetSize implements the ds.Txn interface.
 func (t *Txn) GetSize(ctx context.Context, key ds.Key) (int, error) {
-	ctx, span := t.tracer.Start(ctx, "GetSize", otel.WithAttributes(attribute.String("key", key.String())))
+	ctx, span := t.tracer.Start(ctx, "GetSize", otel.WithAttributes(t.keys.attrs(key)...))
 	defer span.End()
 
 	size, err := t.txn.GetSize(ctx, key)
@@ -308,7 +387,7 @@ func (t *Txn) GetSize(ctx context.Context, key ds.Key) (int, error) {
 
 // Delete implements the ds.Txn interface.
 func (t *Txn) Delete(ctx context.Context, key ds.Key) error {
-	ctx, span := t.tracer.Start(ctx, "Delete", otel.WithAttributes(attribute.String("key", key.String())))
+	ctx, span := t.tracer.Start(ctx, "Delete", otel.WithAttributes(t.keys.attrs(key)...))
 	defer span.End()
 
 	err := t.txn.Delete(ctx, key)
@@ -320,18 +399,20 @@ func (t *Txn) Delete(ctx context.Context, key ds.Key) error {
 	return err
 }
 
-// Query implements the ds.Txn interface.
+// Query implements the ds.Txn interface. The span ends when the results are
+// closed.
 func (t *Txn) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
-	ctx, span := t.tracer.Start(ctx, "Query", otel.WithAttributes(attribute.String("query", q.String())))
-	defer span.End()
+	ctx, span := t.tracer.Start(ctx, "Query", otel.WithAttributes(t.keys.queryAttrs(q)...))
 
 	res, err := t.txn.Query(ctx, q)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
 	}
 
-	return res, err
+	return traceResults(res, span), nil
 }
 
 // Commit implements the ds.Txn interface.
@@ -354,3 +435,84 @@ func (t *Txn) Discard(ctx context.Context) {
 	defer span.End()
 	t.txn.Discard(ctx)
 }
+
+// traceResults wraps res to end span when the results are closed, recording
+// the entries returned and any errors.
+func traceResults(res dsq.Results, span otel.Span) dsq.Results {
+	var entries int64
+	var once sync.Once
+	return dsq.ResultsFromIterator(res.Query(), dsq.Iterator{
+		Next: func() (dsq.Result, bool) {
+			r, ok := res.NextSync()
+			switch {
+			case !ok:
+				span.AddEvent("exhausted")
+			case r.Error != nil:
+				span.RecordError(r.Error)
+				span.SetStatus(codes.Error, r.Error.Error())
+			default:
+				entries++
+			}
+			return r, ok
+		},
+		Close: func() error {
+			err := res.Close()
+			once.Do(func() {
+				if err != nil {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+				}
+				span.SetAttributes(attribute.Int64("entries", entries))
+				span.End()
+			})
+			return err
+		},
+	})
+}
+
+// batch is an adapter that counts the operations of a batch, recording them
+// on the commit span.
+type batch struct {
+	batch  ds.Batch
+	tracer otel.Tracer
+
+	puts, deletes, bytes int64
+}
+
+var _ ds.Batch = (*batch)(nil)
+
+func (b *batch) Put(ctx context.Context, key ds.Key, value []byte) error {
+	err := b.batch.Put(ctx, key, value)
+	if err == nil {
+		b.puts++
+		b.bytes += int64(len(value))
+	}
+	return err
+}
+
+func (b *batch) Delete(ctx context.Context, key ds.Key) error {
+	err := b.batch.Delete(ctx, key)
+	if err == nil {
+		b.deletes++
+	}
+	return err
+}
+
+func (b *batch) Commit(ctx context.Context) error {
+	ctx, span := b.tracer.Start(ctx, "Commit", otel.WithAttributes(
+		attribute.Int64("puts", b.puts),
+		attribute.Int64("deletes", b.deletes),
+		attribute.Int64("bytes", b.bytes),
+	))
+	defer span.End()
+
+	err := b.batch.Commit(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	b.puts, b.deletes, b.bytes = 0, 0, 0
+
+	return nil
+}
@@ -1,14 +1,173 @@
 package trace
 
 import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
 	dstest "github.com/ipfs/go-datastore/test"
+	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestTraceAll(t *testing.T) {
 	tracer := otel.Tracer("tracer")
 	dstest.SubtestAll(t, New(datastore.NewMapDatastore(), tracer))
 }
+
+func newRecorded(d datastore.Datastore) (*Datastore, *tracetest.SpanRecorder) {
+	rec := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	return New(d, provider.Tracer("tracer")), rec
+}
+
+// endedSpan returns the only ended span with the given name.
+func endedSpan(t *testing.T, rec *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	var found []sdktrace.ReadOnlySpan
+	for _, s := range rec.Ended() {
+		if s.Name() == name {
+			found = append(found, s)
+		}
+	}
+	require.Len(t, found, 1, "spans named %s", name)
+	return found[0]
+}
+
+func spanAttr(s sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range s.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestQuerySpanLifecycle(t *testing.T) {
+	ctx := context.Background()
+	d, rec := newRecorded(datastore.NewMapDatastore())
+
+	for _, k := range []string{"/a", "/b", "/c"} {
+		require.NoError(t, d.Put(ctx, datastore.NewKey(k), []byte(k)))
+	}
+	res, err := d.Query(ctx, dsq.Query{})
+	require.NoError(t, err)
+	for _, s := range rec.Ended() {
+		require.NotEqual(t, "Query", s.Name(), "query span ended before its results were closed")
+	}
+
+	entries, err := res.Rest()
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.NoError(t, res.Close())
+
+	span := endedSpan(t, rec, "Query")
+	n, ok := spanAttr(span, "entries")
+	require.True(t, ok)
+	require.Equal(t, int64(3), n.AsInt64())
+	require.Equal(t, "exhausted", span.Events()[0].Name)
+}
+
+func TestQuerySpanErrors(t *testing.T) {
+	ctx := context.Background()
+	d, rec := newRecorded(errorQueryDatastore{datastore.NewMapDatastore()})
+
+	res, err := d.Query(ctx, dsq.Query{})
+	require.NoError(t, err)
+	_, err = res.Rest()
+	require.ErrorIs(t, err, errQuery)
+	require.NoError(t, res.Close())
+
+	span := endedSpan(t, rec, "Query")
+	require.Equal(t, codes.Error, span.Status().Code)
+	n, _ := spanAttr(span, "entries")
+	require.Zero(t, n.AsInt64())
+}
+
+var errQuery = errors.New("query failed")
+
+// errorQueryDatastore returns queries whose only result is an error.
+type errorQueryDatastore struct {
+	*datastore.MapDatastore
+}
+
+func (d errorQueryDatastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	done := false
+	return dsq.ResultsFromIterator(q, dsq.Iterator{
+		Next: func() (dsq.Result, bool) {
+			if done {
+				return dsq.Result{}, false
+			}
+			done = true
+			return dsq.Result{Error: errQuery}, true
+		},
+	}), nil
+}
+
+func TestBatchCommitSpan(t *testing.T) {
+	ctx := context.Background()
+	d, rec := newRecorded(datastore.NewMapDatastore())
+
+	b, err := d.Batch(ctx)
+	require.NoError(t, err)
+	require.NoError(t, b.Put(ctx, datastore.NewKey("/a"), []byte("1")))
+	require.NoError(t, b.Put(ctx, datastore.NewKey("/b"), []byte("22")))
+	require.NoError(t, b.Delete(ctx, datastore.NewKey("/c")))
+	require.NoError(t, b.Commit(ctx))
+
+	span := endedSpan(t, rec, "Commit")
+	for key, want := range map[attribute.Key]int64{"puts": 2, "deletes": 1, "bytes": 3} {
+		v, ok := spanAttr(span, key)
+		require.True(t, ok, key)
+		require.Equal(t, want, v.AsInt64(), key)
+	}
+}
+
+func TestKeyPolicy(t *testing.T) {
+	ctx := context.Background()
+	key := datastore.NewKey("/blocks/secret")
+
+	for policy, want := range map[KeyPolicy]string{
+		"":         "/blocks/secret",
+		KeyFull:    "/blocks/secret",
+		KeyHashed:  fmt.Sprintf("%x", sha256.Sum256([]byte("/blocks/secret"))),
+		KeyPrefix:  "/blocks",
+		KeyOmitted: "",
+	} {
+		t.Run(string(policy), func(t *testing.T) {
+			d, rec := newRecorded(datastore.NewMapDatastore())
+			d.KeyPolicy = policy
+			_, err := d.Has(ctx, key)
+			require.NoError(t, err)
+
+			v, ok := spanAttr(endedSpan(t, rec, "Has"), "key")
+			if policy == KeyOmitted {
+				require.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			require.Equal(t, want, v.AsString())
+		})
+	}
+
+	d, rec := newRecorded(datastore.NewMapDatastore())
+	d.KeyPolicy = KeyPrefix
+	res, err := d.Query(ctx, dsq.Query{Prefix: "/blocks/secret", Filters: []dsq.Filter{dsq.FilterValueCompare{Op: dsq.Equal, Value: []byte("secret")}}})
+	require.NoError(t, err)
+	require.NoError(t, res.Close())
+	span := endedSpan(t, rec, "Query")
+	_, ok := spanAttr(span, "query")
+	require.False(t, ok)
+	prefix, _ := spanAttr(span, "prefix")
+	require.Equal(t, "/blocks", prefix.AsString())
+
+	_, err = ParseKeyPolicy("encrypted")
+	require.Error(t, err)
+}
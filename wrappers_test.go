@@ -0,0 +1,368 @@
+package datastore_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/autobatch"
+	contextds "github.com/ipfs/go-datastore/context"
+	"github.com/ipfs/go-datastore/delayed"
+	"github.com/ipfs/go-datastore/failstore"
+	"github.com/ipfs/go-datastore/merkle"
+	"github.com/ipfs/go-datastore/metrics"
+	"github.com/ipfs/go-datastore/mount"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/overlay"
+	dsq "github.com/ipfs/go-datastore/query"
+	"github.com/ipfs/go-datastore/retrystore"
+	"github.com/ipfs/go-datastore/scoped"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/go-datastore/trace"
+	delay "github.com/ipfs/go-ipfs-delay"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+type wrapper struct {
+	wrap func(datastore.Datastore) datastore.Datastore
+	// batchingChild is set for wrappers that only wrap Batching datastores.
+	batchingChild bool
+	// own lists the features the wrapper implements regardless of its child,
+	// lacks the features it never implements.
+	own, lacks []string
+}
+
+// wrappers are all the wrappers in the repo, each wrapping a single child. They
+// are all scoped down with scoped.Inherit, naming the features they implement
+// on their own.
+var wrappers = map[string]wrapper{
+	"autobatch": {
+		wrap: func(d datastore.Datastore) datastore.Datastore {
+			return autobatch.NewAutoBatching(d.(datastore.Batching), 16)
+		},
+		batchingChild: true,
+		// Writes are batched internally, but autobatch doesn't hand out
+		// batches.
+		lacks: []string{datastore.FeatureNameBatching},
+	},
+	"contextds": {
+		wrap: contextds.WrapDatastore,
+	},
+	"delayed": {
+		wrap: func(d datastore.Datastore) datastore.Datastore {
+			return delayed.New(d, delay.Fixed(0))
+		},
+		own: []string{datastore.FeatureNameBatching},
+	},
+	"failstore": {
+		wrap: func(d datastore.Datastore) datastore.Datastore {
+			return failstore.NewFailstore(d, func(string) error { return nil })
+		},
+	},
+	"keytransform": {
+		wrap: func(d datastore.Datastore) datastore.Datastore {
+			return namespace.Wrap(d, datastore.NewKey("/ns"))
+		},
+	},
+	"log": {
+		wrap: func(d datastore.Datastore) datastore.Datastore {
+			return datastore.NewLogDatastore(d, "")
+		},
+	},
+	"merkle": {
+		wrap: func(d datastore.Datastore) datastore.Datastore {
+			m, err := merkle.Wrap(context.Background(), d, 4)
+			if err != nil {
+				panic(err)
+			}
+			return m
+		},
+		own:   []string{datastore.FeatureNameBatching},
+		lacks: []string{datastore.FeatureNameTTL, datastore.FeatureNameTransaction},
+	},
+	"metrics": {
+		wrap: func(d datastore.Datastore) datastore.Datastore {
+			m, err := metrics.New(d, otel.Meter("meter"))
+			if err != nil {
+				panic(err)
+			}
+			return m
+		},
+	},
+	"mount": {
+		wrap: func(d datastore.Datastore) datastore.Datastore {
+			return mount.New([]mount.Mount{{Prefix: datastore.NewKey("/"), Datastore: d}})
+		},
+		own: []string{
+			datastore.FeatureNameChecked, datastore.FeatureNameScrubbed,
+			datastore.FeatureNameGC, datastore.FeatureNamePersistent,
+		},
+	},
+	"overlay": {
+		wrap: func(d datastore.Datastore) datastore.Datastore {
+			return overlay.New(d)
+		},
+		own: []string{
+			datastore.FeatureNameBatching, datastore.FeatureNameChecked, datastore.FeatureNameScrubbed,
+			datastore.FeatureNameGC, datastore.FeatureNamePersistent,
+		},
+		lacks: []string{datastore.FeatureNameTTL, datastore.FeatureNameTransaction},
+	},
+	"retrystore": {
+		wrap: func(d datastore.Datastore) datastore.Datastore {
+			return &retrystore.Datastore{Batching: d.(datastore.Batching), Delay: time.Millisecond}
+		},
+		batchingChild: true,
+	},
+	"sync": {
+		wrap: func(d datastore.Datastore) datastore.Datastore {
+			return dssync.MutexWrap(d)
+		},
+	},
+	"trace": {
+		wrap: func(d datastore.Datastore) datastore.Datastore {
+			return trace.New(d, otel.Tracer("tracer"))
+		},
+		own: []string{datastore.FeatureNameBatching},
+	},
+}
+
+// featureDatastore implements every feature, recording the optional feature
+// calls it receives.
+type featureDatastore struct {
+	*datastore.MapDatastore
+	calls       []string
+	expirations map[datastore.Key]time.Time
+}
+
+func newFeatureDatastore() *featureDatastore {
+	return &featureDatastore{
+		MapDatastore: datastore.NewMapDatastore(),
+		expirations:  make(map[datastore.Key]time.Time),
+	}
+}
+
+func (d *featureDatastore) Check(ctx context.Context) error {
+	d.calls = append(d.calls, "check")
+	return nil
+}
+
+func (d *featureDatastore) Scrub(ctx context.Context) error {
+	d.calls = append(d.calls, "scrub")
+	return nil
+}
+
+func (d *featureDatastore) CollectGarbage(ctx context.Context) error {
+	d.calls = append(d.calls, "gc")
+	return nil
+}
+
+func (d *featureDatastore) DiskUsage(ctx context.Context) (uint64, error) {
+	d.calls = append(d.calls, "disk-usage")
+	return 42, nil
+}
+
+func (d *featureDatastore) PutWithTTL(ctx context.Context, key datastore.Key, value []byte, ttl time.Duration) error {
+	d.calls = append(d.calls, "put-with-ttl")
+	d.expirations[key] = time.Unix(0, 0).Add(ttl)
+	return d.MapDatastore.Put(ctx, key, value)
+}
+
+func (d *featureDatastore) SetTTL(ctx context.Context, key datastore.Key, ttl time.Duration) error {
+	d.calls = append(d.calls, "set-ttl")
+	d.expirations[key] = time.Unix(0, 0).Add(ttl)
+	return nil
+}
+
+func (d *featureDatastore) GetExpiration(ctx context.Context, key datastore.Key) (time.Time, error) {
+	d.calls = append(d.calls, "get-expiration")
+	exp, ok := d.expirations[key]
+	if !ok {
+		return time.Time{}, datastore.ErrNotFound
+	}
+	return exp, nil
+}
+
+func (d *featureDatastore) NewTransaction(ctx context.Context, readOnly bool) (datastore.Txn, error) {
+	d.calls = append(d.calls, "txn")
+	return &featureTxn{d: d, puts: make(map[datastore.Key][]byte)}, nil
+}
+
+// featureTxn applies its puts on commit.
+type featureTxn struct {
+	d    *featureDatastore
+	puts map[datastore.Key][]byte
+}
+
+func (t *featureTxn) Get(ctx context.Context, key datastore.Key) ([]byte, error) {
+	return t.d.MapDatastore.Get(ctx, key)
+}
+
+func (t *featureTxn) Has(ctx context.Context, key datastore.Key) (bool, error) {
+	return t.d.MapDatastore.Has(ctx, key)
+}
+
+func (t *featureTxn) GetSize(ctx context.Context, key datastore.Key) (int, error) {
+	return t.d.MapDatastore.GetSize(ctx, key)
+}
+
+func (t *featureTxn) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	t.d.calls = append(t.d.calls, "txn-query")
+	return t.d.MapDatastore.Query(ctx, q)
+}
+
+func (t *featureTxn) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	t.puts[key] = value
+	return nil
+}
+
+func (t *featureTxn) Delete(ctx context.Context, key datastore.Key) error {
+	return t.d.MapDatastore.Delete(ctx, key)
+}
+
+func (t *featureTxn) Commit(ctx context.Context) error {
+	t.d.calls = append(t.d.calls, "txn-commit")
+	for k, v := range t.puts {
+		if err := t.d.MapDatastore.Put(ctx, k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *featureTxn) Discard(ctx context.Context) {}
+
+func featureNames(features []datastore.Feature) []string {
+	var names []string
+	for _, f := range features {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestWrappersPreserveFeatures(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	all := featureNames(datastore.Features())
+	var optional []string
+	for _, name := range all {
+		if name != datastore.FeatureNameBatching {
+			optional = append(optional, name)
+		}
+	}
+
+	// Child feature sets: none, each feature alone, each feature with
+	// batching, and all features.
+	subsets := [][]string{nil, {datastore.FeatureNameBatching}}
+	for _, name := range optional {
+		subsets = append(subsets, []string{name}, []string{datastore.FeatureNameBatching, name})
+	}
+	subsets = append(subsets, all)
+
+	for name, w := range wrappers {
+		for _, subset := range subsets {
+			if w.batchingChild && !slices.Contains(subset, datastore.FeatureNameBatching) {
+				continue
+			}
+			t.Run(fmt.Sprintf("%s/%s", name, strings.Join(subset, "+")), func(t *testing.T) {
+				var expected []string
+				for _, f := range all {
+					if (slices.Contains(subset, f) || slices.Contains(w.own, f)) && !slices.Contains(w.lacks, f) {
+						expected = append(expected, f)
+					}
+				}
+
+				fds := newFeatureDatastore()
+				var features []datastore.Feature
+				for _, f := range subset {
+					feat, _ := datastore.FeatureByName(f)
+					features = append(features, feat)
+				}
+				d := scoped.Inherit(w.wrap(scoped.WithFeatures(fds, features)).(datastore.Shim), w.own...)
+				require.Equal(t, expected, featureNames(datastore.FeaturesForDatastore(d)))
+
+				testForwarding(t, d, fds, subset)
+			})
+		}
+	}
+}
+
+// testForwarding calls the optional features implemented by d and checks that
+// those in childFeatures reach fds.
+func testForwarding(t *testing.T, d datastore.Datastore, fds *featureDatastore, childFeatures []string) {
+	ctx := context.Background()
+	var expected []string
+	expect := func(feature string, calls ...string) {
+		if slices.Contains(childFeatures, feature) {
+			expected = append(expected, calls...)
+		}
+	}
+
+	if c, ok := d.(datastore.CheckedFeature); ok {
+		require.NoError(t, c.Check(ctx))
+		expect(datastore.FeatureNameChecked, "check")
+	}
+	if c, ok := d.(datastore.ScrubbedFeature); ok {
+		require.NoError(t, c.Scrub(ctx))
+		expect(datastore.FeatureNameScrubbed, "scrub")
+	}
+	if c, ok := d.(datastore.GCFeature); ok {
+		require.NoError(t, c.CollectGarbage(ctx))
+		expect(datastore.FeatureNameGC, "gc")
+	}
+	if p, ok := d.(datastore.PersistentFeature); ok {
+		du, err := p.DiskUsage(ctx)
+		require.NoError(t, err)
+		if slices.Contains(childFeatures, datastore.FeatureNamePersistent) {
+			require.Equal(t, uint64(42), du)
+			expected = append(expected, "disk-usage")
+		} else {
+			require.Zero(t, du)
+		}
+	}
+	if ttl, ok := d.(datastore.TTL); ok {
+		key := datastore.NewKey("/ttl")
+		require.NoError(t, ttl.PutWithTTL(ctx, key, []byte("v"), time.Hour))
+		require.NoError(t, ttl.SetTTL(ctx, key, 2*time.Hour))
+		exp, err := ttl.GetExpiration(ctx, key)
+		require.NoError(t, err)
+		require.Equal(t, time.Unix(0, 0).Add(2*time.Hour), exp)
+		expect(datastore.FeatureNameTTL, "put-with-ttl", "set-ttl", "get-expiration")
+	}
+	if tds, ok := d.(datastore.TxnFeature); ok {
+		key := datastore.NewKey("/txn")
+		txn, err := tds.NewTransaction(ctx, false)
+		require.NoError(t, err)
+		require.NoError(t, txn.Put(ctx, key, []byte("v")))
+		require.NoError(t, txn.Commit(ctx))
+		v, err := d.Get(ctx, key)
+		require.NoError(t, err)
+		require.Equal(t, "v", string(v))
+
+		txn, err = tds.NewTransaction(ctx, true)
+		require.NoError(t, err)
+		res, err := txn.Query(ctx, dsq.Query{KeysOnly: true})
+		require.NoError(t, err)
+		entries, err := res.Rest()
+		require.NoError(t, err)
+		require.Contains(t, entries, dsq.Entry{Key: "/txn", Size: 1})
+		txn.Discard(ctx)
+		expect(datastore.FeatureNameTransaction, "txn", "txn-commit", "txn", "txn-query")
+	}
+
+	// Only require each call to arrive in order, as wrappers may make more.
+	calls := slices.Compact(slices.Clone(fds.calls))
+	for _, call := range expected {
+		i := slices.Index(calls, call)
+		require.GreaterOrEqual(t, i, 0, "%s was not forwarded (calls: %v)", call, fds.calls)
+		calls = calls[i+1:]
+	}
+}